@@ -6,6 +6,9 @@ import (
 	"log/slog"
 	"os"
 
+	// Embedded time zone database used by scheduled_task time zones.
+	_ "time/tzdata"
+
 	"github.com/spf13/viper"
 	_ "github.com/spf13/viper/remote"
 
@@ -33,6 +36,8 @@ func setDefaults(cfg *viper.Viper) {
 	cfg.SetDefault("boltdb_timeout", 5)
 	cfg.SetDefault("nats_url", "nats://localhost:4222")
 	cfg.SetDefault("nats_bucket", "tarmac")
+	cfg.SetDefault("sql_connect_retries", 5)
+	cfg.SetDefault("sql_connect_retry_interval", 2)
 	cfg.SetDefault("grpc_socket_path", "/grpc.sock")
 	cfg.SetDefault("run_mode", "daemon")
 	cfg.SetDefault("text_log_format", false)
@@ -60,6 +65,25 @@ func handleConfigReadResult(log *slog.Logger, err error) error {
 	return fmt.Errorf("error when fetching configuration: %w", err)
 }
 
+// applyArgs applies command line arguments to the configuration. The migrate command runs Tarmac with the migrate
+// run mode, applying SQL DB migrations and exiting. The reencrypt command runs Tarmac with the reencrypt run mode,
+// re-encrypting KV store values with the current encryption key and exiting.
+func applyArgs(cfg *viper.Viper, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+
+	switch args[0] {
+	case "migrate":
+		cfg.Set("run_mode", "migrate")
+	case "reencrypt":
+		cfg.Set("run_mode", "reencrypt")
+	default:
+		return fmt.Errorf("unknown command %s", args[0])
+	}
+	return nil
+}
+
 func main() {
 	// Initiate a simple logger
 	log := newLogger()
@@ -100,6 +124,13 @@ func main() {
 		}
 	}
 
+	// Apply command line arguments
+	err = applyArgs(cfg, os.Args[1:])
+	if err != nil {
+		log.Error("Error when parsing command line arguments: "+err.Error(), "error", err)
+		os.Exit(1)
+	}
+
 	// Run application
 	srv := app.New(cfg)
 	defer srv.Stop()
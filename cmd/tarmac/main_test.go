@@ -33,6 +33,8 @@ func TestSetDefaults(t *testing.T) {
 		{key: "boltdb_timeout", want: 5},
 		{key: "nats_url", want: "nats://localhost:4222"},
 		{key: "nats_bucket", want: "tarmac"},
+		{key: "sql_connect_retries", want: 5},
+		{key: "sql_connect_retry_interval", want: 2},
 		{key: "grpc_socket_path", want: "/grpc.sock"},
 		{key: "run_mode", want: "daemon"},
 		{key: "text_log_format", want: false},
@@ -84,3 +86,52 @@ func TestHandleConfigReadResult(t *testing.T) {
 		}
 	})
 }
+
+func TestApplyArgs(t *testing.T) {
+	t.Run("no args", func(t *testing.T) {
+		cfg := viper.New()
+		setDefaults(cfg)
+
+		if err := applyArgs(cfg, nil); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if got := cfg.GetString("run_mode"); got != "daemon" {
+			t.Fatalf("unexpected run_mode: got %s want daemon", got)
+		}
+	})
+
+	t.Run("migrate", func(t *testing.T) {
+		cfg := viper.New()
+		setDefaults(cfg)
+
+		if err := applyArgs(cfg, []string{"migrate"}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if got := cfg.GetString("run_mode"); got != "migrate" {
+			t.Fatalf("unexpected run_mode: got %s want migrate", got)
+		}
+	})
+
+	t.Run("reencrypt", func(t *testing.T) {
+		cfg := viper.New()
+		setDefaults(cfg)
+
+		if err := applyArgs(cfg, []string{"reencrypt"}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if got := cfg.GetString("run_mode"); got != "reencrypt" {
+			t.Fatalf("unexpected run_mode: got %s want reencrypt", got)
+		}
+	})
+
+	t.Run("unknown command", func(t *testing.T) {
+		cfg := viper.New()
+
+		if err := applyArgs(cfg, []string{"explode"}); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
@@ -11,4 +11,4 @@ then
 fi
 
 ## Run the Application
-exec /app/tarmac/tarmac
+exec /app/tarmac/tarmac "$@"
@@ -13,35 +13,27 @@ import (
 	pprof "net/http/pprof"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	// MySQL Database Driver.
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/julienschmidt/httprouter"
-
-	// PostgreSQL Database Driver.
-	_ "github.com/lib/pq"
 	"github.com/madflojo/tasks"
+	natsgo "github.com/nats-io/nats.go"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
 	"github.com/tarmac-project/hord"
-	"github.com/tarmac-project/hord/drivers/bbolt"
-	"github.com/tarmac-project/hord/drivers/cassandra"
-	"github.com/tarmac-project/hord/drivers/hashmap"
-	"github.com/tarmac-project/hord/drivers/nats"
-	"github.com/tarmac-project/hord/drivers/redis"
-	"github.com/tarmac-project/wapc-toolkit/callbacks"
-	"github.com/tarmac-project/wapc-toolkit/engine"
 
+	"github.com/tarmac-project/tarmac/pkg/callbacks"
 	"github.com/tarmac-project/tarmac/pkg/callbacks/httpclient"
 	"github.com/tarmac-project/tarmac/pkg/callbacks/kvstore"
 	"github.com/tarmac-project/tarmac/pkg/callbacks/logging"
 	"github.com/tarmac-project/tarmac/pkg/callbacks/metrics"
 	sqlstore "github.com/tarmac-project/tarmac/pkg/callbacks/sql"
-	"github.com/tarmac-project/tarmac/pkg/config"
 	"github.com/tarmac-project/tarmac/pkg/telemetry"
 	"github.com/tarmac-project/tarmac/pkg/tlsconfig"
+	"github.com/tarmac-project/tarmac/pkg/wasm"
 )
 
 // Common errors returned by this app.
@@ -74,6 +66,15 @@ const (
 	// RouteTypeFunction is the route type for function to function calls.
 	RouteTypeFunction = "function"
 
+	// RouteTypeNATS is the route type for NATS subject subscriptions.
+	RouteTypeNATS = "nats"
+
+	// HTTPEnvelopeProto is the envelope format for protobuf encoded HTTP requests and responses.
+	HTTPEnvelopeProto = "proto"
+
+	// HTTPEnvelopeJSON is the envelope format for JSON encoded HTTP requests and responses.
+	HTTPEnvelopeJSON = "json"
+
 	// LevelTrace is a custom log level for trace logging.
 	LevelTrace = slog.LevelDebug - 4
 
@@ -89,13 +90,17 @@ type Server struct {
 	// db is the global reference for the SQL DB.
 	db *sql.DB
 
+	// dbs are the named SQL DBs configured with sql_databases.
+	dbs map[string]*sql.DB
+
 	// engine is the global WASM Engine.
-	engine *engine.Server
+	engine *wasm.Server
 
-	// funcCfg is used to store and access multi-function service configurations.
-	funcCfg *config.Config
+	// callbacks is the WASM Callback Router.
+	callbacks *callbacks.Router
 
-	// httpRouter is used to store and access the HTTP Request Router.
+	// httpRouter is used to store and access the HTTP Request Router. Requests not matching system routes are passed
+	// to the router of the active services.
 	httpRouter *httprouter.Router
 
 	// httpServer is the primary HTTP server.
@@ -104,6 +109,12 @@ type Server struct {
 	// kv is the global reference for the K/V Store.
 	kv hord.Database
 
+	// kvs are the named K/V Stores configured with kvstores.
+	kvs map[string]hord.Database
+
+	// nc is the NATS connection used by nats routes.
+	nc *natsgo.Conn
+
 	// log is used across the app package for logging.
 	log *slog.Logger
 
@@ -116,9 +127,15 @@ type Server struct {
 	// runCtx is a global context used to control shutdown of the application.
 	runCtx context.Context
 
+	// reloadMu serializes service reloads.
+	reloadMu sync.Mutex
+
 	// scheduler is an internal task scheduler for recurring tasks.
 	scheduler *tasks.Scheduler
 
+	// services are the active functions and routes of the service configuration.
+	services atomic.Pointer[services]
+
 	// stats is used across the app package to manage and access system metrics.
 	stats *telemetry.Telemetry
 }
@@ -263,122 +280,91 @@ func (srv *Server) Run() error {
 		}
 	}
 
+	// Setup SQL DB Connections before KV Stores, as KV Stores may be stored within them
+	if srv.cfg.GetBool("enable_sql") {
+		srv.log.Info("Connecting to SQL DB")
+		srv.db, err = openSQL(srv.cfg)
+		if err != nil {
+			return fmt.Errorf("could not establish sql db connection - %w", err)
+		}
+
+		err = srv.pingSQL("", srv.db, srv.cfg)
+		if err != nil {
+			return fmt.Errorf("could not establish sql db connection - %w", err)
+		}
+	}
+	if srv.db == nil {
+		srv.log.Info("SQL DB not configured, skipping")
+	}
+
+	// Setup named SQL DBs
+	srv.dbs, err = srv.openSQLDatabases()
+	if err != nil {
+		return err
+	}
+
 	// Setup the KV Connection
 	if srv.cfg.GetBool("enable_kvstore") {
 		srv.log.Info("Connecting to KV Store")
-		switch srv.cfg.GetString("kvstore_type") {
-		case "in-memory":
-			srv.kv, err = hashmap.Dial(hashmap.Config{})
-			if err != nil {
-				return fmt.Errorf("could not create internal kvstore - %w", err)
-			}
-		case "internal", "boltdb":
-			// Check if file exists, if not create one
-			fh, err := os.OpenFile(
-				srv.cfg.GetString("boltdb_filename"),
-				os.O_RDWR|os.O_CREATE|os.O_EXCL,
-				os.FileMode(srv.cfg.GetInt("boltdb_permissions")),
-			)
-			if err != nil && !os.IsExist(err) {
-				return fmt.Errorf("could not create boltdb file - %w", err)
-			}
-			fh.Close()
-
-			// Open datastore
-			srv.kv, err = bbolt.Dial(bbolt.Config{
-				Filename:    srv.cfg.GetString("boltdb_filename"),
-				Bucketname:  srv.cfg.GetString("boltdb_bucket"),
-				Permissions: os.FileMode(srv.cfg.GetInt("boltdb_permissions")),
-				Timeout:     time.Duration(srv.cfg.GetInt("boltdb_timeout")) * time.Second,
-			})
-			if err != nil {
-				return fmt.Errorf("could not create internal kvstore - %w", err)
-			}
-		case "redis":
-			srv.kv, err = redis.Dial(redis.Config{
-				Server:   srv.cfg.GetString("redis_server"),
-				Password: srv.cfg.GetString("redis_password"),
-				SentinelConfig: redis.SentinelConfig{
-					Servers: srv.cfg.GetStringSlice("redis_sentinel_servers"),
-					Master:  srv.cfg.GetString("redis_sentinel_master"),
-				},
-				ConnectTimeout: time.Duration(srv.cfg.GetInt("redis_connect_timeout")) * time.Second,
-				Database:       srv.cfg.GetInt("redis_database"),
-				SkipTLSVerify:  srv.cfg.GetBool("redis_hostname_verify"),
-				KeepAlive:      time.Duration(srv.cfg.GetInt("redis_keepalive")) * time.Second,
-				MaxActive:      srv.cfg.GetInt("redis_max_active"),
-				ReadTimeout:    time.Duration(srv.cfg.GetInt("redis_read_timeout")) * time.Second,
-				WriteTimeout:   time.Duration(srv.cfg.GetInt("redis_write_timeout")) * time.Second,
-			})
-			if err != nil {
-				return fmt.Errorf("could not establish kvstore connection - %w", err)
-			}
-		case "cassandra":
-			srv.kv, err = cassandra.Dial(cassandra.Config{
-				Hosts:                      srv.cfg.GetStringSlice("cassandra_hosts"),
-				Port:                       srv.cfg.GetInt("cassandra_port"),
-				Keyspace:                   srv.cfg.GetString("cassandra_keyspace"),
-				Consistency:                srv.cfg.GetString("cassandra_consistency"),
-				ReplicationStrategy:        srv.cfg.GetString("cassandra_repl_strategy"),
-				Replicas:                   srv.cfg.GetInt("cassandra_replicas"),
-				User:                       srv.cfg.GetString("cassandra_user"),
-				Password:                   srv.cfg.GetString("cassandra_password"),
-				EnableHostnameVerification: srv.cfg.GetBool("cassandra_hostname_verify"),
-			})
-			if err != nil {
-				return fmt.Errorf("could not establish kvstore connection - %w", err)
-			}
-		case "nats":
-			srv.kv, err = nats.Dial(nats.Config{
-				URL:           srv.cfg.GetString("nats_url"),
-				Bucket:        srv.cfg.GetString("nats_bucket"),
-				Servers:       srv.cfg.GetStringSlice("nats_servers"),
-				SkipTLSVerify: srv.cfg.GetBool("nats_skip_tls_verify"),
-			})
-			if err != nil {
-				return fmt.Errorf("could not establish kvstore connection - %w", err)
-			}
-		default:
-			return fmt.Errorf("unknown kvstore specified - %s", srv.cfg.GetString("kvstore_type"))
+		srv.kv, err = srv.openKV("", srv.cfg)
+		if err != nil {
+			return err
 		}
 
 		// Clean up KV Store connections on shutdown
 		defer srv.kv.Close()
-
-		// Initialize the KV
-		err = srv.kv.Setup()
-		if err != nil {
-			return fmt.Errorf("could not setup kvstore - %w", err)
-		}
 	}
 
 	if srv.kv == nil {
 		srv.log.Info("KV Store not configured, skipping")
 	}
 
-	if srv.cfg.GetBool("enable_sql") {
-		srv.log.Info("Connecting to SQL DB")
-		switch srv.cfg.GetString("sql_type") {
-		case "mysql":
-			srv.db, err = sql.Open("mysql", srv.cfg.GetString("sql_dsn"))
-			if err != nil {
-				return fmt.Errorf("could not establish sql db connection - %w", err)
-			}
-		case "postgres":
-			srv.db, err = sql.Open("postgres", srv.cfg.GetString("sql_dsn"))
-			if err != nil {
-				return fmt.Errorf("could not establish sql db connection - %w", err)
-			}
-		default:
-			return fmt.Errorf("unknown sql store specified - %s", srv.cfg.GetString("sql_type"))
+	// Setup named KV Stores
+	srv.kvs, err = srv.openKVStores()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, kv := range srv.kvs {
+			kv.Close()
 		}
+	}()
+
+	// Export SQL DB connection pool metrics
+	defer srv.registerSQLStats()()
+
+	// Apply SQL DB migrations before any functions are executed
+	migrated, err := srv.migrateSQL()
+	if err != nil {
+		return err
 	}
-	if srv.db == nil {
-		srv.log.Info("SQL DB not configured, skipping")
+
+	// If run-mode is migrate, exit once migrations are applied
+	if srv.cfg.GetString("run_mode") == "migrate" {
+		if migrated == 0 {
+			srv.log.Info("Run mode is migrate, but no sql_migrations_dir is configured, nothing to migrate")
+			return nil
+		}
+		srv.log.Info("Run mode is migrate, exiting after SQL DB migrations")
+		return ErrShutdown
+	}
+
+	// If run-mode is reencrypt, exit once KV store values are re-encrypted
+	if srv.cfg.GetString("run_mode") == "reencrypt" {
+		reencrypted, err := srv.reencryptKV()
+		if err != nil {
+			return err
+		}
+		if reencrypted == 0 {
+			return errors.New("run mode is reencrypt, but no kvstore has encryption enabled")
+		}
+		srv.log.Info("Run mode is reencrypt, exiting after KV Store values are re-encrypted")
+		return ErrShutdown
 	}
 
 	// Setup the HTTP Server
 	srv.httpRouter = httprouter.New()
+	srv.httpRouter.NotFound = http.HandlerFunc(srv.serviceHandler)
 	srv.httpServer = &http.Server{
 		Addr:    srv.cfg.GetString("listen_addr"),
 		Handler: srv.httpRouter,
@@ -434,23 +420,28 @@ func (srv *Server) Run() error {
 	srv.httpRouter.GET("/ready", srv.middleware(srv.Ready))
 
 	// Create WASM Callback Router
-	router, err := callbacks.New(callbacks.RouterConfig{
-		PreFunc: func(rq callbacks.CallbackRequest) ([]byte, error) {
+	router := callbacks.New(callbacks.Config{
+		Authorize: func(ctx context.Context, capability, op string) bool {
+			return srv.permitCallback(wasm.ModuleName(ctx), capability, op)
+		},
+		PreFunc: func(capability, op string, data []byte) ([]byte, error) {
+			now := time.Now()
+
 			// Debug logging of callback
 			srv.log.Debug("CallbackRouter called",
-				"namespace", rq.Namespace,
-				"capability", rq.Capability,
-				"operation", rq.Operation,
-				"callback_start_time", rq.StartTime.String(),
+				"namespace", DefaultNamespace,
+				"capability", capability,
+				"operation", op,
+				"callback_start_time", now.String(),
 			)
 
 			// Trace logging of callback
 			srv.log.Log(context.Background(), LevelTrace, "CallbackRouter called with payload",
-				"namespace", rq.Namespace,
-				"capability", rq.Capability,
-				"operation", rq.Operation,
-				"callback_start_time", rq.StartTime.String(),
-				"payload", string(rq.Input),
+				"namespace", DefaultNamespace,
+				"capability", capability,
+				"operation", op,
+				"callback_start_time", now.String(),
+				"payload", string(data),
 			)
 			return []byte(""), nil
 		},
@@ -463,8 +454,8 @@ func (srv *Server) Run() error {
 			// Debug logging of callback results
 			if r.Err != nil {
 				srv.log.Debug("Callback returned result with error: "+r.Err.Error(),
-					"namespace", r.Namespace,
-					"capability", r.Capability,
+					"namespace", DefaultNamespace,
+					"capability", r.Namespace,
 					"operation", r.Operation,
 					"error", r.Err,
 					"duration", duration,
@@ -472,8 +463,8 @@ func (srv *Server) Run() error {
 				)
 			} else {
 				srv.log.Debug("Callback returned result successfully",
-					"namespace", r.Namespace,
-					"capability", r.Capability,
+					"namespace", DefaultNamespace,
+					"capability", r.Namespace,
 					"operation", r.Operation,
 					"duration", duration,
 					"duration_ms", duration,
@@ -487,9 +478,9 @@ func (srv *Server) Run() error {
 					LevelTrace,
 					"Callback returned result with error and output: "+r.Err.Error(),
 					"namespace",
-					r.Namespace,
+					DefaultNamespace,
 					"capability",
-					r.Capability,
+					r.Namespace,
 					"operation",
 					r.Operation,
 					"error",
@@ -505,8 +496,8 @@ func (srv *Server) Run() error {
 				)
 			} else {
 				srv.log.Log(context.Background(), LevelTrace, "Callback returned result with output",
-					"namespace", r.Namespace,
-					"capability", r.Capability,
+					"namespace", DefaultNamespace,
+					"capability", r.Namespace,
 					"operation", r.Operation,
 					"input", string(r.Input),
 					"duration", duration,
@@ -518,8 +509,8 @@ func (srv *Server) Run() error {
 			// Log Callback failures as warnings
 			if r.Err != nil {
 				srv.log.Warn("Callback call resulted in error: "+r.Err.Error(),
-					"namespace", r.Namespace,
-					"capability", r.Capability,
+					"namespace", DefaultNamespace,
+					"capability", r.Namespace,
 					"operation", r.Operation,
 					"duration", duration,
 					"duration_ms", duration,
@@ -528,12 +519,11 @@ func (srv *Server) Run() error {
 			}
 		},
 	})
-	if err != nil {
-		return fmt.Errorf("unable to initialize callback router - %w", err)
-	}
+
+	srv.callbacks = router
 
 	// Start WASM Engine
-	srv.engine, err = engine.New(engine.ServerConfig{
+	srv.engine, err = wasm.NewServer(wasm.Config{
 		Callback: router.Callback,
 	})
 	if err != nil {
@@ -541,81 +531,48 @@ func (srv *Server) Run() error {
 	}
 
 	// Setup SQL Callbacks
-	if srv.cfg.GetBool("enable_sql") {
-		cbSQL, err := sqlstore.New(sqlstore.Config{DB: srv.db})
+	if srv.db != nil || len(srv.dbs) > 0 {
+		cbSQL, err := sqlstore.New(sqlstore.Config{
+			DB:         srv.db,
+			Databases:  srv.dbs,
+			DataSource: srv.sqlDataSource,
+			Policy:     srv.sqlPolicy,
+		})
 		if err != nil {
 			return fmt.Errorf("unable to initialize callback sqlstore for WASM functions - %w", err)
 		}
 
 		// Register SQLStore Callbacks
-		err = router.RegisterCallback(callbacks.CallbackConfig{
-			Namespace:  DefaultNamespace,
-			Capability: "sql",
-			Operation:  "query",
-			Func:       cbSQL.Query,
-		})
-		if err != nil {
-			return fmt.Errorf("unable to register callback for sql query - %w", err)
-		}
-
-		err = router.RegisterCallback(callbacks.CallbackConfig{
-			Namespace:  DefaultNamespace,
-			Capability: "sql",
-			Operation:  "exec",
-			Func:       cbSQL.Exec,
-		})
-		if err != nil {
-			return fmt.Errorf("unable to register callback for sql exec - %w", err)
-		}
+		router.RegisterCallbackContext("sql", "query", cbSQL.QueryContext)
+		router.RegisterCallbackContext("sql", "exec", cbSQL.ExecContext)
+		router.RegisterCallbackContext("sql", "begin", cbSQL.BeginContext)
+		router.RegisterCallbackContext("sql", "commit", cbSQL.CommitContext)
+		router.RegisterCallbackContext("sql", "rollback", cbSQL.RollbackContext)
 	}
 
 	// Setup KVStore Callbacks
-	if srv.cfg.GetBool("enable_kvstore") {
-		cbKVStore, err := kvstore.New(kvstore.Config{KV: srv.kv})
+	if srv.kv != nil || len(srv.kvs) > 0 {
+		cbKVStore, err := kvstore.New(kvstore.Config{
+			KV:         srv.kv,
+			Stores:     srv.kvs,
+			DataSource: srv.kvDataSource,
+			Namespace:  srv.kvNamespace,
+		})
 		if err != nil {
 			return fmt.Errorf("unable to initialize callback kvstore for WASM functions - %w", err)
 		}
 
 		// Register KVStore Callbacks
-		err = router.RegisterCallback(callbacks.CallbackConfig{
-			Namespace:  DefaultNamespace,
-			Capability: "kvstore",
-			Operation:  "get",
-			Func:       cbKVStore.Get,
-		})
-		if err != nil {
-			return fmt.Errorf("unable to register callback for kvstore get - %w", err)
-		}
-
-		err = router.RegisterCallback(callbacks.CallbackConfig{
-			Namespace:  DefaultNamespace,
-			Capability: "kvstore",
-			Operation:  "set",
-			Func:       cbKVStore.Set,
-		})
-		if err != nil {
-			return fmt.Errorf("unable to register callback for kvstore set - %w", err)
-		}
-
-		err = router.RegisterCallback(callbacks.CallbackConfig{
-			Namespace:  DefaultNamespace,
-			Capability: "kvstore",
-			Operation:  "delete",
-			Func:       cbKVStore.Delete,
-		})
-		if err != nil {
-			return fmt.Errorf("unable to register callback for kvstore delete - %w", err)
-		}
-
-		err = router.RegisterCallback(callbacks.CallbackConfig{
-			Namespace:  DefaultNamespace,
-			Capability: "kvstore",
-			Operation:  "keys",
-			Func:       cbKVStore.Keys,
-		})
-		if err != nil {
-			return fmt.Errorf("unable to register callback for kvstore keys - %w", err)
-		}
+		router.RegisterCallbackContext("kvstore", "get", cbKVStore.GetContext)
+		router.RegisterCallbackContext("kvstore", "set", cbKVStore.SetContext)
+		router.RegisterCallbackContext("kvstore", "delete", cbKVStore.DeleteContext)
+		router.RegisterCallbackContext("kvstore", "keys", cbKVStore.KeysContext)
+		router.RegisterCallbackContext("kvstore", "cas", cbKVStore.CompareAndSwapContext)
+		router.RegisterCallbackContext("kvstore", "incr", cbKVStore.IncrContext)
+		router.RegisterCallbackContext("kvstore", "setnx", cbKVStore.SetNXContext)
+		router.RegisterCallbackContext("kvstore", "mget", cbKVStore.MGetContext)
+		router.RegisterCallbackContext("kvstore", "mset", cbKVStore.MSetContext)
+		router.RegisterCallbackContext("kvstore", "mdelete", cbKVStore.MDeleteContext)
 	}
 
 	// Setup HTTP Callbacks
@@ -627,15 +584,7 @@ func (srv *Server) Run() error {
 	}
 
 	// Register HTTPClient Functions
-	err = router.RegisterCallback(callbacks.CallbackConfig{
-		Namespace:  DefaultNamespace,
-		Capability: "httpclient",
-		Operation:  "call",
-		Func:       cbHTTPClient.Call,
-	})
-	if err != nil {
-		return fmt.Errorf("unable to register callback for httpclient call - %w", err)
-	}
+	router.RegisterCallbackContext("httpclient", "call", cbHTTPClient.CallContext)
 
 	// Setup Logger Callbacks
 	cbLogger, err := logging.New(logging.Config{
@@ -647,55 +596,11 @@ func (srv *Server) Run() error {
 	}
 
 	// Register Logger Functions
-	err = router.RegisterCallback(callbacks.CallbackConfig{
-		Namespace:  DefaultNamespace,
-		Capability: "logger",
-		Operation:  "info",
-		Func:       cbLogger.Info,
-	})
-	if err != nil {
-		return fmt.Errorf("unable to register callback for logger info - %w", err)
-	}
-
-	err = router.RegisterCallback(callbacks.CallbackConfig{
-		Namespace:  DefaultNamespace,
-		Capability: "logger",
-		Operation:  "error",
-		Func:       cbLogger.Error,
-	})
-	if err != nil {
-		return fmt.Errorf("unable to register callback for logger error - %w", err)
-	}
-
-	err = router.RegisterCallback(callbacks.CallbackConfig{
-		Namespace:  DefaultNamespace,
-		Capability: "logger",
-		Operation:  "warn",
-		Func:       cbLogger.Warn,
-	})
-	if err != nil {
-		return fmt.Errorf("unable to register callback for logger warn - %w", err)
-	}
-
-	err = router.RegisterCallback(callbacks.CallbackConfig{
-		Namespace:  DefaultNamespace,
-		Capability: "logger",
-		Operation:  "debug",
-		Func:       cbLogger.Debug,
-	})
-	if err != nil {
-		return fmt.Errorf("unable to register callback for logger debug - %w", err)
-	}
-
-	err = router.RegisterCallback(callbacks.CallbackConfig{
-		Namespace:  DefaultNamespace,
-		Capability: "logger",
-		Operation:  "trace",
-		Func:       cbLogger.Trace,
-	})
-	if err != nil {
-		return fmt.Errorf("unable to register callback for logger trace - %w", err)
-	}
+	router.RegisterCallback("logger", "info", cbLogger.Info)
+	router.RegisterCallback("logger", "error", cbLogger.Error)
+	router.RegisterCallback("logger", "warn", cbLogger.Warn)
+	router.RegisterCallback("logger", "debug", cbLogger.Debug)
+	router.RegisterCallback("logger", "trace", cbLogger.Trace)
 
 	// Setup Metrics Callbacks
 	cbMetrics, err := metrics.New(metrics.Config{})
@@ -704,226 +609,32 @@ func (srv *Server) Run() error {
 	}
 
 	// Register Metrics Callbacks
-	err = router.RegisterCallback(callbacks.CallbackConfig{
-		Namespace:  DefaultNamespace,
-		Capability: "metrics",
-		Operation:  "counter",
-		Func:       cbMetrics.Counter,
-	})
-	if err != nil {
-		return fmt.Errorf("unable to register callback for metrics counter - %w", err)
-	}
+	router.RegisterCallback("metrics", "counter", cbMetrics.Counter)
+	router.RegisterCallback("metrics", "gauge", cbMetrics.Gauge)
+	router.RegisterCallback("metrics", "histogram", cbMetrics.Histogram)
 
-	err = router.RegisterCallback(callbacks.CallbackConfig{
-		Namespace:  DefaultNamespace,
-		Capability: "metrics",
-		Operation:  "gauge",
-		Func:       cbMetrics.Gauge,
-	})
+	// Load Functions and Routes from Config
+	svcs, err := srv.loadServices()
 	if err != nil {
-		return fmt.Errorf("unable to register callback for metrics gauge - %w", err)
+		return err
 	}
+	srv.activate(svcs)
 
-	err = router.RegisterCallback(callbacks.CallbackConfig{
-		Namespace:  DefaultNamespace,
-		Capability: "metrics",
-		Operation:  "histogram",
-		Func:       cbMetrics.Histogram,
-	})
+	// Execute init functions
+	err = srv.runInit(svcs)
 	if err != nil {
-		return fmt.Errorf("unable to register callback for metrics histogram - %w", err)
+		return err
 	}
 
-	// Look for Functions Config
-	srv.funcCfg, err = config.Parse(srv.cfg.GetString("wasm_function_config"))
-	if err != nil {
-		srv.log.Info("Could not load wasm_function_config starting with default function path",
-			"config_path", srv.cfg.GetString("wasm_function_config"),
-			"error", err)
-
-		// Load WASM Function using default path
-		err = srv.engine.LoadModule(engine.ModuleConfig{
-			Name:     "default",
-			Filepath: srv.cfg.GetString("wasm_function"),
-			PoolSize: srv.cfg.GetInt("wasm_pool_size"),
-		})
-		if err != nil {
-			return fmt.Errorf(
-				"could not load default function path for wasm_function (%s) - %w",
-				srv.cfg.GetString("wasm_function"),
-				err,
-			)
-		}
-
-		// Register WASM Handler with default path
-		srv.httpRouter.GET("/", srv.middleware(srv.WASMHandler))
-		srv.httpRouter.POST("/", srv.middleware(srv.WASMHandler))
-		srv.httpRouter.PUT("/", srv.middleware(srv.WASMHandler))
-		srv.httpRouter.DELETE("/", srv.middleware(srv.WASMHandler))
-		srv.httpRouter.HEAD("/", srv.middleware(srv.WASMHandler))
-
-		// Measure Routes
-		srv.stats.Routes.WithLabelValues("default", "http").Inc()
-	}
-
-	// Load Functions from Config
-	if err == nil {
-		srv.log.Info(
-			"Loading Services from wasm_function_config",
-			"config_path",
-			srv.cfg.GetString("wasm_function_config"),
-		)
-
-		routesCounter := map[string]int{
-			RouteTypeInit:          0,
-			RouteTypeHTTP:          0,
-			RouteTypeScheduledTask: 0,
-			RouteTypeFunction:      0,
-		}
-		for svcName, svcCfg := range srv.funcCfg.Services {
-			// Load WASM Functions
-			srv.log.Info("Loading Functions from Service", "service", svcName)
-			for fName, fCfg := range svcCfg.Functions {
-				err := srv.engine.LoadModule(engine.ModuleConfig{
-					Name:     fName,
-					Filepath: fCfg.Filepath,
-					PoolSize: fCfg.PoolSize,
-				})
-				if err != nil {
-					return fmt.Errorf("could not load function %s from path %s - %w", fName, fCfg.Filepath, err)
-				}
-				srv.log.Info("Loaded Function for Service",
-					"function", fName,
-					"service", svcName,
-					"filepath", fCfg.Filepath)
-			}
-
-			// Register Routes
-			srv.log.Info("Registering Routes from Service",
-				"service", svcName)
-			funcRoutes := make(map[string]string)
-			initRoutes := []config.Route{}
-			for _, r := range svcCfg.Routes {
-				switch r.Type {
-				case RouteTypeInit:
-					// Copy init functions for later execution
-					initRoutes = append(initRoutes, r)
-					routesCounter[RouteTypeInit]++
-					srv.stats.Routes.WithLabelValues(svcName, r.Type).Inc()
-
-				case RouteTypeHTTP:
-					// Register HTTP based functions with the HTTP router
-					for _, m := range r.Methods {
-						key := fmt.Sprintf("%s:%s:%s", r.Type, m, r.Path)
-						srv.log.Info("Registering Route for function",
-							"function", r.Function,
-							"method", m,
-							"path", r.Path,
-							"function_type", r.Type,
-							"service", svcName,
-							"route_key", key)
-						funcRoutes[key] = r.Function
-						srv.httpRouter.Handle(m, r.Path, srv.middleware(srv.WASMHandler))
-						routesCounter[RouteTypeHTTP]++
-						srv.stats.Routes.WithLabelValues(svcName, r.Type).Inc()
-					}
-
-				case RouteTypeScheduledTask:
-					// Schedule tasks for scheduled functions
-					fname := r.Function
-					srv.log.Info("Scheduling custom task for function",
-						"function", r.Function,
-						"interval", r.Frequency)
-					id, err := srv.scheduler.Add(&tasks.Task{
-						Interval: time.Duration(r.Frequency) * time.Second,
-						TaskFunc: func() error {
-							now := time.Now()
-							srv.log.Log(context.Background(), LevelTrace, "Executing Scheduled Task", "function", fname)
-							_, err := srv.runWASM(fname, "handler", []byte(""))
-							if err != nil {
-								srv.stats.Tasks.WithLabelValues(fname).Observe(float64(time.Since(now).Milliseconds()))
-								return err
-							}
-							srv.stats.Tasks.WithLabelValues(fname).Observe(float64(time.Since(now).Milliseconds()))
-							return nil
-						},
-					})
-					if err != nil {
-						srv.log.Error(
-							"Error scheduling scheduled task: "+err.Error(),
-							"function",
-							r.Function,
-							"error",
-							err,
-						)
-					}
-					// Clean up Task on Shutdown
-					defer srv.scheduler.Del(id)
-					routesCounter[RouteTypeScheduledTask]++
-					srv.stats.Routes.WithLabelValues(svcName, r.Type).Inc()
-
-				case RouteTypeFunction:
-					// Setup callbacks for function to function calls
-					srv.log.Info("Registering Function to Function callback", "function", r.Function)
-					fname := r.Function
-					f := func(b []byte) ([]byte, error) {
-						srv.log.Info("Executing Function to Function callback", "function", fname)
-						return srv.runWASM(fname, "handler", b)
-					}
-					err := router.RegisterCallback(callbacks.CallbackConfig{
-						Namespace:  DefaultNamespace,
-						Capability: "function",
-						Operation:  fname,
-						Func:       f,
-					})
-					if err != nil {
-						return fmt.Errorf("error registering callback for function %s - %w", fname, err)
-					}
-					routesCounter[RouteTypeFunction]++
-					srv.stats.Routes.WithLabelValues(svcName, r.Type).Inc()
-				}
-			}
-
-			// Execute init functions
-			for _, r := range initRoutes {
-				srv.log.Info("Executing Init Function", "function", r.Function)
-				var success, retries int
-				delay := r.Frequency
-				for success == 0 && retries <= r.Retries {
-					// Execute the function
-					_, err := srv.runWASM(r.Function, "handler", []byte(""))
-					if err != nil {
-						srv.log.Error("Error executing Init Function: "+err.Error(),
-							"function", r.Function,
-							"error", err)
-						retries++
-						// Wait exponentially longer between retries
-						<-time.After(time.Duration(delay) * time.Second)
-						delay *= delay
-						continue
-					}
-					success = 1
-				}
-				if success == 0 {
-					return fmt.Errorf("init function %s exceeded retries", r.Function)
-				}
-			}
-		}
-
-		// Log information about loaded functions and routes
-		srv.log.Info("Loaded Functions and Routes",
-			"init", routesCounter[RouteTypeInit],
-			"http", routesCounter[RouteTypeHTTP],
-			"scheduled_task", routesCounter[RouteTypeScheduledTask],
-			"function", routesCounter[RouteTypeFunction])
-
-		// If run-mode is jobs, exit cleanly
-		if srv.cfg.GetString("run_mode") == "job" {
-			srv.log.Info("Run mode is job, exiting after init function execution")
-			return ErrShutdown
-		}
+	// If run-mode is jobs, exit cleanly
+	if len(svcs.cfg.Services) > 0 && srv.cfg.GetString("run_mode") == "job" {
+		srv.log.Info("Run mode is job, exiting after init function execution")
+		return ErrShutdown
 	}
 
+	// Reload Functions and Routes on SIGHUP or file changes
+	go srv.watchReload()
+
 	// Register Metrics Handler
 	srv.httpRouter.GET("/metrics", srv.handlerWrapper(promhttp.Handler()))
 
@@ -970,9 +681,24 @@ func (srv *Server) Run() error {
 // Stop is used to gracefully shutdown the server.
 func (srv *Server) Stop() {
 	srv.stats.Close()
-	err := srv.httpServer.Shutdown(context.Background())
-	if err != nil {
-		srv.log.Error("Unexpected error while shutting down HTTP server: "+err.Error(), "error", err)
+
+	// The HTTP server is not created when Run exits early, such as within the migrate run mode
+	if srv.httpServer != nil {
+		err := srv.httpServer.Shutdown(context.Background())
+		if err != nil {
+			srv.log.Error("Unexpected error while shutting down HTTP server: "+err.Error(), "error", err)
+		}
+	}
+
+	// Stop scheduled tasks and drain NATS subscriptions, allowing in-flight messages to complete
+	if svcs := srv.services.Load(); svcs != nil {
+		svcs.close(nil)
+	}
+	if srv.nc != nil {
+		err := srv.nc.Drain()
+		if err != nil && !errors.Is(err, natsgo.ErrConnectionClosed) {
+			srv.log.Error("Unexpected error while draining NATS connection: "+err.Error(), "error", err)
+		}
 	}
 	defer srv.runCancel()
 }
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/viper"
+
+	"github.com/tarmac-project/tarmac/pkg/config"
+	"github.com/tarmac-project/tarmac/pkg/wasm"
+)
+
+// dataSourceDefaults are the default options of named data sources, matching the defaults of the default KV store.
+var dataSourceDefaults = map[string]any{
+	"boltdb_bucket":              "tarmac",
+	"boltdb_permissions":         0600,
+	"boltdb_timeout":             5,
+	"nats_bucket":                "tarmac",
+	"sql_connect_retries":        5,
+	"sql_connect_retry_interval": 2,
+}
+
+// dataSources returns the configuration of each named data source defined within the list at key, such as
+// sql_databases or kvstores. Each data source has a unique name and is configured with the same options as the
+// default data source (i.e. sql_type and sql_dsn, or kvstore_type and redis_server).
+func dataSources(cfg *viper.Viper, key string) (map[string]*viper.Viper, error) {
+	var entries []map[string]any
+	err := cfg.UnmarshalKey(key, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s - %w", key, err)
+	}
+
+	sources := make(map[string]*viper.Viper, len(entries))
+	for _, e := range entries {
+		name, _ := e["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("%s entry missing name", key)
+		}
+		if _, ok := sources[name]; ok {
+			return nil, fmt.Errorf("%s entry %s defined more than once", key, name)
+		}
+
+		c := viper.New()
+		for k, v := range dataSourceDefaults {
+			c.SetDefault(k, v)
+		}
+		for k, v := range e {
+			c.Set(k, v)
+		}
+		sources[name] = c
+	}
+	return sources, nil
+}
+
+// checkDataSources returns an error if the function is bound to a data source that is not configured.
+func (srv *Server) checkDataSources(function string, f config.Function) error {
+	if name := f.DataSources.SQL; name != "" {
+		if _, ok := srv.dbs[name]; !ok {
+			return fmt.Errorf("function %s bound to unknown sql data source %s", function, name)
+		}
+	}
+
+	if name := f.DataSources.KVStore; name != "" {
+		if _, ok := srv.kvs[name]; !ok {
+			return fmt.Errorf("function %s bound to unknown kvstore data source %s", function, name)
+		}
+	}
+	return nil
+}
+
+// callerFunction returns the configuration of the named function performing a host callback. The default function
+// loaded without a service configuration has no configuration and returns false, while other functions missing from
+// the service configuration return an error, denying the callback as permitCallback does.
+func (srv *Server) callerFunction(name string) (config.Function, bool, error) {
+	f, err := srv.funcConfig().LookupFunction(name)
+	if err != nil {
+		if name == "default" {
+			return config.Function{}, false, nil
+		}
+		return config.Function{}, false, fmt.Errorf("unknown function %q performing host callback - %w", name, err)
+	}
+	return f, true, nil
+}
+
+// sqlDataSource returns the name of the SQL database bound to the function performing the host callback.
+func (srv *Server) sqlDataSource(ctx context.Context) (string, error) {
+	f, _, err := srv.callerFunction(wasm.ModuleName(ctx))
+	if err != nil {
+		return "", err
+	}
+	return f.DataSources.SQL, nil
+}
+
+// kvDataSource returns the name of the KV store bound to the function performing the host callback.
+func (srv *Server) kvDataSource(ctx context.Context) (string, error) {
+	f, _, err := srv.callerFunction(wasm.ModuleName(ctx))
+	if err != nil {
+		return "", err
+	}
+	return f.DataSources.KVStore, nil
+}
+
+// kvNamespace returns the key prefix isolating the KV store keys of the function performing the host callback.
+func (srv *Server) kvNamespace(ctx context.Context) (string, error) {
+	return srv.functionNamespace(wasm.ModuleName(ctx))
+}
+
+// functionNamespace returns the key prefix isolating the KV store keys of the named function, based on the
+// kv_namespace of the function. The default function loaded without a service configuration uses unprefixed keys, as
+// do functions without a kv_namespace unless enable_kv_namespaces is set.
+func (srv *Server) functionNamespace(name string) (string, error) {
+	f, ok, err := srv.callerFunction(name)
+	if err != nil || !ok {
+		return "", err
+	}
+
+	switch f.KVNamespace {
+	case "shared":
+		return "shared/", nil
+	case "function":
+		return "function/" + name + "/", nil
+	case "":
+		if !srv.cfg.GetBool("enable_kv_namespaces") {
+			return "", nil
+		}
+	}
+
+	svc, err := srv.funcConfig().LookupFunctionService(name)
+	if err != nil {
+		return "", fmt.Errorf("unable to find service of function %q performing host callback - %w", name, err)
+	}
+	return "service/" + svc + "/", nil
+}
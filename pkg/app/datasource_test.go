@@ -0,0 +1,203 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/tarmac-project/hord"
+
+	"github.com/tarmac-project/tarmac/pkg/config"
+)
+
+func TestDataSources(t *testing.T) {
+	t.Run("Named Data Sources", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("sql_databases", []any{
+			map[string]any{"name": "orders", "sql_type": "sqlite", "sql_path": filepath.Join(t.TempDir(), "orders.db")},
+			map[string]any{"name": "reporting", "sql_type": "sqlite", "sql_path": filepath.Join(t.TempDir(), "rpt.db")},
+		})
+		cfg.Set("kvstores", []any{
+			map[string]any{"name": "cache", "kvstore_type": "in-memory"},
+		})
+		srv := New(cfg)
+
+		dbs, err := srv.openSQLDatabases()
+		if err != nil {
+			t.Fatalf("Unexpected error opening SQL databases - %s", err)
+		}
+		for name, db := range dbs {
+			defer db.Close()
+			err = db.Ping()
+			if err != nil {
+				t.Errorf("Unexpected error pinging SQL database %s - %s", name, err)
+			}
+		}
+		if len(dbs) != 2 || dbs["orders"] == nil || dbs["reporting"] == nil {
+			t.Errorf("Unexpected SQL databases opened - %v", dbs)
+		}
+
+		kvs, err := srv.openKVStores()
+		if err != nil {
+			t.Fatalf("Unexpected error opening KV stores - %s", err)
+		}
+		for _, kv := range kvs {
+			defer kv.Close()
+		}
+		if len(kvs) != 1 || kvs["cache"] == nil {
+			t.Errorf("Unexpected KV stores opened - %v", kvs)
+		}
+	})
+
+	t.Run("Undefined", func(t *testing.T) {
+		srv := New(viper.New())
+
+		dbs, err := srv.openSQLDatabases()
+		if err != nil || len(dbs) != 0 {
+			t.Errorf("Unexpected SQL databases opened - %v, %s", dbs, err)
+		}
+
+		kvs, err := srv.openKVStores()
+		if err != nil || len(kvs) != 0 {
+			t.Errorf("Unexpected KV stores opened - %v, %s", kvs, err)
+		}
+	})
+
+	t.Run("Defaults", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("kvstores", []any{
+			map[string]any{"name": "local", "kvstore_type": "boltdb", "boltdb_timeout": 1},
+		})
+
+		sources, err := dataSources(cfg, "kvstores")
+		if err != nil {
+			t.Fatalf("Unexpected error parsing data sources - %s", err)
+		}
+		local := sources["local"]
+		if local.GetString("kvstore_type") != "boltdb" || local.GetString("boltdb_bucket") != "tarmac" {
+			t.Errorf("Unexpected data source configuration - %v", local.AllSettings())
+		}
+		if local.GetInt("boltdb_timeout") != 1 || local.GetInt("boltdb_permissions") != 0600 {
+			t.Errorf("Unexpected data source configuration - %v", local.AllSettings())
+		}
+	})
+
+	tt := []struct {
+		name    string
+		sources []any
+	}{
+		{name: "Missing Name", sources: []any{map[string]any{"kvstore_type": "in-memory"}}},
+		{
+			name: "Duplicate Name",
+			sources: []any{
+				map[string]any{"name": "cache", "kvstore_type": "in-memory"},
+				map[string]any{"name": "cache", "kvstore_type": "in-memory"},
+			},
+		},
+		{name: "Invalid Format", sources: []any{"cache"}},
+		{name: "Unknown Type", sources: []any{map[string]any{"name": "cache", "kvstore_type": "unknown"}}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := viper.New()
+			cfg.Set("kvstores", tc.sources)
+
+			_, err := New(cfg).openKVStores()
+			if err == nil {
+				t.Errorf("Expected error opening KV stores")
+			}
+		})
+	}
+}
+
+func TestCheckDataSources(t *testing.T) {
+	srv := New(viper.New())
+	srv.dbs = map[string]*sql.DB{"orders": nil}
+	srv.kvs = map[string]hord.Database{"cache": nil}
+
+	tt := []struct {
+		name  string
+		ds    config.DataSources
+		valid bool
+	}{
+		{name: "Unbound", valid: true},
+		{name: "Bound", ds: config.DataSources{SQL: "orders", KVStore: "cache"}, valid: true},
+		{name: "Unknown SQL", ds: config.DataSources{SQL: "reporting"}},
+		{name: "Unknown KV Store", ds: config.DataSources{KVStore: "sessions"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := srv.checkDataSources("example", config.Function{DataSources: tc.ds})
+			if err != nil && tc.valid {
+				t.Errorf("Unexpected error checking data sources - %s", err)
+			}
+			if err == nil && !tc.valid {
+				t.Errorf("Expected error checking data sources")
+			}
+		})
+	}
+}
+
+func TestFunctionNamespace(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "tarmac.json")
+	err := os.WriteFile(configPath, []byte(`{"services":{"orders":{"name":"orders","functions":{`+
+		`"unset":{"filepath":"/unset.wasm"},`+
+		`"service":{"filepath":"/service.wasm","kv_namespace":"service"},`+
+		`"private":{"filepath":"/private.wasm","kv_namespace":"function"},`+
+		`"shared":{"filepath":"/shared.wasm","kv_namespace":"shared"}},"routes":[]}}}`), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write temp config file - %s", err)
+	}
+
+	srv := New(viper.New())
+	svcs := newServices(context.Background())
+	defer svcs.close(nil)
+	svcs.cfg, err = config.Parse(configPath)
+	if err != nil {
+		t.Fatalf("Failed to parse config - %s", err)
+	}
+	srv.services.Store(svcs)
+
+	tt := []struct {
+		name       string
+		function   string
+		namespaces bool
+		prefix     string
+		err        bool
+	}{
+		{name: "Legacy Layout", function: "unset"},
+		{name: "Service Namespace", function: "unset", namespaces: true, prefix: "service/orders/"},
+		{name: "Explicit Service Namespace", function: "service", prefix: "service/orders/"},
+		{name: "Function Namespace", function: "private", prefix: "function/private/"},
+		{name: "Shared Namespace", function: "shared", prefix: "shared/"},
+		{name: "Default Function", function: "default", namespaces: true},
+		{name: "Unknown Function", function: "unknown", err: true},
+		{name: "Unknown Function with Namespaces", function: "unknown", namespaces: true, err: true},
+		{name: "Unnamed Function", function: "", err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			srv.cfg.Set("enable_kv_namespaces", tc.namespaces)
+			prefix, err := srv.functionNamespace(tc.function)
+			if (err != nil) != tc.err {
+				t.Fatalf("Unexpected error resolving namespace of %q - %v", tc.function, err)
+			}
+			if prefix != tc.prefix {
+				t.Errorf("Unexpected namespace of %q - got %q, expected %q", tc.function, prefix, tc.prefix)
+			}
+		})
+	}
+
+	t.Run("Data Sources of Unknown Function", func(t *testing.T) {
+		_, _, err := srv.callerFunction("unknown")
+		if err == nil {
+			t.Errorf("Expected error resolving the data sources of an unknown function")
+		}
+	})
+}
@@ -0,0 +1,536 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/FZambia/sentinel"
+	redigo "github.com/gomodule/redigo/redis"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/spf13/viper"
+	"github.com/tarmac-project/hord"
+	"github.com/tarmac-project/hord/drivers/cassandra"
+	"github.com/tarmac-project/hord/drivers/hashmap"
+	"github.com/tarmac-project/hord/drivers/nats"
+	"github.com/tarmac-project/hord/drivers/redis"
+
+	"github.com/tarmac-project/tarmac/pkg/boltkv"
+	"github.com/tarmac-project/tarmac/pkg/kvext"
+	"github.com/tarmac-project/tarmac/pkg/sqlkv"
+)
+
+// defaultKVSweepInterval is the interval expired keys are removed from KV stores without native key TTLs when
+// kvstore_ttl_sweep_interval is not set.
+const defaultKVSweepInterval = 30 * time.Second
+
+const (
+	// defaultKVCacheSize is the number of keys cached when kvstore_cache_size is not set.
+	defaultKVCacheSize = 1000
+
+	// defaultKVCacheTTL is the duration keys are cached when kvstore_cache_ttl is not set.
+	defaultKVCacheTTL = 60 * time.Second
+)
+
+// openKV connects to and sets up the KV store selected by kvstore_type. KV stores are wrapped to support key TTLs,
+// natively with Redis, NATS, and SQL, or by sweeping expired keys every kvstore_ttl_sweep_interval seconds, to encrypt
+// values when enable_kvstore_encryption is set, and to cache keys when enable_kvstore_cache is set. The name of the data
+// source labels its cache metrics. The sql KV store is stored within a SQL DB, which must be opened first.
+func (srv *Server) openKV(name string, cfg *viper.Viper) (hord.Database, error) {
+	var kv hord.Database
+	var err error
+	switch cfg.GetString("kvstore_type") {
+	case "in-memory":
+		kv, err = hashmap.Dial(hashmap.Config{})
+		if err != nil {
+			return nil, fmt.Errorf("could not create internal kvstore - %w", err)
+		}
+	case "internal", "boltdb":
+		// Check if file exists, if not create one
+		fh, err := os.OpenFile(
+			cfg.GetString("boltdb_filename"),
+			os.O_RDWR|os.O_CREATE|os.O_EXCL,
+			os.FileMode(cfg.GetInt("boltdb_permissions")),
+		)
+		if err != nil && !os.IsExist(err) {
+			return nil, fmt.Errorf("could not create boltdb file - %w", err)
+		}
+		fh.Close()
+
+		// Open datastore
+		kv, err = boltkv.Dial(boltkv.Config{
+			Filename:    cfg.GetString("boltdb_filename"),
+			Bucketname:  cfg.GetString("boltdb_bucket"),
+			Permissions: os.FileMode(cfg.GetInt("boltdb_permissions")),
+			Timeout:     time.Duration(cfg.GetInt("boltdb_timeout")) * time.Second,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not create internal kvstore - %w", err)
+		}
+	case "redis":
+		kv, err = redis.Dial(redisConfig(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("could not establish kvstore connection - %w", err)
+		}
+	case "cassandra":
+		kv, err = cassandra.Dial(cassandra.Config{
+			Hosts:                      cfg.GetStringSlice("cassandra_hosts"),
+			Port:                       cfg.GetInt("cassandra_port"),
+			Keyspace:                   cfg.GetString("cassandra_keyspace"),
+			Consistency:                cfg.GetString("cassandra_consistency"),
+			ReplicationStrategy:        cfg.GetString("cassandra_repl_strategy"),
+			Replicas:                   cfg.GetInt("cassandra_replicas"),
+			User:                       cfg.GetString("cassandra_user"),
+			Password:                   cfg.GetString("cassandra_password"),
+			EnableHostnameVerification: cfg.GetBool("cassandra_hostname_verify"),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not establish kvstore connection - %w", err)
+		}
+	case "nats":
+		kv, err = nats.Dial(nats.Config{
+			URL:           cfg.GetString("nats_url"),
+			Bucket:        cfg.GetString("nats_bucket"),
+			Servers:       cfg.GetStringSlice("nats_servers"),
+			SkipTLSVerify: cfg.GetBool("nats_skip_tls_verify"),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not establish kvstore connection - %w", err)
+		}
+	case "sql":
+		db, dialect, err := srv.kvSQL(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("could not establish kvstore connection - %w", err)
+		}
+
+		kv, err = sqlkv.Dial(sqlkv.Config{
+			DB:            db,
+			Dialect:       dialect,
+			Table:         cfg.GetString("kvstore_sql_table"),
+			SweepInterval: time.Duration(cfg.GetInt("kvstore_ttl_sweep_interval")) * time.Second,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not establish kvstore connection - %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown kvstore specified - %s", cfg.GetString("kvstore_type"))
+	}
+
+	kv, err = extendKV(kv, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err = encryptKV(kv, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err = srv.cacheKV(name, kv, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize the KV
+	err = kv.Setup()
+	if err != nil {
+		kv.Close()
+		return nil, fmt.Errorf("could not setup kvstore - %w", err)
+	}
+	return kv, nil
+}
+
+// openKVStores connects to and sets up the named KV stores defined within kvstores.
+func (srv *Server) openKVStores() (map[string]hord.Database, error) {
+	cfgs, err := dataSources(srv.cfg, "kvstores")
+	if err != nil {
+		return nil, err
+	}
+
+	kvs := make(map[string]hord.Database, len(cfgs))
+	for name, cfg := range cfgs {
+		srv.log.Info("Connecting to KV Store", "data_source", name)
+		kv, err := srv.openKV(name, cfg)
+		if err != nil {
+			for _, kv := range kvs {
+				kv.Close()
+			}
+			return nil, fmt.Errorf("could not open kvstore %s - %w", name, err)
+		}
+		kvs[name] = kv
+	}
+	return kvs, nil
+}
+
+// kvSQL returns the SQL DB storing a sql KV store along with its dialect, which is the named SQL DB selected by
+// kvstore_sql_database or the default SQL DB.
+func (srv *Server) kvSQL(cfg *viper.Viper) (*sql.DB, string, error) {
+	name := cfg.GetString("kvstore_sql_database")
+	if name == "" {
+		if srv.db == nil {
+			return nil, "", errors.New("kvstore_type sql requires enable_sql or kvstore_sql_database")
+		}
+		return srv.db, srv.cfg.GetString("sql_type"), nil
+	}
+
+	db, ok := srv.dbs[name]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown sql data source %s", name)
+	}
+
+	cfgs, err := dataSources(srv.cfg, "sql_databases")
+	if err != nil {
+		return nil, "", err
+	}
+	return db, cfgs[name].GetString("sql_type"), nil
+}
+
+// extendKV wraps the KV store selected by kvstore_type to support key TTLs and atomic operations, closing the KV store
+// if it cannot be wrapped. The sql KV store supports both natively and is returned unwrapped.
+func extendKV(kv hord.Database, cfg *viper.Viper) (hord.Database, error) {
+	var ext hord.Database
+	var err error
+	switch cfg.GetString("kvstore_type") {
+	case "redis":
+		ext, err = kvext.NewRedis(kvext.RedisConfig{KV: kv, Pool: redisPool(redisConfig(cfg))})
+	case "sql":
+		// Key TTLs and atomic operations are native to the sql KV store
+		return kv, nil
+	case "nats":
+		var nc *natsgo.Conn
+		nc, err = dialNATS(cfg)
+		if err == nil {
+			ext, err = kvext.NewNATS(kvext.NATSConfig{
+				KV:        kv,
+				Conn:      nc,
+				Bucket:    cfg.GetString("nats_bucket"),
+				EnableTTL: cfg.GetBool("nats_enable_ttl"),
+			})
+			if err != nil {
+				nc.Close()
+			}
+		}
+	default:
+		interval := time.Duration(cfg.GetInt("kvstore_ttl_sweep_interval")) * time.Second
+		if interval <= 0 {
+			interval = defaultKVSweepInterval
+		}
+		var sweeper *kvext.Sweeper
+		sweeper, err = kvext.NewSweeper(kvext.SweeperConfig{KV: kv, Interval: interval})
+		if err == nil {
+			ext, err = kvext.NewLocker(kvext.LockerConfig{KV: sweeper})
+		}
+	}
+	if err != nil {
+		kv.Close()
+		return nil, fmt.Errorf("could not extend kvstore - %w", err)
+	}
+	return ext, nil
+}
+
+// encryptKV wraps the KV store with an Encryptor when enable_kvstore_encryption is set, encrypting new values with the
+// key selected by kvstore_encryption_key_id. The KV store is closed if it cannot be wrapped.
+func encryptKV(kv hord.Database, cfg *viper.Viper) (hord.Database, error) {
+	if !cfg.GetBool("enable_kvstore_encryption") {
+		return kv, nil
+	}
+
+	keys, err := encryptionKeys(cfg)
+	if err != nil {
+		kv.Close()
+		return nil, fmt.Errorf("could not load kvstore encryption keys - %w", err)
+	}
+
+	enc, err := kvext.NewEncryptor(kvext.EncryptorConfig{
+		KV:    kv,
+		Keys:  keys,
+		KeyID: cfg.GetString("kvstore_encryption_key_id"),
+	})
+	if err != nil {
+		kv.Close()
+		return nil, fmt.Errorf("could not configure kvstore encryption - %w", err)
+	}
+	return enc, nil
+}
+
+// encryptionKeys returns the KV store encryption keys by key ID. Keys are read from kvstore_encryption_key_file, which
+// holds a key per line as the key ID and base64 encoded key separated by a colon, skipping blank lines and lines
+// beginning with #. The base64 encoded kvstore_encryption_key, commonly set through the environment, is used as the
+// key of kvstore_encryption_key_id.
+func encryptionKeys(cfg *viper.Viper) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+
+	if path := cfg.GetString("kvstore_encryption_key_file"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read key file - %w", err)
+		}
+
+		s := bufio.NewScanner(bytes.NewReader(b))
+		for n := 1; s.Scan(); n++ {
+			line := strings.TrimSpace(s.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			id, encoded, ok := strings.Cut(line, ":")
+			if !ok {
+				return nil, fmt.Errorf("key file line %d is not formatted as <key id>:<base64 key>", n)
+			}
+			key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+			if err != nil {
+				return nil, fmt.Errorf("key file line %d key is not base64 encoded - %w", n, err)
+			}
+			keys[strings.TrimSpace(id)] = key
+		}
+	}
+
+	id := cfg.GetString("kvstore_encryption_key_id")
+	if id == "" {
+		return nil, errors.New("kvstore_encryption_key_id must be set")
+	}
+
+	if encoded := cfg.GetString("kvstore_encryption_key"); encoded != "" {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("kvstore_encryption_key is not base64 encoded - %w", err)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+// cacheKV wraps the KV store with a read-through Cache when enable_kvstore_cache is set, caching up to
+// kvstore_cache_size keys for kvstore_cache_ttl seconds. With kvstore_cache_nats_watch set, NATS KV stores also remove
+// keys modified by other Tarmac instances from the cache. Lookups are counted by data source name, or default for the
+// default KV store. The KV store is closed if it cannot be wrapped.
+func (srv *Server) cacheKV(name string, kv hord.Database, cfg *viper.Viper) (hord.Database, error) {
+	if !cfg.GetBool("enable_kvstore_cache") {
+		return kv, nil
+	}
+
+	size := cfg.GetInt("kvstore_cache_size")
+	if size <= 0 {
+		size = defaultKVCacheSize
+	}
+	ttl := time.Duration(cfg.GetInt("kvstore_cache_ttl")) * time.Second
+	if ttl <= 0 {
+		ttl = defaultKVCacheTTL
+	}
+
+	var watch func(func(string)) (func(), error)
+	if cfg.GetBool("kvstore_cache_nats_watch") {
+		if cfg.GetString("kvstore_type") != "nats" {
+			kv.Close()
+			return nil, errors.New("kvstore_cache_nats_watch requires a nats kvstore_type")
+		}
+		watch = watchNATS(cfg)
+	}
+
+	label := name
+	if label == "" {
+		label = "default"
+	}
+
+	cache, err := kvext.NewCache(kvext.CacheConfig{
+		KV:    kv,
+		Size:  size,
+		TTL:   ttl,
+		Watch: watch,
+		OnLookup: func(hit bool) {
+			if hit {
+				srv.stats.KVCache.WithLabelValues(label, "hit").Inc()
+				return
+			}
+			srv.stats.KVCache.WithLabelValues(label, "miss").Inc()
+		},
+	})
+	if err != nil {
+		kv.Close()
+		return nil, fmt.Errorf("could not configure kvstore cache - %w", err)
+	}
+	return cache, nil
+}
+
+// uncached returns the KV store wrapped by a Cache, or kv itself when it is not cached.
+func uncached(kv hord.Database) hord.Database {
+	if c, ok := kv.(*kvext.Cache); ok {
+		return c.Database
+	}
+	return kv
+}
+
+// watchNATS returns a Cache watch function reporting the keys modified within the NATS bucket of the KV store, using
+// a dedicated connection closed once the watch is stopped.
+func watchNATS(cfg *viper.Viper) func(func(string)) (func(), error) {
+	return func(invalidate func(string)) (func(), error) {
+		nc, err := dialNATS(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("could not create jetstream context - %w", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stop := func() {
+			cancel()
+			nc.Close()
+		}
+
+		bucket, err := js.KeyValue(ctx, cfg.GetString("nats_bucket"))
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("could not open bucket %s - %w", cfg.GetString("nats_bucket"), err)
+		}
+
+		w, err := bucket.WatchAll(ctx, jetstream.UpdatesOnly())
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("could not watch bucket %s - %w", cfg.GetString("nats_bucket"), err)
+		}
+
+		go func() {
+			for entry := range w.Updates() {
+				if entry != nil {
+					invalidate(entry.Key())
+				}
+			}
+		}()
+		return func() {
+			_ = w.Stop()
+			stop()
+		}, nil
+	}
+}
+
+// reencryptPageSize is the number of keys listed at a time while re-encrypting a KV store.
+const reencryptPageSize = 1000
+
+// reencryptKV re-encrypts the values of every encrypted KV store with the current encryption key, returning the number
+// of KV stores re-encrypted.
+func (srv *Server) reencryptKV() (int, error) {
+	stores := make(map[string]hord.Database, len(srv.kvs)+1)
+	if srv.kv != nil {
+		stores[""] = srv.kv
+	}
+	for name, kv := range srv.kvs {
+		stores[name] = kv
+	}
+
+	var n int
+	for name, kv := range stores {
+		enc, ok := uncached(kv).(*kvext.Encryptor)
+		if !ok {
+			continue
+		}
+
+		srv.log.Info("Re-encrypting KV Store values", "data_source", name)
+		count, err := reencrypt(enc)
+		if err != nil {
+			return n, fmt.Errorf("could not re-encrypt kvstore %s - %w", name, err)
+		}
+		srv.log.Info("Re-encrypted KV Store values", "data_source", name, "keys", count)
+		n++
+	}
+	return n, nil
+}
+
+// reencrypt re-encrypts every value of the KV store not encrypted with the current key, returning the number of values
+// rewritten.
+func reencrypt(enc *kvext.Encryptor) (int, error) {
+	var n int
+	var cursor string
+	for {
+		keys, next, err := kvext.ScanKeys(enc, "", cursor, reencryptPageSize)
+		if err != nil {
+			return n, fmt.Errorf("could not list keys - %w", err)
+		}
+
+		for _, key := range keys {
+			ok, err := enc.Reencrypt(key)
+			if err != nil {
+				return n, fmt.Errorf("could not re-encrypt key %s - %w", key, err)
+			}
+			if ok {
+				n++
+			}
+		}
+
+		if next == "" {
+			return n, nil
+		}
+		cursor = next
+	}
+}
+
+// redisConfig returns the configuration of the Redis KV store, shared by the hord driver and the connection pool used
+// for native Redis operations.
+func redisConfig(cfg *viper.Viper) redis.Config {
+	return redis.Config{
+		Server:   cfg.GetString("redis_server"),
+		Password: cfg.GetString("redis_password"),
+		SentinelConfig: redis.SentinelConfig{
+			Servers: cfg.GetStringSlice("redis_sentinel_servers"),
+			Master:  cfg.GetString("redis_sentinel_master"),
+		},
+		ConnectTimeout: time.Duration(cfg.GetInt("redis_connect_timeout")) * time.Second,
+		Database:       cfg.GetInt("redis_database"),
+		SkipTLSVerify:  cfg.GetBool("redis_hostname_verify"),
+		KeepAlive:      time.Duration(cfg.GetInt("redis_keepalive")) * time.Second,
+		MaxActive:      cfg.GetInt("redis_max_active"),
+		ReadTimeout:    time.Duration(cfg.GetInt("redis_read_timeout")) * time.Second,
+		WriteTimeout:   time.Duration(cfg.GetInt("redis_write_timeout")) * time.Second,
+	}
+}
+
+// redisPool returns a connection pool to the Redis server of the hord Redis configuration, used for the operations the
+// hord driver does not provide. The master is discovered through Redis Sentinel when Sentinel servers are configured.
+// Connections are plain-text, so TLS verification settings do not apply.
+func redisPool(c redis.Config) *redigo.Pool {
+	opts := []redigo.DialOption{
+		redigo.DialPassword(c.Password),
+		redigo.DialDatabase(c.Database),
+		redigo.DialConnectTimeout(c.ConnectTimeout),
+		redigo.DialReadTimeout(c.ReadTimeout),
+		redigo.DialWriteTimeout(c.WriteTimeout),
+		redigo.DialKeepAlive(c.KeepAlive),
+	}
+
+	pool := &redigo.Pool{
+		MaxActive: c.MaxActive,
+		Dial: func() (redigo.Conn, error) {
+			return redigo.Dial("tcp", c.Server, opts...)
+		},
+	}
+	if len(c.SentinelConfig.Servers) == 0 {
+		return pool
+	}
+
+	s := &sentinel.Sentinel{
+		Addrs:      c.SentinelConfig.Servers,
+		MasterName: c.SentinelConfig.Master,
+		Dial: func(addr string) (redigo.Conn, error) {
+			return redigo.Dial("tcp", addr, opts...)
+		},
+	}
+	pool.Dial = func() (redigo.Conn, error) {
+		addr, err := s.MasterAddr()
+		if err != nil {
+			return nil, err
+		}
+		return redigo.Dial("tcp", addr, opts...)
+	}
+	return pool
+}
@@ -0,0 +1,356 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+	"github.com/tarmac-project/hord/drivers/hashmap"
+
+	"github.com/tarmac-project/tarmac/pkg/kvext"
+	"github.com/tarmac-project/tarmac/pkg/sqlkv"
+	"github.com/tarmac-project/tarmac/pkg/telemetry"
+)
+
+func TestEncryptionKeys(t *testing.T) {
+	current := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	previous := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+
+	path := filepath.Join(t.TempDir(), "keys")
+	err := os.WriteFile(path, []byte("# rotated keys\n\nprevious: "+previous+"\n"), 0600)
+	if err != nil {
+		t.Fatalf("Unable to write key file - %s", err)
+	}
+
+	t.Run("File and Environment", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("kvstore_encryption_key_file", path)
+		cfg.Set("kvstore_encryption_key_id", "current")
+		cfg.Set("kvstore_encryption_key", current)
+
+		keys, err := encryptionKeys(cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error loading keys - %s", err)
+		}
+		if len(keys) != 2 || len(keys["current"]) != 32 || len(keys["previous"]) != 16 {
+			t.Errorf("Unexpected keys loaded - %v", keys)
+		}
+	})
+
+	cases := []struct {
+		name string
+		cfg  map[string]any
+	}{
+		{"Missing Key ID", map[string]any{"kvstore_encryption_key": current}},
+		{"Invalid Key", map[string]any{"kvstore_encryption_key_id": "current", "kvstore_encryption_key": "%%%"}},
+		{"Missing File", map[string]any{
+			"kvstore_encryption_key_id":   "previous",
+			"kvstore_encryption_key_file": filepath.Join(t.TempDir(), "missing"),
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := viper.New()
+			for k, v := range tc.cfg {
+				cfg.Set(k, v)
+			}
+
+			_, err := encryptionKeys(cfg)
+			if err == nil {
+				t.Errorf("Expected error loading keys")
+			}
+		})
+	}
+}
+
+func TestReencryptRunMode(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+
+	t.Run("Reencrypt", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("disable_logging", true)
+		cfg.Set("run_mode", "reencrypt")
+		cfg.Set("enable_kvstore", true)
+		cfg.Set("kvstore_type", "in-memory")
+		cfg.Set("enable_kvstore_encryption", true)
+		cfg.Set("kvstore_encryption_key_id", "v1")
+		cfg.Set("kvstore_encryption_key", key)
+
+		srv := New(cfg)
+		defer srv.Stop()
+		err := srv.Run()
+		if !errors.Is(err, ErrShutdown) {
+			t.Fatalf("Unexpected error running reencrypt mode - %v", err)
+		}
+	})
+
+	t.Run("No Encryption", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("disable_logging", true)
+		cfg.Set("run_mode", "reencrypt")
+		cfg.Set("enable_kvstore", true)
+		cfg.Set("kvstore_type", "in-memory")
+
+		srv := New(cfg)
+		defer srv.Stop()
+		err := srv.Run()
+		if err == nil || errors.Is(err, ErrShutdown) {
+			t.Errorf("Expected error running reencrypt mode without encryption - %v", err)
+		}
+	})
+
+	t.Run("Plaintext Values", func(t *testing.T) {
+		db, err := hashmap.Dial(hashmap.Config{})
+		if err != nil {
+			t.Fatalf("Unable to create hashmap - %s", err)
+		}
+		err = db.Set("key", []byte("plaintext"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		srv := New(viper.New())
+		srv.kv, err = kvext.NewEncryptor(kvext.EncryptorConfig{
+			KV:    db,
+			Keys:  map[string][]byte{"v1": []byte("0123456789abcdef")},
+			KeyID: "v1",
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error creating encryptor - %s", err)
+		}
+
+		n, err := srv.reencryptKV()
+		if err != nil || n != 1 {
+			t.Fatalf("Unexpected result re-encrypting kv stores - %d, %v", n, err)
+		}
+
+		raw, err := db.Get("key")
+		if err != nil || string(raw) == "plaintext" {
+			t.Errorf("Unexpected value after re-encrypting - %q, %v", raw, err)
+		}
+		data, err := srv.kv.Get("key")
+		if err != nil || string(data) != "plaintext" {
+			t.Errorf("Unexpected decrypted value - %q, %v", data, err)
+		}
+	})
+}
+
+func TestKVCache(t *testing.T) {
+	srv := &Server{log: slog.New(slog.DiscardHandler), stats: telemetry.New()}
+	defer srv.stats.Close()
+
+	t.Run("Metrics", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("kvstore_type", "in-memory")
+		cfg.Set("enable_kvstore_cache", true)
+
+		kv, err := srv.openKV("cache", cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error opening KV store - %s", err)
+		}
+		defer kv.Close()
+
+		err = kv.Set("key", []byte("data"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+		for range 3 {
+			_, err = kv.Get("key")
+			if err != nil {
+				t.Fatalf("Unexpected error fetching key - %s", err)
+			}
+		}
+
+		hits := testutil.ToFloat64(srv.stats.KVCache.WithLabelValues("cache", "hit"))
+		misses := testutil.ToFloat64(srv.stats.KVCache.WithLabelValues("cache", "miss"))
+		if hits != 2 || misses != 1 {
+			t.Errorf("Unexpected cache metrics - %v hits, %v misses", hits, misses)
+		}
+	})
+
+	t.Run("Watch Requires NATS", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("kvstore_type", "in-memory")
+		cfg.Set("enable_kvstore_cache", true)
+		cfg.Set("kvstore_cache_nats_watch", true)
+
+		_, err := srv.openKV("", cfg)
+		if err == nil {
+			t.Errorf("Expected error watching a KV store other than nats")
+		}
+	})
+
+	t.Run("NATS Watch", func(t *testing.T) {
+		ns, err := server.NewServer(&server.Options{
+			Host:      "127.0.0.1",
+			Port:      -1,
+			JetStream: true,
+			StoreDir:  t.TempDir(),
+			NoLog:     true,
+			NoSigs:    true,
+		})
+		if err != nil {
+			t.Fatalf("Unable to create nats server - %s", err)
+		}
+		go ns.Start()
+		defer ns.Shutdown()
+		if !ns.ReadyForConnections(10 * time.Second) {
+			t.Fatalf("NATS server not ready for connections")
+		}
+
+		cfg := viper.New()
+		cfg.Set("kvstore_type", "nats")
+		cfg.Set("nats_url", ns.ClientURL())
+		cfg.Set("nats_bucket", "tarmac")
+		cfg.Set("enable_kvstore_cache", true)
+		cfg.Set("kvstore_cache_nats_watch", true)
+
+		kv, err := srv.openKV("", cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error opening KV store - %s", err)
+		}
+		defer kv.Close()
+
+		err = kv.Set("key", []byte("local"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+		data, err := kv.Get("key")
+		if err != nil || string(data) != "local" {
+			t.Fatalf("Unexpected value fetched - %q, %v", data, err)
+		}
+
+		// Modify the key as another Tarmac instance would
+		nc, err := natsgo.Connect(ns.ClientURL())
+		if err != nil {
+			t.Fatalf("Unable to connect to nats server - %s", err)
+		}
+		defer nc.Close()
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unable to create jetstream context - %s", err)
+		}
+		bucket, err := js.KeyValue(context.Background(), "tarmac")
+		if err != nil {
+			t.Fatalf("Unable to open bucket - %s", err)
+		}
+		_, err = bucket.Put(context.Background(), "key", []byte("remote"))
+		if err != nil {
+			t.Fatalf("Unable to set key - %s", err)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			data, err = kv.Get("key")
+			if err == nil && string(data) == "remote" {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Cached key not invalidated by watch - %q, %v", data, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+func TestSQLKV(t *testing.T) {
+	t.Run("Default SQL DB", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("sql_type", "sqlite")
+		cfg.Set("sql_path", filepath.Join(t.TempDir(), "tarmac.db"))
+		cfg.Set("kvstore_type", "sql")
+		srv := New(cfg)
+
+		var err error
+		srv.db, err = openSQL(cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error opening SQLite database - %s", err)
+		}
+		defer srv.db.Close()
+
+		kv, err := srv.openKV("", cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error opening KV store - %s", err)
+		}
+		defer kv.Close()
+
+		var count int
+		err = srv.db.QueryRow("SELECT COUNT(*) FROM " + sqlkv.DefaultTable).Scan(&count)
+		if err != nil {
+			t.Errorf("Unexpected error querying created kv table - %s", err)
+		}
+
+		// Keys expire natively, recording their expiration within the table rather than under reserved keys
+		err = kv.(kvext.TTLSetter).SetWithTTL("session", []byte("data"), time.Minute)
+		if err != nil {
+			t.Errorf("Unexpected error setting key with ttl - %s", err)
+		}
+		keys, err := kv.Keys()
+		if err != nil || len(keys) != 1 || keys[0] != "session" {
+			t.Errorf("Unexpected keys - %v, %v", keys, err)
+		}
+
+		// Atomic operations are native, so they hold across Tarmac instances
+		if _, ok := kv.(*sqlkv.Database); !ok {
+			t.Errorf("Unexpected wrapping of sql KV store - %T", kv)
+		}
+	})
+
+	t.Run("Named SQL DB", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("sql_databases", []any{
+			map[string]any{"name": "orders", "sql_type": "sqlite", "sql_path": filepath.Join(t.TempDir(), "orders.db")},
+		})
+		cfg.Set("kvstores", []any{
+			map[string]any{"name": "state", "kvstore_type": "sql", "kvstore_sql_database": "orders", "kvstore_sql_table": "state"},
+		})
+		srv := New(cfg)
+
+		var err error
+		srv.dbs, err = srv.openSQLDatabases()
+		if err != nil {
+			t.Fatalf("Unexpected error opening SQL databases - %s", err)
+		}
+		defer srv.dbs["orders"].Close()
+
+		kvs, err := srv.openKVStores()
+		if err != nil {
+			t.Fatalf("Unexpected error opening KV stores - %s", err)
+		}
+		defer kvs["state"].Close()
+
+		err = kvs["state"].Set("key", []byte("data"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+		data, err := kvs["state"].Get("key")
+		if err != nil || string(data) != "data" {
+			t.Errorf("Unexpected value fetched - %q, %v", data, err)
+		}
+
+		err = kvs["state"].HealthCheck()
+		if err != nil {
+			t.Errorf("Unexpected error checking health - %s", err)
+		}
+	})
+
+	t.Run("No SQL DB", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("kvstore_type", "sql")
+
+		_, err := New(cfg).openKV("", cfg)
+		if err == nil {
+			t.Errorf("Expected error opening sql KV store without a SQL DB")
+		}
+	})
+}
@@ -0,0 +1,232 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/spf13/viper"
+
+	"github.com/tarmac-project/tarmac/pkg/config"
+	"github.com/tarmac-project/tarmac/pkg/tlsconfig"
+)
+
+// connectNATS establishes the NATS connection used by nats routes. The connection is created on first use and shared
+// by all nats routes.
+func (srv *Server) connectNATS() (*natsgo.Conn, error) {
+	if srv.nc != nil {
+		return srv.nc, nil
+	}
+
+	nc, err := dialNATS(srv.cfg)
+	if err != nil {
+		return nil, err
+	}
+	srv.nc = nc
+	return nc, nil
+}
+
+// dialNATS connects to the NATS servers of nats_url and nats_servers.
+func dialNATS(cfg *viper.Viper) (*natsgo.Conn, error) {
+	servers := []string{cfg.GetString("nats_url")}
+	servers = append(servers, cfg.GetStringSlice("nats_servers")...)
+
+	opts := []natsgo.Option{natsgo.Name("tarmac")}
+	if cfg.GetBool("nats_skip_tls_verify") {
+		tlsCfg := tlsconfig.New()
+		tlsCfg.IgnoreHostValidation()
+		opts = append(opts, natsgo.Secure(tlsCfg.Generate()))
+	}
+
+	nc, err := natsgo.Connect(strings.Join(servers, ","), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not establish nats connection - %w", err)
+	}
+	return nc, nil
+}
+
+// subscribeNATS subscribes the route function to the route Topic. Core NATS subscriptions reply to requests with the
+// function output, while JetStream subscriptions acknowledge messages once the function succeeds. Subscriptions are
+// drained when the services are closed.
+func (srv *Server) subscribeNATS(s *services, route config.Route) error {
+	nc, err := srv.connectNATS()
+	if err != nil {
+		return err
+	}
+
+	if route.JetStream != nil {
+		return srv.consumeJetStream(s, nc, route)
+	}
+
+	sub, err := nc.QueueSubscribe(route.Topic, route.Queue, srv.natsHandler(s, route))
+	if err != nil {
+		return fmt.Errorf("could not subscribe to nats subject %s - %w", route.Topic, err)
+	}
+	s.subs = append(s.subs, sub)
+
+	// Ensure the subscription is registered with the server before continuing
+	err = nc.Flush()
+	if err != nil {
+		return fmt.Errorf("could not register nats subscription %s - %w", route.Topic, err)
+	}
+	return nil
+}
+
+// natsWorkers returns the number of messages of the route processed concurrently. This is the pool size of the route
+// function, so each message in progress holds an instance of the function.
+func natsWorkers(s *services, route config.Route) int {
+	if s.cfg != nil {
+		f, err := s.cfg.LookupFunction(route.Function)
+		if err == nil && f.PoolSize > 0 {
+			return f.PoolSize
+		}
+	}
+	return config.DefaultPoolSize
+}
+
+// dispatcher returns a function executing fn on a new goroutine, with at most workers goroutines running at once. Once
+// every worker is busy, it blocks until one completes, so messages are not received faster than they are processed.
+func dispatcher(workers int) func(fn func()) {
+	sem := make(chan struct{}, workers)
+	return func(fn func()) {
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem }()
+			fn()
+		}()
+	}
+}
+
+// natsHandler returns a NATS message handler that executes the route function with the message data once the
+// services are activated, processing up to the function pool size concurrently. When the message is a request, the
+// function output is sent as the reply. Failures are returned to the requester using the NATS service error headers.
+func (srv *Server) natsHandler(s *services, route config.Route) natsgo.MsgHandler {
+	dispatch := dispatcher(natsWorkers(s, route))
+	return func(msg *natsgo.Msg) {
+		dispatch(func() {
+			if s.wait() {
+				srv.replyNATS(route, msg)
+			}
+		})
+	}
+}
+
+// replyNATS executes the route function with the message data, sending the function output as the reply when the
+// message is a request.
+func (srv *Server) replyNATS(route config.Route, msg *natsgo.Msg) {
+	rsp, err := srv.runNATS(route, msg.Subject, msg.Data)
+	if msg.Reply == "" {
+		return
+	}
+
+	reply := natsgo.NewMsg(msg.Reply)
+	reply.Data = rsp
+	if err != nil {
+		code := 500
+		if errors.Is(err, context.DeadlineExceeded) {
+			code = 504
+		}
+		reply.Header.Set(micro.ErrorHeader, err.Error())
+		reply.Header.Set(micro.ErrorCodeHeader, strconv.Itoa(code))
+	}
+
+	err = msg.RespondMsg(reply)
+	if err != nil {
+		srv.log.Error("Unable to reply to nats request: "+err.Error(),
+			"function", route.Function,
+			"subject", msg.Subject,
+			"error", err)
+	}
+}
+
+// consumeJetStream creates or updates the durable consumer defined by the route and consumes its messages, processing
+// up to the function pool size concurrently. Messages are acknowledged when the function succeeds and negatively
+// acknowledged, triggering redelivery, when it fails.
+func (srv *Server) consumeJetStream(s *services, nc *natsgo.Conn, route config.Route) error {
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return fmt.Errorf("could not create jetstream context - %w", err)
+	}
+
+	durable := route.JetStream.Durable
+	if durable == "" {
+		durable = route.Function
+	}
+
+	cCfg := jetstream.ConsumerConfig{
+		Durable:       durable,
+		FilterSubject: route.Topic,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       time.Duration(route.JetStream.AckWait) * time.Second,
+		MaxDeliver:    route.JetStream.MaxDeliver,
+	}
+	if cCfg.MaxDeliver == 0 {
+		cCfg.MaxDeliver = -1
+	}
+
+	consumer, err := js.CreateOrUpdateConsumer(s.ctx, route.JetStream.Stream, cCfg)
+	if err != nil {
+		return fmt.Errorf("could not create jetstream consumer %s on stream %s - %w", durable,
+			route.JetStream.Stream, err)
+	}
+
+	nakDelay := time.Duration(route.JetStream.NakDelay) * time.Second
+	dispatch := dispatcher(natsWorkers(s, route))
+	cc, err := consumer.Consume(func(msg jetstream.Msg) {
+		dispatch(func() {
+			// Messages received by services which are never activated are redelivered once the ack wait expires
+			if !s.wait() {
+				return
+			}
+			_, err := srv.runNATS(route, msg.Subject(), msg.Data())
+			if err != nil {
+				if nakDelay > 0 {
+					err = msg.NakWithDelay(nakDelay)
+				} else {
+					err = msg.Nak()
+				}
+			} else {
+				err = msg.Ack()
+			}
+			if err != nil {
+				srv.log.Error("Unable to acknowledge jetstream message: "+err.Error(),
+					"function", route.Function,
+					"subject", msg.Subject(),
+					"error", err)
+			}
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("could not consume jetstream consumer %s - %w", durable, err)
+	}
+	s.consumers = append(s.consumers, cc)
+	return nil
+}
+
+// runNATS executes the route function with the message data and records the message metrics.
+func (srv *Server) runNATS(route config.Route, subject string, data []byte) ([]byte, error) {
+	now := time.Now()
+	defer func() {
+		srv.stats.Messages.WithLabelValues(route.Topic).Observe(float64(time.Since(now).Milliseconds()))
+	}()
+
+	srv.log.Log(context.Background(), LevelTrace, "Executing NATS Message", "function", route.Function,
+		"subject", subject)
+	ctx, cancel := routeContext(srv.runCtx, route)
+	defer cancel()
+	rsp, err := srv.runWASM(ctx, route.Function, "handler", data)
+	if err != nil {
+		srv.log.Error("Error executing function for nats message: "+err.Error(),
+			"function", route.Function,
+			"subject", subject,
+			"error", err)
+		return rsp, err
+	}
+	return rsp, nil
+}
@@ -0,0 +1,322 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/spf13/viper"
+
+	"github.com/tarmac-project/tarmac/pkg/config"
+	"github.com/tarmac-project/tarmac/pkg/telemetry"
+	"github.com/tarmac-project/tarmac/pkg/wasm"
+)
+
+// echoModule is a waPC guest whose __guest_call export returns the request payload, or fails when the payload is
+// empty.
+var echoModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// Types: (i32, i32) -> i32 and (i32, i32) -> ()
+	0x01, 0x0c, 0x02,
+	0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f,
+	0x60, 0x02, 0x7f, 0x7f, 0x00,
+	// Imports: wapc.__guest_request and wapc.__guest_response
+	0x02, 0x30, 0x02,
+	0x04, 'w', 'a', 'p', 'c',
+	0x0f, '_', '_', 'g', 'u', 'e', 's', 't', '_', 'r', 'e', 'q', 'u', 'e', 's', 't', 0x00, 0x01,
+	0x04, 'w', 'a', 'p', 'c',
+	0x10, '_', '_', 'g', 'u', 'e', 's', 't', '_', 'r', 'e', 's', 'p', 'o', 'n', 's', 'e', 0x00, 0x01,
+	// Function
+	0x03, 0x02, 0x01, 0x00,
+	// Memory: 1 page
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	// Exports: __guest_call and memory
+	0x07, 0x19, 0x02,
+	0x0c, '_', '_', 'g', 'u', 'e', 's', 't', '_', 'c', 'a', 'l', 'l', 0x00, 0x02,
+	0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+	// Code: if payload is empty return 0; __guest_request(0, 1024); __guest_response(1024, len); return 1
+	0x0a, 0x1d, 0x01, 0x1b, 0x00,
+	0x20, 0x01, 0x45, 0x04, 0x40, 0x41, 0x00, 0x0f, 0x0b,
+	0x41, 0x00, 0x41, 0x80, 0x08, 0x10, 0x00,
+	0x41, 0x80, 0x08, 0x20, 0x01, 0x10, 0x01,
+	0x41, 0x01, 0x0b,
+}
+
+func TestNATSRoutes(t *testing.T) {
+	ns, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("Unable to create nats server - %s", err)
+	}
+	go ns.Start()
+	defer ns.Shutdown()
+	if !ns.ReadyForConnections(10 * time.Second) {
+		t.Fatalf("NATS server not ready for connections")
+	}
+
+	cfg := viper.New()
+	cfg.Set("nats_url", ns.ClientURL())
+
+	srv := &Server{cfg: cfg, log: slog.New(slog.DiscardHandler), stats: telemetry.New()}
+	defer srv.stats.Close()
+	srv.runCtx, srv.runCancel = context.WithCancel(context.Background())
+	defer srv.runCancel()
+
+	srv.engine, err = wasm.NewServer(wasm.Config{
+		Callback: func(context.Context, string, string, string, []byte) ([]byte, error) { return []byte(""), nil },
+	})
+	if err != nil {
+		t.Fatalf("Unable to create wasm engine - %s", err)
+	}
+	defer srv.engine.Shutdown()
+
+	fp := filepath.Join(t.TempDir(), "echo.wasm")
+	err = os.WriteFile(fp, echoModule, 0600)
+	if err != nil {
+		t.Fatalf("Unable to write module - %s", err)
+	}
+	err = srv.engine.LoadModule(wasm.ModuleConfig{Name: "echo", Filepath: fp, PoolSize: 2})
+	if err != nil {
+		t.Fatalf("Unable to load module - %s", err)
+	}
+
+	nc, err := srv.connectNATS()
+	if err != nil {
+		t.Fatalf("Unable to connect to nats server - %s", err)
+	}
+	defer nc.Close()
+
+	svcs := newServices(srv.runCtx)
+	defer svcs.close(nil)
+	close(svcs.ready)
+
+	client, err := natsgo.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("Unable to connect to nats server - %s", err)
+	}
+	defer client.Close()
+
+	t.Run("Request Reply", func(t *testing.T) {
+		err := srv.subscribeNATS(svcs, config.Route{Type: RouteTypeNATS, Topic: "echo", Function: "echo"})
+		if err != nil {
+			t.Fatalf("Unexpected error subscribing - %s", err)
+		}
+
+		msg, err := client.Request("echo", []byte("Hello"), 5*time.Second)
+		if err != nil {
+			t.Fatalf("Unexpected error sending request - %s", err)
+		}
+
+		if string(msg.Data) != "Hello" {
+			t.Errorf("Unexpected reply - %s", msg.Data)
+		}
+
+		if msg.Header.Get(micro.ErrorHeader) != "" {
+			t.Errorf("Unexpected error header - %s", msg.Header.Get(micro.ErrorHeader))
+		}
+	})
+
+	t.Run("Request Failure", func(t *testing.T) {
+		msg, err := client.Request("echo", []byte(""), 5*time.Second)
+		if err != nil {
+			t.Fatalf("Unexpected error sending request - %s", err)
+		}
+
+		if msg.Header.Get(micro.ErrorHeader) == "" || msg.Header.Get(micro.ErrorCodeHeader) != "500" {
+			t.Errorf("Unexpected error headers - %+v", msg.Header)
+		}
+	})
+
+	t.Run("Queue Group", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			route := config.Route{Type: RouteTypeNATS, Topic: "queued", Queue: "workers", Function: "echo"}
+			err := srv.subscribeNATS(svcs, route)
+			if err != nil {
+				t.Fatalf("Unexpected error subscribing - %s", err)
+			}
+		}
+
+		inbox := client.NewRespInbox()
+		sub, err := client.SubscribeSync(inbox)
+		if err != nil {
+			t.Fatalf("Unexpected error subscribing to inbox - %s", err)
+		}
+		defer sub.Unsubscribe()
+
+		err = client.PublishRequest("queued", inbox, []byte("Hello"))
+		if err != nil {
+			t.Fatalf("Unexpected error publishing request - %s", err)
+		}
+
+		_, err = sub.NextMsg(5 * time.Second)
+		if err != nil {
+			t.Fatalf("Unexpected error waiting for reply - %s", err)
+		}
+
+		// Only one member of the queue group should process the message
+		_, err = sub.NextMsg(250 * time.Millisecond)
+		if err == nil {
+			t.Errorf("Unexpected second reply from queue group")
+		}
+	})
+
+	t.Run("JetStream", func(t *testing.T) {
+		js, err := jetstream.New(client)
+		if err != nil {
+			t.Fatalf("Unable to create jetstream context - %s", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		stream, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}})
+		if err != nil {
+			t.Fatalf("Unable to create stream - %s", err)
+		}
+
+		err = srv.subscribeNATS(svcs, config.Route{
+			Type:      RouteTypeNATS,
+			Topic:     "orders.>",
+			Function:  "echo",
+			JetStream: &config.JetStream{Stream: "ORDERS", AckWait: 5, MaxDeliver: 3},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error subscribing - %s", err)
+		}
+
+		// waitFor polls the consumer until the condition is met
+		waitFor := func(cond func(*jetstream.ConsumerInfo) bool) *jetstream.ConsumerInfo {
+			var info *jetstream.ConsumerInfo
+			for ctx.Err() == nil {
+				consumer, err := stream.Consumer(ctx, "echo")
+				if err != nil {
+					t.Fatalf("Unable to lookup consumer - %s", err)
+				}
+				info = consumer.CachedInfo()
+				if cond(info) {
+					return info
+				}
+				<-time.After(50 * time.Millisecond)
+			}
+			t.Fatalf("Timeout waiting for consumer - %+v", info)
+			return info
+		}
+
+		t.Run("Ack on Success", func(t *testing.T) {
+			_, err := js.Publish(ctx, "orders.1", []byte("Hello"))
+			if err != nil {
+				t.Fatalf("Unexpected error publishing - %s", err)
+			}
+
+			waitFor(func(info *jetstream.ConsumerInfo) bool {
+				return info.AckFloor.Stream == 1 && info.NumAckPending == 0
+			})
+		})
+
+		t.Run("Redeliver on Failure", func(t *testing.T) {
+			_, err := js.Publish(ctx, "orders.2", []byte(""))
+			if err != nil {
+				t.Fatalf("Unexpected error publishing - %s", err)
+			}
+
+			// The first message is delivered once, the failing message up to max_deliver times
+			info := waitFor(func(info *jetstream.ConsumerInfo) bool {
+				return info.Delivered.Consumer >= 4
+			})
+			if info.Delivered.Consumer != 4 {
+				t.Errorf("Unexpected number of deliveries - %d", info.Delivered.Consumer)
+			}
+		})
+	})
+}
+
+func TestNATSDispatcher(t *testing.T) {
+	dispatch := dispatcher(2)
+
+	var running, peak atomic.Int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		for range 4 {
+			wg.Add(1)
+			dispatch(func() {
+				defer wg.Done()
+				n := running.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				<-release
+				running.Add(-1)
+			})
+		}
+	}()
+
+	// Dispatching blocks once every worker is busy
+	select {
+	case <-dispatched:
+		t.Fatalf("Expected dispatch to block while workers are busy")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	<-dispatched
+	wg.Wait()
+	if peak.Load() != 2 {
+		t.Errorf("Unexpected number of concurrent workers - %d", peak.Load())
+	}
+}
+
+func TestNATSWorkers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tarmac.json")
+	err := os.WriteFile(path, []byte(`{"services": {"svc": {"name": "svc", "functions": {
+		"sized": {"filepath": "sized.wasm", "pool_size": 5},
+		"default": {"filepath": "default.wasm"}
+	}}}}`), 0600)
+	if err != nil {
+		t.Fatalf("Unable to write config - %s", err)
+	}
+	cfg, err := config.Parse(path)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing config - %s", err)
+	}
+
+	cases := []struct {
+		name     string
+		s        *services
+		function string
+		workers  int
+	}{
+		{"Function Pool Size", &services{cfg: cfg}, "sized", 5},
+		{"Unset Pool Size", &services{cfg: cfg}, "default", config.DefaultPoolSize},
+		{"Unknown Function", &services{cfg: cfg}, "missing", config.DefaultPoolSize},
+		{"No Config", &services{}, "sized", config.DefaultPoolSize},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := natsWorkers(tc.s, config.Route{Function: tc.function})
+			if n != tc.workers {
+				t.Errorf("Unexpected number of workers - %d, expected %d", n, tc.workers)
+			}
+		})
+	}
+}
@@ -0,0 +1,534 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/julienschmidt/httprouter"
+	"github.com/madflojo/tasks"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/tarmac-project/tarmac/pkg/config"
+	"github.com/tarmac-project/tarmac/pkg/wasm"
+)
+
+// reloadDebounce is the time waited after a file change before reloading, allowing files to be fully written.
+var reloadDebounce = time.Second
+
+// services holds the functions and routes loaded from the service configuration. Every reload builds a new set of
+// services, which replaces the active set once fully loaded. The replaced set is then closed.
+type services struct {
+	// cfg is the multi-function service configuration.
+	cfg *config.Config
+
+	// router is the HTTP router of the http routes.
+	router *httprouter.Router
+
+	// scheduler executes the scheduled_task routes.
+	scheduler *tasks.Scheduler
+
+	// ctx is canceled once the services are closed.
+	ctx context.Context
+
+	// cancel cancels ctx.
+	cancel context.CancelFunc
+
+	// ready is closed once the services are activated.
+	ready chan struct{}
+
+	// subs are the core NATS subscriptions of the nats routes.
+	subs []*natsgo.Subscription
+
+	// consumers are the JetStream consumers of the nats routes.
+	consumers []jetstream.ConsumeContext
+
+	// campaigns are the leader election campaigns of singleton scheduled tasks, keyed by function.
+	campaigns map[string]*campaign
+
+	// modules are the names of the loaded WASM modules.
+	modules []string
+
+	// staged are the loaded WASM modules, which replace the active modules of the same name once the services are
+	// activated.
+	staged *wasm.StagedModules
+
+	// functions are the names of the functions registered for function to function calls.
+	functions []string
+
+	// initRoutes are the init routes executed once the services are active.
+	initRoutes []config.Route
+
+	// routes counts the loaded routes by service and route type.
+	routes map[routeKey]int
+}
+
+// routeKey identifies the routes of a service by route type.
+type routeKey struct {
+	service   string
+	routeType string
+}
+
+// newServices creates an empty set of services. The services are closed when ctx is canceled.
+func newServices(ctx context.Context) *services {
+	s := &services{
+		cfg:       &config.Config{},
+		router:    httprouter.New(),
+		scheduler: tasks.New(),
+		campaigns: make(map[string]*campaign),
+		routes:    make(map[routeKey]int),
+		ready:     make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	return s
+}
+
+// wait blocks until the services are activated, returning false if they are closed first. Subscriptions receive
+// messages as soon as they are registered, so handlers wait for the functions they execute to be activated.
+func (s *services) wait() bool {
+	select {
+	case <-s.ready:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// close stops the scheduled tasks and drains the NATS subscriptions of the services, allowing in-flight messages to
+// complete. Leader election campaigns which have been carried over to next are left running.
+func (s *services) close(next *services) {
+	s.cancel()
+	s.scheduler.Stop()
+
+	for _, sub := range s.subs {
+		_ = sub.Drain()
+	}
+	for _, c := range s.consumers {
+		c.Drain()
+	}
+
+	for name, c := range s.campaigns {
+		if next == nil || next.campaigns[name] != c {
+			c.cancel()
+		}
+	}
+}
+
+// funcConfig returns the service configuration of the active services.
+func (srv *Server) funcConfig() *config.Config {
+	if s := srv.services.Load(); s != nil {
+		return s.cfg
+	}
+	return &config.Config{}
+}
+
+// serviceHandler routes HTTP requests to the http routes of the active services.
+func (srv *Server) serviceHandler(w http.ResponseWriter, r *http.Request) {
+	s := srv.services.Load()
+	if s == nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.router.ServeHTTP(w, r)
+}
+
+// Reload loads the WASM functions and service configuration again, replacing the active functions and routes without
+// restarting the server. Executions in progress complete on the functions they started with. When the new
+// configuration fails to load, the active routes remain in place.
+func (srv *Server) Reload() error {
+	srv.reloadMu.Lock()
+	defer srv.reloadMu.Unlock()
+
+	srv.log.Info("Reloading Services", "config_path", srv.cfg.GetString("wasm_function_config"))
+	next, err := srv.loadServices()
+	if err != nil {
+		srv.stats.Reloads.WithLabelValues("failure").Inc()
+		return fmt.Errorf("could not reload services - %w", err)
+	}
+	srv.activate(next)
+
+	err = srv.runInit(next)
+	if err != nil {
+		srv.stats.Reloads.WithLabelValues("failure").Inc()
+		return err
+	}
+
+	srv.stats.Reloads.WithLabelValues("success").Inc()
+	return nil
+}
+
+// loadServices loads the functions and routes defined within the wasm_function_config. Services are not active until
+// passed to activate.
+func (srv *Server) loadServices() (*services, error) {
+	next := newServices(srv.runCtx)
+	err := srv.registerServices(next)
+	if err != nil {
+		// The staged modules never replaced the active modules, so the active routes keep executing them
+		next.staged.Close()
+		next.modules = nil
+		srv.release(next, srv.services.Load())
+		return nil, err
+	}
+
+	// Log information about loaded functions and routes
+	counter := make(map[string]int)
+	for k, v := range next.routes {
+		counter[k.routeType] += v
+	}
+	srv.log.Info("Loaded Functions and Routes",
+		"init", counter[RouteTypeInit],
+		"http", counter[RouteTypeHTTP],
+		"scheduled_task", counter[RouteTypeScheduledTask],
+		"function", counter[RouteTypeFunction],
+		"nats", counter[RouteTypeNATS])
+
+	return next, nil
+}
+
+// registerServices loads the functions and registers the routes of the wasm_function_config with the given services.
+// When no configuration can be found on the initial load, the default function is loaded instead.
+func (srv *Server) registerServices(s *services) error {
+	var err error
+	prev := srv.services.Load()
+
+	// Look for Functions Config
+	s.cfg, err = config.Parse(srv.cfg.GetString("wasm_function_config"))
+	if err != nil && prev != nil && len(prev.cfg.Services) > 0 {
+		return fmt.Errorf("could not load wasm_function_config - %w", err)
+	}
+	if err != nil {
+		srv.log.Info("Could not load wasm_function_config starting with default function path",
+			"config_path", srv.cfg.GetString("wasm_function_config"),
+			"error", err)
+
+		// Validate the HTTP envelope format for the default function
+		switch srv.cfg.GetString("wasm_http_envelope") {
+		case "", HTTPEnvelopeProto, HTTPEnvelopeJSON:
+		default:
+			return fmt.Errorf("unknown wasm_http_envelope specified - %s", srv.cfg.GetString("wasm_http_envelope"))
+		}
+
+		// Load WASM Function using default path
+		s.staged, err = srv.engine.PrepareModules(wasm.ModuleConfig{
+			Name:           "default",
+			Filepath:       srv.cfg.GetString("wasm_function"),
+			PoolSize:       srv.cfg.GetInt("wasm_pool_size"),
+			MaxMemoryPages: srv.cfg.GetUint32("wasm_max_memory_pages"),
+		})
+		if err != nil {
+			return fmt.Errorf(
+				"could not load default function path for wasm_function (%s) - %w",
+				srv.cfg.GetString("wasm_function"),
+				err,
+			)
+		}
+		s.modules = append(s.modules, "default")
+
+		// Register WASM Handler with default path
+		s.router.GET("/", srv.middleware(srv.WASMHandler))
+		s.router.POST("/", srv.middleware(srv.WASMHandler))
+		s.router.PUT("/", srv.middleware(srv.WASMHandler))
+		s.router.DELETE("/", srv.middleware(srv.WASMHandler))
+		s.router.HEAD("/", srv.middleware(srv.WASMHandler))
+
+		// Measure Routes
+		s.routes[routeKey{"default", RouteTypeHTTP}]++
+		return nil
+	}
+
+	srv.log.Info(
+		"Loading Services from wasm_function_config",
+		"config_path",
+		srv.cfg.GetString("wasm_function_config"),
+	)
+
+	// Load WASM Functions, replacing the existing functions only once the services are activated
+	var modules []wasm.ModuleConfig
+	for svcName, svcCfg := range s.cfg.Services {
+		srv.log.Info("Loading Functions from Service", "service", svcName)
+		for fName, fCfg := range svcCfg.Functions {
+			err = srv.checkDataSources(fName, fCfg)
+			if err != nil {
+				return fmt.Errorf("could not load functions - %w", err)
+			}
+			modules = append(modules, wasm.ModuleConfig{
+				Name:           fName,
+				Filepath:       fCfg.Filepath,
+				PoolSize:       fCfg.PoolSize,
+				MaxMemoryPages: fCfg.MaxMemoryPages,
+			})
+			s.modules = append(s.modules, fName)
+		}
+	}
+	s.staged, err = srv.engine.PrepareModules(modules...)
+	if err != nil {
+		return fmt.Errorf("could not load functions - %w", err)
+	}
+	for svcName, svcCfg := range s.cfg.Services {
+		for fName, fCfg := range svcCfg.Functions {
+			srv.log.Info("Loaded Function for Service",
+				"function", fName,
+				"service", svcName,
+				"filepath", fCfg.Filepath)
+		}
+	}
+
+	for svcName, svcCfg := range s.cfg.Services {
+		// Register Routes
+		srv.log.Info("Registering Routes from Service",
+			"service", svcName)
+		for _, r := range svcCfg.Routes {
+			switch r.Type {
+			case RouteTypeInit:
+				// Copy init functions for later execution
+				s.initRoutes = append(s.initRoutes, r)
+				s.routes[routeKey{svcName, r.Type}]++
+
+			case RouteTypeHTTP:
+				// Register HTTP based functions with the HTTP router
+				for _, m := range r.Methods {
+					key := fmt.Sprintf("%s:%s:%s", r.Type, m, r.Path)
+					srv.log.Info("Registering Route for function",
+						"function", r.Function,
+						"method", m,
+						"path", r.Path,
+						"function_type", r.Type,
+						"service", svcName,
+						"route_key", key)
+					err := srv.registerHTTPRoute(s.router, m, r)
+					if err != nil {
+						return fmt.Errorf("could not register route %s for function %s - %w", key, r.Function, err)
+					}
+					s.routes[routeKey{svcName, r.Type}]++
+				}
+
+			case RouteTypeScheduledTask:
+				// Schedule tasks for scheduled functions
+				srv.log.Info("Scheduling custom task for function",
+					"function", r.Function,
+					"interval", r.Frequency,
+					"cron", r.Cron,
+					"time_zone", r.TimeZone,
+					"at", r.At)
+				err := srv.scheduleTask(s, r)
+				if err != nil {
+					srv.log.Error(
+						"Error scheduling scheduled task: "+err.Error(),
+						"function",
+						r.Function,
+						"error",
+						err,
+					)
+				}
+				s.routes[routeKey{svcName, r.Type}]++
+
+			case RouteTypeFunction:
+				// Setup callbacks for function to function calls
+				srv.log.Info("Registering Function to Function callback", "function", r.Function)
+				fname := r.Function
+				// Function calls inherit the context, and therefore the deadline, of the calling function
+				f := func(ctx context.Context, b []byte) ([]byte, error) {
+					srv.log.Info("Executing Function to Function callback", "function", fname)
+					return srv.runWASM(ctx, fname, "handler", b)
+				}
+				if srv.callbacks != nil {
+					srv.callbacks.RegisterCallbackContext("function", fname, f)
+				}
+				s.functions = append(s.functions, fname)
+				s.routes[routeKey{svcName, r.Type}]++
+
+			case RouteTypeNATS:
+				// Subscribe functions to NATS subjects
+				srv.log.Info("Subscribing function to NATS subject",
+					"function", r.Function,
+					"subject", r.Topic,
+					"queue", r.Queue,
+					"jetstream", r.JetStream != nil,
+					"service", svcName)
+				err := srv.subscribeNATS(s, r)
+				if err != nil {
+					return fmt.Errorf("could not subscribe function %s to %s - %w", r.Function, r.Topic, err)
+				}
+				s.routes[routeKey{svcName, r.Type}]++
+			}
+		}
+	}
+
+	return nil
+}
+
+// activate replaces the active functions and services with those of next and releases the previous services. Route
+// metrics are updated to reflect the newly active routes.
+func (srv *Server) activate(next *services) {
+	srv.engine.ActivateModules(next.staged)
+	prev := srv.services.Swap(next)
+	close(next.ready)
+
+	srv.stats.Routes.Reset()
+	for k, v := range next.routes {
+		srv.stats.Routes.WithLabelValues(k.service, k.routeType).Set(float64(v))
+	}
+
+	if prev != nil {
+		srv.release(prev, next)
+	}
+}
+
+// release closes the services and unloads any functions or function to function callbacks not used by keep.
+func (srv *Server) release(s, keep *services) {
+	s.close(keep)
+	if keep == nil {
+		keep = &services{}
+	}
+
+	for _, m := range s.modules {
+		if !slices.Contains(keep.modules, m) {
+			srv.engine.UnloadModule(m)
+		}
+	}
+
+	for _, f := range s.functions {
+		if !slices.Contains(keep.functions, f) && srv.callbacks != nil {
+			srv.callbacks.DelCallback("function", f)
+		}
+	}
+}
+
+// runInit executes the init routes of the services, retrying failed executions up to the route Retries.
+func (srv *Server) runInit(s *services) error {
+	for _, r := range s.initRoutes {
+		srv.log.Info("Executing Init Function", "function", r.Function)
+		var success, retries int
+		delay := r.Frequency
+		for success == 0 && retries <= r.Retries {
+			// Execute the function
+			ctx, cancel := routeContext(srv.runCtx, r)
+			_, err := srv.runWASM(ctx, r.Function, "handler", []byte(""))
+			cancel()
+			if err != nil {
+				srv.log.Error("Error executing Init Function: "+err.Error(),
+					"function", r.Function,
+					"error", err)
+				retries++
+				// Wait exponentially longer between retries
+				<-time.After(time.Duration(delay) * time.Second)
+				delay *= delay
+				continue
+			}
+			success = 1
+		}
+		if success == 0 {
+			return fmt.Errorf("init function %s exceeded retries", r.Function)
+		}
+	}
+	return nil
+}
+
+// watchReload reloads the services whenever a SIGHUP is received. When enable_hot_reload is set, the services are
+// also reloaded once the wasm_function_config or any function file changes.
+func (srv *Server) watchReload() {
+	trap := make(chan os.Signal, 1)
+	signal.Notify(trap, syscall.SIGHUP)
+	defer signal.Stop(trap)
+
+	var watcher *fsnotify.Watcher
+	if srv.cfg.GetBool("enable_hot_reload") {
+		var err error
+		watcher, err = fsnotify.NewWatcher()
+		if err != nil {
+			srv.log.Error("Unable to watch function files for changes: "+err.Error(), "error", err)
+		} else {
+			defer watcher.Close()
+		}
+	}
+
+	watched := srv.watchFiles(watcher)
+	var debounce <-chan time.Time
+	for {
+		var events <-chan fsnotify.Event
+		var errs <-chan error
+		if watcher != nil {
+			events, errs = watcher.Events, watcher.Errors
+		}
+
+		select {
+		case <-srv.runCtx.Done():
+			return
+
+		case s := <-trap:
+			srv.log.Info("Received reload signal", "signal", s)
+			srv.reload()
+			watched = srv.watchFiles(watcher)
+
+		case e := <-events:
+			// Kubernetes updates mounted files by swapping a hidden ..data directory
+			if watched[e.Name] || strings.HasPrefix(filepath.Base(e.Name), "..") {
+				srv.log.Debug("Detected change to watched file", "file", e.Name, "operation", e.Op.String())
+				debounce = time.After(reloadDebounce)
+			}
+
+		case err := <-errs:
+			srv.log.Warn("Error watching function files for changes: "+err.Error(), "error", err)
+
+		case <-debounce:
+			debounce = nil
+			srv.reload()
+			watched = srv.watchFiles(watcher)
+		}
+	}
+}
+
+// reload reloads the services, logging any failure.
+func (srv *Server) reload() {
+	err := srv.Reload()
+	if err != nil {
+		srv.log.Error("Unable to reload services: "+err.Error(), "error", err)
+	}
+}
+
+// watchFiles adds the directories of the wasm_function_config and function files to the watcher, returning the set
+// of files which trigger a reload when changed. Directories are watched rather than files so that files replaced by
+// editors or deployments continue to be watched.
+func (srv *Server) watchFiles(watcher *fsnotify.Watcher) map[string]bool {
+	watched := make(map[string]bool)
+	if watcher == nil {
+		return watched
+	}
+
+	paths := []string{srv.cfg.GetString("wasm_function_config")}
+	cfg := srv.funcConfig()
+	if len(cfg.Services) == 0 {
+		paths = append(paths, srv.cfg.GetString("wasm_function"))
+	}
+	for _, svc := range cfg.Services {
+		for _, f := range svc.Functions {
+			paths = append(paths, f.Filepath)
+		}
+	}
+
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		p, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		watched[p] = true
+
+		err = watcher.Add(filepath.Dir(p))
+		if err != nil {
+			srv.log.Warn("Unable to watch directory for changes: "+err.Error(), "directory", filepath.Dir(p), "error", err)
+		}
+	}
+	return watched
+}
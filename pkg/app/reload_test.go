@@ -0,0 +1,183 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/spf13/viper"
+
+	"github.com/tarmac-project/tarmac/pkg/telemetry"
+	"github.com/tarmac-project/tarmac/pkg/wasm"
+)
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "echo.wasm")
+	err := os.WriteFile(fp, echoModule, 0600)
+	if err != nil {
+		t.Fatalf("Unable to write module - %s", err)
+	}
+
+	// writeConfig writes a service configuration with the given function serving the given HTTP path
+	configPath := filepath.Join(dir, "tarmac.json")
+	writeConfig := func(function, path string) {
+		err := os.WriteFile(configPath, []byte(fmt.Sprintf(`{"services":{"test":{"name":"test",`+
+			`"functions":{%q:{"filepath":%q}},`+
+			`"routes":[{"type":"http","path":%q,"methods":["POST"],"function":%q}]}}}`, function, fp, path, function)), 0600)
+		if err != nil {
+			t.Fatalf("Unable to write config - %s", err)
+		}
+	}
+
+	cfg := viper.New()
+	cfg.Set("wasm_function_config", configPath)
+
+	srv := &Server{cfg: cfg, log: slog.New(slog.DiscardHandler), stats: telemetry.New()}
+	defer srv.stats.Close()
+	srv.runCtx, srv.runCancel = context.WithCancel(context.Background())
+	defer srv.runCancel()
+
+	srv.engine, err = wasm.NewServer(wasm.Config{
+		Callback: func(context.Context, string, string, string, []byte) ([]byte, error) { return []byte(""), nil },
+	})
+	if err != nil {
+		t.Fatalf("Unable to create wasm engine - %s", err)
+	}
+	defer srv.engine.Shutdown()
+
+	srv.httpRouter = httprouter.New()
+	srv.httpRouter.NotFound = http.HandlerFunc(srv.serviceHandler)
+
+	// request sends a request to the HTTP router returning the status code and body
+	request := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		srv.httpRouter.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader("Hello")))
+		return w.Code, w.Body.String()
+	}
+
+	t.Run("Initial Load", func(t *testing.T) {
+		writeConfig("echo", "/v1")
+		err := srv.Reload()
+		if err != nil {
+			t.Fatalf("Unexpected error loading services - %s", err)
+		}
+
+		code, body := request("/v1")
+		if code != http.StatusOK || body != "Hello" {
+			t.Errorf("Unexpected response - %d %s", code, body)
+		}
+	})
+
+	t.Run("Routes Replaced", func(t *testing.T) {
+		writeConfig("echo", "/v2")
+		err := srv.Reload()
+		if err != nil {
+			t.Fatalf("Unexpected error reloading services - %s", err)
+		}
+
+		if code, _ := request("/v1"); code != http.StatusNotFound {
+			t.Errorf("Unexpected status code for removed route - %d", code)
+		}
+		if code, body := request("/v2"); code != http.StatusOK || body != "Hello" {
+			t.Errorf("Unexpected response for added route - %d %s", code, body)
+		}
+	})
+
+	t.Run("Invalid Config", func(t *testing.T) {
+		err := os.WriteFile(configPath, []byte(`{"services":`), 0600)
+		if err != nil {
+			t.Fatalf("Unable to write config - %s", err)
+		}
+
+		err = srv.Reload()
+		if err == nil {
+			t.Fatalf("Expected error reloading invalid config")
+		}
+
+		if code, body := request("/v2"); code != http.StatusOK || body != "Hello" {
+			t.Errorf("Unexpected response after failed reload - %d %s", code, body)
+		}
+	})
+
+	t.Run("Failed Route Registration", func(t *testing.T) {
+		// Respond with the payload from the second byte onwards
+		changed := bytes.Replace(echoModule, []byte{0x41, 0x80, 0x08, 0x20, 0x01, 0x10, 0x01},
+			[]byte{0x41, 0x81, 0x08, 0x20, 0x01, 0x10, 0x01}, 1)
+		err := os.WriteFile(fp, changed, 0600)
+		if err != nil {
+			t.Fatalf("Unable to write module - %s", err)
+		}
+		defer func() {
+			err := os.WriteFile(fp, echoModule, 0600)
+			if err != nil {
+				t.Fatalf("Unable to restore module - %s", err)
+			}
+		}()
+
+		// The changed function loads, but registering the conflicting routes fails
+		err = os.WriteFile(configPath, []byte(fmt.Sprintf(`{"services":{"test":{"name":"test",`+
+			`"functions":{"echo":{"filepath":%q}},`+
+			`"routes":[{"type":"http","path":"/v2","methods":["POST"],"function":"echo"},`+
+			`{"type":"http","path":"/v2","methods":["POST"],"function":"echo"}]}}}`, fp)), 0600)
+		if err != nil {
+			t.Fatalf("Unable to write config - %s", err)
+		}
+
+		err = srv.Reload()
+		if err == nil {
+			t.Fatalf("Expected error reloading conflicting routes")
+		}
+
+		if code, body := request("/v2"); code != http.StatusOK || body != "Hello" {
+			t.Errorf("Unexpected response from previous function after failed reload - %d %q", code, body)
+		}
+	})
+
+	t.Run("Function Removed", func(t *testing.T) {
+		writeConfig("echo2", "/v2")
+		err := srv.Reload()
+		if err != nil {
+			t.Fatalf("Unexpected error reloading services - %s", err)
+		}
+
+		_, err = srv.engine.Module("echo")
+		if err == nil {
+			t.Errorf("Expected removed function to be unloaded")
+		}
+		if code, body := request("/v2"); code != http.StatusOK || body != "Hello" {
+			t.Errorf("Unexpected response from replaced function - %d %s", code, body)
+		}
+	})
+
+	t.Run("Hot Reload", func(t *testing.T) {
+		reloadDebounce = 10 * time.Millisecond
+		cfg.Set("enable_hot_reload", true)
+		go srv.watchReload()
+
+		// Allow the watcher to start before changing the config
+		<-time.After(250 * time.Millisecond)
+		writeConfig("echo", "/v3")
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			code, _ := request("/v3")
+			if code == http.StatusOK {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Timeout waiting for hot reload, got status code %d", code)
+			}
+			<-time.After(25 * time.Millisecond)
+		}
+	})
+}
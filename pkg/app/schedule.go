@@ -0,0 +1,238 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/madflojo/tasks"
+	"github.com/robfig/cron/v3"
+
+	"github.com/tarmac-project/tarmac/pkg/config"
+	"github.com/tarmac-project/tarmac/pkg/election"
+	"github.com/tarmac-project/tarmac/pkg/kvext"
+)
+
+// campaign is the leader election campaign of a singleton scheduled task. Campaigns are carried over between reloads
+// while the task remains defined, so leadership is retained.
+type campaign struct {
+	// elector campaigns for the task leadership.
+	elector *election.Elector
+
+	// leaseTTL is the lease TTL of the route the campaign was created for.
+	leaseTTL int
+
+	// cancel stops the campaign, releasing any held lease.
+	cancel context.CancelFunc
+}
+
+// scheduleTask schedules the function of a scheduled_task route with the services scheduler. Routes are executed at a
+// fixed interval defined by Frequency, on the schedule of a Cron expression, or once at the time defined by At. Tasks
+// are removed when the services are closed.
+func (srv *Server) scheduleTask(s *services, route config.Route) error {
+	f := srv.taskFunc(route)
+
+	if route.Singleton {
+		var err error
+		f, err = srv.singletonTask(s, route, f)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Tasks execute only once the functions of the services are activated
+	task := f
+	f = func() error {
+		if !s.wait() {
+			return nil
+		}
+		return task()
+	}
+
+	if route.RunOnStart {
+		go func() {
+			_ = f()
+		}()
+	}
+
+	switch {
+	case route.Cron != "":
+		schedule, err := route.Schedule()
+		if err != nil {
+			return fmt.Errorf("could not parse cron %s - %w", route.Cron, err)
+		}
+		return srv.scheduleNext(s, schedule, f)
+
+	case route.At != "":
+		at, err := route.StartAt()
+		if err != nil {
+			return fmt.Errorf("could not parse at %s - %w", route.At, err)
+		}
+
+		// One-shot tasks in the past have already been executed or missed, and are not executed again
+		if !at.After(time.Now()) {
+			srv.log.Warn("Skipping scheduled task with at time in the past",
+				"function", route.Function,
+				"at", at)
+			return nil
+		}
+
+		_, err = s.scheduler.Add(&tasks.Task{
+			Interval: time.Until(at),
+			RunOnce:  true,
+			TaskFunc: f,
+		})
+		return err
+
+	default:
+		_, err := s.scheduler.Add(&tasks.Task{
+			Interval: time.Duration(route.Frequency) * time.Second,
+			TaskFunc: f,
+		})
+		return err
+	}
+}
+
+// scheduleNext adds a one-shot task for the next time of the cron schedule. Each execution schedules the following
+// one before running, so the time of every execution is calculated from the wall-clock within the schedule time zone.
+func (srv *Server) scheduleNext(s *services, schedule cron.Schedule, f func() error) error {
+	interval := time.Until(schedule.Next(time.Now()))
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+
+	_, err := s.scheduler.Add(&tasks.Task{
+		Interval: interval,
+		RunOnce:  true,
+		TaskFunc: func() error {
+			if s.ctx.Err() == nil {
+				err := srv.scheduleNext(s, schedule, f)
+				if err != nil {
+					srv.log.Error("Error scheduling next execution of scheduled task: "+err.Error(), "error", err)
+				}
+			}
+			return f()
+		},
+	})
+	return err
+}
+
+// leaderPrefix prefixes the leadership lease keys of singleton scheduled tasks. Leases are reserved keys, so they
+// cannot be modified by functions through the kvstore callbacks.
+const leaderPrefix = kvext.ReservedPrefix + "leader:"
+
+// leaseKVStore returns whether the kvstore_type acquires leadership leases atomically, and whether those leases are
+// shared by every Tarmac instance. The in-memory, internal, and boltdb KV stores are local to each instance, so each
+// instance holds its own lease. Cassandra is not supported, as hord does not expose its lightweight transactions.
+func leaseKVStore(kvType string) (atomic, shared bool) {
+	switch kvType {
+	case "redis", "nats", "sql":
+		return true, true
+	case "in-memory", "internal", "boltdb":
+		return true, false
+	}
+	return false, false
+}
+
+// singletonTask wraps the task of a singleton scheduled_task route so it is only executed while this instance holds
+// the leadership lease. The lease is campaigned for until the task is no longer defined or the server is stopped.
+func (srv *Server) singletonTask(s *services, route config.Route, f func() error) (func() error, error) {
+	if srv.kv == nil {
+		return nil, fmt.Errorf("singleton scheduled task %s requires enable_kvstore", route.Function)
+	}
+	kvType := srv.cfg.GetString("kvstore_type")
+	atomic, shared := leaseKVStore(kvType)
+	if !atomic {
+		return nil, fmt.Errorf("singleton scheduled task %s requires a redis, nats, or sql kvstore_type to elect a "+
+			"leader across instances, kvstore_type %s is not supported", route.Function, kvType)
+	}
+	if !shared {
+		srv.log.Warn("Singleton scheduled task leases are local to each instance with kvstore_type "+kvType+
+			", every instance will execute the task",
+			"function", route.Function,
+			"kvstore_type", kvType)
+	}
+
+	// Carry over the campaign of the active services so leadership is retained across reloads
+	if active := srv.services.Load(); active != nil {
+		if c, ok := active.campaigns[route.Function]; ok && c.leaseTTL == route.LeaseTTL {
+			s.campaigns[route.Function] = c
+			return srv.leaderTask(route, c.elector, f), nil
+		}
+	}
+
+	node := srv.nodeID()
+	srv.stats.Leaders.WithLabelValues(route.Function, node).Set(0)
+	elector, err := election.New(election.Config{
+		// Bypass any KV store cache, so leases renewed by other nodes are seen immediately
+		KV:  uncached(srv.kv),
+		Key: leaderPrefix + route.Function,
+		ID:  node,
+		TTL: time.Duration(route.LeaseTTL) * time.Second,
+		OnChange: func(leader bool) {
+			srv.log.Info("Scheduled task leadership changed",
+				"function", route.Function,
+				"node", node,
+				"leader", leader)
+			if leader {
+				srv.stats.Leaders.WithLabelValues(route.Function, node).Set(1)
+				return
+			}
+			srv.stats.Leaders.WithLabelValues(route.Function, node).Set(0)
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create leader election for %s - %w", route.Function, err)
+	}
+
+	// Campaign once before scheduling so run_on_start executes on the initial leader
+	err = elector.Acquire()
+	if err != nil {
+		srv.log.Warn("Unable to acquire scheduled task leadership: "+err.Error(),
+			"function", route.Function,
+			"error", err)
+	}
+	ctx, cancel := context.WithCancel(srv.runCtx)
+	go elector.Campaign(ctx)
+	s.campaigns[route.Function] = &campaign{elector: elector, leaseTTL: route.LeaseTTL, cancel: cancel}
+
+	return srv.leaderTask(route, elector, f), nil
+}
+
+// leaderTask returns a task executing f only while elector holds the leadership.
+func (srv *Server) leaderTask(route config.Route, elector *election.Elector, f func() error) func() error {
+	return func() error {
+		if !elector.IsLeader() {
+			srv.log.Log(context.Background(), LevelTrace, "Skipping Scheduled Task on non-leader",
+				"function", route.Function)
+			return nil
+		}
+		return f()
+	}
+}
+
+// nodeID returns the identity of this instance used for leader election, defaulting to the hostname.
+func (srv *Server) nodeID() string {
+	if id := srv.cfg.GetString("node_id"); id != "" {
+		return id
+	}
+	h, err := os.Hostname()
+	if err != nil {
+		return "tarmac"
+	}
+	return h
+}
+
+// taskFunc returns the task executing the function of a scheduled_task route.
+func (srv *Server) taskFunc(route config.Route) func() error {
+	return func() error {
+		now := time.Now()
+		srv.log.Log(context.Background(), LevelTrace, "Executing Scheduled Task", "function", route.Function)
+		ctx, cancel := routeContext(srv.runCtx, route)
+		defer cancel()
+		_, err := srv.runWASM(ctx, route.Function, "handler", []byte(""))
+		srv.stats.Tasks.WithLabelValues(route.Function).Observe(float64(time.Since(now).Milliseconds()))
+		return err
+	}
+}
@@ -0,0 +1,270 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/spf13/viper"
+	"github.com/tarmac-project/hord/drivers/hashmap"
+
+	"github.com/tarmac-project/tarmac/pkg/config"
+	"github.com/tarmac-project/tarmac/pkg/kvext"
+	"github.com/tarmac-project/tarmac/pkg/telemetry"
+	"github.com/tarmac-project/tarmac/pkg/wasm"
+)
+
+func TestScheduleTask(t *testing.T) {
+	srv := &Server{cfg: viper.New(), log: slog.New(slog.DiscardHandler), stats: telemetry.New()}
+	defer srv.stats.Close()
+	srv.runCtx, srv.runCancel = context.WithCancel(context.Background())
+	defer srv.runCancel()
+
+	var err error
+	srv.engine, err = wasm.NewServer(wasm.Config{
+		Callback: func(context.Context, string, string, string, []byte) ([]byte, error) { return []byte(""), nil },
+	})
+	if err != nil {
+		t.Fatalf("Unable to create wasm engine - %s", err)
+	}
+	defer srv.engine.Shutdown()
+
+	// executions returns the number of executions recorded for the function
+	executions := func(function string) uint64 {
+		var m dto.Metric
+		err := srv.stats.Tasks.WithLabelValues(function).(prometheus.Summary).Write(&m)
+		if err != nil {
+			t.Fatalf("Unable to read task metrics - %s", err)
+		}
+		return m.GetSummary().GetSampleCount()
+	}
+
+	// waitFor polls until the function has been executed the expected number of times
+	waitFor := func(function string, count uint64) {
+		deadline := time.Now().Add(5 * time.Second)
+		for executions(function) < count {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timeout waiting for %d executions of %s, got %d", count, function, executions(function))
+			}
+			<-time.After(25 * time.Millisecond)
+		}
+	}
+
+	tt := []struct {
+		name     string
+		route    config.Route
+		tasks    int
+		runOnce  bool
+		interval time.Duration
+	}{
+		{
+			name:     "Frequency",
+			route:    config.Route{Function: "frequency", Frequency: 60},
+			tasks:    1,
+			interval: 60 * time.Second,
+		},
+		{
+			name:     "Cron",
+			route:    config.Route{Function: "cron", Cron: "0 2 * * *", TimeZone: "America/New_York"},
+			tasks:    1,
+			runOnce:  true,
+			interval: 24 * time.Hour,
+		},
+		{
+			name:     "At",
+			route:    config.Route{Function: "at", At: time.Now().Add(time.Hour).Format(time.RFC3339)},
+			tasks:    1,
+			runOnce:  true,
+			interval: time.Hour,
+		},
+		{
+			name:  "At in the Past",
+			route: config.Route{Function: "past", At: "2000-01-02T15:04:05Z"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			svcs := newServices(srv.runCtx)
+			defer svcs.close(nil)
+			close(svcs.ready)
+
+			err := srv.scheduleTask(svcs, tc.route)
+			if err != nil {
+				t.Fatalf("Unexpected error scheduling task - %s", err)
+			}
+
+			scheduled := svcs.scheduler.Tasks()
+			if len(scheduled) != tc.tasks {
+				t.Fatalf("Unexpected number of tasks scheduled - %d", len(scheduled))
+			}
+
+			for _, task := range scheduled {
+				if task.RunOnce != tc.runOnce {
+					t.Errorf("Unexpected run once value - %t", task.RunOnce)
+				}
+				if task.Interval <= 0 || task.Interval > tc.interval {
+					t.Errorf("Unexpected task interval - %s", task.Interval)
+				}
+			}
+		})
+	}
+
+	t.Run("Run on Start", func(t *testing.T) {
+		svcs := newServices(srv.runCtx)
+		defer svcs.close(nil)
+		close(svcs.ready)
+
+		err := srv.scheduleTask(svcs, config.Route{Function: "start", Frequency: 3600, RunOnStart: true})
+		if err != nil {
+			t.Fatalf("Unexpected error scheduling task - %s", err)
+		}
+		waitFor("start", 1)
+	})
+
+	t.Run("Cron Reschedules", func(t *testing.T) {
+		svcs := newServices(srv.runCtx)
+		defer svcs.close(nil)
+		close(svcs.ready)
+
+		err := srv.scheduleTask(svcs, config.Route{Function: "every", Cron: "@every 1s"})
+		if err != nil {
+			t.Fatalf("Unexpected error scheduling task - %s", err)
+		}
+		waitFor("every", 2)
+
+		if len(svcs.scheduler.Tasks()) != 1 {
+			t.Errorf("Unexpected number of tasks scheduled - %d", len(svcs.scheduler.Tasks()))
+		}
+	})
+
+	db, err := hashmap.Dial(hashmap.Config{})
+	if err != nil {
+		t.Fatalf("Unable to create kv - %s", err)
+	}
+	err = db.Setup()
+	if err != nil {
+		t.Fatalf("Unable to setup kv - %s", err)
+	}
+	kv, err := kvext.NewLocker(kvext.LockerConfig{KV: db})
+	if err != nil {
+		t.Fatalf("Unable to create locker - %s", err)
+	}
+
+	t.Run("Singleton", func(t *testing.T) {
+		srv.kv = kv
+		srv.cfg.Set("kvstore_type", "in-memory")
+		srv.cfg.Set("node_id", "node-a")
+		svcs := newServices(srv.runCtx)
+		defer svcs.close(nil)
+		close(svcs.ready)
+
+		// Create a second instance sharing the kvstore
+		cfg := viper.New()
+		cfg.Set("kvstore_type", "in-memory")
+		cfg.Set("node_id", "node-b")
+		other := &Server{cfg: cfg, log: srv.log, stats: srv.stats, engine: srv.engine, kv: kv}
+		other.runCtx, other.runCancel = context.WithCancel(context.Background())
+		defer other.runCancel()
+		otherSvcs := newServices(other.runCtx)
+		defer otherSvcs.close(nil)
+		close(otherSvcs.ready)
+
+		route := config.Route{Function: "singleton", Frequency: 3600, RunOnStart: true, Singleton: true, LeaseTTL: 15}
+		err = srv.scheduleTask(svcs, route)
+		if err != nil {
+			t.Fatalf("Unexpected error scheduling task - %s", err)
+		}
+		err = other.scheduleTask(otherSvcs, route)
+		if err != nil {
+			t.Fatalf("Unexpected error scheduling task - %s", err)
+		}
+
+		waitFor("singleton", 1)
+		<-time.After(250 * time.Millisecond)
+		if n := executions("singleton"); n != 1 {
+			t.Errorf("Unexpected number of singleton executions - %d", n)
+		}
+
+		_, err = db.Get(kvext.ReservedPrefix + "leader:singleton")
+		if err != nil {
+			t.Errorf("Expected lease stored under a reserved key - %s", err)
+		}
+
+		for node, expected := range map[string]float64{"node-a": 1, "node-b": 0} {
+			var m dto.Metric
+			err := srv.stats.Leaders.WithLabelValues("singleton", node).Write(&m)
+			if err != nil {
+				t.Fatalf("Unable to read leader metrics - %s", err)
+			}
+			if m.GetGauge().GetValue() != expected {
+				t.Errorf("Unexpected leader status for %s - %f", node, m.GetGauge().GetValue())
+			}
+		}
+	})
+
+	t.Run("Singleton on Per-Instance KVStore", func(t *testing.T) {
+		var logs syncBuffer
+		cfg := viper.New()
+		cfg.Set("kvstore_type", "boltdb")
+		local := &Server{cfg: cfg, log: slog.New(slog.NewJSONHandler(&logs, nil)), stats: srv.stats, kv: kv}
+		local.runCtx, local.runCancel = context.WithCancel(context.Background())
+		defer local.runCancel()
+
+		svcs := newServices(local.runCtx)
+		defer svcs.close(nil)
+		route := config.Route{Function: "local", Frequency: 3600, Singleton: true, LeaseTTL: 15}
+		err := local.scheduleTask(svcs, route)
+		if err != nil {
+			t.Fatalf("Unexpected error scheduling task - %s", err)
+		}
+		if !strings.Contains(logs.String(), `"level":"WARN"`) || !strings.Contains(logs.String(), `"function":"local"`) {
+			t.Errorf("Expected warning of per-instance leases - %s", logs.String())
+		}
+	})
+
+	t.Run("Singleton without Atomic KVStore", func(t *testing.T) {
+		srv.kv = kv
+		srv.cfg.Set("kvstore_type", "cassandra")
+		defer srv.cfg.Set("kvstore_type", "in-memory")
+
+		route := config.Route{Function: "cassandra", Frequency: 60, Singleton: true, LeaseTTL: 15}
+		err := srv.scheduleTask(newServices(srv.runCtx), route)
+		if err == nil {
+			t.Errorf("Unexpected success scheduling singleton task without atomic kvstore")
+		}
+	})
+
+	t.Run("Singleton without KVStore", func(t *testing.T) {
+		srv.kv = nil
+		route := config.Route{Function: "nokv", Frequency: 60, Singleton: true, LeaseTTL: 15}
+		err := srv.scheduleTask(newServices(srv.runCtx), route)
+		if err == nil {
+			t.Errorf("Unexpected success scheduling singleton task without kvstore")
+		}
+	})
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use, capturing logs written by background goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
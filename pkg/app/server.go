@@ -1,6 +1,9 @@
 package app
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -9,9 +12,15 @@ import (
 	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/pquerna/ffjson/ffjson"
 
+	"github.com/tarmac-project/tarmac"
 	"github.com/tarmac-project/tarmac/pkg/config"
+	"github.com/tarmac-project/tarmac/pkg/envelope"
 	"github.com/tarmac-project/tarmac/pkg/sanitize"
+	"github.com/tarmac-project/tarmac/pkg/wasm"
+
+	proto "github.com/tarmac-project/protobuf-go/sdk/http"
 )
 
 // isPProf is a regex that validates if the given path is used for PProf.
@@ -25,7 +34,7 @@ func (srv *Server) Health(w http.ResponseWriter, _ *http.Request, _ httprouter.P
 
 // Ready is used to handle HTTP Ready requests to this service. Use this for readiness
 // probes or any checks that validate the service is ready to accept traffic.
-func (srv *Server) Ready(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+func (srv *Server) Ready(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	// Check if maintence mode is enabled and return 503
 	if srv.cfg.GetBool("enable_maintenance_mode") {
 		w.WriteHeader(http.StatusServiceUnavailable)
@@ -40,6 +49,29 @@ func (srv *Server) Ready(w http.ResponseWriter, _ *http.Request, _ httprouter.Pa
 			return
 		}
 	}
+	for _, kv := range srv.kvs {
+		err := kv.HealthCheck()
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	// Check SQL DB connectivity
+	if srv.db != nil {
+		err := srv.db.PingContext(r.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}
+	for _, db := range srv.dbs {
+		err := db.PingContext(r.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -96,16 +128,55 @@ func (srv *Server) handlerWrapper(h http.Handler) httprouter.Handle {
 
 // WASMHandler is the primary HTTP handler for WASM Module traffic. This handler will load the
 // specified module and create an execution environment for that module.
-func (srv *Server) WASMHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+func (srv *Server) WASMHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Find Function
-	function, err := srv.funcCfg.RouteLookup(fmt.Sprintf("http:%s:%s", r.Method, r.URL.EscapedPath()))
+	route, err := srv.funcConfig().LookupRoute(fmt.Sprintf("http:%s:%s", r.Method, r.URL.EscapedPath()))
 	if errors.Is(err, config.ErrRouteNotFound) {
-		function = "default"
+		route.Function = "default"
+		route.Envelope = srv.cfg.GetString("wasm_http_envelope")
 	}
 
+	srv.routeHandler(route)(w, r, ps)
+}
+
+// routeHandler returns an HTTP handler that executes the function of the given route. Any parameters captured from
+// the request path are passed to the function within the request envelope.
+func (srv *Server) routeHandler(route config.Route) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		// Bind the execution to the request, stopping it if the client disconnects or the route timeout is reached
+		ctx, cancel := routeContext(r.Context(), route)
+		defer cancel()
+		r = r.WithContext(ctx)
+
+		// Pass the full request context to functions using envelopes
+		if route.Envelope != "" {
+			srv.envelopeHandler(w, r, ps, route.Function, route.Envelope)
+			return
+		}
+
+		srv.bodyHandler(w, r, route.Function)
+	}
+}
+
+// registerHTTPRoute registers the route with the HTTP router for the given method. The HTTP router panics on
+// conflicting paths (i.e. /users/:id and /users/:name), which is returned as an error instead.
+func (srv *Server) registerHTTPRoute(router *httprouter.Router, method string, route config.Route) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	router.Handle(method, route.Path, srv.middleware(srv.routeHandler(route)))
+	return nil
+}
+
+// bodyHandler executes the function with the HTTP request body as the payload, returning the function output as the
+// HTTP response body.
+func (srv *Server) bodyHandler(w http.ResponseWriter, r *http.Request, function string) {
 	// Read the HTTP Payload
 	var payload []byte
 	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		var err error
 		payload, err = io.ReadAll(r.Body)
 		if err != nil {
 			srv.log.DebugContext(r.Context(), "Error reading HTTP payload: "+err.Error(),
@@ -120,7 +191,7 @@ func (srv *Server) WASMHandler(w http.ResponseWriter, r *http.Request, _ httprou
 	}
 
 	// Execute WASM Module
-	rsp, err := srv.runWASM(function, "handler", payload)
+	rsp, err := srv.runWASM(r.Context(), function, "handler", payload)
 	if err != nil {
 		srv.writeWASMError(w, r, rsp, err)
 		return
@@ -131,6 +202,188 @@ func (srv *Server) WASMHandler(w http.ResponseWriter, r *http.Request, _ httprou
 	fmt.Fprintf(w, "%s", rsp)
 }
 
+// envelopeHandler executes the function using the HTTPRequest and HTTPResponse envelopes, giving the function access
+// to the full context of the HTTP request and control over the status code, headers, and body of the response.
+func (srv *Server) envelopeHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	ps httprouter.Params,
+	function, format string,
+) {
+	// Read the HTTP Payload
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		srv.log.DebugContext(r.Context(), "Error reading HTTP payload: "+err.Error(),
+			"method", r.Method,
+			"remote-addr", r.RemoteAddr,
+			"http-protocol", r.Proto,
+			"content-length", r.ContentLength,
+			"error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Build the Request Envelope
+	payload, err := encodeHTTPRequest(newHTTPRequest(r, ps, body), format)
+	if err != nil {
+		srv.writeWASMError(w, r, nil, err)
+		return
+	}
+
+	// Execute WASM Module
+	rsp, err := srv.runWASM(r.Context(), function, "handler", payload)
+	if err != nil {
+		srv.writeWASMError(w, r, rsp, err)
+		return
+	}
+
+	// Decode the Response Envelope
+	out, err := decodeHTTPResponse(rsp, format)
+	if err != nil {
+		srv.writeWASMError(w, r, nil, err)
+		return
+	}
+
+	// Return headers, status code, and body
+	for k, h := range out.Headers {
+		for _, v := range h.GetValues() {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(int(out.Code))
+	_, _ = w.Write(out.Body)
+}
+
+// newHTTPRequest creates an HTTPRequest envelope from the inbound HTTP request, its path parameters, and its body.
+func newHTTPRequest(r *http.Request, ps httprouter.Params, body []byte) *envelope.HTTPRequest {
+	rq := &envelope.HTTPRequest{
+		Method:     r.Method,
+		Path:       r.URL.EscapedPath(),
+		Query:      r.URL.RawQuery,
+		Headers:    make(map[string]*proto.Header, len(r.Header)),
+		RemoteAddr: r.RemoteAddr,
+		Body:       body,
+	}
+
+	for k, v := range r.Header {
+		rq.Headers[k] = &proto.Header{Values: v}
+	}
+
+	if len(ps) > 0 {
+		rq.Params = make(map[string]string, len(ps))
+		for _, p := range ps {
+			rq.Params[p.Key] = p.Value
+		}
+	}
+
+	if r.TLS != nil {
+		rq.Tls = &envelope.TLS{
+			Version:     tls.VersionName(r.TLS.Version),
+			CipherSuite: tls.CipherSuiteName(r.TLS.CipherSuite),
+			ServerName:  r.TLS.ServerName,
+		}
+		for _, c := range r.TLS.PeerCertificates {
+			rq.Tls.PeerCertificates = append(rq.Tls.PeerCertificates, &envelope.Certificate{
+				Subject:      c.Subject.String(),
+				Issuer:       c.Issuer.String(),
+				SerialNumber: c.SerialNumber.String(),
+				DnsNames:     c.DNSNames,
+			})
+		}
+	}
+
+	return rq
+}
+
+// encodeHTTPRequest encodes the HTTPRequest envelope using the specified envelope format.
+func encodeHTTPRequest(rq *envelope.HTTPRequest, format string) ([]byte, error) {
+	if format == HTTPEnvelopeProto {
+		b, err := rq.MarshalVT()
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal http request envelope - %w", err)
+		}
+		return b, nil
+	}
+
+	j := tarmac.HTTPRequest{
+		Method:     rq.Method,
+		Path:       rq.Path,
+		Query:      rq.Query,
+		Headers:    make(map[string][]string, len(rq.Headers)),
+		RemoteAddr: rq.RemoteAddr,
+		Body:       base64.StdEncoding.EncodeToString(rq.Body),
+		Params:     rq.Params,
+	}
+
+	for k, h := range rq.Headers {
+		j.Headers[k] = h.GetValues()
+	}
+
+	if rq.Tls != nil {
+		j.TLS = &tarmac.HTTPRequestTLS{
+			Version:     rq.Tls.Version,
+			CipherSuite: rq.Tls.CipherSuite,
+			ServerName:  rq.Tls.ServerName,
+		}
+		for _, c := range rq.Tls.PeerCertificates {
+			j.TLS.PeerCertificates = append(j.TLS.PeerCertificates, tarmac.HTTPRequestCertificate{
+				Subject:      c.Subject,
+				Issuer:       c.Issuer,
+				SerialNumber: c.SerialNumber,
+				DNSNames:     c.DnsNames,
+			})
+		}
+	}
+
+	b, err := ffjson.Marshal(j)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal http request envelope - %w", err)
+	}
+	return b, nil
+}
+
+// decodeHTTPResponse decodes the HTTPResponse envelope returned by a function using the specified envelope format. If
+// no status code is set, a 200 is used. Status codes outside of 100-599 are rejected.
+func decodeHTTPResponse(b []byte, format string) (*envelope.HTTPResponse, error) {
+	rsp := &envelope.HTTPResponse{}
+	var code int
+	if format == HTTPEnvelopeProto {
+		err := rsp.UnmarshalVT(b)
+		if err != nil {
+			return nil, fmt.Errorf("unable to unmarshal http response envelope - %w", err)
+		}
+		code = int(rsp.Code)
+	} else {
+		var j tarmac.HTTPResponse
+		err := ffjson.Unmarshal(b, &j)
+		if err != nil {
+			return nil, fmt.Errorf("unable to unmarshal http response envelope - %w", err)
+		}
+
+		code = j.Code
+		rsp.Body, err = base64.StdEncoding.DecodeString(j.Body)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode http response envelope body - %w", err)
+		}
+
+		rsp.Headers = make(map[string]*proto.Header, len(j.Headers))
+		for k, v := range j.Headers {
+			rsp.Headers[k] = &proto.Header{Values: v}
+		}
+	}
+
+	if code == 0 {
+		code = http.StatusOK
+	}
+
+	if code < 100 || code > 599 {
+		return nil, fmt.Errorf("invalid http response envelope status code %d", code)
+	}
+	rsp.Code = int32(code)
+
+	return rsp, nil
+}
+
 func (srv *Server) writeWASMError(w http.ResponseWriter, r *http.Request, rsp []byte, err error) {
 	srv.log.DebugContext(r.Context(), "Error executing WASM module: "+err.Error(),
 		"method", r.Method,
@@ -138,6 +391,14 @@ func (srv *Server) writeWASMError(w http.ResponseWriter, r *http.Request, rsp []
 		"http-protocol", r.Proto,
 		"content-length", r.ContentLength,
 		"error", err)
+
+	// Executions stopped by the route or function timeout return a Gateway Timeout
+	if errors.Is(err, context.DeadlineExceeded) {
+		w.WriteHeader(http.StatusGatewayTimeout)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
 	w.WriteHeader(http.StatusInternalServerError)
 	if len(rsp) > 0 {
 		_, _ = w.Write(rsp)
@@ -146,10 +407,15 @@ func (srv *Server) writeWASMError(w http.ResponseWriter, r *http.Request, rsp []
 	_, _ = w.Write([]byte(err.Error()))
 }
 
-// runWASM will load and execute the specified WASM module.
-func (srv *Server) runWASM(module, handler string, rq []byte) ([]byte, error) {
+// runWASM will load and execute the specified WASM module. The execution is stopped once ctx is done. If ctx does not
+// carry a deadline, the function timeout is applied.
+func (srv *Server) runWASM(ctx context.Context, module, handler string, rq []byte) ([]byte, error) {
 	now := time.Now()
 
+	// Apply the function timeout
+	ctx, cancel := srv.functionContext(ctx, module)
+	defer cancel()
+
 	// Fetch Module and run with payload
 	m, err := srv.engine.Module(module)
 	if err != nil {
@@ -159,8 +425,22 @@ func (srv *Server) runWASM(module, handler string, rq []byte) ([]byte, error) {
 	}
 
 	// Execute the WASM Handler
-	rsp, err := m.Run(handler, rq)
+	rsp, err := m.RunWithContext(ctx, handler, rq)
+
+	// Modules replaced by a reload after being fetched are executed using the replacement module
+	if errors.Is(err, wasm.ErrModuleClosed) {
+		m, err = srv.engine.Module(module)
+		if err == nil {
+			rsp, err = m.RunWithContext(ctx, handler, rq)
+		}
+	}
 	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			srv.stats.Timeouts.WithLabelValues(module).Inc()
+		}
+		if errors.Is(err, wasm.ErrMemoryLimit) {
+			srv.stats.MemoryLimits.WithLabelValues(module).Inc()
+		}
 		srv.stats.Wasm.WithLabelValues(fmt.Sprintf("%s:%s", module, handler)).
 			Observe(float64(time.Since(now).Milliseconds()))
 		return rsp, fmt.Errorf("failed to execute wasm module - %w", err)
@@ -175,3 +455,76 @@ func (srv *Server) runWASM(module, handler string, rq []byte) ([]byte, error) {
 		"duration", time.Since(now).Milliseconds())
 	return rsp, nil
 }
+
+// functionContext returns a context bounded by the execution timeout of the specified function. Deadlines already
+// set by routes or calling functions are kept when they expire before the function timeout.
+func (srv *Server) functionContext(ctx context.Context, function string) (context.Context, context.CancelFunc) {
+	if timeout := srv.functionTimeout(function); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// defaultLimitedTimeout is the execution timeout of functions limited by max_memory_pages without a timeout defined, so
+// functions with a memory limit are always bounded in execution time as well.
+const defaultLimitedTimeout = 60 * time.Second
+
+// functionTimeout returns the execution timeout of the specified function, falling back to the wasm_function_timeout
+// default when the function does not define a timeout. Functions with a memory limit but no timeout use
+// defaultLimitedTimeout.
+func (srv *Server) functionTimeout(function string) time.Duration {
+	f, err := srv.funcConfig().LookupFunction(function)
+	if err == nil && f.Timeout > 0 {
+		return time.Duration(f.Timeout) * time.Second
+	}
+	if timeout := srv.cfg.GetInt("wasm_function_timeout"); timeout > 0 {
+		return time.Duration(timeout) * time.Second
+	}
+
+	limited := f.MaxMemoryPages > 0
+	if err != nil && function == "default" {
+		limited = srv.cfg.GetUint32("wasm_max_memory_pages") > 0
+	}
+	if limited {
+		return defaultLimitedTimeout
+	}
+	return 0
+}
+
+// permitCallback returns true if the function is permitted to call the host callback of the namespace and operation.
+// Denied callbacks are logged as security events. Functions without Capabilities defined, and the default function
+// loaded without a service configuration, are permitted to call every host callback. Functions missing from the
+// service configuration are denied every host callback.
+func (srv *Server) permitCallback(function, namespace, op string) bool {
+	f, err := srv.funcConfig().LookupFunction(function)
+	if err != nil {
+		if function == "default" {
+			return true
+		}
+		srv.log.Warn("Security: unknown function denied host callback",
+			"security", true,
+			"function", function,
+			"capability", namespace,
+			"operation", op,
+			"error", err)
+		return false
+	}
+	if f.Permits(namespace, op) {
+		return true
+	}
+
+	srv.log.Warn("Security: function denied host callback not granted by its capabilities",
+		"security", true,
+		"function", function,
+		"capability", namespace,
+		"operation", op)
+	return false
+}
+
+// routeContext returns a context for executions triggered by the route, bounded by the route timeout when defined.
+func routeContext(ctx context.Context, route config.Route) (context.Context, context.CancelFunc) {
+	if route.Timeout > 0 {
+		return context.WithTimeout(ctx, time.Duration(route.Timeout)*time.Second)
+	}
+	return context.WithCancel(ctx)
+}
@@ -3,8 +3,11 @@ package app
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -13,7 +16,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/julienschmidt/httprouter"
+	"github.com/pquerna/ffjson/ffjson"
 	"github.com/spf13/viper"
+
+	"github.com/tarmac-project/tarmac"
+	"github.com/tarmac-project/tarmac/pkg/config"
+	"github.com/tarmac-project/tarmac/pkg/envelope"
+
+	proto "github.com/tarmac-project/protobuf-go/sdk/http"
 )
 
 type RunnerCase struct {
@@ -215,6 +226,16 @@ func TestFullService(t *testing.T) {
 	tc.cfg.Set("wasm_function_config", "/testdata/tarmac.json")
 	tt = append(tt, tc)
 
+	tc = FullServiceTestCase{name: "SQLite", cfg: viper.New()}
+	tc.cfg.Set("disable_logging", false)
+	tc.cfg.Set("debug", true)
+	tc.cfg.Set("listen_addr", "localhost:9001")
+	tc.cfg.Set("enable_sql", true)
+	tc.cfg.Set("sql_type", "sqlite")
+	tc.cfg.Set("sql_path", filepath.Join(t.TempDir(), "sqlite.db"))
+	tc.cfg.Set("wasm_function_config", "/testdata/tarmac.json")
+	tt = append(tt, tc)
+
 	tc = FullServiceTestCase{name: "In-Memory SDKv1", cfg: viper.New()}
 	tc.cfg.Set("disable_logging", false)
 	tc.cfg.Set("debug", true)
@@ -234,6 +255,16 @@ func TestFullService(t *testing.T) {
 	tc.cfg.Set("wasm_function_config", "/testdata/sdkv1/tarmac.json")
 	tt = append(tt, tc)
 
+	tc = FullServiceTestCase{name: "SQLite SDKv1", cfg: viper.New()}
+	tc.cfg.Set("disable_logging", false)
+	tc.cfg.Set("debug", true)
+	tc.cfg.Set("listen_addr", "localhost:9001")
+	tc.cfg.Set("enable_sql", true)
+	tc.cfg.Set("sql_type", "sqlite")
+	tc.cfg.Set("sql_path", filepath.Join(t.TempDir(), "sqlite-sdkv1.db"))
+	tc.cfg.Set("wasm_function_config", "/testdata/sdkv1/tarmac.json")
+	tt = append(tt, tc)
+
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
 			srv := New(tc.cfg)
@@ -470,7 +501,7 @@ func TestWASMRunner(t *testing.T) {
 
 	for _, c := range tc {
 		t.Run(c.name, func(t *testing.T) {
-			_, err := srv.runWASM(c.module, c.handler, c.request)
+			_, err := srv.runWASM(context.Background(), c.module, c.handler, c.request)
 			if err != nil && !c.err {
 				t.Errorf("Unexpected error executing module - %s", err)
 			}
@@ -713,7 +744,7 @@ func TestRunWASMWithFailingModule(t *testing.T) {
 	time.Sleep(5 * time.Second)
 
 	t.Run("Invoke failing module", func(t *testing.T) {
-		_, err := srv.runWASM("fail", "handler", []byte("test"))
+		_, err := srv.runWASM(context.Background(), "fail", "handler", []byte("test"))
 		if err == nil {
 			t.Errorf("Expected error when executing failing module, got success")
 		}
@@ -723,7 +754,7 @@ func TestRunWASMWithFailingModule(t *testing.T) {
 	})
 
 	t.Run("Module not found error", func(t *testing.T) {
-		_, err := srv.runWASM("nonexistent", "handler", []byte("test"))
+		_, err := srv.runWASM(context.Background(), "nonexistent", "handler", []byte("test"))
 		if err == nil {
 			t.Errorf("Expected error when executing non-existent module, got success")
 		}
@@ -732,3 +763,295 @@ func TestRunWASMWithFailingModule(t *testing.T) {
 		}
 	})
 }
+
+func TestHTTPEnvelopes(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/users/123?a=1&b=2", bytes.NewBufferString("Howdie"))
+	r.Header.Add("X-Testing", "one")
+	r.Header.Add("X-Testing", "two")
+
+	ps := httprouter.Params{{Key: "id", Value: "123"}, {Key: "filepath", Value: "/a/b.txt"}}
+
+	rq := newHTTPRequest(r, ps, []byte("Howdie"))
+
+	t.Run("Request Context", func(t *testing.T) {
+		if rq.Method != http.MethodPost || rq.Path != "/users/123" || rq.Query != "a=1&b=2" {
+			t.Errorf("Unexpected request values - %+v", rq)
+		}
+		if len(rq.Headers["X-Testing"].GetValues()) != 2 {
+			t.Errorf("Unexpected request headers - %+v", rq.Headers)
+		}
+		if rq.RemoteAddr == "" {
+			t.Errorf("Remote address not set")
+		}
+		if rq.Tls != nil {
+			t.Errorf("Unexpected TLS details for plain text request")
+		}
+		if rq.Params["id"] != "123" || rq.Params["filepath"] != "/a/b.txt" {
+			t.Errorf("Unexpected request params - %+v", rq.Params)
+		}
+	})
+
+	t.Run("Request Context with TLS", func(t *testing.T) {
+		tr := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+		rq := newHTTPRequest(tr, nil, nil)
+		if rq.Tls == nil || rq.Tls.ServerName != "example.com" {
+			t.Errorf("Unexpected TLS details - %+v", rq.Tls)
+		}
+	})
+
+	t.Run("Encode Protobuf Request", func(t *testing.T) {
+		b, err := encodeHTTPRequest(rq, HTTPEnvelopeProto)
+		if err != nil {
+			t.Fatalf("Unexpected error encoding request - %s", err)
+		}
+		var got envelope.HTTPRequest
+		err = got.UnmarshalVT(b)
+		if err != nil {
+			t.Fatalf("Unexpected error decoding request - %s", err)
+		}
+		if string(got.Body) != "Howdie" || got.Path != "/users/123" || got.Params["id"] != "123" {
+			t.Errorf("Unexpected request values - %+v", got)
+		}
+	})
+
+	t.Run("Encode JSON Request", func(t *testing.T) {
+		b, err := encodeHTTPRequest(rq, HTTPEnvelopeJSON)
+		if err != nil {
+			t.Fatalf("Unexpected error encoding request - %s", err)
+		}
+		var got tarmac.HTTPRequest
+		err = ffjson.Unmarshal(b, &got)
+		if err != nil {
+			t.Fatalf("Unexpected error decoding request - %s", err)
+		}
+		if got.Body != base64.StdEncoding.EncodeToString([]byte("Howdie")) || got.Query != "a=1&b=2" ||
+			got.Params["filepath"] != "/a/b.txt" {
+			t.Errorf("Unexpected request values - %+v", got)
+		}
+		if len(got.Headers["X-Testing"]) != 2 {
+			t.Errorf("Unexpected request headers - %+v", got.Headers)
+		}
+	})
+
+	t.Run("Decode Responses", func(t *testing.T) {
+		pb, err := (&envelope.HTTPResponse{
+			Code:    http.StatusCreated,
+			Headers: map[string]*proto.Header{"X-Testing": {Values: []string{"one"}}},
+			Body:    []byte("Created"),
+		}).MarshalVT()
+		if err != nil {
+			t.Fatalf("Unexpected error encoding response - %s", err)
+		}
+
+		tt := []struct {
+			name   string
+			format string
+			data   []byte
+			code   int32
+			body   string
+			err    bool
+		}{
+			{name: "Protobuf", format: HTTPEnvelopeProto, data: pb, code: http.StatusCreated, body: "Created"},
+			{name: "Protobuf Default Status", format: HTTPEnvelopeProto, data: []byte{}, code: http.StatusOK},
+			{name: "Invalid Protobuf", format: HTTPEnvelopeProto, data: []byte(`{"code":404}`), err: true},
+			{name: "JSON", format: HTTPEnvelopeJSON, data: []byte(`{"code":202}`), code: http.StatusAccepted},
+			{name: "JSON Default Status", format: HTTPEnvelopeJSON, data: []byte(`{}`), code: http.StatusOK},
+			{name: "Invalid JSON", format: HTTPEnvelopeJSON, data: []byte(`Howdie`), err: true},
+			{name: "Invalid Body", format: HTTPEnvelopeJSON, data: []byte(`{"body":"!!!"}`), err: true},
+			{name: "Invalid Status", format: HTTPEnvelopeJSON, data: []byte(`{"code":1000}`), err: true},
+			{name: "Status beyond HTTP Range", format: HTTPEnvelopeJSON, data: []byte(`{"code":600}`), err: true},
+			{name: "Status below HTTP Range", format: HTTPEnvelopeJSON, data: []byte(`{"code":99}`), err: true},
+			{name: "Highest Status", format: HTTPEnvelopeJSON, data: []byte(`{"code":599}`), code: 599},
+		}
+
+		for _, tc := range tt {
+			t.Run(tc.name, func(t *testing.T) {
+				rsp, err := decodeHTTPResponse(tc.data, tc.format)
+				if err != nil {
+					if !tc.err {
+						t.Fatalf("Unexpected error decoding response - %s", err)
+					}
+					return
+				}
+				if tc.err {
+					t.Fatalf("Unexpected success decoding response - %+v", rsp)
+				}
+				if rsp.Code != tc.code || string(rsp.Body) != tc.body {
+					t.Errorf("Unexpected response values - %+v", rsp)
+				}
+			})
+		}
+	})
+}
+
+func TestRegisterHTTPRoute(t *testing.T) {
+	srv := &Server{}
+	router := httprouter.New()
+
+	err := srv.registerHTTPRoute(router, http.MethodGet, config.Route{Path: "/users/:id", Function: "users"})
+	if err != nil {
+		t.Fatalf("Unexpected error registering route - %s", err)
+	}
+
+	err = srv.registerHTTPRoute(router, http.MethodGet, config.Route{Path: "/users/:name/*filepath", Function: "files"})
+	if err == nil {
+		t.Errorf("Expected error registering conflicting route")
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "tarmac-test.json")
+	err := os.WriteFile(configPath, []byte(`{"services":{"test-service":{"name":"test-service",`+
+		`"functions":{"slow":{"filepath":"/slow.wasm","timeout":30},"fast":{"filepath":"/fast.wasm","timeout":1},`+
+		`"default":{"filepath":"/default.wasm"},"limited":{"filepath":"/limited.wasm","max_memory_pages":16}},`+
+		`"routes":[{"type":"http","path":"/","methods":["GET"],"function":"slow","timeout":2}]}}}`), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write temp config file - %s", err)
+	}
+
+	cfg := viper.New()
+	cfg.Set("wasm_function_timeout", 10)
+
+	srv := &Server{cfg: cfg, log: slog.New(slog.DiscardHandler)}
+	svcs := newServices(context.Background())
+	defer svcs.close(nil)
+	svcs.cfg, err = config.Parse(configPath)
+	if err != nil {
+		t.Fatalf("Failed to parse config - %s", err)
+	}
+	srv.services.Store(svcs)
+
+	t.Run("Function Timeout", func(t *testing.T) {
+		if d := srv.functionTimeout("slow"); d != 30*time.Second {
+			t.Errorf("Unexpected function timeout - %s", d)
+		}
+	})
+
+	t.Run("Default Function Timeout", func(t *testing.T) {
+		if d := srv.functionTimeout("default"); d != 10*time.Second {
+			t.Errorf("Unexpected function timeout - %s", d)
+		}
+	})
+
+	t.Run("Memory Limited Function Timeout", func(t *testing.T) {
+		if d := srv.functionTimeout("limited"); d != 10*time.Second {
+			t.Errorf("Unexpected function timeout - %s", d)
+		}
+
+		// Functions with a memory limit are given a timeout when none is configured
+		cfg.Set("wasm_function_timeout", 0)
+		defer cfg.Set("wasm_function_timeout", 10)
+		if d := srv.functionTimeout("limited"); d != defaultLimitedTimeout {
+			t.Errorf("Unexpected function timeout - %s", d)
+		}
+		if d := srv.functionTimeout("default"); d != 0 {
+			t.Errorf("Unexpected function timeout - %s", d)
+		}
+	})
+
+	t.Run("Route Timeout", func(t *testing.T) {
+		route, err := srv.funcConfig().LookupRoute("http:GET:/")
+		if err != nil {
+			t.Fatalf("Unexpected error looking up route - %s", err)
+		}
+
+		ctx, cancel := routeContext(context.Background(), route)
+		defer cancel()
+		deadline, ok := ctx.Deadline()
+		if !ok || time.Until(deadline) > 2*time.Second {
+			t.Errorf("Unexpected route deadline - %s", deadline)
+		}
+	})
+
+	t.Run("Route without Timeout", func(t *testing.T) {
+		ctx, cancel := routeContext(context.Background(), config.Route{})
+		defer cancel()
+		if _, ok := ctx.Deadline(); ok {
+			t.Errorf("Unexpected deadline for route without timeout")
+		}
+	})
+
+	t.Run("Function Timeout within Route Timeout", func(t *testing.T) {
+		route, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		ctx, cancel := srv.functionContext(route, "fast")
+		defer cancel()
+		deadline, ok := ctx.Deadline()
+		if !ok || time.Until(deadline) > time.Second {
+			t.Errorf("Unexpected function deadline - %s", deadline)
+		}
+	})
+
+	t.Run("Route Timeout within Function Timeout", func(t *testing.T) {
+		route, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		ctx, cancel := srv.functionContext(route, "slow")
+		defer cancel()
+		deadline, ok := ctx.Deadline()
+		if !ok || time.Until(deadline) > 2*time.Second {
+			t.Errorf("Unexpected function deadline - %s", deadline)
+		}
+	})
+
+	t.Run("Gateway Timeout", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		srv.writeWASMError(w, r, nil, fmt.Errorf("invocation of WASM module stopped - %w", context.DeadlineExceeded))
+		if w.Code != http.StatusGatewayTimeout {
+			t.Errorf("Unexpected status code - %d", w.Code)
+		}
+	})
+}
+
+func TestPermitCallback(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "tarmac-test.json")
+	err := os.WriteFile(configPath, []byte(`{"services":{"test-service":{"name":"test-service","functions":{`+
+		`"restricted":{"filepath":"/restricted.wasm","capabilities":["kvstore:get","logger:*"]},`+
+		`"trusted":{"filepath":"/trusted.wasm"}},"routes":[]}}}`), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write temp config file - %s", err)
+	}
+
+	var logs bytes.Buffer
+	srv := &Server{cfg: viper.New(), log: slog.New(slog.NewJSONHandler(&logs, nil))}
+	svcs := newServices(context.Background())
+	defer svcs.close(nil)
+	svcs.cfg, err = config.Parse(configPath)
+	if err != nil {
+		t.Fatalf("Failed to parse config - %s", err)
+	}
+	srv.services.Store(svcs)
+
+	tt := []struct {
+		name      string
+		function  string
+		namespace string
+		op        string
+		permitted bool
+	}{
+		{name: "Granted Capability", function: "restricted", namespace: "kvstore", op: "get", permitted: true},
+		{name: "Granted Wildcard", function: "restricted", namespace: "logger", op: "warn", permitted: true},
+		{name: "Denied Capability", function: "restricted", namespace: "kvstore", op: "delete"},
+		{name: "Denied Function Call", function: "restricted", namespace: "function", op: "trusted"},
+		{name: "Unrestricted Function", function: "trusted", namespace: "sql", op: "exec", permitted: true},
+		{name: "Default Function", function: "default", namespace: "sql", op: "exec", permitted: true},
+		{name: "Unknown Function", function: "unknown", namespace: "kvstore", op: "get"},
+		{name: "Unnamed Function", function: "", namespace: "kvstore", op: "get"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			logs.Reset()
+			if srv.permitCallback(tc.function, tc.namespace, tc.op) != tc.permitted {
+				t.Fatalf("Unexpected permission for %s calling %s:%s", tc.function, tc.namespace, tc.op)
+			}
+
+			logged := strings.Contains(logs.String(), `"security":true`)
+			if logged == tc.permitted {
+				t.Errorf("Unexpected security log entry - %s", logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	// MySQL Database Driver.
+	_ "github.com/go-sql-driver/mysql"
+
+	// PostgreSQL Database Driver.
+	_ "github.com/lib/pq"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/spf13/viper"
+
+	sqlstore "github.com/tarmac-project/tarmac/pkg/callbacks/sql"
+	"github.com/tarmac-project/tarmac/pkg/migrate"
+	"github.com/tarmac-project/tarmac/pkg/wasm"
+
+	// SQLite Database Driver.
+	_ "modernc.org/sqlite"
+)
+
+// sqlPingTimeout is the maximum duration of a single SQL DB ping.
+const sqlPingTimeout = 5 * time.Second
+
+// defaultSQLitePragmas are applied to every SQLite connection when sql_pragmas is not configured. They allow
+// concurrent readers alongside a writer and wait for locks rather than failing immediately.
+var defaultSQLitePragmas = []string{"busy_timeout(5000)", "journal_mode(WAL)", "foreign_keys(1)"}
+
+// openSQL opens the SQL database selected by sql_type, configuring its connection pool.
+func openSQL(cfg *viper.Viper) (*sql.DB, error) {
+	var db *sql.DB
+	var err error
+	switch cfg.GetString("sql_type") {
+	case "mysql":
+		db, err = sql.Open("mysql", cfg.GetString("sql_dsn"))
+	case "postgres":
+		db, err = sql.Open("postgres", cfg.GetString("sql_dsn"))
+	case "sqlite":
+		path := cfg.GetString("sql_path")
+		if path == "" {
+			path = cfg.GetString("sql_dsn")
+		}
+		if path == "" {
+			return nil, errors.New("sql_path must be set for sqlite")
+		}
+
+		pragmas := defaultSQLitePragmas
+		if cfg.IsSet("sql_pragmas") {
+			pragmas = cfg.GetStringSlice("sql_pragmas")
+		}
+		db, err = sql.Open("sqlite", sqliteDSN(path, pragmas))
+	default:
+		return nil, fmt.Errorf("unknown sql store specified - %s", cfg.GetString("sql_type"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Configure the connection pool, leaving driver defaults for options not set
+	if cfg.IsSet("sql_max_open_conns") {
+		db.SetMaxOpenConns(cfg.GetInt("sql_max_open_conns"))
+	}
+	if cfg.IsSet("sql_max_idle_conns") {
+		db.SetMaxIdleConns(cfg.GetInt("sql_max_idle_conns"))
+	}
+	if cfg.IsSet("sql_conn_max_lifetime") {
+		db.SetConnMaxLifetime(time.Duration(cfg.GetInt("sql_conn_max_lifetime")) * time.Second)
+	}
+	if cfg.IsSet("sql_conn_max_idle_time") {
+		db.SetConnMaxIdleTime(time.Duration(cfg.GetInt("sql_conn_max_idle_time")) * time.Second)
+	}
+	return db, nil
+}
+
+// pingSQL verifies the database is reachable, retrying up to sql_connect_retries times, sql_connect_retry_interval
+// seconds apart.
+func (srv *Server) pingSQL(name string, db *sql.DB, cfg *viper.Viper) error {
+	interval := time.Duration(cfg.GetInt("sql_connect_retry_interval")) * time.Second
+	retries := cfg.GetInt("sql_connect_retries")
+
+	var err error
+	for i := 0; ; i++ {
+		ctx, cancel := context.WithTimeout(srv.runCtx, sqlPingTimeout)
+		err = db.PingContext(ctx)
+		cancel()
+		if err == nil || i >= retries {
+			return err
+		}
+
+		srv.log.Warn("Unable to reach SQL DB, retrying: "+err.Error(),
+			"data_source", name,
+			"attempt", i+1,
+			"error", err,
+		)
+
+		select {
+		case <-srv.runCtx.Done():
+			return err
+		case <-time.After(interval):
+		}
+	}
+}
+
+// registerSQLStats exports the connection pool statistics of the default and named SQL DBs to Prometheus, returning a
+// function that unregisters them.
+func (srv *Server) registerSQLStats() func() {
+	dbs := make(map[string]*sql.DB, len(srv.dbs)+1)
+	if srv.db != nil {
+		dbs["default"] = srv.db
+	}
+	for name, db := range srv.dbs {
+		dbs[name] = db
+	}
+
+	var cs []prometheus.Collector
+	for name, db := range dbs {
+		c := collectors.NewDBStatsCollector(db, name)
+		err := prometheus.Register(c)
+		if err != nil {
+			srv.log.Warn("Unable to register SQL DB metrics: "+err.Error(), "data_source", name, "error", err)
+			continue
+		}
+		cs = append(cs, c)
+	}
+
+	return func() {
+		for _, c := range cs {
+			prometheus.Unregister(c)
+		}
+	}
+}
+
+// openSQLDatabases opens the named SQL databases defined within sql_databases.
+func (srv *Server) openSQLDatabases() (map[string]*sql.DB, error) {
+	cfgs, err := dataSources(srv.cfg, "sql_databases")
+	if err != nil {
+		return nil, err
+	}
+
+	dbs := make(map[string]*sql.DB, len(cfgs))
+	for name, cfg := range cfgs {
+		srv.log.Info("Connecting to SQL DB", "data_source", name)
+		db, err := openSQL(cfg)
+		if err == nil {
+			err = srv.pingSQL(name, db, cfg)
+			if err != nil {
+				_ = db.Close()
+			}
+		}
+		if err != nil {
+			for _, db := range dbs {
+				_ = db.Close()
+			}
+			return nil, fmt.Errorf("could not establish sql db connection %s - %w", name, err)
+		}
+		dbs[name] = db
+	}
+	return dbs, nil
+}
+
+// migrateSQL applies the schema migrations within sql_migrations_dir to the default SQL DB and to each named SQL DB
+// defining its own sql_migrations_dir, returning the number of databases migrated.
+func (srv *Server) migrateSQL() (int, error) {
+	cfgs, err := dataSources(srv.cfg, "sql_databases")
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	if srv.db != nil && srv.cfg.GetString("sql_migrations_dir") != "" {
+		err := srv.migrate("", srv.db, srv.cfg)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	for name, cfg := range cfgs {
+		db, ok := srv.dbs[name]
+		if !ok || cfg.GetString("sql_migrations_dir") == "" {
+			continue
+		}
+
+		err := srv.migrate(name, db, cfg)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// migrate applies the schema migrations within sql_migrations_dir to the database.
+func (srv *Server) migrate(name string, db *sql.DB, cfg *viper.Viper) error {
+	m, err := migrate.New(migrate.Config{
+		DB:      db,
+		Dialect: cfg.GetString("sql_type"),
+		Dir:     cfg.GetString("sql_migrations_dir"),
+	})
+	if err != nil {
+		return fmt.Errorf("could not migrate sql db %s - %w", name, err)
+	}
+
+	srv.log.Info("Applying SQL DB migrations", "data_source", name, "dir", cfg.GetString("sql_migrations_dir"))
+	applied, err := m.Up(srv.runCtx)
+	for _, mg := range applied {
+		srv.log.Info("Applied SQL DB migration", "data_source", name, "version", mg.Version, "name", mg.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("could not migrate sql db %s - %w", name, err)
+	}
+	if len(applied) == 0 {
+		srv.log.Info("SQL DB schema is up to date, nothing to migrate", "data_source", name)
+	}
+	return nil
+}
+
+// sqlPolicy returns the SQL statement policy of the function performing the host callback. Functions without a
+// sql_policy may execute any statement.
+func (srv *Server) sqlPolicy(ctx context.Context) sqlstore.Policy {
+	f, err := srv.funcConfig().LookupFunction(wasm.ModuleName(ctx))
+	if err != nil {
+		return sqlstore.Policy{}
+	}
+	return sqlstore.Policy{ReadOnly: f.SQLPolicy.ReadOnly, Statements: f.SQLPolicy.Statements}
+}
+
+// sqliteDSN returns the SQLite data source name for the database file at path, executing each pragma (i.e.
+// "busy_timeout(5000)") as connections are opened.
+func sqliteDSN(path string, pragmas []string) string {
+	dsn := path
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+
+	v := url.Values{}
+	for _, p := range pragmas {
+		if p = strings.TrimSpace(p); p != "" {
+			v.Add("_pragma", p)
+		}
+	}
+	if len(v) == 0 {
+		return dsn
+	}
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + v.Encode()
+}
@@ -0,0 +1,379 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+)
+
+func TestSQLiteDSN(t *testing.T) {
+	tt := []struct {
+		name    string
+		path    string
+		pragmas []string
+		dsn     string
+	}{
+		{name: "No Pragmas", path: "/data/tarmac.db", dsn: "file:/data/tarmac.db"},
+		{name: "File URI", path: "file:/data/tarmac.db", dsn: "file:/data/tarmac.db"},
+		{
+			name:    "Pragmas",
+			path:    "/data/tarmac.db",
+			pragmas: []string{"busy_timeout(5000)", " journal_mode(WAL) ", ""},
+			dsn:     "file:/data/tarmac.db?_pragma=busy_timeout%285000%29&_pragma=journal_mode%28WAL%29",
+		},
+		{
+			name:    "Existing Query",
+			path:    "file:/data/tarmac.db?mode=ro",
+			pragmas: []string{"foreign_keys(1)"},
+			dsn:     "file:/data/tarmac.db?mode=ro&_pragma=foreign_keys%281%29",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dsn := sqliteDSN(tc.path, tc.pragmas)
+			if dsn != tc.dsn {
+				t.Errorf("Unexpected DSN - got %s, expected %s", dsn, tc.dsn)
+			}
+		})
+	}
+}
+
+func TestOpenSQLite(t *testing.T) {
+	t.Run("Default Pragmas", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("sql_type", "sqlite")
+		cfg.Set("sql_path", filepath.Join(t.TempDir(), "tarmac.db"))
+
+		db, err := openSQL(cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error opening SQLite database - %s", err)
+		}
+		defer db.Close()
+
+		var mode string
+		err = db.QueryRow("PRAGMA journal_mode").Scan(&mode)
+		if err != nil {
+			t.Fatalf("Unexpected error querying SQLite database - %s", err)
+		}
+		if mode != "wal" {
+			t.Errorf("Unexpected journal mode - got %s, expected wal", mode)
+		}
+	})
+
+	t.Run("Configured Pragmas", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("sql_type", "sqlite")
+		cfg.Set("sql_path", filepath.Join(t.TempDir(), "tarmac.db"))
+		cfg.Set("sql_pragmas", []string{"busy_timeout(1234)"})
+
+		db, err := openSQL(cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error opening SQLite database - %s", err)
+		}
+		defer db.Close()
+
+		var timeout int
+		err = db.QueryRow("PRAGMA busy_timeout").Scan(&timeout)
+		if err != nil {
+			t.Fatalf("Unexpected error querying SQLite database - %s", err)
+		}
+		if timeout != 1234 {
+			t.Errorf("Unexpected busy timeout - got %d, expected 1234", timeout)
+		}
+
+		var mode string
+		err = db.QueryRow("PRAGMA journal_mode").Scan(&mode)
+		if err != nil {
+			t.Fatalf("Unexpected error querying SQLite database - %s", err)
+		}
+		if mode == "wal" {
+			t.Errorf("Unexpected journal mode - default pragmas should not be applied")
+		}
+	})
+
+	t.Run("Pool Options", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("sql_type", "sqlite")
+		cfg.Set("sql_path", filepath.Join(t.TempDir(), "tarmac.db"))
+		cfg.Set("sql_max_open_conns", 7)
+		cfg.Set("sql_max_idle_conns", 3)
+		cfg.Set("sql_conn_max_lifetime", 60)
+		cfg.Set("sql_conn_max_idle_time", 30)
+
+		db, err := openSQL(cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error opening SQLite database - %s", err)
+		}
+		defer db.Close()
+
+		if n := db.Stats().MaxOpenConnections; n != 7 {
+			t.Errorf("Unexpected max open connections - got %d, expected 7", n)
+		}
+	})
+
+	t.Run("Missing Path", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("sql_type", "sqlite")
+
+		_, err := openSQL(cfg)
+		if err == nil {
+			t.Errorf("Expected error opening SQLite database without a path")
+		}
+	})
+
+	t.Run("Unknown Type", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("sql_type", "oracle")
+
+		_, err := openSQL(cfg)
+		if err == nil {
+			t.Errorf("Expected error opening unknown SQL store")
+		}
+	})
+}
+
+func TestMigrateRunMode(t *testing.T) {
+	t.Run("Apply Migrations", func(t *testing.T) {
+		dir := t.TempDir()
+		err := os.WriteFile(
+			filepath.Join(dir, "1_create_users.up.sql"),
+			[]byte("CREATE TABLE users (id INTEGER PRIMARY KEY);"),
+			0600,
+		)
+		if err != nil {
+			t.Fatalf("Unable to write migration - %s", err)
+		}
+
+		path := filepath.Join(t.TempDir(), "tarmac.db")
+		cfg := viper.New()
+		cfg.Set("disable_logging", true)
+		cfg.Set("run_mode", "migrate")
+		cfg.Set("enable_sql", true)
+		cfg.Set("sql_type", "sqlite")
+		cfg.Set("sql_path", path)
+		cfg.Set("sql_migrations_dir", dir)
+
+		srv := New(cfg)
+		defer srv.Stop()
+		err = srv.Run()
+		if !errors.Is(err, ErrShutdown) {
+			t.Fatalf("Unexpected error running migrate mode - %v", err)
+		}
+
+		db, err := openSQL(cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error opening SQLite database - %s", err)
+		}
+		defer db.Close()
+
+		var count int
+		err = db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+		if err != nil {
+			t.Errorf("Unexpected error querying migrated table - %s", err)
+		}
+	})
+
+	t.Run("No Migrations", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("disable_logging", true)
+		cfg.Set("run_mode", "migrate")
+		cfg.Set("enable_sql", true)
+		cfg.Set("sql_type", "sqlite")
+		cfg.Set("sql_path", filepath.Join(t.TempDir(), "tarmac.db"))
+
+		srv := New(cfg)
+		defer srv.Stop()
+		err := srv.Run()
+		if err != nil {
+			t.Errorf("Unexpected error running migrate mode without migrations - %v", err)
+		}
+	})
+
+	t.Run("Already Migrated", func(t *testing.T) {
+		dir := t.TempDir()
+		err := os.WriteFile(
+			filepath.Join(dir, "1_create_users.up.sql"),
+			[]byte("CREATE TABLE users (id INTEGER PRIMARY KEY);"),
+			0600,
+		)
+		if err != nil {
+			t.Fatalf("Unable to write migration - %s", err)
+		}
+
+		cfg := viper.New()
+		cfg.Set("disable_logging", true)
+		cfg.Set("run_mode", "migrate")
+		cfg.Set("enable_sql", true)
+		cfg.Set("sql_type", "sqlite")
+		cfg.Set("sql_path", filepath.Join(t.TempDir(), "tarmac.db"))
+		cfg.Set("sql_migrations_dir", dir)
+
+		for i := 0; i < 2; i++ {
+			srv := New(cfg)
+			err = srv.Run()
+			srv.Stop()
+			if !errors.Is(err, ErrShutdown) {
+				t.Fatalf("Unexpected error running migrate mode %d times - %v", i+1, err)
+			}
+		}
+	})
+
+	t.Run("Failed Migration", func(t *testing.T) {
+		dir := t.TempDir()
+		err := os.WriteFile(filepath.Join(dir, "1_broken.up.sql"), []byte("INSERT INTO missing VALUES (1);"), 0600)
+		if err != nil {
+			t.Fatalf("Unable to write migration - %s", err)
+		}
+
+		cfg := viper.New()
+		cfg.Set("disable_logging", true)
+		cfg.Set("run_mode", "migrate")
+		cfg.Set("enable_sql", true)
+		cfg.Set("sql_type", "sqlite")
+		cfg.Set("sql_path", filepath.Join(t.TempDir(), "tarmac.db"))
+		cfg.Set("sql_migrations_dir", dir)
+
+		srv := New(cfg)
+		defer srv.Stop()
+		err = srv.Run()
+		if err == nil || errors.Is(err, ErrShutdown) {
+			t.Errorf("Expected error running migrate mode with a failed migration - %v", err)
+		}
+	})
+}
+
+func TestPingSQL(t *testing.T) {
+	cfg := viper.New()
+	cfg.Set("disable_logging", true)
+	srv := New(cfg)
+
+	t.Run("Reachable", func(t *testing.T) {
+		c := viper.New()
+		c.Set("sql_type", "sqlite")
+		c.Set("sql_path", filepath.Join(t.TempDir(), "tarmac.db"))
+
+		db, err := openSQL(c)
+		if err != nil {
+			t.Fatalf("Unexpected error opening SQLite database - %s", err)
+		}
+		defer db.Close()
+
+		err = srv.pingSQL("", db, c)
+		if err != nil {
+			t.Errorf("Unexpected error pinging SQLite database - %s", err)
+		}
+	})
+
+	t.Run("Unreachable", func(t *testing.T) {
+		c := viper.New()
+		c.Set("sql_type", "sqlite")
+		c.Set("sql_path", filepath.Join(t.TempDir(), "missing", "tarmac.db"))
+		c.Set("sql_connect_retries", 2)
+		c.Set("sql_connect_retry_interval", 0)
+
+		db, err := openSQL(c)
+		if err != nil {
+			t.Fatalf("Unexpected error opening SQLite database - %s", err)
+		}
+		defer db.Close()
+
+		err = srv.pingSQL("", db, c)
+		if err == nil {
+			t.Errorf("Expected error pinging unreachable SQLite database")
+		}
+	})
+}
+
+func TestReadySQL(t *testing.T) {
+	cfg := viper.New()
+	cfg.Set("disable_logging", true)
+	cfg.Set("sql_type", "sqlite")
+	cfg.Set("sql_path", filepath.Join(t.TempDir(), "tarmac.db"))
+
+	db, err := openSQL(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error opening SQLite database - %s", err)
+	}
+
+	srv := New(cfg)
+	srv.db = db
+
+	tt := []struct {
+		name   string
+		status int
+		setup  func()
+	}{
+		{name: "Reachable", status: http.StatusOK, setup: func() {}},
+		{name: "Unreachable", status: http.StatusServiceUnavailable, setup: func() { _ = db.Close() }},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.setup()
+
+			w := httptest.NewRecorder()
+			srv.Ready(w, httptest.NewRequest(http.MethodGet, "/ready", nil), nil)
+			if w.Code != tc.status {
+				t.Errorf("Unexpected http status code when checking readiness - got %d, expected %d", w.Code, tc.status)
+			}
+		})
+	}
+}
+
+func TestRegisterSQLStats(t *testing.T) {
+	cfg := viper.New()
+	cfg.Set("disable_logging", true)
+	cfg.Set("sql_type", "sqlite")
+	cfg.Set("sql_path", filepath.Join(t.TempDir(), "tarmac.db"))
+
+	db, err := openSQL(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error opening SQLite database - %s", err)
+	}
+	defer db.Close()
+
+	srv := New(cfg)
+	srv.db = db
+	srv.dbs = map[string]*sql.DB{"orders": db}
+
+	unregister := srv.registerSQLStats()
+
+	found := func() map[string]bool {
+		names := make(map[string]bool)
+		mfs, err := prometheus.DefaultGatherer.Gather()
+		if err != nil {
+			t.Fatalf("Unexpected error gathering metrics - %s", err)
+		}
+		for _, mf := range mfs {
+			if mf.GetName() != "go_sql_max_open_connections" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if l.GetName() == "db_name" {
+						names[l.GetValue()] = true
+					}
+				}
+			}
+		}
+		return names
+	}
+
+	names := found()
+	if !names["default"] || !names["orders"] {
+		t.Errorf("Unexpected SQL DB metrics - %v", names)
+	}
+
+	unregister()
+	if names := found(); len(names) != 0 {
+		t.Errorf("Unexpected SQL DB metrics after unregistering - %v", names)
+	}
+}
@@ -0,0 +1,237 @@
+/*
+Package boltkv is a hord.Database driver storing keys within a bucket of a BoltDB file, extending the hord bbolt driver
+with native prefix scans.
+
+	// Open the BoltDB file
+	kv, err := boltkv.Dial(boltkv.Config{
+		Filename:   "/data/tarmac.db",
+		Bucketname: "tarmac",
+	})
+	if err != nil {
+		// do something
+	}
+
+	// Create the bucket if it does not exist
+	err = kv.Setup()
+	if err != nil {
+		// do something
+	}
+
+Keys are stored within the bucket as the hord bbolt driver stores them, so existing BoltDB files remain readable. Keys
+are kept in byte order, allowing Scan to seek to the first matching key rather than listing every key.
+*/
+package boltkv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tarmac-project/hord"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrNoBucket is returned by operations on a Database whose bucket has not been created by Setup.
+var ErrNoBucket = errors.New("bucket does not exist")
+
+// Config provides the configuration options of a Database.
+type Config struct {
+	// Filename is the path of the BoltDB file, created if it does not exist.
+	Filename string
+
+	// Bucketname is the bucket keys are stored within.
+	Bucketname string
+
+	// Permissions are the file mode of a created BoltDB file.
+	Permissions os.FileMode
+
+	// Timeout is the maximum duration to wait for the file lock held by other processes. Zero waits indefinitely.
+	Timeout time.Duration
+}
+
+// Database is a hord.Database storing keys within a BoltDB bucket.
+type Database struct {
+	// db is the open BoltDB file.
+	db *bolt.DB
+
+	// bucket is the name of the bucket storing keys.
+	bucket []byte
+}
+
+// Dial opens the BoltDB file of Config and returns a Database using it. The bucket is created by Setup.
+func Dial(cfg Config) (*Database, error) {
+	if cfg.Filename == "" {
+		return nil, errors.New("filename cannot be empty")
+	}
+	if cfg.Bucketname == "" {
+		return nil, errors.New("bucketname cannot be empty")
+	}
+
+	db, err := bolt.Open(cfg.Filename, cfg.Permissions, &bolt.Options{Timeout: cfg.Timeout})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open boltdb file %s - %w", cfg.Filename, err)
+	}
+	return &Database{db: db, bucket: []byte(cfg.Bucketname)}, nil
+}
+
+// Setup creates the bucket if it does not exist.
+func (d *Database) Setup() error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(d.bucket)
+		if err != nil {
+			return fmt.Errorf("unable to create bucket %s - %w", d.bucket, err)
+		}
+		return nil
+	})
+}
+
+// HealthCheck confirms the file is open and the bucket exists.
+func (d *Database) HealthCheck() error {
+	return d.db.View(func(tx *bolt.Tx) error {
+		_, err := d.lookup(tx)
+		return err
+	})
+}
+
+// Get fetches the data stored under key, returning hord.ErrNil if the key does not exist.
+func (d *Database) Get(key string) ([]byte, error) {
+	if err := hord.ValidKey(key); err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b, err := d.lookup(tx)
+		if err != nil {
+			return err
+		}
+
+		v := b.Get([]byte(key))
+		if v == nil {
+			return hord.ErrNil
+		}
+
+		// Values are only valid within the transaction
+		data = bytes.Clone(v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Set stores data under key, replacing any existing data.
+func (d *Database) Set(key string, data []byte) error {
+	if err := hord.ValidKey(key); err != nil {
+		return err
+	}
+	if err := hord.ValidData(data); err != nil {
+		return err
+	}
+
+	return d.db.Update(func(tx *bolt.Tx) error {
+		b, err := d.lookup(tx)
+		if err != nil {
+			return err
+		}
+
+		err = b.Put([]byte(key), data)
+		if err != nil {
+			return fmt.Errorf("unable to store key %s - %w", key, err)
+		}
+		return nil
+	})
+}
+
+// Delete removes the key. Deleting a missing key is not an error.
+func (d *Database) Delete(key string) error {
+	if err := hord.ValidKey(key); err != nil {
+		return err
+	}
+
+	return d.db.Update(func(tx *bolt.Tx) error {
+		b, err := d.lookup(tx)
+		if err != nil {
+			return err
+		}
+
+		err = b.Delete([]byte(key))
+		if err != nil {
+			return fmt.Errorf("unable to delete key %s - %w", key, err)
+		}
+		return nil
+	})
+}
+
+// Keys lists every key in byte order.
+func (d *Database) Keys() ([]string, error) {
+	var keys []string
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b, err := d.lookup(tx)
+		if err != nil {
+			return err
+		}
+
+		return b.ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Scan lists keys beginning with prefix in byte order, resuming after cursor, by seeking a cursor of the bucket to the
+// first matching key. It returns up to limit keys along with the last key returned as the cursor when more keys
+// remain. When limit is zero or less, every remaining key is listed.
+func (d *Database) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	var keys []string
+	var next string
+	err := d.db.View(func(tx *bolt.Tx) error {
+		b, err := d.lookup(tx)
+		if err != nil {
+			return err
+		}
+
+		start := prefix
+		if cursor > start {
+			start = cursor
+		}
+
+		c := b.Cursor()
+		for k, _ := c.Seek([]byte(start)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Next() {
+			if string(k) == cursor {
+				continue
+			}
+			if limit > 0 && len(keys) == limit {
+				next = keys[len(keys)-1]
+				return nil
+			}
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return keys, next, nil
+}
+
+// Close closes the BoltDB file, releasing its file lock.
+func (d *Database) Close() {
+	_ = d.db.Close()
+}
+
+// lookup returns the bucket storing keys within the transaction.
+func (d *Database) lookup(tx *bolt.Tx) (*bolt.Bucket, error) {
+	b := tx.Bucket(d.bucket)
+	if b == nil {
+		return nil, fmt.Errorf("%w - %s", ErrNoBucket, d.bucket)
+	}
+	return b, nil
+}
@@ -0,0 +1,169 @@
+package boltkv
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tarmac-project/hord"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestDial(t *testing.T) {
+	tt := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "Missing Filename", cfg: Config{Bucketname: "tarmac"}},
+		{name: "Missing Bucketname", cfg: Config{Filename: filepath.Join(t.TempDir(), "kv.db")}},
+		{name: "Invalid Path", cfg: Config{Filename: filepath.Join(t.TempDir(), "missing", "kv.db"), Bucketname: "tarmac"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.Permissions = 0600
+			_, err := Dial(tc.cfg)
+			if err == nil {
+				t.Errorf("Expected error creating kv store")
+			}
+		})
+	}
+}
+
+func TestDatabase(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "kv.db")
+	kv, err := Dial(Config{Filename: filename, Bucketname: "tarmac", Permissions: 0600, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Unexpected error creating kv store - %s", err)
+	}
+
+	err = kv.HealthCheck()
+	if !errors.Is(err, ErrNoBucket) {
+		t.Errorf("Unexpected error checking health before setup - %v", err)
+	}
+
+	err = kv.Setup()
+	if err != nil {
+		t.Fatalf("Unexpected error setting up kv store - %s", err)
+	}
+
+	err = kv.HealthCheck()
+	if err != nil {
+		t.Errorf("Unexpected error checking health - %s", err)
+	}
+
+	t.Run("Set and Get", func(t *testing.T) {
+		for _, data := range []string{"one", "two"} {
+			err := kv.Set("key", []byte(data))
+			if err != nil {
+				t.Fatalf("Unexpected error setting key - %s", err)
+			}
+
+			got, err := kv.Get("key")
+			if err != nil || string(got) != data {
+				t.Errorf("Unexpected value fetched - %q, %v", got, err)
+			}
+		}
+
+		_, err := kv.Get("missing")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected error fetching missing key - %v", err)
+		}
+	})
+
+	t.Run("Invalid Input", func(t *testing.T) {
+		err := kv.Set("", []byte("data"))
+		if !errors.Is(err, hord.ErrInvalidKey) {
+			t.Errorf("Unexpected error setting empty key - %v", err)
+		}
+		err = kv.Set("key", nil)
+		if !errors.Is(err, hord.ErrInvalidData) {
+			t.Errorf("Unexpected error setting empty data - %v", err)
+		}
+	})
+
+	t.Run("Keys", func(t *testing.T) {
+		for _, k := range []string{"user:b", "user:a", "session:a", "user:c"} {
+			err := kv.Set(k, []byte(k))
+			if err != nil {
+				t.Fatalf("Unexpected error setting key - %s", err)
+			}
+		}
+
+		keys, err := kv.Keys()
+		if err != nil || strings.Join(keys, ",") != "key,session:a,user:a,user:b,user:c" {
+			t.Errorf("Unexpected keys listed - %v, %v", keys, err)
+		}
+	})
+
+	t.Run("Scan", func(t *testing.T) {
+		tc := []struct {
+			name   string
+			prefix string
+			cursor string
+			limit  int
+			keys   string
+			next   string
+		}{
+			{name: "Every Key", keys: "key,session:a,user:a,user:b,user:c"},
+			{name: "Prefix", prefix: "user:", keys: "user:a,user:b,user:c"},
+			{name: "First Page", prefix: "user:", limit: 2, keys: "user:a,user:b", next: "user:b"},
+			{name: "Last Page", prefix: "user:", cursor: "user:b", limit: 2, keys: "user:c"},
+			{name: "Exact Page", prefix: "user:", limit: 3, keys: "user:a,user:b,user:c"},
+			{name: "Cursor before Prefix", prefix: "user:", cursor: "key", keys: "user:a,user:b,user:c"},
+			{name: "Cursor after Prefix", prefix: "session:", cursor: "user:a"},
+			{name: "No Match", prefix: "missing:"},
+		}
+
+		for _, c := range tc {
+			t.Run(c.name, func(t *testing.T) {
+				keys, next, err := kv.Scan(c.prefix, c.cursor, c.limit)
+				if err != nil {
+					t.Fatalf("Unexpected error scanning keys - %s", err)
+				}
+				if strings.Join(keys, ",") != c.keys || next != c.next {
+					t.Errorf("Unexpected scan result - %v, %q", keys, next)
+				}
+			})
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		err := kv.Delete("key")
+		if err != nil {
+			t.Fatalf("Unexpected error deleting key - %s", err)
+		}
+		_, err = kv.Get("key")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected error fetching deleted key - %v", err)
+		}
+
+		err = kv.Delete("key")
+		if err != nil {
+			t.Errorf("Unexpected error deleting missing key - %s", err)
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		kv.Close()
+
+		_, err := kv.Get("user:a")
+		if !errors.Is(err, bolt.ErrDatabaseNotOpen) {
+			t.Errorf("Unexpected error fetching key after close - %v", err)
+		}
+
+		// Closing releases the file lock and keeps the stored keys
+		reopened, err := Dial(Config{Filename: filename, Bucketname: "tarmac", Permissions: 0600, Timeout: time.Second})
+		if err != nil {
+			t.Fatalf("Unexpected error reopening kv store - %s", err)
+		}
+		defer reopened.Close()
+
+		data, err := reopened.Get("user:a")
+		if err != nil || string(data) != "user:a" {
+			t.Errorf("Unexpected value fetched after reopening - %q, %v", data, err)
+		}
+	})
+}
@@ -4,6 +4,16 @@ Package callbacks provides a Host Callback router for wapc-go servers.
 This package is deprecated and will be removed in a future release.
 
 Use github.com/tarmac-project/wapc-toolkit instead.
+
+Callbacks registered with RegisterCallbackContext receive the context of the host call, allowing callbacks to observe
+the cancellation and deadline of the WASM function execution that made the call.
+
+When an Authorize function is configured, every host call must be authorized before the callback is executed. Host
+calls which are not authorized are rejected with ErrNotPermitted.
+
+Tarmac itself continues to route host callbacks using this package until
+github.com/tarmac-project/wapc-toolkit/callbacks passes the context of the host call to callbacks. This is an interim
+measure and does not lift the deprecation.
 */
 package callbacks
 
@@ -16,8 +26,9 @@ import (
 )
 
 var (
-	ErrNotFound = errors.New("callback not found")
-	ErrCanceled = errors.New("callback context has expired")
+	ErrNotFound     = errors.New("callback not found")
+	ErrCanceled     = errors.New("callback context has expired")
+	ErrNotPermitted = errors.New("callback not permitted")
 )
 
 // Router is a callback router, which provides a Callback function that users can register with wapc-go. This callback function will
@@ -35,6 +46,9 @@ type Router struct {
 	// postFunc is a user-defined function called after the execution of the registered callback function. This postFunc is
 	// used to enable tracking of callback execution as well as the results of each execution.
 	postFunc func(CallbackResult)
+
+	// authorize holds a user-defined function deciding if a host call may execute the requested callback.
+	authorize func(context.Context, string, string) bool
 }
 
 // Config will configure the Callbacks router and allows users to specify items such as the PreFunc or any router level configurations.
@@ -46,6 +60,11 @@ type Config struct {
 	// PostFunc is a user-defined function called after the execution of the registered callback function. This PostFunc is
 	// used to enable tracking of callback execution as well as the results of each execution.
 	PostFunc func(CallbackResult)
+
+	// Authorize is a user-defined function called with the context, namespace, and operation of every host call before
+	// the callback is looked up. Host calls are rejected with ErrNotPermitted when Authorize returns false. When
+	// undefined, all host calls are permitted.
+	Authorize func(ctx context.Context, namespace, op string) bool
 }
 
 // Callback is a type that holds the details and function used for callback execution. This type is primarily used internally but
@@ -61,6 +80,10 @@ type Callback struct {
 	// Func is the user-provided callback function. This function will execute when the router receives a call with the
 	// specified Namespace and Operation key.
 	Func func([]byte) ([]byte, error)
+
+	// FuncContext is the user-provided context-aware callback function. When defined, this function is executed in place
+	// of Func with the context of the host call.
+	FuncContext func(context.Context, []byte) ([]byte, error)
 }
 
 // CallbackResult provides detailed information regarding Callback execution. The callback result is the input to the
@@ -92,8 +115,9 @@ type CallbackResult struct {
 // New will return a Router instance that users can use to register callbacks and provide a generic host callback function.
 func New(cfg Config) *Router {
 	r := &Router{
-		preFunc:  cfg.PreFunc,
-		postFunc: cfg.PostFunc,
+		preFunc:   cfg.PreFunc,
+		postFunc:  cfg.PostFunc,
+		authorize: cfg.Authorize,
 	}
 	r.callbacks = make(map[string]*Callback)
 	return r
@@ -117,6 +141,11 @@ func (r *Router) Callback(ctx context.Context, _, namespace, op string, data []b
 		return []byte(""), errors.New("namespace and op cannot be empty")
 	}
 
+	// Reject host calls the caller is not permitted to make
+	if r.authorize != nil && !r.authorize(ctx, namespace, op) {
+		return []byte(""), fmt.Errorf("%w - %s:%s", ErrNotPermitted, namespace, op)
+	}
+
 	// Lookup registered Callback
 	key := fmt.Sprintf("%s:%s", namespace, op)
 	c, err := r.Lookup(key)
@@ -138,7 +167,7 @@ func (r *Router) Callback(ctx context.Context, _, namespace, op string, data []b
 	}
 
 	// Run the callback returning to user
-	if c.Func != nil {
+	if c.Func != nil || c.FuncContext != nil {
 		result := CallbackResult{
 			Namespace: namespace,
 			Operation: op,
@@ -147,7 +176,11 @@ func (r *Router) Callback(ctx context.Context, _, namespace, op string, data []b
 		}
 
 		// Call user-function and capture results
-		result.Output, result.Err = c.Func(result.Input)
+		if c.FuncContext != nil {
+			result.Output, result.Err = c.FuncContext(ctx, result.Input)
+		} else {
+			result.Output, result.Err = c.Func(result.Input)
+		}
 		result.EndTime = time.Now()
 
 		// Call user-defined PostFunc
@@ -171,6 +204,18 @@ func (r *Router) RegisterCallback(namespace, op string, f func([]byte) ([]byte,
 	}
 }
 
+// RegisterCallbackContext will add the provided context-aware function into the internal map store of Callbacks. When
+// executed, the function is provided the context of the host call.
+func (r *Router) RegisterCallbackContext(namespace, op string, f func(context.Context, []byte) ([]byte, error)) {
+	r.Lock()
+	defer r.Unlock()
+	r.callbacks[fmt.Sprintf("%s:%s", namespace, op)] = &Callback{
+		Namespace:   namespace,
+		Operation:   op,
+		FuncContext: f,
+	}
+}
+
 // DelCallback will remove any Callback functions saved for the specified namespace and operation.
 func (r *Router) DelCallback(namespace, op string) {
 	r.Lock()
@@ -150,3 +150,69 @@ func TestCallbacks(t *testing.T) {
 		}
 	})
 }
+
+func TestCallbacksContext(t *testing.T) {
+	router := New(Config{})
+
+	type ctxKey struct{}
+	router.RegisterCallbackContext("context", "value", func(ctx context.Context, _ []byte) ([]byte, error) {
+		v, _ := ctx.Value(ctxKey{}).(string)
+		return []byte(v), nil
+	})
+
+	t.Run("Context Passed to Callback", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), ctxKey{}, "howdie")
+		b, err := router.Callback(ctx, "default", "context", "value", []byte(""))
+		if err != nil {
+			t.Fatalf("Unexpected error when calling Callback function for registered callback - %s", err)
+		}
+		if string(b) != "howdie" {
+			t.Errorf("Callback did not receive the host call context - %s", b)
+		}
+	})
+
+	t.Run("Canceled Context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := router.Callback(ctx, "default", "context", "value", []byte(""))
+		if !errors.Is(err, ErrCanceled) {
+			t.Errorf("Expected canceled error when calling Callback with canceled context, got %v", err)
+		}
+	})
+}
+
+func TestCallbacksAuthorize(t *testing.T) {
+	type ctxKey struct{}
+	router := New(Config{
+		Authorize: func(ctx context.Context, namespace, op string) bool {
+			caller, _ := ctx.Value(ctxKey{}).(string)
+			return caller == "trusted" || namespace+":"+op == "kv:get"
+		},
+	})
+
+	router.RegisterCallback("kv", "get", func([]byte) ([]byte, error) { return []byte("value"), nil })
+	router.RegisterCallback("kv", "delete", func([]byte) ([]byte, error) { return []byte(""), nil })
+
+	tt := []struct {
+		name   string
+		caller string
+		op     string
+		err    error
+	}{
+		{name: "Permitted Operation", caller: "untrusted", op: "get"},
+		{name: "Denied Operation", caller: "untrusted", op: "delete", err: ErrNotPermitted},
+		{name: "Permitted Caller", caller: "trusted", op: "delete"},
+		{name: "Unknown Operation", caller: "untrusted", op: "keys", err: ErrNotPermitted},
+		{name: "Unknown Operation Permitted Caller", caller: "trusted", op: "keys", err: ErrNotFound},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), ctxKey{}, tc.caller)
+			_, err := router.Callback(ctx, "default", "kv", tc.op, []byte(""))
+			if !errors.Is(err, tc.err) {
+				t.Errorf("Unexpected error calling callback - %v", err)
+			}
+		})
+	}
+}
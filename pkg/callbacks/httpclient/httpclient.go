@@ -85,12 +85,18 @@ func New(cfg Config) (*HTTPClient, error) {
 // base64 decoding of payload data are all handled via this function. Note, this function expects the
 // HTTPClientRequest JSON type as input and will return a KVStoreGetResponse JSON.
 func (hc *HTTPClient) Call(b []byte) ([]byte, error) {
+	return hc.CallContext(context.Background(), b)
+}
+
+// CallContext performs the same function as Call, with the HTTP request bound to the provided context. When the context
+// is canceled or its deadline expires, the HTTP request is aborted.
+func (hc *HTTPClient) CallContext(ctx context.Context, b []byte) ([]byte, error) {
 	// Parse incoming Request
 	msg := &proto.HTTPClient{}
 	err := msg.UnmarshalVT(b)
 	if err != nil {
 		// Assume JSON for backwards compatibility
-		return hc.callJSON(b)
+		return hc.callJSON(ctx, b)
 	}
 
 	// Create HTTPClientResponse
@@ -113,7 +119,7 @@ func (hc *HTTPClient) Call(b []byte) ([]byte, error) {
 
 	// Create HTTP Request
 	request, err = http.NewRequestWithContext(
-		context.Background(),
+		ctx,
 		msg.GetMethod(),
 		msg.GetUrl(),
 		bytes.NewBuffer(msg.GetBody()),
@@ -181,7 +187,7 @@ func (hc *HTTPClient) Call(b []byte) ([]byte, error) {
 	return rsp, fmt.Errorf("%s", r.GetStatus().GetStatus())
 }
 
-func (hc *HTTPClient) callJSON(b []byte) ([]byte, error) {
+func (hc *HTTPClient) callJSON(ctx context.Context, b []byte) ([]byte, error) {
 	// Start Response Message assuming everything is good
 	r := tarmac.HTTPClientResponse{}
 	r.Status.Code = 200
@@ -218,7 +224,7 @@ func (hc *HTTPClient) callJSON(b []byte) ([]byte, error) {
 		}
 
 		// Create HTTP Request
-		request, err = http.NewRequestWithContext(context.Background(), rq.Method, rq.URL, bytes.NewBuffer(data))
+		request, err = http.NewRequestWithContext(ctx, rq.Method, rq.URL, bytes.NewBuffer(data))
 		if err != nil {
 			r.Status.Code = 400
 			r.Status.Status = fmt.Sprintf("Unable to create HTTP request - %s", err)
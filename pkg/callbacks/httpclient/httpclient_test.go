@@ -1,6 +1,7 @@
 package httpclient
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/pquerna/ffjson/ffjson"
 
@@ -701,3 +703,49 @@ func TestCallSkipsNilProtobufHeaders(t *testing.T) {
 		t.Fatalf("unexpected status code: got %d want %d", rsp.GetStatus().GetCode(), http.StatusOK)
 	}
 }
+
+func TestCallContextCanceled(t *testing.T) {
+	h, err := New(Config{})
+	if err != nil {
+		t.Fatalf("Unable to create HTTP Client - %s", err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	req := &proto.HTTPClient{Method: "GET", Url: ts.URL}
+	msg, err := req.MarshalVT()
+	if err != nil {
+		t.Fatalf("Unable to marshal protobuf request - %s", err)
+	}
+
+	t.Run("Protobuf", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		b, err := h.CallContext(ctx, msg)
+		if err == nil {
+			t.Fatalf("Expected error from HTTP call with expired context")
+		}
+
+		var rsp proto.HTTPClientResponse
+		if err := rsp.UnmarshalVT(b); err != nil {
+			t.Fatalf("Failed to unmarshal protobuf response: %s", err)
+		}
+		if rsp.GetStatus().GetCode() != http.StatusInternalServerError {
+			t.Errorf("unexpected status code: got %d want %d", rsp.GetStatus().GetCode(), http.StatusInternalServerError)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := h.CallContext(ctx, []byte(fmt.Sprintf(`{"method":"GET","url":"%s"}`, ts.URL)))
+		if err == nil {
+			t.Fatalf("Expected error from HTTP call with expired context")
+		}
+	})
+}
@@ -0,0 +1,236 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pquerna/ffjson/ffjson"
+	"github.com/tarmac-project/hord"
+
+	"github.com/tarmac-project/tarmac"
+	"github.com/tarmac-project/tarmac/pkg/kvext"
+)
+
+// ErrAtomicNotSupported is returned when a request performs an atomic operation on a KV store unable to modify keys
+// atomically.
+var ErrAtomicNotSupported = errors.New("kv store does not support atomic operations")
+
+// atomic returns the KV store named by the data source of a request as a kvext.Atomic.
+func (k *KVStore) atomic(ctx context.Context, name string) (kvext.Atomic, int, error) {
+	kv, err := k.store(ctx, name)
+	if err != nil {
+		return nil, 404, err
+	}
+
+	a, ok := kv.(kvext.Atomic)
+	if !ok {
+		return nil, 501, ErrAtomicNotSupported
+	}
+	return a, 200, nil
+}
+
+// atomicCode returns the status code of an error returned by an atomic operation.
+func atomicCode(err error) int {
+	switch {
+	case errors.Is(err, kvext.ErrNotSupported):
+		return 501
+	case errors.Is(err, kvext.ErrNotInteger):
+		return 409
+	case errors.Is(err, hord.ErrInvalidKey), errors.Is(err, hord.ErrInvalidData):
+		return 400
+	}
+	return 500
+}
+
+// CompareAndSwap will store data under the key specified if the key currently holds the expected value. Requests
+// whose key holds another value, or does not exist, succeed without swapping.
+func (k *KVStore) CompareAndSwap(b []byte) ([]byte, error) {
+	return k.CompareAndSwapContext(context.Background(), b)
+}
+
+// CompareAndSwapContext performs the same function as CompareAndSwap, using the KV store selected for the context when
+// the request does not specify a data source.
+func (k *KVStore) CompareAndSwapContext(ctx context.Context, b []byte) ([]byte, error) {
+	// Start Response Message assuming everything is good
+	r := tarmac.KVStoreCASResponse{}
+	r.Status.Code = 200
+	r.Status.Status = "OK"
+
+	// Parse incoming Request
+	var rq tarmac.KVStoreCAS
+	err := ffjson.Unmarshal(b, &rq)
+	if err != nil {
+		r.Status.Code = 400
+		r.Status.Status = "Error Parsing Input"
+	}
+
+	if r.Status.Code == 200 && rq.Key == "" {
+		r.Status.Code = 400
+		r.Status.Status = ErrNilKey.Error()
+	}
+
+	// Decode expected and new values
+	expected, err := base64.StdEncoding.DecodeString(rq.Expected)
+	if err != nil {
+		r.Status.Code = 400
+		r.Status.Status = fmt.Sprintf("Unable to decode expected data - %s", err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(rq.Data)
+	if err != nil {
+		r.Status.Code = 400
+		r.Status.Status = fmt.Sprintf("Unable to decode data - %s", err)
+	}
+
+	var kv kvext.Atomic
+	if r.Status.Code == 200 {
+		kv, r.Status.Code, err = k.atomic(ctx, rq.DataSource)
+		if err != nil {
+			r.Status.Status = fmt.Sprintf("Unable to use data source - %s", err)
+		}
+	}
+
+	if r.Status.Code == 200 {
+		r.Swapped, err = kv.CompareAndSwap(rq.Key, expected, data)
+		if err != nil {
+			r.Status.Code = atomicCode(err)
+			r.Status.Status = fmt.Sprintf("Unable to swap key %s - %s", rq.Key, err)
+		}
+	}
+
+	// Marshal a response JSON to return to caller
+	rsp, err := ffjson.Marshal(r)
+	if err != nil {
+		return []byte(""), errors.New("unable to marshal kvstore:cas response")
+	}
+
+	if r.Status.Code == 200 {
+		return rsp, nil
+	}
+	return rsp, fmt.Errorf("%s", r.Status.Status)
+}
+
+// Incr will add a delta to the base 10 integer stored under the key specified, returning the new value. Missing keys
+// are treated as zero.
+func (k *KVStore) Incr(b []byte) ([]byte, error) {
+	return k.IncrContext(context.Background(), b)
+}
+
+// IncrContext performs the same function as Incr, using the KV store selected for the context when the request does
+// not specify a data source.
+func (k *KVStore) IncrContext(ctx context.Context, b []byte) ([]byte, error) {
+	// Start Response Message assuming everything is good
+	r := tarmac.KVStoreIncrResponse{}
+	r.Status.Code = 200
+	r.Status.Status = "OK"
+
+	// Parse incoming Request
+	var rq tarmac.KVStoreIncr
+	err := ffjson.Unmarshal(b, &rq)
+	if err != nil {
+		r.Status.Code = 400
+		r.Status.Status = "Error Parsing Input"
+	}
+
+	if r.Status.Code == 200 && rq.Key == "" {
+		r.Status.Code = 400
+		r.Status.Status = ErrNilKey.Error()
+	}
+
+	var kv kvext.Atomic
+	if r.Status.Code == 200 {
+		kv, r.Status.Code, err = k.atomic(ctx, rq.DataSource)
+		if err != nil {
+			r.Status.Status = fmt.Sprintf("Unable to use data source - %s", err)
+		}
+	}
+
+	if r.Status.Code == 200 {
+		r.Value, err = kv.Incr(rq.Key, rq.Delta)
+		if err != nil {
+			r.Status.Code = atomicCode(err)
+			r.Status.Status = fmt.Sprintf("Unable to increment key %s - %s", rq.Key, err)
+		}
+	}
+
+	// Marshal a response JSON to return to caller
+	rsp, err := ffjson.Marshal(r)
+	if err != nil {
+		return []byte(""), errors.New("unable to marshal kvstore:incr response")
+	}
+
+	if r.Status.Code == 200 {
+		return rsp, nil
+	}
+	return rsp, fmt.Errorf("%s", r.Status.Status)
+}
+
+// SetNX will store data under the key specified if the key does not exist. Requests for existing keys succeed without
+// storing the data.
+func (k *KVStore) SetNX(b []byte) ([]byte, error) {
+	return k.SetNXContext(context.Background(), b)
+}
+
+// SetNXContext performs the same function as SetNX, using the KV store selected for the context when the request does
+// not specify a data source.
+func (k *KVStore) SetNXContext(ctx context.Context, b []byte) ([]byte, error) {
+	// Start Response Message assuming everything is good
+	r := tarmac.KVStoreSetNXResponse{}
+	r.Status.Code = 200
+	r.Status.Status = "OK"
+
+	// Parse incoming Request
+	var rq tarmac.KVStoreSetNX
+	err := ffjson.Unmarshal(b, &rq)
+	if err != nil {
+		r.Status.Code = 400
+		r.Status.Status = "Error Parsing Input"
+	}
+
+	if r.Status.Code == 200 && rq.Key == "" {
+		r.Status.Code = 400
+		r.Status.Status = ErrNilKey.Error()
+	}
+
+	// Decode data to store
+	data, err := base64.StdEncoding.DecodeString(rq.Data)
+	if err != nil {
+		r.Status.Code = 400
+		r.Status.Status = fmt.Sprintf("Unable to decode data - %s", err)
+	}
+
+	if rq.TTL < 0 {
+		r.Status.Code = 400
+		r.Status.Status = "TTL cannot be negative"
+	}
+
+	var kv kvext.Atomic
+	if r.Status.Code == 200 {
+		kv, r.Status.Code, err = k.atomic(ctx, rq.DataSource)
+		if err != nil {
+			r.Status.Status = fmt.Sprintf("Unable to use data source - %s", err)
+		}
+	}
+
+	if r.Status.Code == 200 {
+		r.Set, err = kv.SetNX(rq.Key, data, time.Duration(rq.TTL)*time.Second)
+		if err != nil {
+			r.Status.Code = atomicCode(err)
+			r.Status.Status = fmt.Sprintf("Unable to store data using key %s - %s", rq.Key, err)
+		}
+	}
+
+	// Marshal a response JSON to return to caller
+	rsp, err := ffjson.Marshal(r)
+	if err != nil {
+		return []byte(""), errors.New("unable to marshal kvstore:setnx response")
+	}
+
+	if r.Status.Code == 200 {
+		return rsp, nil
+	}
+	return rsp, fmt.Errorf("%s", r.Status.Status)
+}
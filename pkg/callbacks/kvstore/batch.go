@@ -0,0 +1,170 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/pquerna/ffjson/ffjson"
+	"github.com/tarmac-project/hord"
+
+	"github.com/tarmac-project/tarmac"
+	"github.com/tarmac-project/tarmac/pkg/kvext"
+)
+
+// MaxBatchSize is the maximum number of keys or entries within a single batch request.
+const MaxBatchSize = 1000
+
+// MGet will fetch the data stored under multiple keys, returning a result per key. KV stores implementing
+// kvext.Batcher fetch every key with a single request.
+func (k *KVStore) MGet(b []byte) ([]byte, error) {
+	return k.MGetContext(context.Background(), b)
+}
+
+// MGetContext performs the same function as MGet, using the KV store selected for the context when the request does
+// not specify a data source.
+func (k *KVStore) MGetContext(ctx context.Context, b []byte) ([]byte, error) {
+	var rq tarmac.KVStoreMGet
+	err := ffjson.Unmarshal(b, &rq)
+	if err != nil {
+		return batchResponse(nil, 400, "Error Parsing Input", "mget")
+	}
+
+	kv, code, status := k.batchStore(ctx, rq.DataSource, len(rq.Keys))
+	if code != 200 {
+		return batchResponse(nil, code, status, "mget")
+	}
+
+	data, errs := kvext.GetMany(kv, rq.Keys)
+	results := make([]tarmac.KVStoreResult, len(rq.Keys))
+	for i, key := range rq.Keys {
+		results[i] = result(key, errs[i], "Unable to fetch key")
+		if errs[i] == nil {
+			results[i].Data = base64.StdEncoding.EncodeToString(data[i])
+		}
+	}
+	return batchResponse(results, 200, "OK", "mget")
+}
+
+// MSet will store multiple entries, returning a result per key. KV stores implementing kvext.Batcher store every
+// entry with a single request.
+func (k *KVStore) MSet(b []byte) ([]byte, error) {
+	return k.MSetContext(context.Background(), b)
+}
+
+// MSetContext performs the same function as MSet, using the KV store selected for the context when the request does
+// not specify a data source.
+func (k *KVStore) MSetContext(ctx context.Context, b []byte) ([]byte, error) {
+	var rq tarmac.KVStoreMSet
+	err := ffjson.Unmarshal(b, &rq)
+	if err != nil {
+		return batchResponse(nil, 400, "Error Parsing Input", "mset")
+	}
+
+	// Decode all entries before storing any of them
+	entries := make([]kvext.Entry, len(rq.Entries))
+	for i, e := range rq.Entries {
+		entries[i].Key = e.Key
+		entries[i].Data, err = base64.StdEncoding.DecodeString(e.Data)
+		if err != nil {
+			return batchResponse(nil, 400, fmt.Sprintf("Unable to decode data of key %s - %s", e.Key, err), "mset")
+		}
+	}
+
+	kv, code, status := k.batchStore(ctx, rq.DataSource, len(entries))
+	if code != 200 {
+		return batchResponse(nil, code, status, "mset")
+	}
+
+	errs := kvext.SetMany(kv, entries)
+	results := make([]tarmac.KVStoreResult, len(entries))
+	for i, e := range entries {
+		results[i] = result(e.Key, errs[i], "Unable to store data using key")
+	}
+	return batchResponse(results, 200, "OK", "mset")
+}
+
+// MDelete will remove multiple keys, returning a result per key. KV stores implementing kvext.Batcher remove every key
+// with a single request.
+func (k *KVStore) MDelete(b []byte) ([]byte, error) {
+	return k.MDeleteContext(context.Background(), b)
+}
+
+// MDeleteContext performs the same function as MDelete, using the KV store selected for the context when the request
+// does not specify a data source.
+func (k *KVStore) MDeleteContext(ctx context.Context, b []byte) ([]byte, error) {
+	var rq tarmac.KVStoreMDelete
+	err := ffjson.Unmarshal(b, &rq)
+	if err != nil {
+		return batchResponse(nil, 400, "Error Parsing Input", "mdelete")
+	}
+
+	kv, code, status := k.batchStore(ctx, rq.DataSource, len(rq.Keys))
+	if code != 200 {
+		return batchResponse(nil, code, status, "mdelete")
+	}
+
+	errs := kvext.DeleteMany(kv, rq.Keys)
+	results := make([]tarmac.KVStoreResult, len(rq.Keys))
+	for i, key := range rq.Keys {
+		results[i] = result(key, errs[i], "Unable to delete key")
+	}
+	return batchResponse(results, 200, "OK", "mdelete")
+}
+
+// batchStore validates the size of a batch request and returns the KV store named by its data source, along with the
+// status code and message of the request.
+func (k *KVStore) batchStore(ctx context.Context, name string, n int) (hord.Database, int, string) {
+	if n == 0 {
+		return nil, 400, "Keys cannot be empty"
+	}
+	if n > MaxBatchSize {
+		return nil, 400, fmt.Sprintf("Batch size %d exceeds maximum of %d", n, MaxBatchSize)
+	}
+
+	kv, err := k.store(ctx, name)
+	if err != nil {
+		return nil, 404, fmt.Sprintf("Unable to find data source - %s", err)
+	}
+	return kv, 200, "OK"
+}
+
+// result returns the result of the operation on key, describing err with msg when the operation failed.
+func result(key string, err error, msg string) tarmac.KVStoreResult {
+	r := tarmac.KVStoreResult{Key: key}
+	r.Status.Code = 200
+	r.Status.Status = "OK"
+
+	if err == nil {
+		return r
+	}
+
+	r.Status.Code = 500
+	switch {
+	case errors.Is(err, hord.ErrNil):
+		r.Status.Code = 404
+	case errors.Is(err, hord.ErrInvalidKey), errors.Is(err, hord.ErrInvalidData):
+		r.Status.Code = 400
+	}
+	r.Status.Status = fmt.Sprintf("%s %s - %s", msg, key, err)
+	return r
+}
+
+// batchResponse marshals the response of a batch request.
+func batchResponse(results []tarmac.KVStoreResult, code int, status, op string) ([]byte, error) {
+	r := tarmac.KVStoreBatchResponse{Results: results}
+	r.Status.Code = code
+	r.Status.Status = status
+
+	// Marshal a response JSON to return to caller
+	rsp, err := ffjson.Marshal(r)
+	if err != nil {
+		return []byte(""), fmt.Errorf("unable to marshal kvstore:%s response", op)
+	}
+
+	if r.Status.Code == 200 {
+		return rsp, nil
+	}
+	return rsp, fmt.Errorf("%s", r.Status.Status)
+}
@@ -16,18 +16,35 @@ provide WASM functions with a host callback interface that provides key:value st
 		router.RegisterCallback("kvstore", "set", kvStore.Set)
 		router.RegisterCallback("kvstore", "delete", kvStore.Delete)
 	}
+
+In addition to the default KV store, named KV stores can be configured with Stores. Requests select a named KV store
+with their data source; requests without a data source use the KV store returned by DataSource for the context of the
+callback, or the default KV store. The context-aware callbacks, such as GetContext, must be registered for DataSource
+to be consulted.
+
+Keys of requests are isolated within the namespace returned by Namespace for the context of the callback, if any, and
+requests are rejected when DataSource or Namespace return an error for the caller. Unprefixed keys beginning with
+kvext.ReservedPrefix, which Tarmac uses for leader election leases and the expiration of keys, are rejected and omitted
+from listings.
+
+Set requests with a TTL require a KV store implementing kvext.TTLSetter, and the CompareAndSwap, Incr, and SetNX
+callbacks require a KV store implementing kvext.Atomic, such as those wrapped by the kvext package.
 */
 package kvstore
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/pquerna/ffjson/ffjson"
 	"github.com/tarmac-project/hord"
 
 	"github.com/tarmac-project/tarmac"
+	"github.com/tarmac-project/tarmac/pkg/envelope"
+	"github.com/tarmac-project/tarmac/pkg/kvext"
 
 	sdkproto "github.com/tarmac-project/protobuf-go/sdk"
 	proto "github.com/tarmac-project/protobuf-go/sdk/kvstore"
@@ -41,6 +58,15 @@ type KVStore struct {
 	// itself does not manage database connections but rather relies on the hord.Database interface. Users must
 	// supply an initiated hord.Database to work with.
 	kv hord.Database
+
+	// stores are the named KV stores selectable by the data source of a request.
+	stores map[string]hord.Database
+
+	// dataSource returns the name of the KV store used by requests without a data source.
+	dataSource func(context.Context) (string, error)
+
+	// namespace returns the key prefix isolating requests made with a context.
+	namespace func(context.Context) (string, error)
 }
 
 // Config is provided to users to configure the Host Callback. All Tarmac Callbacks follow the same configuration
@@ -48,32 +74,99 @@ type KVStore struct {
 type Config struct {
 	// KV is the user-provided Key:Value store instance using the github.com/tarmac-project/hord package. This package by
 	// itself does not manage database connections but rather relies on the hord.Database interface. Users must
-	// supply an initiated hord.Database to work with.
+	// supply an initiated hord.Database to work with. KV is the default KV store and may be nil when Stores are
+	// defined.
 	KV hord.Database
+
+	// Stores are named KV stores, selected by the data source of a request.
+	Stores map[string]hord.Database
+
+	// DataSource returns the name of the KV store used for requests made with the context that do not specify a data
+	// source. When undefined or returning an empty name, the default KV store is used. Requests are rejected when it
+	// returns an error.
+	DataSource func(ctx context.Context) (string, error)
+
+	// Namespace returns the key prefix isolating requests made with the context from the keys of other callers. Keys
+	// are prefixed before reaching the KV store and listed without the prefix. When undefined or returning an empty
+	// prefix, requests use the unprefixed key space shared by every caller. Requests are rejected when it returns an
+	// error.
+	Namespace func(ctx context.Context) (string, error)
 }
 
 var (
 	// ErrNilKey is returned when the key is nil.
 	ErrNilKey = errors.New("key cannot be nil")
+
+	// ErrDataSourceNotFound is returned when a request refers to a KV store that is not configured.
+	ErrDataSourceNotFound = errors.New("data source not found")
+
+	// ErrTTLNotSupported is returned when a request sets a TTL on a KV store unable to expire keys.
+	ErrTTLNotSupported = errors.New("kv store does not support ttls")
 )
 
 // New will create and return a new KVStore instance that users can register as a Tarmac Host Callback function. Users
 // can provide any custom KVStore configurations using the configuration options supplied.
 func New(cfg Config) (*KVStore, error) {
 	k := &KVStore{}
-	if cfg.KV == nil {
+	if cfg.KV == nil && len(cfg.Stores) == 0 {
 		return k, errors.New("KV Store cannot be nil")
 	}
 	k.kv = cfg.KV
+	k.stores = cfg.Stores
+	k.dataSource = cfg.DataSource
+	k.namespace = cfg.Namespace
 	return k, nil
 }
 
+// store returns the KV store named by the data source of a request. When name is empty, the KV store returned by
+// DataSource for ctx is used, falling back to the default KV store. The KV store is wrapped within the namespace
+// returned by Namespace for ctx, which rejects reserved keys.
+func (k *KVStore) store(ctx context.Context, name string) (hord.Database, error) {
+	if k.dataSource != nil {
+		// Callers without a data source are rejected even when the request selects one
+		source, err := k.dataSource(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			name = source
+		}
+	}
+
+	kv := k.kv
+	if name != "" {
+		kv = k.stores[name]
+		if kv == nil {
+			return nil, fmt.Errorf("%w - %s", ErrDataSourceNotFound, name)
+		}
+	}
+	if kv == nil {
+		return nil, fmt.Errorf("%w - no default KV store", ErrDataSourceNotFound)
+	}
+
+	var prefix string
+	if k.namespace != nil {
+		var err error
+		prefix, err = k.namespace(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return kvext.NewNamespace(kvext.NamespaceConfig{KV: kv, Prefix: prefix})
+}
+
 // Get will fetch data from the key:value datastore using the key specified.
 func (k *KVStore) Get(b []byte) ([]byte, error) {
+	return k.GetContext(context.Background(), b)
+}
+
+// GetContext performs the same function as Get, using the KV store selected for the context when the request does
+// not specify a data source.
+func (k *KVStore) GetContext(ctx context.Context, b []byte) ([]byte, error) {
 	msg := &proto.KVStoreGet{}
 	err := msg.UnmarshalVT(b)
 	if err != nil {
-		return k.getJSON(b)
+		return k.getJSON(ctx, b)
 	}
 
 	rsp := &proto.KVStoreGetResponse{
@@ -88,8 +181,17 @@ func (k *KVStore) Get(b []byte) ([]byte, error) {
 		rsp.Status.Status = ErrNilKey.Error()
 	}
 
+	var kv hord.Database
+	if rsp.GetStatus().GetCode() == 200 {
+		kv, err = k.store(ctx, "")
+		if err != nil {
+			rsp.Status.Code = 404
+			rsp.Status.Status = fmt.Sprintf("Unable to find data source - %s", err)
+		}
+	}
+
 	if rsp.GetStatus().GetCode() == 200 {
-		data, err := k.kv.Get(msg.GetKey())
+		data, err := kv.Get(msg.GetKey())
 		if err != nil {
 			rsp.Status.Code = 404
 			rsp.Status.Status = fmt.Sprintf("Unable to fetch key %s", err)
@@ -112,7 +214,7 @@ func (k *KVStore) Get(b []byte) ([]byte, error) {
 
 // getJSON retains the JSON based Get function for backwards compatibility. This function will be removed in future
 // versions of Tarmac.
-func (k *KVStore) getJSON(b []byte) ([]byte, error) {
+func (k *KVStore) getJSON(ctx context.Context, b []byte) ([]byte, error) {
 	// Start Response Message assuming everything is good
 	r := tarmac.KVStoreGetResponse{}
 	r.Status.Code = 200
@@ -126,9 +228,18 @@ func (k *KVStore) getJSON(b []byte) ([]byte, error) {
 		r.Status.Status = "Error Parsing Input"
 	}
 
+	var kv hord.Database
+	if r.Status.Code == 200 {
+		kv, err = k.store(ctx, rq.DataSource)
+		if err != nil {
+			r.Status.Code = 404
+			r.Status.Status = fmt.Sprintf("Unable to find data source - %s", err)
+		}
+	}
+
 	// Fetch data from KVStore if we do not have any other errors
 	if r.Status.Code == 200 {
-		data, err := k.kv.Get(rq.Key)
+		data, err := kv.Get(rq.Key)
 		if err != nil {
 			r.Status.Code = 404
 			r.Status.Status = fmt.Sprintf("Unable to fetch key %s - %s", rq.Key, err)
@@ -152,10 +263,17 @@ func (k *KVStore) getJSON(b []byte) ([]byte, error) {
 
 // Set will store data within the key:value datastore using the key specified.
 func (k *KVStore) Set(b []byte) ([]byte, error) {
-	msg := &proto.KVStoreSet{}
+	return k.SetContext(context.Background(), b)
+}
+
+// SetContext performs the same function as Set, using the KV store selected for the context when the request does
+// not specify a data source. Proto requests are decoded as the KVStoreSet envelope, which extends the SDK message
+// with a TTL and data source.
+func (k *KVStore) SetContext(ctx context.Context, b []byte) ([]byte, error) {
+	msg := &envelope.KVStoreSet{}
 	err := msg.UnmarshalVT(b)
 	if err != nil {
-		return k.setJSON(b)
+		return k.setJSON(ctx, b)
 	}
 
 	rsp := &proto.KVStoreSetResponse{
@@ -175,10 +293,27 @@ func (k *KVStore) Set(b []byte) ([]byte, error) {
 		rsp.Status.Status = "Data cannot be nil"
 	}
 
+	if msg.GetTtl() < 0 {
+		rsp.Status.Code = 400
+		rsp.Status.Status = "TTL cannot be negative"
+	}
+
+	var kv hord.Database
 	if rsp.GetStatus().GetCode() == 200 {
-		err = k.kv.Set(msg.GetKey(), msg.GetData())
+		kv, err = k.store(ctx, msg.GetDataSource())
+		if err != nil {
+			rsp.Status.Code = 404
+			rsp.Status.Status = fmt.Sprintf("Unable to find data source - %s", err)
+		}
+	}
+
+	if rsp.GetStatus().GetCode() == 200 {
+		err = set(kv, msg.GetKey(), msg.GetData(), msg.GetTtl())
 		if err != nil {
 			rsp.Status.Code = 500
+			if errors.Is(err, ErrTTLNotSupported) || errors.Is(err, kvext.ErrNotSupported) {
+				rsp.Status.Code = 501
+			}
 			rsp.Status.Status = fmt.Sprintf("Unable to store data - %s", err)
 		}
 	}
@@ -197,7 +332,7 @@ func (k *KVStore) Set(b []byte) ([]byte, error) {
 
 // setJSON retains the JSON based Set function for backwards compatibility. This function will be removed in future
 // versions of Tarmac.
-func (k *KVStore) setJSON(b []byte) ([]byte, error) {
+func (k *KVStore) setJSON(ctx context.Context, b []byte) ([]byte, error) {
 	// Start Response Message assuming everything is good
 	r := tarmac.KVStoreSetResponse{}
 	r.Status.Code = 200
@@ -218,11 +353,28 @@ func (k *KVStore) setJSON(b []byte) ([]byte, error) {
 		r.Status.Status = fmt.Sprintf("Unable to decode data - %s", err)
 	}
 
+	if rq.TTL < 0 {
+		r.Status.Code = 400
+		r.Status.Status = "TTL cannot be negative"
+	}
+
+	var kv hord.Database
+	if r.Status.Code == 200 {
+		kv, err = k.store(ctx, rq.DataSource)
+		if err != nil {
+			r.Status.Code = 404
+			r.Status.Status = fmt.Sprintf("Unable to find data source - %s", err)
+		}
+	}
+
 	// Store data in KVStore if we do not have any other errors
 	if r.Status.Code == 200 {
-		err = k.kv.Set(rq.Key, data)
+		err = set(kv, rq.Key, data, rq.TTL)
 		if err != nil {
 			r.Status.Code = 500
+			if errors.Is(err, ErrTTLNotSupported) || errors.Is(err, kvext.ErrNotSupported) {
+				r.Status.Code = 501
+			}
 			r.Status.Status = fmt.Sprintf("Unable to store data using key %s - %s", rq.Key, err)
 		}
 	}
@@ -239,12 +391,31 @@ func (k *KVStore) setJSON(b []byte) ([]byte, error) {
 	return rsp, fmt.Errorf("%s", r.Status.Status)
 }
 
+// set stores data under key, expiring the key after ttl seconds when ttl is greater than zero.
+func set(kv hord.Database, key string, data []byte, ttl int64) error {
+	if ttl <= 0 {
+		return kv.Set(key, data)
+	}
+
+	t, ok := kv.(kvext.TTLSetter)
+	if !ok {
+		return ErrTTLNotSupported
+	}
+	return t.SetWithTTL(key, data, time.Duration(ttl)*time.Second)
+}
+
 // Delete will remove data from the key:value datastore using the key specified.
 func (k *KVStore) Delete(b []byte) ([]byte, error) {
+	return k.DeleteContext(context.Background(), b)
+}
+
+// DeleteContext performs the same function as Delete, using the KV store selected for the context when the request
+// does not specify a data source.
+func (k *KVStore) DeleteContext(ctx context.Context, b []byte) ([]byte, error) {
 	msg := &proto.KVStoreDelete{}
 	err := msg.UnmarshalVT(b)
 	if err != nil {
-		return k.deleteJSON(b)
+		return k.deleteJSON(ctx, b)
 	}
 
 	rsp := &proto.KVStoreDeleteResponse{
@@ -259,8 +430,17 @@ func (k *KVStore) Delete(b []byte) ([]byte, error) {
 		rsp.Status.Status = ErrNilKey.Error()
 	}
 
+	var kv hord.Database
 	if rsp.GetStatus().GetCode() == 200 {
-		err = k.kv.Delete(msg.GetKey())
+		kv, err = k.store(ctx, "")
+		if err != nil {
+			rsp.Status.Code = 404
+			rsp.Status.Status = fmt.Sprintf("Unable to find data source - %s", err)
+		}
+	}
+
+	if rsp.GetStatus().GetCode() == 200 {
+		err = kv.Delete(msg.GetKey())
 		if err != nil {
 			rsp.Status.Code = 404
 			rsp.Status.Status = fmt.Sprintf("Unable to delete key %s", err)
@@ -281,7 +461,7 @@ func (k *KVStore) Delete(b []byte) ([]byte, error) {
 
 // deleteJSON retains the JSON based Delete function for backwards compatibility. This function will be removed in future
 // versions of Tarmac.
-func (k *KVStore) deleteJSON(b []byte) ([]byte, error) {
+func (k *KVStore) deleteJSON(ctx context.Context, b []byte) ([]byte, error) {
 	// Start Response Message assuming everything is good
 	r := tarmac.KVStoreDeleteResponse{}
 	r.Status.Code = 200
@@ -295,9 +475,18 @@ func (k *KVStore) deleteJSON(b []byte) ([]byte, error) {
 		r.Status.Status = "Error Parsing Input"
 	}
 
+	var kv hord.Database
+	if r.Status.Code == 200 {
+		kv, err = k.store(ctx, rq.DataSource)
+		if err != nil {
+			r.Status.Code = 404
+			r.Status.Status = fmt.Sprintf("Unable to find data source - %s", err)
+		}
+	}
+
 	// Delete data in KVStore if we do not have any other errors
 	if r.Status.Code == 200 {
-		err = k.kv.Delete(rq.Key)
+		err = kv.Delete(rq.Key)
 		if err != nil {
 			r.Status.Code = 404
 			r.Status.Status = fmt.Sprintf("Unable to delete key %s - %s", rq.Key, err)
@@ -316,24 +505,53 @@ func (k *KVStore) deleteJSON(b []byte) ([]byte, error) {
 	return rsp, fmt.Errorf("%s", r.Status.Status)
 }
 
+// Keys will return a list of keys within the key:value datastore.
 func (k *KVStore) Keys(b []byte) ([]byte, error) {
+	return k.KeysContext(context.Background(), b)
+}
+
+// KeysContext performs the same function as Keys, using the KV store selected for the context when the request does
+// not specify a data source. Proto requests are decoded as the KVStoreKeys envelope, which extends the SDK message
+// with the prefix, cursor, and limit of the JSON interface, and listed with kvext.ScanKeys.
+func (k *KVStore) KeysContext(ctx context.Context, b []byte) ([]byte, error) {
 	if len(b) == 0 {
-		return k.keysJSON(b)
+		return k.keysJSON(ctx, b)
 	}
 
-	rsp := &proto.KVStoreKeysResponse{
+	msg := &envelope.KVStoreKeys{}
+	err := msg.UnmarshalVT(b)
+	if err != nil {
+		return k.keysJSON(ctx, b)
+	}
+
+	rsp := &envelope.KVStoreKeysResponse{
 		Status: &sdkproto.Status{
 			Code:   200,
 			Status: "OK",
 		},
 	}
 
-	keys, err := k.kv.Keys()
-	if err != nil {
-		rsp.Status.Code = 500
-		rsp.Status.Status = fmt.Sprintf("Unable to fetch keys - %s", err)
+	if msg.GetLimit() < 0 {
+		rsp.Status.Code = 400
+		rsp.Status.Status = "Limit cannot be negative"
+	}
+
+	var kv hord.Database
+	if rsp.GetStatus().GetCode() == 200 {
+		kv, err = k.store(ctx, msg.GetDataSource())
+		if err != nil {
+			rsp.Status.Code = 404
+			rsp.Status.Status = fmt.Sprintf("Unable to find data source - %s", err)
+		}
+	}
+
+	if rsp.GetStatus().GetCode() == 200 {
+		rsp.Keys, rsp.Cursor, err = kvext.ScanKeys(kv, msg.GetPrefix(), msg.GetCursor(), int(msg.GetLimit()))
+		if err != nil {
+			rsp.Status.Code = 500
+			rsp.Status.Status = fmt.Sprintf("Unable to fetch keys - %s", err)
+		}
 	}
-	rsp.Keys = keys
 
 	m, err := rsp.MarshalVT()
 	if err != nil {
@@ -347,18 +565,47 @@ func (k *KVStore) Keys(b []byte) ([]byte, error) {
 	return m, fmt.Errorf("%s", rsp.GetStatus().GetStatus())
 }
 
-func (k *KVStore) keysJSON(_ []byte) ([]byte, error) {
+// keysJSON retains the JSON based Keys function for backwards compatibility. Requests without a payload list the keys
+// of the default KV store. JSON requests may page through keys matching a prefix using a limit and cursor, scanning
+// natively on KV stores implementing kvext.Scanner.
+func (k *KVStore) keysJSON(ctx context.Context, b []byte) ([]byte, error) {
 	// Start Response Message assuming everything is good
 	r := tarmac.KVStoreKeysResponse{}
 	r.Status.Code = 200
 	r.Status.Status = "OK"
 
-	// Fetch keys from datastore
+	// Parse incoming Request
+	var rq tarmac.KVStoreKeys
 	var err error
-	r.Keys, err = k.kv.Keys()
-	if err != nil {
-		r.Status.Code = 500
-		r.Status.Status = fmt.Sprintf("Unable to fetch keys - %s", err)
+	if len(b) > 0 {
+		err = ffjson.Unmarshal(b, &rq)
+		if err != nil {
+			r.Status.Code = 400
+			r.Status.Status = "Error Parsing Input"
+		}
+	}
+
+	var kv hord.Database
+	if r.Status.Code == 200 {
+		kv, err = k.store(ctx, rq.DataSource)
+		if err != nil {
+			r.Status.Code = 404
+			r.Status.Status = fmt.Sprintf("Unable to find data source - %s", err)
+		}
+	}
+
+	if rq.Limit < 0 {
+		r.Status.Code = 400
+		r.Status.Status = "Limit cannot be negative"
+	}
+
+	// Fetch keys from datastore
+	if r.Status.Code == 200 {
+		r.Keys, r.Cursor, err = kvext.ScanKeys(kv, rq.Prefix, rq.Cursor, rq.Limit)
+		if err != nil {
+			r.Status.Code = 500
+			r.Status.Status = fmt.Sprintf("Unable to fetch keys - %s", err)
+		}
 	}
 
 	// Marshal a response JSON to return to caller
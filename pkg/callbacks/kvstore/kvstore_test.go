@@ -2,14 +2,21 @@ package kvstore
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pquerna/ffjson/ffjson"
+	"github.com/tarmac-project/hord"
+	"github.com/tarmac-project/hord/drivers/hashmap"
 	"github.com/tarmac-project/hord/drivers/mock"
 
 	"github.com/tarmac-project/tarmac"
+	"github.com/tarmac-project/tarmac/pkg/envelope"
+	"github.com/tarmac-project/tarmac/pkg/kvext"
 
 	proto "github.com/tarmac-project/protobuf-go/sdk/kvstore"
 )
@@ -581,3 +588,667 @@ func TestKVStoreJSON(t *testing.T) {
 		}
 	}
 }
+
+func TestKVStoreDataSources(t *testing.T) {
+	def, err := hashmap.Dial(hashmap.Config{})
+	if err != nil {
+		t.Fatalf("Unable to create default KV store - %s", err)
+	}
+	cache, err := hashmap.Dial(hashmap.Config{})
+	if err != nil {
+		t.Fatalf("Unable to create cache KV store - %s", err)
+	}
+
+	// Requests made with a bound context default to the cache store
+	type bindingKey struct{}
+	k, err := New(Config{
+		KV:     def,
+		Stores: map[string]hord.Database{"cache": cache},
+		DataSource: func(ctx context.Context) (string, error) {
+			name, _ := ctx.Value(bindingKey{}).(string)
+			if name == "denied" {
+				return "", errors.New("unknown caller")
+			}
+			return name, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unable to create new KVStore Instance - %s", err)
+	}
+	bound := context.WithValue(context.Background(), bindingKey{}, "cache")
+
+	t.Run("Named Data Source", func(t *testing.T) {
+		_, err := k.SetContext(context.Background(), []byte(`{"key":"named","data":"aGk=","data_source":"cache"}`))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		v, err := cache.Get("named")
+		if err != nil || string(v) != "hi" {
+			t.Errorf("Unexpected value within cache store - %s, %s", v, err)
+		}
+
+		_, err = def.Get("named")
+		if err == nil {
+			t.Errorf("Unexpected key within default store")
+		}
+
+		b, err := k.KeysContext(context.Background(), []byte(`{"data_source":"cache"}`))
+		if err != nil {
+			t.Fatalf("Unexpected error fetching keys - %s", err)
+		}
+		var rsp tarmac.KVStoreKeysResponse
+		err = ffjson.Unmarshal(b, &rsp)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing keys response - %s", err)
+		}
+		if len(rsp.Keys) != 1 || rsp.Keys[0] != "named" {
+			t.Errorf("Unexpected keys returned - %v", rsp.Keys)
+		}
+
+		_, err = k.DeleteContext(context.Background(), []byte(`{"key":"named","data_source":"cache"}`))
+		if err != nil {
+			t.Fatalf("Unexpected error deleting key - %s", err)
+		}
+	})
+
+	t.Run("Default Binding", func(t *testing.T) {
+		msg := &proto.KVStoreSet{Key: "bound", Data: []byte("hi")}
+		b, err := msg.MarshalVT()
+		if err != nil {
+			t.Fatalf("Unable to marshal request - %s", err)
+		}
+
+		_, err = k.SetContext(bound, b)
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		_, err = cache.Get("bound")
+		if err != nil {
+			t.Errorf("Unexpected error fetching key from cache store - %s", err)
+		}
+
+		// The default store is used without a binding
+		_, err = k.GetContext(context.Background(), []byte(`{"key":"bound"}`))
+		if err == nil {
+			t.Errorf("Unexpected key within default store")
+		}
+
+		_, err = k.GetContext(bound, []byte(`{"key":"bound"}`))
+		if err != nil {
+			t.Errorf("Unexpected error fetching bound key - %s", err)
+		}
+
+		// A data source in the request takes precedence over the binding
+		_, err = k.GetContext(bound, []byte(`{"key":"bound","data_source":"missing"}`))
+		if err == nil {
+			t.Errorf("Expected error fetching key from unknown data source")
+		}
+	})
+
+	t.Run("Rejected Caller", func(t *testing.T) {
+		denied := context.WithValue(context.Background(), bindingKey{}, "denied")
+		for _, rq := range []string{`{"key":"named"}`, `{"key":"named","data_source":"cache"}`} {
+			_, err := k.GetContext(denied, []byte(rq))
+			if err == nil {
+				t.Errorf("Unexpected success fetching key for rejected caller with request %s", rq)
+			}
+		}
+	})
+
+	t.Run("Unknown Data Source", func(t *testing.T) {
+		b, err := k.GetContext(context.Background(), []byte(`{"key":"named","data_source":"missing"}`))
+		if err == nil {
+			t.Fatalf("Expected error fetching key from unknown data source")
+		}
+
+		var rsp tarmac.KVStoreGetResponse
+		err = ffjson.Unmarshal(b, &rsp)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing get response - %s", err)
+		}
+		if rsp.Status.Code != 404 {
+			t.Errorf("Unexpected status code - %d", rsp.Status.Code)
+		}
+	})
+
+	t.Run("No Default Store", func(t *testing.T) {
+		k, err := New(Config{Stores: map[string]hord.Database{"cache": cache}})
+		if err != nil {
+			t.Fatalf("Unable to create new KVStore Instance - %s", err)
+		}
+
+		_, err = k.Keys([]byte(""))
+		if !strings.Contains(fmt.Sprint(err), ErrDataSourceNotFound.Error()) {
+			t.Errorf("Unexpected error fetching keys without a default store - %s", err)
+		}
+
+		_, err = k.Keys([]byte(`{"data_source":"cache"}`))
+		if err != nil {
+			t.Errorf("Unexpected error fetching keys from named store - %s", err)
+		}
+	})
+
+	t.Run("No Stores", func(t *testing.T) {
+		_, err := New(Config{})
+		if err == nil {
+			t.Errorf("Expected error creating KVStore without stores")
+		}
+	})
+}
+
+func TestKVStoreTTL(t *testing.T) {
+	db, err := hashmap.Dial(hashmap.Config{})
+	if err != nil {
+		t.Fatalf("Unable to create KV store - %s", err)
+	}
+	plain, err := hashmap.Dial(hashmap.Config{})
+	if err != nil {
+		t.Fatalf("Unable to create KV store - %s", err)
+	}
+
+	kv, err := kvext.NewSweeper(kvext.SweeperConfig{KV: db, Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("Unable to create sweeper - %s", err)
+	}
+
+	k, err := New(Config{KV: kv, Stores: map[string]hord.Database{"plain": plain}})
+	if err != nil {
+		t.Fatalf("Unable to create new KVStore Instance - %s", err)
+	}
+
+	tt := []struct {
+		name   string
+		req    string
+		status int
+	}{
+		{name: "Without TTL", req: `{"key":"a","data":"aGk="}`, status: 200},
+		{name: "With TTL", req: `{"key":"b","data":"aGk=","ttl":60}`, status: 200},
+		{name: "Negative TTL", req: `{"key":"c","data":"aGk=","ttl":-1}`, status: 400},
+		{name: "Unsupported Store", req: `{"key":"d","data":"aGk=","ttl":60,"data_source":"plain"}`, status: 501},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := k.Set([]byte(tc.req))
+			if (err != nil) != (tc.status != 200) {
+				t.Fatalf("Unexpected error result - %v", err)
+			}
+
+			var rsp tarmac.KVStoreSetResponse
+			err = ffjson.Unmarshal(b, &rsp)
+			if err != nil {
+				t.Fatalf("Unexpected error parsing set response - %s", err)
+			}
+			if rsp.Status.Code != tc.status {
+				t.Errorf("Unexpected status code - got %d, expected %d", rsp.Status.Code, tc.status)
+			}
+		})
+	}
+
+	t.Run("Expires", func(t *testing.T) {
+		_, err := db.Get(kvext.ExpiryPrefix + "b")
+		if err != nil {
+			t.Errorf("Unexpected error fetching expiration of key - %s", err)
+		}
+
+		_, err = db.Get(kvext.ExpiryPrefix + "a")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected expiration of key without ttl - %v", err)
+		}
+	})
+
+	t.Run("Proto", func(t *testing.T) {
+		pt := []struct {
+			name   string
+			msg    *envelope.KVStoreSet
+			status int32
+		}{
+			{name: "With TTL", msg: &envelope.KVStoreSet{Key: "e", Data: []byte("hi"), Ttl: 60}, status: 200},
+			{name: "Negative TTL", msg: &envelope.KVStoreSet{Key: "f", Data: []byte("hi"), Ttl: -1}, status: 400},
+			{name: "Unsupported Store", msg: &envelope.KVStoreSet{Key: "g", Data: []byte("hi"), Ttl: 60,
+				DataSource: "plain"}, status: 501},
+		}
+
+		for _, tc := range pt {
+			t.Run(tc.name, func(t *testing.T) {
+				req, err := tc.msg.MarshalVT()
+				if err != nil {
+					t.Fatalf("Unable to marshal request - %s", err)
+				}
+
+				b, err := k.Set(req)
+				if (err != nil) != (tc.status != 200) {
+					t.Fatalf("Unexpected error result - %v", err)
+				}
+
+				rsp := &proto.KVStoreSetResponse{}
+				err = rsp.UnmarshalVT(b)
+				if err != nil {
+					t.Fatalf("Unexpected error parsing set response - %s", err)
+				}
+				if rsp.GetStatus().GetCode() != tc.status {
+					t.Errorf("Unexpected status code - got %d, expected %d", rsp.GetStatus().GetCode(), tc.status)
+				}
+			})
+		}
+
+		ttl, err := kv.TTL("e")
+		if err != nil || ttl <= 0 || ttl > time.Minute {
+			t.Errorf("Unexpected ttl of key set with proto request - %s, %v", ttl, err)
+		}
+	})
+}
+
+func TestKVStoreAtomic(t *testing.T) {
+	db, err := hashmap.Dial(hashmap.Config{})
+	if err != nil {
+		t.Fatalf("Unable to create KV store - %s", err)
+	}
+	plain, err := hashmap.Dial(hashmap.Config{})
+	if err != nil {
+		t.Fatalf("Unable to create KV store - %s", err)
+	}
+
+	kv, err := kvext.NewLocker(kvext.LockerConfig{KV: db})
+	if err != nil {
+		t.Fatalf("Unable to create locker - %s", err)
+	}
+
+	k, err := New(Config{KV: kv, Stores: map[string]hord.Database{"plain": plain}})
+	if err != nil {
+		t.Fatalf("Unable to create new KVStore Instance - %s", err)
+	}
+
+	// Steps run in order, each depending on the state left by the previous steps
+	tt := []struct {
+		name   string
+		call   func([]byte) ([]byte, error)
+		req    string
+		status int
+		rsp    string
+	}{
+		{name: "SetNX Missing Key", call: k.SetNX, req: `{"key":"a","data":"MQ=="}`, status: 200, rsp: `"set":true`},
+		{name: "SetNX Existing Key", call: k.SetNX, req: `{"key":"a","data":"Mg=="}`, status: 200, rsp: `"set":false`},
+		{name: "SetNX Without TTL Support", call: k.SetNX, req: `{"key":"b","data":"MQ==","ttl":60}`, status: 501},
+		{name: "SetNX Negative TTL", call: k.SetNX, req: `{"key":"b","data":"MQ==","ttl":-1}`, status: 400},
+		{name: "SetNX Empty Key", call: k.SetNX, req: `{"data":"MQ=="}`, status: 400},
+		{name: "CAS Matching Value", call: k.CompareAndSwap, req: `{"key":"a","expected":"MQ==","data":"Mg=="}`,
+			status: 200, rsp: `"swapped":true`},
+		{name: "CAS Stale Value", call: k.CompareAndSwap, req: `{"key":"a","expected":"MQ==","data":"Mw=="}`,
+			status: 200, rsp: `"swapped":false`},
+		{name: "CAS Missing Key", call: k.CompareAndSwap, req: `{"key":"c","expected":"MQ==","data":"Mw=="}`,
+			status: 200, rsp: `"swapped":false`},
+		{name: "CAS Invalid Data", call: k.CompareAndSwap, req: `{"key":"a","expected":"MQ==","data":"!"}`,
+			status: 400},
+		{name: "Incr Existing Key", call: k.Incr, req: `{"key":"a","delta":5}`, status: 200, rsp: `"value":7`},
+		{name: "Incr Missing Key", call: k.Incr, req: `{"key":"d","delta":-3}`, status: 200, rsp: `"value":-3`},
+		{name: "Incr Unsupported Store", call: k.Incr, req: `{"key":"a","delta":1,"data_source":"plain"}`,
+			status: 501},
+		{name: "Incr Unknown Store", call: k.Incr, req: `{"key":"a","delta":1,"data_source":"nope"}`, status: 404},
+		{name: "Incr Invalid JSON", call: k.Incr, req: `{`, status: 400},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := tc.call([]byte(tc.req))
+			if (err != nil) != (tc.status != 200) {
+				t.Fatalf("Unexpected error result - %v", err)
+			}
+
+			var rsp tarmac.KVStoreSetResponse
+			err = ffjson.Unmarshal(b, &rsp)
+			if err != nil {
+				t.Fatalf("Unexpected error parsing response - %s", err)
+			}
+			if rsp.Status.Code != tc.status {
+				t.Errorf("Unexpected status code - got %d, expected %d", rsp.Status.Code, tc.status)
+			}
+			if !strings.Contains(string(b), tc.rsp) {
+				t.Errorf("Unexpected response - %s does not contain %s", b, tc.rsp)
+			}
+		})
+	}
+
+	t.Run("Incr Not Integer", func(t *testing.T) {
+		err := kv.Set("e", []byte("abc"))
+		if err != nil {
+			t.Fatalf("Unexpected error storing key - %s", err)
+		}
+
+		b, err := k.Incr([]byte(`{"key":"e","delta":1}`))
+		if err == nil {
+			t.Fatalf("Expected error incrementing non integer value")
+		}
+		if !strings.Contains(string(b), `"code":409`) {
+			t.Errorf("Unexpected response - %s", b)
+		}
+	})
+}
+
+func TestKVStoreKeysPaging(t *testing.T) {
+	db, err := hashmap.Dial(hashmap.Config{})
+	if err != nil {
+		t.Fatalf("Unable to create KV store - %s", err)
+	}
+	for _, key := range []string{"user:3", "user:1", "session:1", "user:2", "user:5", "user:4"} {
+		err = db.Set(key, []byte("data"))
+		if err != nil {
+			t.Fatalf("Unable to store key - %s", err)
+		}
+	}
+
+	k, err := New(Config{KV: db})
+	if err != nil {
+		t.Fatalf("Unable to create new KVStore Instance - %s", err)
+	}
+
+	t.Run("Pages", func(t *testing.T) {
+		var keys []string
+		var cursor string
+		for pages := 1; ; pages++ {
+			b, err := k.Keys([]byte(fmt.Sprintf(`{"prefix":"user:","limit":2,"cursor":"%s"}`, cursor)))
+			if err != nil {
+				t.Fatalf("Unexpected error fetching keys - %s", err)
+			}
+
+			var rsp tarmac.KVStoreKeysResponse
+			err = ffjson.Unmarshal(b, &rsp)
+			if err != nil {
+				t.Fatalf("Unexpected error parsing keys response - %s", err)
+			}
+			if len(rsp.Keys) > 2 {
+				t.Fatalf("Unexpected page size - %v", rsp.Keys)
+			}
+			keys = append(keys, rsp.Keys...)
+
+			cursor = rsp.Cursor
+			if cursor == "" {
+				if pages != 3 {
+					t.Errorf("Unexpected number of pages - %d", pages)
+				}
+				break
+			}
+		}
+
+		if strings.Join(keys, ",") != "user:1,user:2,user:3,user:4,user:5" {
+			t.Errorf("Unexpected keys returned - %v", keys)
+		}
+	})
+
+	t.Run("Proto Pages", func(t *testing.T) {
+		var keys []string
+		var cursor string
+		for pages := 1; ; pages++ {
+			req, err := (&envelope.KVStoreKeys{ReturnProto: true, Prefix: "user:", Cursor: cursor, Limit: 2}).MarshalVT()
+			if err != nil {
+				t.Fatalf("Unable to marshal request - %s", err)
+			}
+
+			b, err := k.Keys(req)
+			if err != nil {
+				t.Fatalf("Unexpected error fetching keys - %s", err)
+			}
+
+			rsp := &envelope.KVStoreKeysResponse{}
+			err = rsp.UnmarshalVT(b)
+			if err != nil {
+				t.Fatalf("Unexpected error parsing keys response - %s", err)
+			}
+			if len(rsp.GetKeys()) > 2 {
+				t.Fatalf("Unexpected page size - %v", rsp.GetKeys())
+			}
+			keys = append(keys, rsp.GetKeys()...)
+
+			cursor = rsp.GetCursor()
+			if cursor == "" {
+				if pages != 3 {
+					t.Errorf("Unexpected number of pages - %d", pages)
+				}
+				break
+			}
+		}
+
+		if strings.Join(keys, ",") != "user:1,user:2,user:3,user:4,user:5" {
+			t.Errorf("Unexpected keys returned - %v", keys)
+		}
+	})
+
+	t.Run("Proto Negative Limit", func(t *testing.T) {
+		req, err := (&envelope.KVStoreKeys{ReturnProto: true, Limit: -1}).MarshalVT()
+		if err != nil {
+			t.Fatalf("Unable to marshal request - %s", err)
+		}
+
+		b, err := k.Keys(req)
+		if err == nil {
+			t.Fatalf("Expected error fetching keys with negative limit")
+		}
+
+		rsp := &proto.KVStoreKeysResponse{}
+		err = rsp.UnmarshalVT(b)
+		if err != nil || rsp.GetStatus().GetCode() != 400 {
+			t.Errorf("Unexpected response - %+v, %v", rsp, err)
+		}
+	})
+
+	t.Run("Negative Limit", func(t *testing.T) {
+		b, err := k.Keys([]byte(`{"limit":-1}`))
+		if err == nil {
+			t.Fatalf("Expected error fetching keys with negative limit")
+		}
+		if !strings.Contains(string(b), `"code":400`) {
+			t.Errorf("Unexpected response - %s", b)
+		}
+	})
+}
+
+func TestKVStoreBatch(t *testing.T) {
+	db, err := hashmap.Dial(hashmap.Config{})
+	if err != nil {
+		t.Fatalf("Unable to create KV store - %s", err)
+	}
+
+	k, err := New(Config{KV: db})
+	if err != nil {
+		t.Fatalf("Unable to create new KVStore Instance - %s", err)
+	}
+
+	// Steps run in order, each depending on the state left by the previous steps
+	tt := []struct {
+		name    string
+		call    func([]byte) ([]byte, error)
+		req     string
+		status  int
+		results []int
+		data    []string
+	}{
+		{name: "MSet", call: k.MSet, req: `{"entries":[{"key":"a","data":"MQ=="},{"key":"b","data":"Mg=="}]}`,
+			status: 200, results: []int{200, 200}},
+		{name: "MSet Invalid Entry", call: k.MSet, req: `{"entries":[{"key":"","data":"MQ=="},{"key":"c","data":""}]}`,
+			status: 200, results: []int{400, 400}},
+		{name: "MSet Invalid Data", call: k.MSet, req: `{"entries":[{"key":"c","data":"!"}]}`, status: 400},
+		{name: "MGet", call: k.MGet, req: `{"keys":["a","missing","b"]}`, status: 200, results: []int{200, 404, 200},
+			data: []string{"MQ==", "", "Mg=="}},
+		{name: "MDelete", call: k.MDelete, req: `{"keys":["a"]}`, status: 200, results: []int{200}},
+		{name: "MGet after MDelete", call: k.MGet, req: `{"keys":["a","b"]}`, status: 200, results: []int{404, 200},
+			data: []string{"", "Mg=="}},
+		{name: "Empty Keys", call: k.MGet, req: `{"keys":[]}`, status: 400},
+		{name: "Unknown Data Source", call: k.MDelete, req: `{"keys":["a"],"data_source":"nope"}`, status: 404},
+		{name: "Invalid JSON", call: k.MGet, req: `{`, status: 400},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := tc.call([]byte(tc.req))
+			if (err != nil) != (tc.status != 200) {
+				t.Fatalf("Unexpected error result - %v", err)
+			}
+
+			var rsp tarmac.KVStoreBatchResponse
+			err = ffjson.Unmarshal(b, &rsp)
+			if err != nil {
+				t.Fatalf("Unexpected error parsing response - %s", err)
+			}
+			if rsp.Status.Code != tc.status {
+				t.Fatalf("Unexpected status code - got %d, expected %d", rsp.Status.Code, tc.status)
+			}
+			if len(rsp.Results) != len(tc.results) {
+				t.Fatalf("Unexpected number of results - %+v", rsp.Results)
+			}
+			for i, r := range rsp.Results {
+				if r.Status.Code != tc.results[i] {
+					t.Errorf("Unexpected status code of key %s - got %d, expected %d", r.Key, r.Status.Code, tc.results[i])
+				}
+				if tc.data != nil && r.Data != tc.data[i] {
+					t.Errorf("Unexpected data of key %s - got %s, expected %s", r.Key, r.Data, tc.data[i])
+				}
+			}
+		})
+	}
+
+	t.Run("Batch Too Large", func(t *testing.T) {
+		keys := make([]string, MaxBatchSize+1)
+		for i := range keys {
+			keys[i] = fmt.Sprintf(`"key%d"`, i)
+		}
+
+		_, err := k.MGet([]byte(`{"keys":[` + strings.Join(keys, ",") + `]}`))
+		if err == nil {
+			t.Errorf("Expected error fetching too many keys")
+		}
+	})
+}
+
+func TestKVStoreNamespace(t *testing.T) {
+	db, err := hashmap.Dial(hashmap.Config{})
+	if err != nil {
+		t.Fatalf("Unable to create KV store - %s", err)
+	}
+
+	type nsKey struct{}
+	k, err := New(Config{KV: db, Namespace: func(ctx context.Context) (string, error) {
+		ns, ok := ctx.Value(nsKey{}).(string)
+		if ok && ns == "" {
+			return "", errors.New("unknown caller")
+		}
+		return ns, nil
+	}})
+	if err != nil {
+		t.Fatalf("Unable to create new KVStore Instance - %s", err)
+	}
+
+	a := context.WithValue(context.Background(), nsKey{}, "service/a/")
+	b := context.WithValue(context.Background(), nsKey{}, "service/b/")
+	shared := context.Background()
+
+	for ctx, data := range map[context.Context]string{a: "YQ==", b: "Yg==", shared: "cw=="} {
+		_, err = k.SetContext(ctx, []byte(`{"key":"key","data":"`+data+`"}`))
+		if err != nil {
+			t.Fatalf("Unexpected error storing key - %s", err)
+		}
+	}
+
+	t.Run("Get", func(t *testing.T) {
+		for ctx, data := range map[context.Context]string{a: "YQ==", b: "Yg==", shared: "cw=="} {
+			rsp, err := k.GetContext(ctx, []byte(`{"key":"key"}`))
+			if err != nil {
+				t.Fatalf("Unexpected error fetching key - %s", err)
+			}
+			if !strings.Contains(string(rsp), data) {
+				t.Errorf("Unexpected response - %s does not contain %s", rsp, data)
+			}
+		}
+	})
+
+	t.Run("Keys", func(t *testing.T) {
+		rsp, err := k.KeysContext(a, []byte(`{}`))
+		if err != nil {
+			t.Fatalf("Unexpected error fetching keys - %s", err)
+		}
+
+		var r tarmac.KVStoreKeysResponse
+		err = ffjson.Unmarshal(rsp, &r)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing keys response - %s", err)
+		}
+		if strings.Join(r.Keys, ",") != "key" {
+			t.Errorf("Unexpected keys within namespace - %v", r.Keys)
+		}
+
+		rsp, err = k.KeysContext(shared, []byte(`{}`))
+		if err != nil {
+			t.Fatalf("Unexpected error fetching keys - %s", err)
+		}
+		err = ffjson.Unmarshal(rsp, &r)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing keys response - %s", err)
+		}
+		if strings.Join(r.Keys, ",") != "key,service/a/key,service/b/key" {
+			t.Errorf("Unexpected keys within shared namespace - %v", r.Keys)
+		}
+	})
+
+	t.Run("Rejected Caller", func(t *testing.T) {
+		denied := context.WithValue(context.Background(), nsKey{}, "")
+		_, err := k.GetContext(denied, []byte(`{"key":"key"}`))
+		if err == nil {
+			t.Errorf("Unexpected success fetching key for rejected caller")
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		_, err := k.DeleteContext(a, []byte(`{"key":"key"}`))
+		if err != nil {
+			t.Fatalf("Unexpected error deleting key - %s", err)
+		}
+
+		_, err = k.GetContext(b, []byte(`{"key":"key"}`))
+		if err != nil {
+			t.Errorf("Unexpected error fetching key of another namespace - %s", err)
+		}
+	})
+
+	t.Run("Reserved Keys", func(t *testing.T) {
+		err := db.Set(kvext.ReservedPrefix+"leader:task", []byte("lease"))
+		if err != nil {
+			t.Fatalf("Unexpected error storing key - %s", err)
+		}
+
+		_, err = k.SetContext(shared, []byte(`{"key":"tarmac:leader:task","data":"YQ=="}`))
+		if err == nil {
+			t.Errorf("Unexpected success storing reserved key")
+		}
+		_, err = k.GetContext(shared, []byte(`{"key":"tarmac:leader:task"}`))
+		if err == nil {
+			t.Errorf("Unexpected success fetching reserved key")
+		}
+
+		// Prefixed namespaces cannot reach reserved keys, so their keys are unrestricted
+		_, err = k.SetContext(a, []byte(`{"key":"tarmac:leader:task","data":"YQ=="}`))
+		if err != nil {
+			t.Errorf("Unexpected error storing key within namespace - %s", err)
+		}
+
+		rsp, err := k.KeysContext(shared, []byte(`{}`))
+		if err != nil {
+			t.Fatalf("Unexpected error fetching keys - %s", err)
+		}
+		if strings.Contains(string(rsp), `"`+kvext.ReservedPrefix) {
+			t.Errorf("Unexpected reserved key listed - %s", rsp)
+		}
+
+		data, err := db.Get(kvext.ReservedPrefix + "leader:task")
+		if err != nil || string(data) != "lease" {
+			t.Errorf("Unexpected reserved key value - %q, %v", data, err)
+		}
+	})
+
+	t.Run("TTL Not Supported", func(t *testing.T) {
+		rsp, err := k.SetContext(a, []byte(`{"key":"key","data":"YQ==","ttl":60}`))
+		if err == nil || !strings.Contains(string(rsp), `"code":501`) {
+			t.Errorf("Unexpected response setting ttl - %s, %v", rsp, err)
+		}
+	})
+}
@@ -0,0 +1,226 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Statement classes permitted by a Policy.
+const (
+	// StatementSelect are statements that read data, such as SELECT, SHOW, and EXPLAIN.
+	StatementSelect = "select"
+
+	// StatementDML are statements that modify data, such as INSERT, UPDATE, and DELETE.
+	StatementDML = "dml"
+
+	// StatementDDL are statements that modify the schema or permissions, such as CREATE, ALTER, DROP, and GRANT.
+	StatementDDL = "ddl"
+
+	// StatementOther are all other statements, such as SET, PRAGMA, CALL, and transaction control.
+	StatementOther = "other"
+)
+
+// ErrStatementNotPermitted is returned when a query contains a statement the Policy of the caller does not permit.
+var ErrStatementNotPermitted = errors.New("statement not permitted")
+
+// Policy restricts the SQL statements a caller may execute.
+//
+// Statements are classified by their keywords, so a SELECT calling a function that modifies data is classified as
+// a select statement. ReadOnly additionally executes statements within read-only transactions, allowing databases
+// that support them (i.e. PostgreSQL and MySQL) to reject any modification.
+type Policy struct {
+	// ReadOnly restricts the caller to select statements executed within read-only transactions.
+	ReadOnly bool
+
+	// Statements are the statement classes the caller may execute. When empty, every statement class is permitted.
+	Statements []string
+}
+
+// permits returns true if the Policy permits statements of the class.
+func (p Policy) permits(class string) bool {
+	if p.ReadOnly && class != StatementSelect {
+		return false
+	}
+	return len(p.Statements) == 0 || slices.Contains(p.Statements, class)
+}
+
+// permit returns an error wrapping ErrStatementNotPermitted if the Policy of the caller does not permit every
+// statement within the query.
+func (db *Database) permit(ctx context.Context, qry []byte) error {
+	if db.policy == nil {
+		return nil
+	}
+
+	p := db.policy(ctx)
+	if !p.ReadOnly && len(p.Statements) == 0 {
+		return nil
+	}
+
+	// Dialects disagree on how strings are escaped and comments are written, split the query using the rules of
+	// each so statements cannot be hidden from one within what the other considers a string or comment
+	for _, d := range []dialect{dialectStandard, dialectMySQL} {
+		for _, words := range statements(string(qry), d) {
+			class := classify(words)
+			if !p.permits(class) {
+				return fmt.Errorf("%w - %s statement %s", ErrStatementNotPermitted, class, words[0])
+			}
+		}
+	}
+	return nil
+}
+
+// readOnly returns true if the caller is restricted to read-only transactions.
+func (db *Database) readOnly(ctx context.Context) bool {
+	return db.policy != nil && db.policy(ctx).ReadOnly
+}
+
+// readOnlyTx begins a read-only transaction on the connection when the caller is restricted to read-only
+// transactions and the connection is not already a transaction. The returned transaction is nil when not begun.
+func (db *Database) readOnlyTx(ctx context.Context, c conn) (conn, *sql.Tx, error) {
+	d, ok := c.(*sql.DB)
+	if !ok || !db.readOnly(ctx) {
+		return c, nil, nil
+	}
+
+	tx, err := d.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to begin read-only transaction - %w", err)
+	}
+	return tx, tx, nil
+}
+
+// dialect selects the lexical rules used to split queries into statements.
+type dialect int
+
+const (
+	// dialectStandard rules escape quotes by doubling them and only escape with backslashes within E'' strings, as used by
+	// PostgreSQL and SQLite.
+	dialectStandard dialect = iota
+
+	// dialectMySQL rules also escape with backslashes, begin comments with # or "-- ", and execute the contents of /*! */
+	// comments.
+	dialectMySQL
+)
+
+// statements splits the query into statements, returning the upper-cased keywords and identifiers of each. Strings,
+// quoted identifiers, and comments are skipped.
+func statements(q string, d dialect) [][]string {
+	var stmts [][]string
+	var words []string
+	for i := 0; i < len(q); {
+		c := q[i]
+		switch {
+		case c == ';':
+			if len(words) > 0 {
+				stmts = append(stmts, words)
+				words = nil
+			}
+			i++
+		case strings.HasPrefix(q[i:], "--") && (d == dialectStandard || i+2 == len(q) || q[i+2] <= ' '):
+			i = skipLine(q, i)
+		case c == '#' && d == dialectMySQL:
+			i = skipLine(q, i)
+		case strings.HasPrefix(q[i:], "/*!") && d == dialectMySQL:
+			// MySQL executes the contents of these comments, skip only the marker and version
+			i += 3
+			for i < len(q) && isDigit(q[i]) {
+				i++
+			}
+		case strings.HasPrefix(q[i:], "*/") && d == dialectMySQL:
+			i += 2
+		case strings.HasPrefix(q[i:], "/*"):
+			end := strings.Index(q[i+2:], "*/")
+			if end < 0 {
+				i = len(q)
+				break
+			}
+			i += end + 4
+		case c == '\'' || c == '"':
+			escapes := d == dialectMySQL || (c == '\'' && i > 0 && (q[i-1] == 'E' || q[i-1] == 'e') &&
+				(i == 1 || !isWord(q[i-2])))
+			i = skipQuoted(q, i, escapes)
+		case c == '`':
+			i = skipQuoted(q, i, false)
+		case isWord(c):
+			j := i
+			for j < len(q) && isWord(q[j]) {
+				j++
+			}
+			if !isDigit(c) && c != '$' {
+				words = append(words, strings.ToUpper(q[i:j]))
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+
+	if len(words) > 0 {
+		stmts = append(stmts, words)
+	}
+	return stmts
+}
+
+// classify returns the class of the statement made up of words.
+func classify(words []string) string {
+	switch words[0] {
+	case "SELECT", "WITH", "VALUES", "TABLE", "EXPLAIN", "SHOW", "DESCRIBE", "DESC":
+		// Queries can contain data-modifying common table expressions, create tables with SELECT INTO, or lock rows
+		class := StatementSelect
+		for _, w := range words[1:] {
+			switch w {
+			case "CREATE", "ALTER", "DROP", "TRUNCATE":
+				return StatementDDL
+			case "INSERT", "UPDATE", "DELETE", "MERGE", "INTO":
+				class = StatementDML
+			}
+		}
+		return class
+	case "INSERT", "UPDATE", "DELETE", "MERGE", "REPLACE", "UPSERT":
+		return StatementDML
+	case "CREATE", "ALTER", "DROP", "TRUNCATE", "RENAME", "COMMENT", "GRANT", "REVOKE":
+		return StatementDDL
+	default:
+		return StatementOther
+	}
+}
+
+// skipLine returns the index following the end of the line at i.
+func skipLine(q string, i int) int {
+	end := strings.IndexByte(q[i:], '\n')
+	if end < 0 {
+		return len(q)
+	}
+	return i + end + 1
+}
+
+// skipQuoted returns the index following the string or quoted identifier beginning at i. Quotes are escaped by
+// doubling them, or with a backslash when escapes is true.
+func skipQuoted(q string, i int, escapes bool) int {
+	quote := q[i]
+	for j := i + 1; j < len(q); j++ {
+		switch {
+		case escapes && q[j] == '\\':
+			j++
+		case q[j] == quote && j+1 < len(q) && q[j+1] == quote:
+			j++
+		case q[j] == quote:
+			return j + 1
+		}
+	}
+	return len(q)
+}
+
+// isDigit returns true if c is an ASCII digit.
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isWord returns true if c may be part of a keyword or identifier.
+func isWord(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
@@ -0,0 +1,255 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tarmac-project/tarmac/pkg/envelope"
+
+	sdkproto "github.com/tarmac-project/protobuf-go/sdk"
+)
+
+// ErrCursorNotFound is returned when a cursor does not refer to an open result set of the caller.
+var ErrCursorNotFound = errors.New("cursor not found")
+
+// cursor is an open result set read incrementally across callbacks.
+type cursor struct {
+	rows *sql.Rows
+
+	// columns describe the columns of the result set.
+	columns []*sql.ColumnType
+
+	// next is a row read ahead of the current page to determine whether rows remain.
+	next []any
+
+	// tx is the read-only transaction the query was executed within, it is rolled back once the cursor is released.
+	tx *sql.Tx
+
+	// handle identifies the cursor to subsequent queries, it is set once the cursor is tracked.
+	handle string
+
+	// done is the done channel of the context the query was executed with, see transaction.
+	done <-chan struct{}
+}
+
+// open executes the query against the connection, returning a cursor over the result set.
+func (db *Database) open(ctx context.Context, c conn, qry []byte, args ...any) (*cursor, error) {
+	c, tx, err := db.readOnlyTx(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.QueryContext(ctx, string(qry), args...)
+	if err != nil {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+		return nil, fmt.Errorf("unable to execute query - %w", err)
+	}
+
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		_ = rows.Close()
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+		return nil, fmt.Errorf("unable to process query results - %w", err)
+	}
+
+	return &cursor{rows: rows, columns: columns, tx: tx, done: ctx.Done()}, nil
+}
+
+// cursor returns the open cursor referred to by handle.
+func (db *Database) cursor(ctx context.Context, handle string) (*cursor, error) {
+	db.Lock()
+	defer db.Unlock()
+	cur, ok := db.cursors[handle]
+	if !ok || cur.done != ctx.Done() {
+		return nil, ErrCursorNotFound
+	}
+	return cur, nil
+}
+
+// page reads the next page of up to maxRows rows from the cursor, or all remaining rows when maxRows is zero. When
+// rows remain after the page, the cursor is tracked under a handle until the rows are read or ctx is canceled.
+// Otherwise, the cursor is closed.
+func (db *Database) page(ctx context.Context, cur *cursor, maxRows int) ([][]any, error) {
+	var rows [][]any
+	if cur.next != nil {
+		rows = append(rows, cur.next)
+		cur.next = nil
+	}
+
+	for (maxRows == 0 || len(rows) < maxRows) && cur.rows.Next() {
+		row, err := cur.scan()
+		if err != nil {
+			db.release(cur)
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+
+	// Read ahead to determine whether rows remain
+	if maxRows > 0 && len(rows) == maxRows && cur.rows.Next() {
+		row, err := cur.scan()
+		if err != nil {
+			db.release(cur)
+			return nil, err
+		}
+		cur.next = row
+
+		if cur.handle == "" {
+			err = db.trackCursor(ctx, cur)
+			if err != nil {
+				db.release(cur)
+				return nil, err
+			}
+		}
+		return rows, nil
+	}
+
+	err := cur.rows.Err()
+	db.release(cur)
+	if err != nil {
+		return nil, fmt.Errorf("error while processing query results - %w", err)
+	}
+	return rows, nil
+}
+
+// trackCursor registers the cursor under a new random handle. The cursor is released when ctx is canceled.
+func (db *Database) trackCursor(ctx context.Context, cur *cursor) error {
+	handle, err := newHandle()
+	if err != nil {
+		return fmt.Errorf("unable to generate cursor - %w", err)
+	}
+
+	db.Lock()
+	cur.handle = handle
+	db.cursors[handle] = cur
+	db.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		db.release(cur)
+	})
+	return nil
+}
+
+// release closes the cursor and removes it from the tracked cursors.
+func (db *Database) release(cur *cursor) {
+	db.Lock()
+	if cur.handle != "" {
+		delete(db.cursors, cur.handle)
+	}
+	db.Unlock()
+	_ = cur.rows.Close()
+	if cur.tx != nil {
+		_ = cur.tx.Rollback()
+	}
+}
+
+// scan reads the current row of the cursor.
+func (cur *cursor) scan() ([]any, error) {
+	row := make([]any, len(cur.columns))
+	dest := make([]any, len(cur.columns))
+	for i := range row {
+		dest[i] = &row[i]
+	}
+
+	err := cur.rows.Scan(dest...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to process query results - %w", err)
+	}
+	return row, nil
+}
+
+// names returns the column names of the cursor.
+func (cur *cursor) names() []string {
+	names := make([]string, 0, len(cur.columns))
+	for _, c := range cur.columns {
+		names = append(names, c.Name())
+	}
+	return names
+}
+
+// resultSet converts a page of rows read from the cursor into a typed SQLResultSet.
+func resultSet(cur *cursor, rows [][]any) (*envelope.SQLResultSet, error) {
+	rs := &envelope.SQLResultSet{Status: &sdkproto.Status{Code: 200, Status: "OK"}}
+	if cur == nil {
+		return rs, nil
+	}
+
+	for _, c := range cur.columns {
+		nullable, ok := c.Nullable()
+		rs.Columns = append(rs.Columns, &envelope.SQLColumn{
+			Name:         c.Name(),
+			DatabaseType: c.DatabaseTypeName(),
+			Nullable:     nullable || !ok,
+		})
+	}
+
+	for _, row := range rows {
+		values := make([]any, 0, len(row))
+		for i, v := range row {
+			values = append(values, typedValue(v, cur.columns[i].DatabaseTypeName()))
+		}
+		r, err := envelope.NewSQLRow(values)
+		if err != nil {
+			return nil, err
+		}
+		rs.Rows = append(rs.Rows, r)
+	}
+
+	if cur.next != nil {
+		rs.Cursor = cur.handle
+	}
+	return rs, nil
+}
+
+// typedValue converts a value scanned from the database into a SQLValue type. Drivers returning values as text,
+// such as MySQL, return byte slices for every column; these are converted using the database type of the column.
+func typedValue(v any, databaseType string) any {
+	switch v := v.(type) {
+	case nil, string, int64, float64, bool, time.Time:
+		return v
+	case []byte:
+		return bytesValue(v, databaseType)
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// bytesValue converts a byte slice value into the type of its database column. Values that do not parse as the
+// column type are returned as strings.
+func bytesValue(v []byte, databaseType string) any {
+	switch strings.TrimPrefix(strings.ToUpper(databaseType), "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "INT2", "INT4", "INT8", "YEAR":
+		i, err := strconv.ParseInt(string(v), 10, 64)
+		if err == nil {
+			return i
+		}
+	case "FLOAT", "DOUBLE", "REAL", "FLOAT4", "FLOAT8", "DOUBLE PRECISION":
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err == nil {
+			return f
+		}
+	case "BOOL", "BOOLEAN":
+		b, err := strconv.ParseBool(string(v))
+		if err == nil {
+			return b
+		}
+	case "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY", "BYTEA":
+		return v
+	}
+	return string(v)
+}
@@ -14,19 +14,36 @@ provide WASM functions with a host callback interface that provides SQL database
 		router := callbacks.New()
 		router.RegisterCallback("sql", "query", dBase.Query)
 	}
+
+Transactions are begun with BeginContext, which returns a transaction handle used by queries and execs within the
+transaction. Transactions are bound to the context of the callback that began them, and are rolled back
+automatically if still open when that context is canceled.
+
+A Policy restricts the statements callers may execute, such as permitting only select statements within read-only
+transactions for reporting functions sharing a database with others.
+
+In addition to the default database, named databases can be configured with Databases. JSON requests select a named
+database with their data source; requests without a data source use the database returned by DataSource for the
+context of the callback, or the default database.
 */
 package sql
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/pquerna/ffjson/ffjson"
 
 	"github.com/tarmac-project/tarmac"
+	"github.com/tarmac-project/tarmac/pkg/envelope"
 
 	sdkproto "github.com/tarmac-project/protobuf-go/sdk"
 	proto "github.com/tarmac-project/protobuf-go/sdk/sql"
@@ -37,36 +54,128 @@ import (
 // Users will send the specified JSON request to execute a query and receive an appropriate JSON response.
 type Database struct {
 	db *sql.DB
+
+	// dbs are the named databases selectable by the data source of a request.
+	dbs map[string]*sql.DB
+
+	// dataSource returns the name of the database used by requests without a data source.
+	dataSource func(context.Context) (string, error)
+
+	// policy returns the statement Policy of the caller.
+	policy func(context.Context) Policy
+
+	// txs are the open transactions indexed by handle.
+	txs map[string]*transaction
+
+	// cursors are the partially read result sets indexed by handle.
+	cursors map[string]*cursor
+
+	sync.Mutex
 }
 
+// transaction is an open transaction and the context it is bound to.
+type transaction struct {
+	tx *sql.Tx
+
+	// done is the done channel of the context the transaction was begun with. Transactions may only be used by
+	// callbacks sharing the context, which prevents handles being used outside of the invocation that began them.
+	done <-chan struct{}
+}
+
+// conn is the common interface of sql.DB and sql.Tx used to execute queries.
+type conn interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+var (
+	// ErrTransactionNotFound is returned when a transaction handle does not refer to an open transaction of the
+	// caller.
+	ErrTransactionNotFound = errors.New("transaction not found")
+
+	// ErrDataSourceNotFound is returned when a request refers to a database that is not configured.
+	ErrDataSourceNotFound = errors.New("data source not found")
+)
+
 // Config is provided to users to configure the Host Callback. All Tarmac Callbacks follow the same configuration
 // format; each Config struct gives the specific Host Callback unique functionality.
 type Config struct {
 	// DB is the user-provided SQL database instance using the standard "database/sql" interface. This package by
 	// itself does not manage database connections but rather relies on the sql.DB interface. Users must
-	// supply an initiated sql.DB to work with.
+	// supply an initiated sql.DB to work with. DB is the default database and may be nil when Databases are defined.
 	DB *sql.DB
+
+	// Databases are named databases, selected by the data source of a request.
+	Databases map[string]*sql.DB
+
+	// DataSource returns the name of the database used for requests made with the context that do not specify a data
+	// source. When undefined or returning an empty name, the default database is used. Requests are rejected when it
+	// returns an error.
+	DataSource func(ctx context.Context) (string, error)
+
+	// Policy returns the statement Policy of requests made with the context. When undefined, every statement is
+	// permitted.
+	Policy func(ctx context.Context) Policy
 }
 
 // New will create and return a new Database instance that users can register as a Tarmac Host Callback function. Users
 // can provide any custom Database configurations using the configuration options supplied.
 func New(cfg Config) (*Database, error) {
-	db := &Database{}
-	if cfg.DB == nil {
+	db := &Database{txs: make(map[string]*transaction), cursors: make(map[string]*cursor)}
+	if cfg.DB == nil && len(cfg.Databases) == 0 {
 		return db, errors.New("DB cannot be nil")
 	}
 	db.db = cfg.DB
+	db.dbs = cfg.Databases
+	db.dataSource = cfg.DataSource
+	db.policy = cfg.Policy
 	return db, nil
 }
 
+// source returns the database named by the data source of a request. When name is empty, the database returned by
+// DataSource for ctx is used, falling back to the default database.
+func (db *Database) source(ctx context.Context, name string) (*sql.DB, error) {
+	if db.dataSource != nil {
+		// Callers without a data source are rejected even when the request selects one
+		source, err := db.dataSource(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			name = source
+		}
+	}
+
+	if name == "" {
+		if db.db == nil {
+			return nil, fmt.Errorf("%w - no default database", ErrDataSourceNotFound)
+		}
+		return db.db, nil
+	}
+
+	d, ok := db.dbs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w - %s", ErrDataSourceNotFound, name)
+	}
+	return d, nil
+}
+
 // Exec will execute the supplied query against the supplied database. Error handling, processing results, and base64 encoding
 // of data are all handled via this function. Note, this function expects the SQLExec type as input
-// and will return a SQLExecResponse JSON.
+// and will return a SQLExecResponse JSON. Proto SQLExec requests are also accepted.
 func (db *Database) Exec(b []byte) ([]byte, error) {
-	msg := &proto.SQLExec{}
+	return db.ExecContext(context.Background(), b)
+}
+
+// ExecContext performs the same function as Exec, with the query bound to the provided context. When the context is
+// canceled or its deadline expires, the query is aborted. Proto requests are decoded as the SQLExec envelope, which
+// extends the SDK message with bind parameters, transactions, and data sources.
+func (db *Database) ExecContext(ctx context.Context, b []byte) ([]byte, error) {
+	msg := &envelope.SQLExec{}
 	err := msg.UnmarshalVT(b)
 	if err != nil {
-		return []byte(""), errors.New("unable to unmarshal database:exec request")
+		// Fallback to JSON if proto fails
+		return db.execJSON(ctx, b)
 	}
 
 	r := &proto.SQLExecResponse{}
@@ -77,9 +186,26 @@ func (db *Database) Exec(b []byte) ([]byte, error) {
 		r.Status.Status = "SQL Query must be defined"
 	}
 
+	var c conn
+	if r.GetStatus().GetCode() == 200 {
+		c, err = db.conn(ctx, msg.GetTransaction(), msg.GetDataSource())
+		if err != nil {
+			r.Status.Code = 404
+			r.Status.Status = fmt.Sprintf("Unable to select database - %s", err)
+		}
+	}
+
+	if r.GetStatus().GetCode() == 200 {
+		err = db.permit(ctx, msg.GetQuery())
+		if err != nil {
+			r.Status.Code = 403
+			r.Status.Status = fmt.Sprintf("Unable to execute query - %s", err)
+		}
+	}
+
 	var results sql.Result
 	if r.GetStatus().GetCode() == 200 {
-		results, err = db.exec(msg.GetQuery())
+		results, err = db.exec(ctx, c, msg.GetQuery(), protoParams(msg.GetParams())...)
 		if err != nil {
 			r.Status.Code = 500
 			r.Status.Status = fmt.Sprintf("Unable to execute query - %s", err)
@@ -120,33 +246,45 @@ func (db *Database) Exec(b []byte) ([]byte, error) {
 
 // Query will execute the supplied query against the supplied database. Error handling, processing results, and base64 encoding
 // of data are all handled via this function. Note, this function expects the SQLQueryJSON type as input
-// and will return a SQLQueryResponse JSON.
+// and will return a SQLQueryResponse JSON. Proto SQLQuery requests are also accepted.
 func (db *Database) Query(b []byte) ([]byte, error) {
-	msg := &proto.SQLQuery{}
+	return db.QueryContext(context.Background(), b)
+}
+
+// QueryContext performs the same function as Query, with the query bound to the provided context. When the context is
+// canceled or its deadline expires, the query is aborted. Proto requests are decoded as the SQLQuery envelope, which
+// extends the SDK message with the bind parameters, transactions, data sources, paging, and formats of the JSON
+// interface.
+func (db *Database) QueryContext(ctx context.Context, b []byte) ([]byte, error) {
+	msg := &envelope.SQLQuery{}
 	err := msg.UnmarshalVT(b)
 	if err != nil {
 		// Fallback to JSON if proto fails
-		return db.queryJSON(b)
+		return db.queryJSON(ctx, b)
 	}
 
-	// Create a new SQLQueryResponse
-	r := &proto.SQLQueryResponse{}
-	r.Status = &sdkproto.Status{Code: 200, Status: "OK"}
+	status := tarmac.Status{Code: 200, Status: "OK"}
+	cur, rows := db.read(ctx, msg.GetFormat(), msg.GetMaxRows(), msg.GetCursor(), &status, func() *cursor {
+		if len(msg.GetQuery()) < 1 {
+			status.Code = 400
+			status.Status = "SQL Query must be defined"
+			return nil
+		}
+		return db.openQuery(ctx, msg.GetQuery(), protoParams(msg.GetParams()), msg.GetTransaction(),
+			msg.GetDataSource(), &status)
+	})
 
-	if len(msg.GetQuery()) < 1 {
-		r.Status.Code = 400
-		r.Status.Status = "SQL Query must be defined"
+	if msg.GetFormat() == "proto" {
+		return resultSetResponse(cur, rows, status)
 	}
 
-	if r.GetStatus().GetCode() == 200 {
-		columns, results, err := db.query(msg.GetQuery())
-		if err != nil {
-			r.Status.Code = 500
-			r.Status.Status = fmt.Sprintf("Unable to execute query - %s", err)
-		}
+	// Create a new SQLQueryResponse
+	r := &envelope.SQLQueryResponse{}
+	r.Status = &sdkproto.Status{Code: int32(status.Code), Status: status.Status}
 
+	if r.GetStatus().GetCode() == 200 {
 		// Marshal results into JSON bytes
-		j, err := ffjson.Marshal(results)
+		j, err := ffjson.Marshal(rowMaps(cur, rows))
 		if err != nil {
 			r.Status.Code = 500
 			r.Status.Status = fmt.Sprintf("Unable to convert query results to JSON - %s", err)
@@ -154,7 +292,10 @@ func (db *Database) Query(b []byte) ([]byte, error) {
 
 		// Set the response data
 		r.Data = j
-		r.Columns = columns
+		r.Columns = cur.names()
+		if cur.next != nil {
+			r.Cursor = cur.handle
+		}
 	}
 
 	// Marshal a response Proto to return to caller
@@ -170,8 +311,153 @@ func (db *Database) Query(b []byte) ([]byte, error) {
 	return rsp, fmt.Errorf("%s", r.GetStatus().GetStatus())
 }
 
-// queryJSON retains the JSON interface for backwards compatibility with the Tarmac Host Callback interface.
-func (db *Database) queryJSON(b []byte) ([]byte, error) {
+// BeginContext begins a transaction bound to the provided context, returning a SQLBeginResponse JSON with the
+// transaction handle. Queries and execs supplying the handle are executed within the transaction until it is
+// committed or rolled back. If the context is canceled while the transaction is open, it is rolled back. An optional
+// SQLBegin JSON selects the database of the transaction.
+func (db *Database) BeginContext(ctx context.Context, b []byte) ([]byte, error) {
+	r := tarmac.SQLBeginResponse{}
+	r.Status.Code = 200
+	r.Status.Status = "OK"
+
+	var rq tarmac.SQLBegin
+	var err error
+	if len(b) > 0 {
+		err = ffjson.Unmarshal(b, &rq)
+		if err != nil {
+			r.Status.Code = 400
+			r.Status.Status = "Error Parsing Input"
+		}
+	}
+
+	var d *sql.DB
+	if r.Status.Code == 200 {
+		d, err = db.source(ctx, rq.DataSource)
+		if err != nil {
+			r.Status.Code = 404
+			r.Status.Status = fmt.Sprintf("Unable to select database - %s", err)
+		}
+	}
+
+	var tx *sql.Tx
+	if r.Status.Code == 200 {
+		tx, err = d.BeginTx(ctx, &sql.TxOptions{ReadOnly: db.readOnly(ctx)})
+		if err != nil {
+			r.Status.Code = 500
+			r.Status.Status = fmt.Sprintf("Unable to begin transaction - %s", err)
+		}
+	}
+
+	if r.Status.Code == 200 {
+		r.Transaction, err = db.track(ctx, tx)
+		if err != nil {
+			_ = tx.Rollback()
+			r.Status.Code = 500
+			r.Status.Status = fmt.Sprintf("Unable to begin transaction - %s", err)
+		}
+	}
+
+	rsp, err := ffjson.Marshal(r)
+	if err != nil {
+		return []byte(""), errors.New("unable to marshal database:begin response")
+	}
+
+	if r.Status.Code == 200 {
+		return rsp, nil
+	}
+	return rsp, fmt.Errorf("%s", r.Status.Status)
+}
+
+// CommitContext commits the transaction referred to by the handle within the supplied SQLTransaction JSON, returning
+// a SQLTransactionResponse JSON.
+func (db *Database) CommitContext(ctx context.Context, b []byte) ([]byte, error) {
+	return db.end(ctx, b, "commit", func(tx *sql.Tx) error { return tx.Commit() })
+}
+
+// RollbackContext rolls back the transaction referred to by the handle within the supplied SQLTransaction JSON,
+// returning a SQLTransactionResponse JSON.
+func (db *Database) RollbackContext(ctx context.Context, b []byte) ([]byte, error) {
+	return db.end(ctx, b, "rollback", func(tx *sql.Tx) error { return tx.Rollback() })
+}
+
+// end removes the transaction referred to by the request and ends it with the supplied commit or rollback function.
+func (db *Database) end(ctx context.Context, b []byte, op string, f func(*sql.Tx) error) ([]byte, error) {
+	r := tarmac.SQLTransactionResponse{}
+	r.Status.Code = 200
+	r.Status.Status = "OK"
+
+	var rq tarmac.SQLTransaction
+	err := ffjson.Unmarshal(b, &rq)
+	if err != nil {
+		r.Status.Code = 400
+		r.Status.Status = "Error Parsing Input"
+	}
+
+	if r.Status.Code == 200 {
+		tx, err := db.untrack(ctx, rq.Transaction)
+		if err != nil {
+			r.Status.Code = 404
+			r.Status.Status = fmt.Sprintf("Unable to find transaction - %s", err)
+		}
+
+		if err == nil {
+			err = f(tx)
+			if err != nil {
+				r.Status.Code = 500
+				r.Status.Status = fmt.Sprintf("Unable to %s transaction - %s", op, err)
+			}
+		}
+	}
+
+	rsp, err := ffjson.Marshal(r)
+	if err != nil {
+		return []byte(""), fmt.Errorf("unable to marshal database:%s response", op)
+	}
+
+	if r.Status.Code == 200 {
+		return rsp, nil
+	}
+	return rsp, fmt.Errorf("%s", r.Status.Status)
+}
+
+// track registers an open transaction under a new random handle. The transaction is removed and rolled back when
+// ctx is canceled.
+func (db *Database) track(ctx context.Context, tx *sql.Tx) (string, error) {
+	handle, err := newHandle()
+	if err != nil {
+		return "", fmt.Errorf("unable to generate transaction handle - %w", err)
+	}
+
+	db.Lock()
+	db.txs[handle] = &transaction{tx: tx, done: ctx.Done()}
+	db.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		db.Lock()
+		delete(db.txs, handle)
+		db.Unlock()
+		_ = tx.Rollback()
+	})
+
+	return handle, nil
+}
+
+// untrack removes and returns the transaction referred to by handle.
+func (db *Database) untrack(ctx context.Context, handle string) (*sql.Tx, error) {
+	db.Lock()
+	defer db.Unlock()
+	t, ok := db.txs[handle]
+	if !ok || t.done != ctx.Done() {
+		return nil, ErrTransactionNotFound
+	}
+	delete(db.txs, handle)
+	return t.tx, nil
+}
+
+// queryJSON retains the JSON interface for backwards compatibility with the Tarmac Host Callback interface. The JSON
+// interface also supports bind parameters, transactions, paging through results with max_rows and cursor, and
+// returning typed results as a protobuf SQLResultSet with the proto format.
+func (db *Database) queryJSON(ctx context.Context, b []byte) ([]byte, error) {
 	// Start Response Message assuming everything is good
 	r := tarmac.SQLQueryResponse{}
 	r.Status.Code = 200
@@ -185,7 +471,184 @@ func (db *Database) queryJSON(b []byte) ([]byte, error) {
 		r.Status.Status = "Error Parsing Input"
 	}
 
+	cur, rows := db.read(ctx, rq.Format, int64(rq.MaxRows), rq.Cursor, &r.Status, func() *cursor {
+		return db.openJSON(ctx, rq, &r.Status)
+	})
+
+	if rq.Format == "proto" {
+		return resultSetResponse(cur, rows, r.Status)
+	}
+
+	if r.Status.Code == 200 {
+		// Convert results into JSON
+		j, err := ffjson.Marshal(rowMaps(cur, rows))
+		if err != nil {
+			r.Status.Code = 500
+			r.Status.Status = fmt.Sprintf("Unable to convert query results to JSON - %s", err)
+		}
+
+		// Base64 encode results to avoid JSON format conflicts
+		r.Data = base64.StdEncoding.EncodeToString(j)
+		if cur.next != nil {
+			r.Cursor = cur.handle
+		}
+	}
+
+	// Marshal a resposne JSON to return to caller
+	rsp, err := ffjson.Marshal(r)
+	if err != nil {
+		return []byte(""), errors.New("unable to marshal database:query response")
+	}
+
+	if r.Status.Code == 200 {
+		return rsp, nil
+	}
+	return rsp, fmt.Errorf("%s", r.Status.Status)
+}
+
+// read validates the format and paging options of a query request, then executes the query with open or continues
+// reading the result set of a previous query when a cursor is provided. The cursor and its next page of rows are
+// returned. On failure, the status is updated to describe the failure.
+func (db *Database) read(ctx context.Context, format string, maxRows int64, handle string, status *tarmac.Status,
+	open func() *cursor) (*cursor, [][]any) {
+	if format != "" && format != "json" && format != "proto" {
+		status.Code = 400
+		status.Status = fmt.Sprintf("Unknown format %s", format)
+	}
+
+	if maxRows < 0 {
+		status.Code = 400
+		status.Status = "Max rows cannot be negative"
+	}
+
+	var cur *cursor
+	var err error
+	switch {
+	case status.Code != 200:
+	case handle != "":
+		// Continue reading the result set of a previous query
+		cur, err = db.cursor(ctx, handle)
+		if err != nil {
+			status.Code = 404
+			status.Status = fmt.Sprintf("Unable to find cursor - %s", err)
+		}
+	default:
+		cur = open()
+	}
+
+	var rows [][]any
+	if status.Code == 200 {
+		rows, err = db.page(ctx, cur, int(maxRows))
+		if err != nil {
+			status.Code = 500
+			status.Status = fmt.Sprintf("Unable to execute query - %s", err)
+		}
+	}
+	return cur, rows
+}
+
+// resultSetResponse returns a page of rows read from the cursor as a SQLResultSet with the supplied status, used for
+// queries requesting the proto format.
+func resultSetResponse(cur *cursor, rows [][]any, status tarmac.Status) ([]byte, error) {
+	rs, err := resultSet(cur, rows)
+	if err != nil {
+		return []byte(""), errors.New("unable to marshal database:query response")
+	}
+	rs.Status = &sdkproto.Status{Code: int32(status.Code), Status: status.Status}
+	rsp, err := rs.MarshalVT()
+	if err != nil {
+		return []byte(""), errors.New("unable to marshal database:query response")
+	}
+
+	if status.Code == 200 {
+		return rsp, nil
+	}
+	return rsp, fmt.Errorf("%s", status.Status)
+}
+
+// rowMaps converts a page of rows read from the cursor into a list of maps of column name to value, used for queries
+// requesting the json format.
+func rowMaps(cur *cursor, rows [][]any) []map[string]any {
+	results := make([]map[string]any, 0, len(rows))
+	columns := cur.names()
+	for _, row := range rows {
+		m := make(map[string]any)
+		for i, c := range columns {
+			m[c] = row[i]
+		}
+		results = append(results, m)
+	}
+	return results
+}
+
+// openJSON decodes the query and bind parameters of a JSON request and executes the query, returning a cursor over
+// the result set. On failure, nil is returned and the status is updated to describe the failure.
+func (db *Database) openJSON(ctx context.Context, rq tarmac.SQLQuery, status *tarmac.Status) *cursor {
 	// Decode Query to execute
+	q, err := base64.StdEncoding.DecodeString(rq.Query)
+	if err != nil {
+		status.Code = 400
+		status.Status = fmt.Sprintf("Unable to decode query - %s", err)
+		return nil
+	}
+
+	if len(q) < 1 {
+		status.Code = 400
+		status.Status = "SQL Query must be defined"
+		return nil
+	}
+
+	// Convert bind parameters into query arguments
+	args, err := params(rq.Params)
+	if err != nil {
+		status.Code = 400
+		status.Status = fmt.Sprintf("Invalid query parameters - %s", err)
+		return nil
+	}
+
+	return db.openQuery(ctx, q, args, rq.Transaction, rq.DataSource, status)
+}
+
+// openQuery executes the query within the transaction referred to by handle, or against the database named by
+// dataSource, returning a cursor over the result set. On failure, nil is returned and the status is updated to
+// describe the failure.
+func (db *Database) openQuery(ctx context.Context, q []byte, args []any, handle, dataSource string,
+	status *tarmac.Status) *cursor {
+	c, err := db.conn(ctx, handle, dataSource)
+	if err != nil {
+		status.Code = 404
+		status.Status = fmt.Sprintf("Unable to select database - %s", err)
+		return nil
+	}
+
+	err = db.permit(ctx, q)
+	if err != nil {
+		status.Code = 403
+		status.Status = fmt.Sprintf("Unable to execute query - %s", err)
+		return nil
+	}
+
+	cur, err := db.open(ctx, c, q, args...)
+	if err != nil {
+		status.Code = 500
+		status.Status = fmt.Sprintf("Unable to execute query - %s", err)
+		return nil
+	}
+	return cur
+}
+
+// execJSON provides the JSON interface of the Exec Host Callback, used for statements with bind parameters.
+func (db *Database) execJSON(ctx context.Context, b []byte) ([]byte, error) {
+	r := tarmac.SQLExecResponse{}
+	r.Status.Code = 200
+	r.Status.Status = "OK"
+
+	var rq tarmac.SQLExec
+	err := ffjson.Unmarshal(b, &rq)
+	if err != nil {
+		return []byte(""), errors.New("unable to unmarshal database:exec request")
+	}
+
 	q, err := base64.StdEncoding.DecodeString(rq.Query)
 	if err != nil {
 		r.Status.Code = 400
@@ -197,28 +660,51 @@ func (db *Database) queryJSON(b []byte) ([]byte, error) {
 		r.Status.Status = "SQL Query must be defined"
 	}
 
+	args, err := params(rq.Params)
+	if err != nil {
+		r.Status.Code = 400
+		r.Status.Status = fmt.Sprintf("Invalid query parameters - %s", err)
+	}
+
+	c, err := db.conn(ctx, rq.Transaction, rq.DataSource)
+	if err != nil && r.Status.Code == 200 {
+		r.Status.Code = 404
+		r.Status.Status = fmt.Sprintf("Unable to select database - %s", err)
+	}
+
 	if r.Status.Code == 200 {
-		_, results, err := db.query(q)
+		err = db.permit(ctx, q)
 		if err != nil {
-			r.Status.Code = 500
+			r.Status.Code = 403
 			r.Status.Status = fmt.Sprintf("Unable to execute query - %s", err)
 		}
+	}
 
-		// Convert results into JSON
-		j, err := ffjson.Marshal(results)
+	if r.Status.Code == 200 {
+		results, err := db.exec(ctx, c, q, args...)
 		if err != nil {
 			r.Status.Code = 500
-			r.Status.Status = fmt.Sprintf("Unable to convert query results to JSON - %s", err)
+			r.Status.Status = fmt.Sprintf("Unable to execute query - %s", err)
 		}
 
-		// Base64 encode results to avoid JSON format conflicts
-		r.Data = base64.StdEncoding.EncodeToString(j)
+		if err == nil {
+			r.RowsAffected, err = results.RowsAffected()
+			if err != nil {
+				r.Status.Code = 206
+				r.Status.Status = fmt.Sprintf("Unable to get rows affected - %s", err)
+			}
+
+			r.LastInsertID, err = results.LastInsertId()
+			if err != nil {
+				r.Status.Code = 206
+				r.Status.Status = fmt.Sprintf("Unable to get last insert ID - %s", err)
+			}
+		}
 	}
 
-	// Marshal a resposne JSON to return to caller
 	rsp, err := ffjson.Marshal(r)
 	if err != nil {
-		return []byte(""), errors.New("unable to marshal database:query response")
+		return []byte(""), errors.New("unable to marshal database:exec response")
 	}
 
 	if r.Status.Code == 200 {
@@ -227,56 +713,101 @@ func (db *Database) queryJSON(b []byte) ([]byte, error) {
 	return rsp, fmt.Errorf("%s", r.Status.Status)
 }
 
-// query will execute the supplied query against the database and return
-// the rows as a list of maps. The keys in the map are the column names
-// and the values are the column values.
-func (db *Database) query(qry []byte) ([]string, []map[string]any, error) {
-	rows, err := db.db.QueryContext(context.Background(), string(qry))
+// exec will execute the supplied query against the connection and return the result.
+func (db *Database) exec(ctx context.Context, c conn, qry []byte, args ...any) (sql.Result, error) {
+	c, tx, err := db.readOnlyTx(ctx, c)
 	if err != nil {
-		return nil, nil, fmt.Errorf("unable to execute query - %w", err)
+		return nil, err
+	}
+	if tx == nil {
+		return c.ExecContext(ctx, string(qry), args...)
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	columns, err := rows.Columns()
+	results, err := c.ExecContext(ctx, string(qry), args...)
 	if err != nil {
-		return nil, nil, fmt.Errorf("unable to process query results - %w", err)
+		return nil, err
 	}
+	return results, tx.Commit()
+}
 
-	var results []map[string]any
+// conn returns the transaction referred to by handle, or the database named by dataSource when no handle is provided.
+func (db *Database) conn(ctx context.Context, handle, dataSource string) (conn, error) {
+	if handle == "" {
+		return db.source(ctx, dataSource)
+	}
 
-	for rows.Next() {
-		colNames := make([]interface{}, len(columns))
-		data := make([]interface{}, len(columns))
-		for i := range colNames {
-			data[i] = &colNames[i]
-		}
+	db.Lock()
+	defer db.Unlock()
+	t, ok := db.txs[handle]
+	if !ok || t.done != ctx.Done() {
+		return nil, ErrTransactionNotFound
+	}
+	return t.tx, nil
+}
+
+// newHandle returns a new random handle used to refer to transactions and cursors.
+func newHandle() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
 
-		err := rows.Scan(data...)
+// params converts the bind parameters of a request into query arguments for the database driver. Named parameters
+// are converted into sql.NamedArg values.
+func params(p []tarmac.SQLParam) ([]any, error) {
+	args := make([]any, 0, len(p))
+	for i, param := range p {
+		v, err := paramValue(param)
 		if err != nil {
-			return nil, nil, fmt.Errorf("unable to process query results - %w", err)
+			return nil, fmt.Errorf("parameter %d - %w", i+1, err)
 		}
 
-		m := make(map[string]any)
-		for i, c := range columns {
-			value, ok := data[i].(*interface{})
-			if !ok {
-				continue
-			}
-			val := *value
-			m[c] = val
+		if param.Name != "" {
+			args = append(args, sql.Named(param.Name, v))
+			continue
 		}
-
-		results = append(results, m)
+		args = append(args, v)
 	}
+	return args, nil
+}
 
-	if rows.Err() != nil {
-		return nil, nil, fmt.Errorf("error while processing query results - %w", rows.Err())
+// protoParams converts the bind parameters of a proto request into query arguments for the database driver. Named
+// parameters are converted into sql.NamedArg values.
+func protoParams(p []*envelope.SQLParam) []any {
+	args := make([]any, 0, len(p))
+	for _, param := range p {
+		v := param.GetValue().Interface()
+		if param.GetName() != "" {
+			args = append(args, sql.Named(param.GetName(), v))
+			continue
+		}
+		args = append(args, v)
 	}
-
-	return columns, results, nil
+	return args
 }
 
-// exec will execute the supplied query against the database and return the result.
-func (db *Database) exec(qry []byte) (sql.Result, error) {
-	return db.db.ExecContext(context.Background(), string(qry))
+// paramValue parses the string representation of a bind parameter into a value of its type.
+func paramValue(p tarmac.SQLParam) (any, error) {
+	switch p.Type {
+	case "string":
+		return p.Value, nil
+	case "int":
+		return strconv.ParseInt(p.Value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(p.Value, 64)
+	case "bool":
+		return strconv.ParseBool(p.Value)
+	case "bytes":
+		return base64.StdEncoding.DecodeString(p.Value)
+	case "null":
+		return nil, nil
+	case "timestamp":
+		return time.Parse(time.RFC3339Nano, p.Value)
+	default:
+		return nil, fmt.Errorf("unknown parameter type %q", p.Type)
+	}
 }
@@ -1,18 +1,27 @@
 package sql
 
 import (
+	"context"
 	"database/sql"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"reflect"
 	"strconv"
 
 	// Import MySQL Driver.
 	"testing"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/pquerna/ffjson/ffjson"
 
+	// Import SQLite Driver.
+	_ "modernc.org/sqlite"
+
 	"github.com/tarmac-project/tarmac"
+	"github.com/tarmac-project/tarmac/pkg/envelope"
 
 	proto "github.com/tarmac-project/protobuf-go/sdk/sql"
 )
@@ -467,6 +476,74 @@ func TestSQLQuery(t *testing.T) {
 				}
 			})
 
+			t.Run("Parameterized Exec", func(t *testing.T) {
+				q := base64.StdEncoding.EncodeToString([]byte(`INSERT INTO testpkg (id, name) VALUES (?, ?);`))
+				j := fmt.Sprintf(`{"query":"%s","params":[{"type":"int","value":"2"},`+
+					`{"type":"string","value":"Jane \"Smith\"); DROP TABLE testpkg; --"}]}`, q)
+				r, err := db.Exec([]byte(j))
+				if err != nil {
+					t.Fatalf("Unable to execute parameterized statement - %s", err)
+				}
+
+				var rsp tarmac.SQLExecResponse
+				err = ffjson.Unmarshal(r, &rsp)
+				if err != nil {
+					t.Fatalf("Error parsing returned exec response")
+				}
+				if rsp.Status.Code != 200 || rsp.RowsAffected != 1 {
+					t.Fatalf("Unexpected exec response - %+v", rsp)
+				}
+			})
+
+			t.Run("Parameterized Query", func(t *testing.T) {
+				q := base64.StdEncoding.EncodeToString([]byte(`SELECT name FROM testpkg WHERE id = ?;`))
+				j := fmt.Sprintf(`{"query":"%s","params":[{"type":"int","value":"2"}]}`, q)
+				r, err := db.Query([]byte(j))
+				if err != nil {
+					t.Fatalf("Unable to execute parameterized query - %s", err)
+				}
+
+				var rsp tarmac.SQLQueryResponse
+				err = ffjson.Unmarshal(r, &rsp)
+				if err != nil {
+					t.Fatalf("Error parsing returned query response")
+				}
+
+				data, err := base64.StdEncoding.DecodeString(rsp.Data)
+				if err != nil {
+					t.Fatalf("Callback returned undecodable response - %s", err)
+				}
+
+				var records []struct {
+					Name []byte `json:"name"`
+				}
+				err = ffjson.Unmarshal(data, &records)
+				if err != nil {
+					t.Fatalf("Unable to unmarshal SQL response - %s", err)
+				}
+				if len(records) != 1 || string(records[0].Name) != `Jane "Smith"); DROP TABLE testpkg; --` {
+					t.Fatalf("Unexpected value from Database got %+v", records)
+				}
+			})
+
+			t.Run("Invalid Parameters", func(t *testing.T) {
+				q := base64.StdEncoding.EncodeToString([]byte(`SELECT name FROM testpkg WHERE id = ?;`))
+				j := fmt.Sprintf(`{"query":"%s","params":[{"type":"int","value":"two"}]}`, q)
+				r, err := db.Query([]byte(j))
+				if err == nil {
+					t.Fatalf("Unexpected success with invalid parameters")
+				}
+
+				var rsp tarmac.SQLQueryResponse
+				err = ffjson.Unmarshal(r, &rsp)
+				if err != nil {
+					t.Fatalf("Error parsing returned query response")
+				}
+				if rsp.Status.Code != 400 {
+					t.Fatalf("Unexpected status code - %d", rsp.Status.Code)
+				}
+			})
+
 			t.Run("Delete Table", func(t *testing.T) {
 				q := base64.StdEncoding.EncodeToString([]byte(`DROP TABLE IF EXISTS testpkg;`))
 				j := fmt.Sprintf(`{"query":"%s"}`, q)
@@ -490,3 +567,1056 @@ func TestSQLQuery(t *testing.T) {
 		})
 	})
 }
+
+func TestParams(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	t.Run("Typed Values", func(t *testing.T) {
+		args, err := params([]tarmac.SQLParam{
+			{Type: "string", Value: "hello"},
+			{Type: "int", Value: "-42"},
+			{Type: "float", Value: "1.5"},
+			{Type: "bool", Value: "true"},
+			{Type: "bytes", Value: base64.StdEncoding.EncodeToString([]byte("data"))},
+			{Type: "null"},
+			{Type: "timestamp", Value: ts.Format(time.RFC3339Nano)},
+			{Name: "id", Type: "int", Value: "7"},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error converting parameters - %s", err)
+		}
+
+		expected := []any{"hello", int64(-42), 1.5, true, []byte("data"), nil, ts, sql.Named("id", int64(7))}
+		if !reflect.DeepEqual(args, expected) {
+			t.Errorf("Unexpected arguments - %#v", args)
+		}
+	})
+
+	tt := map[string]tarmac.SQLParam{
+		"Unknown Type":      {Type: "uuid", Value: "abc"},
+		"Missing Type":      {Value: "abc"},
+		"Invalid Int":       {Type: "int", Value: "1.5"},
+		"Invalid Float":     {Type: "float", Value: "one"},
+		"Invalid Bool":      {Type: "bool", Value: "yes"},
+		"Invalid Bytes":     {Type: "bytes", Value: "not base64!"},
+		"Invalid Timestamp": {Type: "timestamp", Value: "2024-01-02"},
+	}
+
+	for name, p := range tt {
+		t.Run(name, func(t *testing.T) {
+			_, err := params([]tarmac.SQLParam{p})
+			if err == nil {
+				t.Errorf("Expected error converting parameter %+v", p)
+			}
+		})
+	}
+}
+
+func TestSQLContextCanceled(t *testing.T) {
+	mockDB, err := sql.Open("mysql", "root:example@tcp(mysql:3306)/example")
+	if err != nil {
+		t.Fatalf("Unable to create DB for testing")
+	}
+	defer mockDB.Close()
+
+	db, err := New(Config{DB: mockDB})
+	if err != nil {
+		t.Fatalf("Unable to create new Database instance - %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	t.Run("Query", func(t *testing.T) {
+		query := &proto.SQLQuery{Query: []byte(`SELECT 1;`)}
+		qMsg, err := query.MarshalVT()
+		if err != nil {
+			t.Fatalf("Unable to marshal query message")
+		}
+
+		r, err := db.QueryContext(ctx, qMsg)
+		if err == nil {
+			t.Fatalf("Expected error executing query with canceled context")
+		}
+
+		var rsp proto.SQLQueryResponse
+		err = rsp.UnmarshalVT(r)
+		if err != nil {
+			t.Fatalf("Unable to unmarshal response - %s", err)
+		}
+		if rsp.GetStatus().GetCode() != 500 {
+			t.Errorf("Unexpected status code - %d", rsp.GetStatus().GetCode())
+		}
+	})
+
+	t.Run("Exec", func(t *testing.T) {
+		exec := &proto.SQLExec{Query: []byte(`DELETE FROM example;`)}
+		eMsg, err := exec.MarshalVT()
+		if err != nil {
+			t.Fatalf("Unable to marshal exec message")
+		}
+
+		_, err = db.ExecContext(ctx, eMsg)
+		if err == nil {
+			t.Fatalf("Expected error executing exec with canceled context")
+		}
+	})
+}
+
+func TestSQLTransactions(t *testing.T) {
+	mockDB, err := sql.Open("mysql", "root:example@tcp(mysql:3306)/example")
+	if err != nil {
+		t.Fatalf("Unable to create DB for testing")
+	}
+	defer mockDB.Close()
+
+	db, err := New(Config{DB: mockDB})
+	if err != nil {
+		t.Fatalf("Unable to create new Database instance - %s", err)
+	}
+
+	// execute runs a statement through the JSON interface, optionally within a transaction
+	execute := func(ctx context.Context, q, handle string) (tarmac.SQLExecResponse, error) {
+		var rsp tarmac.SQLExecResponse
+		j := fmt.Sprintf(`{"query":"%s","transaction":"%s"}`, base64.StdEncoding.EncodeToString([]byte(q)), handle)
+		r, err := db.ExecContext(ctx, []byte(j))
+		if uErr := ffjson.Unmarshal(r, &rsp); uErr != nil {
+			t.Fatalf("Error parsing returned exec response - %s", uErr)
+		}
+		return rsp, err
+	}
+
+	// begin starts a transaction bound to ctx and returns the handle
+	begin := func(ctx context.Context) string {
+		r, err := db.BeginContext(ctx, []byte(""))
+		if err != nil {
+			t.Fatalf("Unable to begin transaction - %s", err)
+		}
+		var rsp tarmac.SQLBeginResponse
+		err = ffjson.Unmarshal(r, &rsp)
+		if err != nil || rsp.Transaction == "" {
+			t.Fatalf("Unexpected begin response - %s %+v", err, rsp)
+		}
+		return rsp.Transaction
+	}
+
+	// count returns the number of rows within the test table
+	count := func() int {
+		var n int
+		err := mockDB.QueryRow(`SELECT COUNT(*) FROM testtx;`).Scan(&n)
+		if err != nil {
+			t.Fatalf("Unable to count rows - %s", err)
+		}
+		return n
+	}
+
+	_, err = execute(context.Background(), `CREATE TABLE IF NOT EXISTS testtx ( id int NOT NULL, PRIMARY KEY (id) );`, "")
+	if err != nil {
+		t.Fatalf("Unable to create table - %s", err)
+	}
+	defer func() {
+		_, _ = execute(context.Background(), `DROP TABLE IF EXISTS testtx;`, "")
+	}()
+
+	t.Run("Commit", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tx := begin(ctx)
+		_, err := execute(ctx, `INSERT INTO testtx (id) VALUES (1);`, tx)
+		if err != nil {
+			t.Fatalf("Unable to insert within transaction - %s", err)
+		}
+
+		_, err = db.CommitContext(ctx, []byte(fmt.Sprintf(`{"transaction":"%s"}`, tx)))
+		if err != nil {
+			t.Fatalf("Unable to commit transaction - %s", err)
+		}
+		if n := count(); n != 1 {
+			t.Errorf("Unexpected row count after commit - %d", n)
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tx := begin(ctx)
+		_, err := execute(ctx, `INSERT INTO testtx (id) VALUES (2);`, tx)
+		if err != nil {
+			t.Fatalf("Unable to insert within transaction - %s", err)
+		}
+
+		_, err = db.RollbackContext(ctx, []byte(fmt.Sprintf(`{"transaction":"%s"}`, tx)))
+		if err != nil {
+			t.Fatalf("Unable to roll back transaction - %s", err)
+		}
+		if n := count(); n != 1 {
+			t.Errorf("Unexpected row count after rollback - %d", n)
+		}
+
+		_, err = db.CommitContext(ctx, []byte(fmt.Sprintf(`{"transaction":"%s"}`, tx)))
+		if err == nil {
+			t.Errorf("Unexpected success committing a rolled back transaction")
+		}
+	})
+
+	t.Run("Rollback on Cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		tx := begin(ctx)
+		_, err := execute(ctx, `INSERT INTO testtx (id) VALUES (3);`, tx)
+		if err != nil {
+			t.Fatalf("Unable to insert within transaction - %s", err)
+		}
+		cancel()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			db.Lock()
+			_, open := db.txs[tx]
+			db.Unlock()
+			if !open {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Timeout waiting for transaction to be rolled back")
+			}
+			<-time.After(10 * time.Millisecond)
+		}
+
+		if n := count(); n != 1 {
+			t.Errorf("Unexpected row count after cancellation - %d", n)
+		}
+	})
+
+	t.Run("Transaction from another Context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tx := begin(ctx)
+		rsp, err := execute(context.Background(), `INSERT INTO testtx (id) VALUES (4);`, tx)
+		if err == nil {
+			t.Fatalf("Unexpected success using a transaction from another context")
+		}
+		if rsp.Status.Code != 404 {
+			t.Errorf("Unexpected status code - %d", rsp.Status.Code)
+		}
+	})
+
+	t.Run("Unknown Transaction", func(t *testing.T) {
+		r, err := db.CommitContext(context.Background(), []byte(`{"transaction":"unknown"}`))
+		if err == nil {
+			t.Fatalf("Unexpected success committing unknown transaction")
+		}
+
+		var rsp tarmac.SQLTransactionResponse
+		err = ffjson.Unmarshal(r, &rsp)
+		if err != nil {
+			t.Fatalf("Error parsing returned response - %s", err)
+		}
+		if rsp.Status.Code != 404 {
+			t.Errorf("Unexpected status code - %d", rsp.Status.Code)
+		}
+	})
+}
+
+func TestTypedValue(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	tt := []struct {
+		name         string
+		value        any
+		databaseType string
+		expected     any
+	}{
+		{name: "Null", value: nil, databaseType: "INT", expected: nil},
+		{name: "Int", value: int64(42), databaseType: "INT", expected: int64(42)},
+		{name: "Time", value: ts, databaseType: "DATETIME", expected: ts},
+		{name: "Text Int", value: []byte("42"), databaseType: "BIGINT", expected: int64(42)},
+		{name: "Text Unsigned Int", value: []byte("42"), databaseType: "UNSIGNED INT", expected: int64(42)},
+		{name: "Text Float", value: []byte("1.5"), databaseType: "DOUBLE", expected: 1.5},
+		{name: "Text Bool", value: []byte("true"), databaseType: "BOOLEAN", expected: true},
+		{name: "Text String", value: []byte("John"), databaseType: "VARCHAR", expected: "John"},
+		{name: "Text Decimal", value: []byte("1.10"), databaseType: "DECIMAL", expected: "1.10"},
+		{name: "Text Unknown Type", value: []byte("John"), databaseType: "", expected: "John"},
+		{name: "Text Overflow", value: []byte("18446744073709551615"), databaseType: "UNSIGNED BIGINT",
+			expected: "18446744073709551615"},
+		{name: "Blob", value: []byte{0x00, 0xff}, databaseType: "BLOB", expected: []byte{0x00, 0xff}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			v := typedValue(tc.value, tc.databaseType)
+			if !reflect.DeepEqual(v, tc.expected) {
+				t.Errorf("Unexpected value - %#v", v)
+			}
+		})
+	}
+}
+
+func TestSQLPaging(t *testing.T) {
+	mockDB, err := sql.Open("mysql", "root:example@tcp(mysql:3306)/example")
+	if err != nil {
+		t.Fatalf("Unable to create DB for testing")
+	}
+	defer mockDB.Close()
+
+	db, err := New(Config{DB: mockDB})
+	if err != nil {
+		t.Fatalf("Unable to create new Database instance - %s", err)
+	}
+
+	_, err = mockDB.Exec(`CREATE TABLE IF NOT EXISTS testrows ( id int NOT NULL, name varchar(255), PRIMARY KEY (id) );`)
+	if err != nil {
+		t.Fatalf("Unable to create table - %s", err)
+	}
+	defer func() {
+		_, _ = mockDB.Exec(`DROP TABLE IF EXISTS testrows;`)
+	}()
+	for i := 1; i <= 5; i++ {
+		_, err = mockDB.Exec(`INSERT INTO testrows (id, name) VALUES (?, ?);`, i, fmt.Sprintf("name-%d", i))
+		if err != nil {
+			t.Fatalf("Unable to insert rows - %s", err)
+		}
+	}
+
+	q := base64.StdEncoding.EncodeToString([]byte(`SELECT id, name FROM testrows ORDER BY id;`))
+
+	t.Run("Proto Format", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var ids []any
+		var pages int
+		j := fmt.Sprintf(`{"query":"%s","max_rows":2,"format":"proto"}`, q)
+		for {
+			r, err := db.QueryContext(ctx, []byte(j))
+			if err != nil {
+				t.Fatalf("Unable to execute query - %s", err)
+			}
+
+			var rs envelope.SQLResultSet
+			err = rs.UnmarshalVT(r)
+			if err != nil {
+				t.Fatalf("Unable to unmarshal result set - %s", err)
+			}
+			pages++
+
+			if len(rs.Columns) != 2 || rs.Columns[0].Name != "id" || rs.Columns[1].Name != "name" {
+				t.Fatalf("Unexpected columns - %+v", rs.Columns)
+			}
+			if rs.Columns[0].DatabaseType == "" {
+				t.Errorf("Expected database type of column")
+			}
+
+			for _, row := range rs.Rows {
+				id, name := row.Values[0].Interface(), row.Values[1].Interface()
+				ids = append(ids, id)
+				if name != fmt.Sprintf("name-%d", id) {
+					t.Errorf("Unexpected row values - %#v, %#v", id, name)
+				}
+			}
+
+			if rs.Cursor == "" {
+				break
+			}
+			j = fmt.Sprintf(`{"cursor":"%s","max_rows":2,"format":"proto"}`, rs.Cursor)
+		}
+
+		if pages != 3 || !reflect.DeepEqual(ids, []any{int64(1), int64(2), int64(3), int64(4), int64(5)}) {
+			t.Errorf("Unexpected pages %d with ids %#v", pages, ids)
+		}
+	})
+
+	t.Run("JSON Format", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		r, err := db.QueryContext(ctx, []byte(fmt.Sprintf(`{"query":"%s","max_rows":4}`, q)))
+		if err != nil {
+			t.Fatalf("Unable to execute query - %s", err)
+		}
+
+		var rsp tarmac.SQLQueryResponse
+		err = ffjson.Unmarshal(r, &rsp)
+		if err != nil || rsp.Cursor == "" {
+			t.Fatalf("Unexpected query response - %s %+v", err, rsp)
+		}
+
+		r, err = db.QueryContext(ctx, []byte(fmt.Sprintf(`{"cursor":"%s","max_rows":4}`, rsp.Cursor)))
+		if err != nil {
+			t.Fatalf("Unable to read next page - %s", err)
+		}
+
+		var next tarmac.SQLQueryResponse
+		err = ffjson.Unmarshal(r, &next)
+		if err != nil || next.Cursor != "" {
+			t.Fatalf("Unexpected query response - %s %+v", err, next)
+		}
+
+		data, err := base64.StdEncoding.DecodeString(next.Data)
+		if err != nil {
+			t.Fatalf("Callback returned undecodable response - %s", err)
+		}
+
+		var records []map[string]any
+		err = ffjson.Unmarshal(data, &records)
+		if err != nil || len(records) != 1 {
+			t.Fatalf("Unexpected records - %s %+v", err, records)
+		}
+
+		// The cursor is released once all rows are read
+		_, err = db.QueryContext(ctx, []byte(fmt.Sprintf(`{"cursor":"%s"}`, rsp.Cursor)))
+		if err == nil {
+			t.Errorf("Unexpected success reading a completed cursor")
+		}
+	})
+
+	t.Run("Cursor Released on Cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		r, err := db.QueryContext(ctx, []byte(fmt.Sprintf(`{"query":"%s","max_rows":1}`, q)))
+		if err != nil {
+			t.Fatalf("Unable to execute query - %s", err)
+		}
+
+		var rsp tarmac.SQLQueryResponse
+		err = ffjson.Unmarshal(r, &rsp)
+		if err != nil || rsp.Cursor == "" {
+			t.Fatalf("Unexpected query response - %s %+v", err, rsp)
+		}
+
+		_, err = db.QueryContext(context.Background(), []byte(fmt.Sprintf(`{"cursor":"%s"}`, rsp.Cursor)))
+		if err == nil {
+			t.Errorf("Unexpected success reading cursor from another context")
+		}
+
+		cancel()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			db.Lock()
+			_, open := db.cursors[rsp.Cursor]
+			db.Unlock()
+			if !open {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Timeout waiting for cursor to be released")
+			}
+			<-time.After(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("Invalid Requests", func(t *testing.T) {
+		for name, j := range map[string]string{
+			"Negative Max Rows": fmt.Sprintf(`{"query":"%s","max_rows":-1}`, q),
+			"Unknown Format":    fmt.Sprintf(`{"query":"%s","format":"xml"}`, q),
+			"Unknown Cursor":    `{"cursor":"unknown"}`,
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, err := db.QueryContext(context.Background(), []byte(j))
+				if err == nil {
+					t.Errorf("Unexpected success with invalid request")
+				}
+			})
+		}
+	})
+}
+
+func TestSQLDataSources(t *testing.T) {
+	open := func(name string) *sql.DB {
+		d, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), name+".db"))
+		if err != nil {
+			t.Fatalf("Unable to create DB for testing - %s", err)
+		}
+		t.Cleanup(func() { d.Close() })
+
+		_, err = d.Exec(`CREATE TABLE source ( name varchar(255) );`)
+		if err != nil {
+			t.Fatalf("Unable to create table - %s", err)
+		}
+		_, err = d.Exec(`INSERT INTO source (name) VALUES (?);`, name)
+		if err != nil {
+			t.Fatalf("Unable to insert row - %s", err)
+		}
+		return d
+	}
+	defaultDB, orders := open("default"), open("orders")
+
+	// Requests made with a bound context default to the orders database
+	type bindingKey struct{}
+	db, err := New(Config{
+		DB:        defaultDB,
+		Databases: map[string]*sql.DB{"orders": orders},
+		DataSource: func(ctx context.Context) (string, error) {
+			name, _ := ctx.Value(bindingKey{}).(string)
+			if name == "denied" {
+				return "", errors.New("unknown caller")
+			}
+			return name, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unable to create new Database instance - %s", err)
+	}
+	bound := context.WithValue(context.Background(), bindingKey{}, "orders")
+	denied := context.WithValue(context.Background(), bindingKey{}, "denied")
+
+	// source queries the source table through the JSON interface and returns the name of the database
+	source := func(ctx context.Context, dataSource string) (string, error) {
+		j := fmt.Sprintf(`{"query":"%s","data_source":"%s"}`,
+			base64.StdEncoding.EncodeToString([]byte(`SELECT name FROM source;`)), dataSource)
+		r, err := db.QueryContext(ctx, []byte(j))
+		if err != nil {
+			return "", err
+		}
+
+		var rsp tarmac.SQLQueryResponse
+		err = ffjson.Unmarshal(r, &rsp)
+		if err != nil {
+			t.Fatalf("Error parsing returned query response - %s", err)
+		}
+		data, err := base64.StdEncoding.DecodeString(rsp.Data)
+		if err != nil {
+			t.Fatalf("Error decoding returned data - %s", err)
+		}
+		var rows []map[string]string
+		err = ffjson.Unmarshal(data, &rows)
+		if err != nil || len(rows) != 1 {
+			t.Fatalf("Unexpected rows returned - %s %s", data, err)
+		}
+		return rows[0]["name"], nil
+	}
+
+	tt := []struct {
+		name       string
+		ctx        context.Context
+		dataSource string
+		expected   string
+		err        bool
+	}{
+		{name: "Default Database", ctx: context.Background(), expected: "default"},
+		{name: "Named Data Source", ctx: context.Background(), dataSource: "orders", expected: "orders"},
+		{name: "Default Binding", ctx: bound, expected: "orders"},
+		{name: "Unknown Data Source", ctx: bound, dataSource: "missing", err: true},
+		{name: "Rejected Caller", ctx: denied, err: true},
+		{name: "Rejected Caller with Data Source", ctx: denied, dataSource: "orders", err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			name, err := source(tc.ctx, tc.dataSource)
+			if err != nil && !tc.err {
+				t.Fatalf("Unexpected error querying data source - %s", err)
+			}
+			if err == nil && tc.err {
+				t.Fatalf("Expected error querying data source, got %s", name)
+			}
+			if name != tc.expected {
+				t.Errorf("Unexpected database queried - got %s, expected %s", name, tc.expected)
+			}
+		})
+	}
+
+	t.Run("Proto Default Binding", func(t *testing.T) {
+		q := &proto.SQLExec{Query: []byte(`INSERT INTO source (name) VALUES ('proto');`)}
+		b, err := q.MarshalVT()
+		if err != nil {
+			t.Fatalf("Unable to marshal request - %s", err)
+		}
+
+		_, err = db.ExecContext(bound, b)
+		if err != nil {
+			t.Fatalf("Unexpected error executing statement - %s", err)
+		}
+
+		var n int
+		err = orders.QueryRow(`SELECT COUNT(*) FROM source WHERE name = 'proto';`).Scan(&n)
+		if err != nil || n != 1 {
+			t.Errorf("Unexpected rows within orders database - %d %s", n, err)
+		}
+	})
+
+	t.Run("Transaction Data Source", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		r, err := db.BeginContext(ctx, []byte(`{"data_source":"orders"}`))
+		if err != nil {
+			t.Fatalf("Unable to begin transaction - %s", err)
+		}
+		var rsp tarmac.SQLBeginResponse
+		err = ffjson.Unmarshal(r, &rsp)
+		if err != nil {
+			t.Fatalf("Error parsing returned begin response - %s", err)
+		}
+
+		j := fmt.Sprintf(`{"query":"%s","transaction":"%s"}`,
+			base64.StdEncoding.EncodeToString([]byte(`INSERT INTO source (name) VALUES ('tx');`)), rsp.Transaction)
+		_, err = db.ExecContext(ctx, []byte(j))
+		if err != nil {
+			t.Fatalf("Unexpected error executing statement - %s", err)
+		}
+
+		_, err = db.CommitContext(ctx, []byte(fmt.Sprintf(`{"transaction":"%s"}`, rsp.Transaction)))
+		if err != nil {
+			t.Fatalf("Unexpected error committing transaction - %s", err)
+		}
+
+		var n int
+		err = orders.QueryRow(`SELECT COUNT(*) FROM source WHERE name = 'tx';`).Scan(&n)
+		if err != nil || n != 1 {
+			t.Errorf("Unexpected rows within orders database - %d %s", n, err)
+		}
+
+		_, err = db.BeginContext(ctx, []byte(`{"data_source":"missing"}`))
+		if err == nil {
+			t.Errorf("Expected error beginning transaction on unknown data source")
+		}
+	})
+
+	t.Run("No Default Database", func(t *testing.T) {
+		db, err := New(Config{Databases: map[string]*sql.DB{"orders": orders}})
+		if err != nil {
+			t.Fatalf("Unable to create new Database instance - %s", err)
+		}
+
+		q := &proto.SQLQuery{Query: []byte(`SELECT name FROM source;`)}
+		b, err := q.MarshalVT()
+		if err != nil {
+			t.Fatalf("Unable to marshal request - %s", err)
+		}
+
+		_, err = db.QueryContext(context.Background(), b)
+		if err == nil {
+			t.Errorf("Expected error querying without a default database")
+		}
+	})
+}
+
+func TestSQLProtoRequests(t *testing.T) {
+	open := func(name string) *sql.DB {
+		d, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), name+".db"))
+		if err != nil {
+			t.Fatalf("Unable to create DB for testing - %s", err)
+		}
+		t.Cleanup(func() { d.Close() })
+
+		_, err = d.Exec(`CREATE TABLE users ( id int NOT NULL, name varchar(255), PRIMARY KEY (id) );`)
+		if err != nil {
+			t.Fatalf("Unable to create table - %s", err)
+		}
+		return d
+	}
+	defaultDB, orders := open("default"), open("orders")
+
+	db, err := New(Config{DB: defaultDB, Databases: map[string]*sql.DB{"orders": orders}})
+	if err != nil {
+		t.Fatalf("Unable to create new Database instance - %s", err)
+	}
+
+	// param returns a bind parameter holding v
+	param := func(name string, v any) *envelope.SQLParam {
+		value, err := envelope.NewSQLValue(v)
+		if err != nil {
+			t.Fatalf("Unable to create parameter value - %s", err)
+		}
+		return &envelope.SQLParam{Name: name, Value: value}
+	}
+
+	// exec runs a statement through the proto interface
+	exec := func(ctx context.Context, msg *envelope.SQLExec) (*proto.SQLExecResponse, error) {
+		b, err := msg.MarshalVT()
+		if err != nil {
+			t.Fatalf("Unable to marshal request - %s", err)
+		}
+		r, err := db.ExecContext(ctx, b)
+		rsp := &proto.SQLExecResponse{}
+		if uErr := rsp.UnmarshalVT(r); uErr != nil {
+			t.Fatalf("Error parsing returned exec response - %s", uErr)
+		}
+		return rsp, err
+	}
+
+	// query runs a query through the proto interface, returning the names of the rows
+	query := func(ctx context.Context, msg *envelope.SQLQuery) ([]string, error) {
+		b, err := msg.MarshalVT()
+		if err != nil {
+			t.Fatalf("Unable to marshal request - %s", err)
+		}
+		r, err := db.QueryContext(ctx, b)
+		if err != nil {
+			return nil, err
+		}
+
+		rsp := &envelope.SQLQueryResponse{}
+		err = rsp.UnmarshalVT(r)
+		if err != nil {
+			t.Fatalf("Error parsing returned query response - %s", err)
+		}
+		var rows []map[string]string
+		err = ffjson.Unmarshal(rsp.GetData(), &rows)
+		if err != nil {
+			t.Fatalf("Unexpected rows returned - %s %s", rsp.GetData(), err)
+		}
+		names := make([]string, 0, len(rows))
+		for _, row := range rows {
+			names = append(names, row["name"])
+		}
+		return names, nil
+	}
+
+	t.Run("Parameterized Exec", func(t *testing.T) {
+		rsp, err := exec(context.Background(), &envelope.SQLExec{
+			Query:  []byte(`INSERT INTO users (id, name) VALUES (?, ?);`),
+			Params: []*envelope.SQLParam{param("", int64(1)), param("", `Jane "Smith"); DROP TABLE users; --`)},
+		})
+		if err != nil || rsp.GetRowsAffected() != 1 {
+			t.Fatalf("Unexpected exec response - %s %+v", err, rsp)
+		}
+	})
+
+	t.Run("Parameterized Query", func(t *testing.T) {
+		names, err := query(context.Background(), &envelope.SQLQuery{
+			Query:  []byte(`SELECT name FROM users WHERE id = :id;`),
+			Params: []*envelope.SQLParam{param("id", int64(1))},
+		})
+		if err != nil {
+			t.Fatalf("Unable to execute parameterized query - %s", err)
+		}
+		if len(names) != 1 || names[0] != `Jane "Smith"); DROP TABLE users; --` {
+			t.Fatalf("Unexpected value from Database got %+v", names)
+		}
+	})
+
+	t.Run("Data Source", func(t *testing.T) {
+		_, err := exec(context.Background(), &envelope.SQLExec{
+			Query:      []byte(`INSERT INTO users (id, name) VALUES (?, ?);`),
+			Params:     []*envelope.SQLParam{param("", int64(1)), param("", "orders")},
+			DataSource: "orders",
+		})
+		if err != nil {
+			t.Fatalf("Unable to execute statement - %s", err)
+		}
+
+		names, err := query(context.Background(), &envelope.SQLQuery{
+			Query:      []byte(`SELECT name FROM users;`),
+			DataSource: "orders",
+		})
+		if err != nil || len(names) != 1 || names[0] != "orders" {
+			t.Fatalf("Unexpected rows from orders database - %s %+v", err, names)
+		}
+	})
+
+	t.Run("Transaction", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		r, err := db.BeginContext(ctx, []byte(""))
+		if err != nil {
+			t.Fatalf("Unable to begin transaction - %s", err)
+		}
+		var tx tarmac.SQLBeginResponse
+		err = ffjson.Unmarshal(r, &tx)
+		if err != nil {
+			t.Fatalf("Error parsing returned begin response - %s", err)
+		}
+
+		_, err = exec(ctx, &envelope.SQLExec{
+			Query:       []byte(`INSERT INTO users (id, name) VALUES (?, ?);`),
+			Params:      []*envelope.SQLParam{param("", int64(2)), param("", "tx")},
+			Transaction: tx.Transaction,
+		})
+		if err != nil {
+			t.Fatalf("Unable to insert within transaction - %s", err)
+		}
+
+		// The uncommitted row is only visible within the transaction
+		q := &envelope.SQLQuery{Query: []byte(`SELECT name FROM users WHERE id = 2;`), Transaction: tx.Transaction}
+		names, err := query(ctx, q)
+		if err != nil || len(names) != 1 || names[0] != "tx" {
+			t.Fatalf("Unexpected rows within transaction - %s %+v", err, names)
+		}
+
+		_, err = db.CommitContext(ctx, []byte(fmt.Sprintf(`{"transaction":"%s"}`, tx.Transaction)))
+		if err != nil {
+			t.Fatalf("Unable to commit transaction - %s", err)
+		}
+
+		var n int
+		err = defaultDB.QueryRow(`SELECT COUNT(*) FROM users WHERE name = 'tx';`).Scan(&n)
+		if err != nil || n != 1 {
+			t.Errorf("Unexpected rows after commit - %d %s", n, err)
+		}
+
+		_, err = query(ctx, q)
+		if err == nil {
+			t.Errorf("Unexpected success querying within a committed transaction")
+		}
+	})
+
+	t.Run("Proto Format with Paging", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var ids []any
+		msg := &envelope.SQLQuery{Query: []byte(`SELECT id, name FROM users ORDER BY id;`), MaxRows: 1, Format: "proto"}
+		for range 3 {
+			b, err := msg.MarshalVT()
+			if err != nil {
+				t.Fatalf("Unable to marshal request - %s", err)
+			}
+			r, err := db.QueryContext(ctx, b)
+			if err != nil {
+				t.Fatalf("Unable to execute query - %s", err)
+			}
+
+			var rs envelope.SQLResultSet
+			err = rs.UnmarshalVT(r)
+			if err != nil {
+				t.Fatalf("Error parsing returned result set - %s", err)
+			}
+			for _, row := range rs.GetRows() {
+				ids = append(ids, row.GetValues()[0].Interface())
+			}
+			if rs.GetCursor() == "" {
+				break
+			}
+			msg = &envelope.SQLQuery{Cursor: rs.GetCursor(), MaxRows: 1, Format: "proto"}
+		}
+
+		if !reflect.DeepEqual(ids, []any{int64(1), int64(2)}) {
+			t.Errorf("Unexpected ids returned - %+v", ids)
+		}
+	})
+
+	t.Run("Invalid Requests", func(t *testing.T) {
+		for name, msg := range map[string]*envelope.SQLQuery{
+			"Unknown Format":      {Query: []byte(`SELECT 1;`), Format: "xml"},
+			"Negative Max Rows":   {Query: []byte(`SELECT 1;`), MaxRows: -1},
+			"Unknown Transaction": {Query: []byte(`SELECT 1;`), Transaction: "missing"},
+			"Unknown Cursor":      {Cursor: "missing"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, err := query(context.Background(), msg)
+				if err == nil {
+					t.Errorf("Unexpected success with invalid request")
+				}
+			})
+		}
+	})
+}
+
+func TestStatementClassification(t *testing.T) {
+	tt := []struct {
+		name    string
+		query   string
+		classes []string
+	}{
+		{name: "Select", query: "SELECT * FROM users;", classes: []string{StatementSelect}},
+		{name: "Lowercase", query: "select * from users", classes: []string{StatementSelect}},
+		{name: "Parenthesized", query: "(SELECT 1) UNION (SELECT 2)", classes: []string{StatementSelect}},
+		{name: "Show", query: "SHOW TABLES", classes: []string{StatementSelect}},
+		{name: "Insert", query: "INSERT INTO users (name) VALUES ('drop')", classes: []string{StatementDML}},
+		{name: "Update", query: "UPDATE users SET name = ?", classes: []string{StatementDML}},
+		{name: "Drop", query: "DROP TABLE users", classes: []string{StatementDDL}},
+		{name: "Create", query: "  create table users (id int)", classes: []string{StatementDDL}},
+		{name: "Grant", query: "GRANT ALL ON users TO bob", classes: []string{StatementDDL}},
+		{name: "Pragma", query: "PRAGMA journal_mode=DELETE", classes: []string{StatementOther}},
+		{name: "Select Into", query: "SELECT * INTO backup FROM users", classes: []string{StatementDML}},
+		{name: "Select For Update", query: "SELECT * FROM users FOR UPDATE", classes: []string{StatementDML}},
+		{
+			name:    "Data Modifying CTE",
+			query:   "WITH d AS (DELETE FROM users RETURNING *) SELECT * FROM d",
+			classes: []string{StatementDML},
+		},
+		{name: "Explain Create", query: "EXPLAIN ANALYZE CREATE TABLE t AS SELECT 1", classes: []string{StatementDDL}},
+		{
+			name:    "Multiple Statements",
+			query:   "SELECT 1; DROP TABLE users;",
+			classes: []string{StatementSelect, StatementDDL},
+		},
+		{name: "Keywords in Strings", query: `SELECT 'DROP TABLE users', "delete" FROM t`, classes: []string{StatementSelect}},
+		{name: "Keywords in Comments", query: "SELECT 1 -- DROP TABLE users\n/* ; DELETE */", classes: []string{StatementSelect}},
+		{
+			name:    "Doubled Quotes",
+			query:   "SELECT 'it''s; DROP TABLE users'",
+			classes: []string{StatementSelect},
+		},
+		{
+			name:    "Backslash Escaped Quote",
+			query:   `SELECT 'a\'; DROP TABLE users; --'`,
+			classes: []string{StatementSelect, StatementDDL},
+		},
+		{
+			name:    "Backslash Before Doubled Quote",
+			query:   `SELECT 'a\'', 'b'; DROP TABLE users; -- '`,
+			classes: []string{StatementSelect, StatementDDL},
+		},
+		{
+			name:    "Escape String",
+			query:   `SELECT E'\'', 'a\'; DROP TABLE users; --'`,
+			classes: []string{StatementSelect, StatementDDL},
+		},
+		{name: "Hash Operator", query: "SELECT 1 # 2; DROP TABLE users", classes: []string{StatementSelect, StatementDDL}},
+		{
+			name:    "Double Dash Without Space",
+			query:   "SELECT 1 --1; DROP TABLE users",
+			classes: []string{StatementSelect, StatementDDL},
+		},
+		{
+			name:    "Executable Comment",
+			query:   "SELECT 1 /*! ; DROP TABLE users */",
+			classes: []string{StatementSelect, StatementDDL},
+		},
+		{name: "Unterminated Comment", query: "SELECT 1 /* DROP", classes: []string{StatementSelect}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			found := make(map[string]bool)
+			for _, d := range []dialect{dialectStandard, dialectMySQL} {
+				for _, words := range statements(tc.query, d) {
+					found[classify(words)] = true
+				}
+			}
+
+			for _, c := range tc.classes {
+				if !found[c] {
+					t.Errorf("Expected %s statement within %q - found %v", c, tc.query, found)
+				}
+				delete(found, c)
+			}
+			if len(found) > 0 {
+				t.Errorf("Unexpected statements within %q - %v", tc.query, found)
+			}
+		})
+	}
+}
+
+func TestSQLPolicy(t *testing.T) {
+	d, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "policy.db"))
+	if err != nil {
+		t.Fatalf("Unable to create DB for testing - %s", err)
+	}
+	defer d.Close()
+
+	_, err = d.Exec(`CREATE TABLE users ( name varchar(255) );`)
+	if err != nil {
+		t.Fatalf("Unable to create table - %s", err)
+	}
+
+	// Requests made with a context carrying a Policy are restricted by it
+	type policyKey struct{}
+	db, err := New(Config{
+		DB: d,
+		Policy: func(ctx context.Context) Policy {
+			p, _ := ctx.Value(policyKey{}).(Policy)
+			return p
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unable to create new Database instance - %s", err)
+	}
+
+	readOnly := context.WithValue(context.Background(), policyKey{}, Policy{ReadOnly: true})
+	noDDL := context.WithValue(
+		context.Background(),
+		policyKey{},
+		Policy{Statements: []string{StatementSelect, StatementDML}},
+	)
+
+	query := func(q string) []byte {
+		return []byte(fmt.Sprintf(`{"query":"%s"}`, base64.StdEncoding.EncodeToString([]byte(q))))
+	}
+
+	tt := []struct {
+		name   string
+		ctx    context.Context
+		call   func(context.Context, []byte) ([]byte, error)
+		query  string
+		status int
+	}{
+		{name: "Unrestricted Exec", ctx: context.Background(), call: db.ExecContext,
+			query: "INSERT INTO users (name) VALUES ('a');", status: 200},
+		{name: "Read Only Query", ctx: readOnly, call: db.QueryContext, query: "SELECT * FROM users;", status: 200},
+		{name: "Read Only Exec", ctx: readOnly, call: db.ExecContext,
+			query: "INSERT INTO users (name) VALUES ('b');", status: 403},
+		{name: "Read Only Drop", ctx: readOnly, call: db.QueryContext,
+			query: "SELECT 1; DROP TABLE users;", status: 403},
+		{name: "No DDL Exec", ctx: noDDL, call: db.ExecContext,
+			query: "UPDATE users SET name = 'c';", status: 200},
+		{name: "No DDL Drop", ctx: noDDL, call: db.ExecContext, query: "DROP TABLE users;", status: 403},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := tc.call(tc.ctx, query(tc.query))
+			if (err != nil) != (tc.status != 200) {
+				t.Fatalf("Unexpected error result - %v", err)
+			}
+
+			var rsp tarmac.SQLExecResponse
+			err = ffjson.Unmarshal(r, &rsp)
+			if err != nil {
+				t.Fatalf("Error parsing returned response - %s", err)
+			}
+			if rsp.Status.Code != tc.status {
+				t.Errorf("Unexpected status - got %d, expected %d - %s", rsp.Status.Code, tc.status, rsp.Status.Status)
+			}
+		})
+	}
+
+	t.Run("Proto Read Only Exec", func(t *testing.T) {
+		msg := &proto.SQLExec{Query: []byte("DELETE FROM users;")}
+		b, err := msg.MarshalVT()
+		if err != nil {
+			t.Fatalf("Unable to marshal request - %s", err)
+		}
+
+		r, err := db.ExecContext(readOnly, b)
+		if err == nil {
+			t.Fatalf("Expected error executing statement with read only policy")
+		}
+
+		var rsp proto.SQLExecResponse
+		err = rsp.UnmarshalVT(r)
+		if err != nil {
+			t.Fatalf("Unable to unmarshal response - %s", err)
+		}
+		if rsp.GetStatus().GetCode() != 403 {
+			t.Errorf("Unexpected status - %d", rsp.GetStatus().GetCode())
+		}
+	})
+
+	t.Run("Read Only Transaction", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(readOnly)
+		defer cancel()
+
+		r, err := db.BeginContext(ctx, []byte(""))
+		if err != nil {
+			t.Fatalf("Unexpected error beginning transaction - %s", err)
+		}
+
+		var rsp tarmac.SQLBeginResponse
+		err = ffjson.Unmarshal(r, &rsp)
+		if err != nil {
+			t.Fatalf("Error parsing returned response - %s", err)
+		}
+
+		j := fmt.Sprintf(`{"query":"%s","transaction":"%s"}`,
+			base64.StdEncoding.EncodeToString([]byte("SELECT * FROM users;")), rsp.Transaction)
+		_, err = db.QueryContext(ctx, []byte(j))
+		if err != nil {
+			t.Errorf("Unexpected error querying within read only transaction - %s", err)
+		}
+	})
+
+	var count int
+	err = d.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	if err != nil {
+		t.Fatalf("Unexpected error counting users - %s", err)
+	}
+	if count != 1 {
+		t.Errorf("Unexpected number of users - got %d, expected 1", count)
+	}
+}
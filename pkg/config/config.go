@@ -8,7 +8,11 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
 )
 
 // Config is a struct that represents the parsed configuration file. It contains a map of Tarmac Services, where each
@@ -16,8 +20,14 @@ import (
 type Config struct {
 	sync.RWMutex
 
-	// routes is an internal mapping of routes and functions.
-	routes map[string]string
+	// routes is an internal mapping of routes and their configuration.
+	routes map[string]Route
+
+	// functions is an internal mapping of function names and their configuration.
+	functions map[string]Function
+
+	// functionServices is an internal mapping of function names to the name of the service providing them.
+	functionServices map[string]string
 
 	// Services maps the names of Tarmac services to their configurations, which include the set of functions they provide
 	// and the routes by which they can be invoked.
@@ -43,6 +53,54 @@ type Function struct {
 
 	// PoolSize defines the number of instances of the function to create
 	PoolSize int `json:"pool_size"`
+
+	// Timeout defines the maximum duration in seconds of a single function execution. When the timeout is reached, the
+	// execution is stopped. A route Timeout takes precedence over the function Timeout. The default value is 0 which
+	// means the global default is used.
+	Timeout int `json:"timeout,omitempty"`
+
+	// MaxMemoryPages limits the linear memory of each function instance to the number of 64KiB pages. Instances
+	// failing after reaching the limit are replaced. The default value is 0 which means the runtime limit of 65536
+	// pages (4GiB) is used.
+	MaxMemoryPages uint32 `json:"max_memory_pages,omitempty"`
+
+	// Capabilities defines the host callbacks the function is permitted to call, formatted as namespace:operation
+	// (i.e. kvstore:get, sql:query, or function:other-function). A wildcard operation grants every operation within
+	// the namespace (i.e. logger:*). When undefined, the function is permitted to call every host callback; an empty
+	// list permits none.
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// DataSources binds the function to named SQL databases and KV stores, used by host callbacks that do not specify
+	// a data source. When undefined, the default SQL database and KV store are used.
+	DataSources DataSources `json:"data_sources,omitempty"`
+
+	// SQLPolicy restricts the SQL statements the function may execute. When undefined, every statement is permitted.
+	SQLPolicy SQLPolicy `json:"sql_policy,omitempty"`
+
+	// KVNamespace isolates the keys the function stores within KV stores (Options: service, function, shared). Keys
+	// of the service namespace are shared by the functions of the service, keys of the function namespace are private
+	// to the function, and keys of the shared namespace are shared by every function opting in. When undefined, the
+	// service namespace is used if enable_kv_namespaces is set, otherwise keys are stored unprefixed.
+	KVNamespace string `json:"kv_namespace,omitempty"`
+}
+
+// SQLPolicy defines the SQL statements a function may execute.
+type SQLPolicy struct {
+	// ReadOnly restricts the function to select statements, executed within read-only transactions.
+	ReadOnly bool `json:"read_only,omitempty"`
+
+	// Statements are the statement classes the function may execute (Options: select, dml, ddl, other). When
+	// undefined, every statement class is permitted.
+	Statements []string `json:"statements,omitempty"`
+}
+
+// DataSources defines the named data sources a function uses by default.
+type DataSources struct {
+	// SQL is the name of the SQL database, from the sql_databases server configuration.
+	SQL string `json:"sql,omitempty"`
+
+	// KVStore is the name of the KV store, from the kvstores server configuration.
+	KVStore string `json:"kvstore,omitempty"`
 }
 
 // Route defines available routes for the service.
@@ -54,14 +112,28 @@ type Route struct {
 	// - function - Function to Function calls
 	// - scheduled_task - Scheduled function calls
 	// - init - Initialization functions
+	// - nats - NATS subject subscriptions
 	Type string `json:"type"`
 
 	// Path defines the path for HTTP types.
+	//
+	// Paths may include named parameters (i.e. /users/:id), which match a single path segment, and a trailing
+	// catch-all parameter (i.e. /files/*filepath), which matches the remainder of the path. Captured values are
+	// passed to the function within the HTTP request envelope, so routes using parameters must define an Envelope.
 	Path string `json:"path,omitempty"`
 
-	// Topic defines the topic or channel to listen to for message queue based routes.
+	// Topic defines the topic or channel to listen to for message queue based routes. For nats routes, Topic is the
+	// NATS subject to subscribe to and may include wildcards (i.e. orders.*).
 	Topic string `json:"topic,omitempty"`
 
+	// Queue defines the queue group for nats routes. When multiple Tarmac instances subscribe with the same queue
+	// group, each message is delivered to only one of them.
+	Queue string `json:"queue,omitempty"`
+
+	// JetStream configures nats routes to consume messages from a JetStream stream rather than a core NATS
+	// subscription. JetStream messages are acknowledged when the function succeeds and redelivered when it fails.
+	JetStream *JetStream `json:"jetstream,omitempty"`
+
 	// Methods defines the HTTP methods to accept for the defined route.
 	Methods []string `json:"methods,omitempty"`
 
@@ -71,17 +143,77 @@ type Route struct {
 	// Frequency is used for both scheduled_task and init routes, with the value being the interval in seconds.
 	//
 	// When defined as an scheduled_task route, frequency is the interval at which tasks are executed.
-	// If no frequency is defined, an error will occur.
+	// Each scheduled_task route must define exactly one of Frequency, Cron, or At.
 	//
 	// When defined as an init route, frequency is used to define the interval in seconds between retries.
 	// As the number of retries increases, the interval will exponentially increase.
 	// If no frequency is defined, the default value is 1 second.
 	Frequency int `json:"frequency,omitempty"`
 
+	// Cron defines the schedule of scheduled_task routes as a standard five field cron expression (i.e. 0 2 * * *) or
+	// a descriptor such as @daily or @hourly.
+	Cron string `json:"cron,omitempty"`
+
+	// TimeZone is the IANA time zone (i.e. America/New_York) used to evaluate the Cron expression and At timestamps
+	// without an offset. The default value is UTC.
+	TimeZone string `json:"time_zone,omitempty"`
+
+	// At defines a one-shot scheduled_task route executed once at the specified time. The value is an RFC 3339
+	// timestamp (i.e. 2025-01-02T15:04:05Z), or a timestamp without an offset (i.e. 2025-01-02T15:04:05) evaluated
+	// within TimeZone.
+	At string `json:"at,omitempty"`
+
+	// RunOnStart is used by scheduled_task routes to execute the function once at startup in addition to the
+	// defined schedule.
+	RunOnStart bool `json:"run_on_start,omitempty"`
+
+	// Singleton is used by scheduled_task routes to execute the function on only one Tarmac instance across the
+	// cluster. Instances elect a leader using a lease stored within the configured kvstore, which must be enabled.
+	Singleton bool `json:"singleton,omitempty"`
+
+	// LeaseTTL is the duration in seconds of the leadership lease for singleton scheduled_task routes. If the leader
+	// fails to renew the lease within the LeaseTTL, another instance takes over. The default value is 15 seconds.
+	LeaseTTL int `json:"lease_ttl,omitempty"`
+
 	// Retries is used to define the number of retries for init routes.
 	// If the init route fails, it will be retried for the number of times defined with a exponential backoff.
 	// The default value is 0 which means no retries.
 	Retries int `json:"retries,omitempty"`
+
+	// Envelope defines how HTTP requests are passed to the function and how the function response is returned.
+	//
+	// Valid options are:
+	// - "" - The raw HTTP body is passed to the function, and the function output is returned with a 200 (default)
+	// - proto - A protobuf HTTPRequest is passed to the function, which returns a protobuf HTTPResponse
+	// - json - A JSON HTTPRequest is passed to the function, which returns a JSON HTTPResponse
+	Envelope string `json:"envelope,omitempty"`
+
+	// Timeout defines the maximum duration in seconds of function executions triggered by this route. The function
+	// Timeout still applies when it is shorter. Timeouts are supported for http, scheduled_task, init, and nats routes.
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// JetStream defines the JetStream consumer used by nats routes.
+type JetStream struct {
+	// Stream is the name of the existing JetStream stream to consume messages from.
+	Stream string `json:"stream"`
+
+	// Durable is the name of the durable consumer. Tarmac instances sharing a durable consumer share the delivery of
+	// messages. The default value is the route Function name.
+	Durable string `json:"durable,omitempty"`
+
+	// AckWait is the duration in seconds JetStream waits for an acknowledgement before redelivering a message. The
+	// AckWait should be longer than the function timeout. The default value is 0 which means the JetStream default is
+	// used.
+	AckWait int `json:"ack_wait,omitempty"`
+
+	// MaxDeliver is the maximum number of times a message is delivered before JetStream stops redelivering it. The
+	// default value is 0 which means messages are redelivered until acknowledged.
+	MaxDeliver int `json:"max_deliver,omitempty"`
+
+	// NakDelay is the delay in seconds before a message is redelivered after a function fails. The default value is
+	// 0 which means failed messages are redelivered immediately.
+	NakDelay int `json:"nak_delay,omitempty"`
 }
 
 var (
@@ -89,6 +221,9 @@ var (
 	// service's route configuration.
 	ErrRouteNotFound = errors.New("route not found")
 
+	// ErrFunctionNotFound is returned when a requested function is not found in any service's configuration.
+	ErrFunctionNotFound = errors.New("function not found")
+
 	// ErrInvalidConfig is returned when the configuration file does not contain the required fields or is otherwise
 	// invalid.
 	ErrInvalidConfig = errors.New("invalid configuration file")
@@ -100,6 +235,12 @@ const (
 
 	// DefaultFrequency is the default frequency for init routes.
 	DefaultFrequency = 1
+
+	// DefaultLeaseTTL is the default leadership lease duration in seconds for singleton scheduled_task routes.
+	DefaultLeaseTTL = 15
+
+	// MaxMemoryPages is the maximum number of 64KiB memory pages a function can be limited to.
+	MaxMemoryPages = 65536
 )
 
 // Parse function reads the file specified and attempts to parse the contents into a Config instance.
@@ -125,14 +266,20 @@ func Parse(filepath string) (*Config, error) {
 		return &Config{}, ErrInvalidConfig
 	}
 
-	// Populate the internal routes map
-	cfg.routes = make(map[string]string)
-	for _, svcCfg := range cfg.Services {
+	// Populate the internal routes and functions maps
+	cfg.routes = make(map[string]Route)
+	cfg.functions = make(map[string]Function)
+	cfg.functionServices = make(map[string]string)
+	for svcName, svcCfg := range cfg.Services {
+		for fName, f := range svcCfg.Functions {
+			cfg.functions[fName] = f
+			cfg.functionServices[fName] = svcName
+		}
 		for _, r := range svcCfg.Routes {
 			if r.Type == "http" {
 				for _, m := range r.Methods {
 					key := fmt.Sprintf("%s:%s:%s", r.Type, m, r.Path)
-					cfg.routes[key] = r.Function
+					cfg.routes[key] = r
 				}
 			}
 		}
@@ -154,8 +301,16 @@ func (cfg *Config) Validate() error {
 			return fmt.Errorf("service missing name: %w", ErrInvalidConfig)
 		}
 
+		// Service and function names form KV namespace prefixes, so they cannot contain the prefix separator
+		if strings.Contains(sk, "/") || strings.Contains(svcCfg.Name, "/") {
+			return fmt.Errorf("service %s name contains '/': %w", sk, ErrInvalidConfig)
+		}
+
 		// Validate functions
 		for fk, f := range svcCfg.Functions {
+			if strings.Contains(fk, "/") {
+				return fmt.Errorf("function %s name contains '/': %w", fk, ErrInvalidConfig)
+			}
 			if f.Filepath == "" {
 				return fmt.Errorf("function missing filepath: %w", ErrInvalidConfig)
 			}
@@ -163,6 +318,30 @@ func (cfg *Config) Validate() error {
 				f.PoolSize = DefaultPoolSize
 				cfg.Services[sk].Functions[fk] = f
 			}
+			if f.Timeout < 0 {
+				return fmt.Errorf("function has negative timeout: %w", ErrInvalidConfig)
+			}
+			if f.MaxMemoryPages > MaxMemoryPages {
+				return fmt.Errorf("function has max_memory_pages greater than %d: %w", MaxMemoryPages, ErrInvalidConfig)
+			}
+			for _, c := range f.Capabilities {
+				namespace, op, ok := strings.Cut(c, ":")
+				if !ok || namespace == "" || op == "" {
+					return fmt.Errorf("function %s has invalid capability %s: %w", fk, c, ErrInvalidConfig)
+				}
+			}
+			switch f.KVNamespace {
+			case "", "service", "function", "shared":
+			default:
+				return fmt.Errorf("function %s has unknown kv_namespace %s: %w", fk, f.KVNamespace, ErrInvalidConfig)
+			}
+			for _, st := range f.SQLPolicy.Statements {
+				switch st {
+				case "select", "dml", "ddl", "other":
+				default:
+					return fmt.Errorf("function %s has unknown sql statement class %s: %w", fk, st, ErrInvalidConfig)
+				}
+			}
 		}
 
 		// Validate routes
@@ -170,6 +349,12 @@ func (cfg *Config) Validate() error {
 			if r.Type == "" || r.Function == "" {
 				return fmt.Errorf("route missing type or function: %w", ErrInvalidConfig)
 			}
+			if r.Timeout < 0 {
+				return fmt.Errorf("route has negative timeout: %w", ErrInvalidConfig)
+			}
+			if r.Singleton && r.Type != "scheduled_task" {
+				return fmt.Errorf("singleton is only supported by scheduled_task routes: %w", ErrInvalidConfig)
+			}
 
 			// Validate the route type
 			switch r.Type {
@@ -177,14 +362,64 @@ func (cfg *Config) Validate() error {
 				if r.Path == "" || len(r.Methods) == 0 {
 					return fmt.Errorf("http route missing path or methods: %w", ErrInvalidConfig)
 				}
+				if r.Envelope != "" && r.Envelope != "proto" && r.Envelope != "json" {
+					return fmt.Errorf("http route has unknown envelope %s: %w", r.Envelope, ErrInvalidConfig)
+				}
+				if r.HasParams() && r.Envelope == "" {
+					return fmt.Errorf("http route %s has path parameters but no envelope: %w", r.Path, ErrInvalidConfig)
+				}
 			case "scheduled_task":
-				if r.Frequency == 0 {
-					return fmt.Errorf("scheduled_task route missing frequency: %w", ErrInvalidConfig)
+				var schedules int
+				for _, defined := range []bool{r.Frequency != 0, r.Cron != "", r.At != ""} {
+					if defined {
+						schedules++
+					}
+				}
+				if schedules != 1 {
+					return fmt.Errorf("scheduled_task route must define one of frequency, cron, or at: %w",
+						ErrInvalidConfig)
+				}
+				if r.Frequency < 0 {
+					return fmt.Errorf("scheduled_task route has negative frequency: %w", ErrInvalidConfig)
+				}
+				if r.LeaseTTL < 0 {
+					return fmt.Errorf("scheduled_task route has negative lease_ttl: %w", ErrInvalidConfig)
+				}
+				if r.Singleton && r.LeaseTTL == 0 {
+					cfg.Services[sk].Routes[rk].LeaseTTL = DefaultLeaseTTL
+				}
+				if _, err := r.Location(); err != nil {
+					return fmt.Errorf("scheduled_task route has invalid time_zone %s: %w", r.TimeZone, ErrInvalidConfig)
+				}
+				if r.Cron != "" {
+					if _, err := r.Schedule(); err != nil {
+						return fmt.Errorf("scheduled_task route has invalid cron %s: %w", r.Cron, ErrInvalidConfig)
+					}
+				}
+				if r.At != "" {
+					if _, err := r.StartAt(); err != nil {
+						return fmt.Errorf("scheduled_task route has invalid at %s: %w", r.At, ErrInvalidConfig)
+					}
 				}
 			case "init":
 				if r.Frequency == 0 {
 					cfg.Services[sk].Routes[rk].Frequency = DefaultFrequency
 				}
+			case "nats":
+				if r.Topic == "" {
+					return fmt.Errorf("nats route missing topic: %w", ErrInvalidConfig)
+				}
+				if r.JetStream != nil {
+					if r.JetStream.Stream == "" {
+						return fmt.Errorf("nats route %s missing jetstream stream: %w", r.Topic, ErrInvalidConfig)
+					}
+					if r.Queue != "" {
+						return fmt.Errorf("nats route %s cannot use both queue and jetstream: %w", r.Topic, ErrInvalidConfig)
+					}
+					if r.JetStream.AckWait < 0 || r.JetStream.MaxDeliver < 0 || r.JetStream.NakDelay < 0 {
+						return fmt.Errorf("nats route %s has negative jetstream options: %w", r.Topic, ErrInvalidConfig)
+					}
+				}
 			}
 		}
 	}
@@ -201,5 +436,95 @@ func (cfg *Config) RouteLookup(key string) (string, error) {
 	if !ok {
 		return "", ErrRouteNotFound
 	}
+	return v.Function, nil
+}
+
+// LookupRoute searches the routes map for a given key and returns the full Route configuration if the key is found,
+// or an empty Route and an error if it is not found.
+func (cfg *Config) LookupRoute(key string) (Route, error) {
+	cfg.RLock()
+	defer cfg.RUnlock()
+	v, ok := cfg.routes[key]
+	if !ok {
+		return Route{}, ErrRouteNotFound
+	}
+	return v, nil
+}
+
+// LookupFunction searches the functions map for a given function name and returns the Function configuration if found,
+// or an empty Function and an error if it is not found.
+func (cfg *Config) LookupFunction(name string) (Function, error) {
+	cfg.RLock()
+	defer cfg.RUnlock()
+	v, ok := cfg.functions[name]
+	if !ok {
+		return Function{}, ErrFunctionNotFound
+	}
+	return v, nil
+}
+
+// LookupFunctionService searches the functions map for a given function name and returns the name of the service
+// providing the function if found, or an empty string and an error if it is not found.
+func (cfg *Config) LookupFunctionService(name string) (string, error) {
+	cfg.RLock()
+	defer cfg.RUnlock()
+	v, ok := cfg.functionServices[name]
+	if !ok {
+		return "", ErrFunctionNotFound
+	}
 	return v, nil
 }
+
+// Permits returns true if the function Capabilities permit calling the host callback of the namespace and operation.
+func (f Function) Permits(namespace, op string) bool {
+	if f.Capabilities == nil {
+		return true
+	}
+	for _, c := range f.Capabilities {
+		if c == namespace+":"+op || c == namespace+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasParams returns true if the route Path contains named or catch-all parameters.
+func (r Route) HasParams() bool {
+	for _, seg := range strings.Split(r.Path, "/") {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// Location returns the time zone defined by the route TimeZone, or UTC if no time zone is defined.
+func (r Route) Location() (*time.Location, error) {
+	if r.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(r.TimeZone)
+}
+
+// Schedule parses the route Cron expression, evaluated within the route TimeZone, into a cron schedule.
+func (r Route) Schedule() (cron.Schedule, error) {
+	loc, err := r.Location()
+	if err != nil {
+		return nil, err
+	}
+	return cron.ParseStandard(fmt.Sprintf("CRON_TZ=%s %s", loc, r.Cron))
+}
+
+// StartAt parses the route At timestamp. Timestamps without an offset are evaluated within the route TimeZone.
+func (r Route) StartAt() (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, r.At)
+	if err == nil {
+		return t, nil
+	}
+
+	loc, err := r.Location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.ParseInLocation("2006-01-02T15:04:05", r.At, loc)
+}
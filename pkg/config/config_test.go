@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 type TestCase struct {
@@ -14,7 +15,7 @@ type TestCase struct {
 func TestParserFile(t *testing.T) {
 	// Define the JSON data that will be used to create the temporary file
 	data := []byte(
-		`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm","pool_size":10},"example-defaults":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"example"},{"type":"scheduled_task","function":"example","frequency":15},{"type":"init","function":"example","retries":15,"frequency":50},{"type":"init","function":"example-defaults"},{"type":"function","function":"function1"}]}}}`,
+		`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm","pool_size":10,"timeout":5,"data_sources":{"sql":"orders","kvstore":"cache"}},"example-defaults":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"example","timeout":2},{"type":"scheduled_task","function":"example","frequency":15,"singleton":true},{"type":"init","function":"example","retries":15,"frequency":50},{"type":"init","function":"example-defaults"},{"type":"function","function":"function1"}]}}}`,
 	)
 
 	// Create a temporary file in the /tmp directory
@@ -72,6 +73,24 @@ func TestParserFile(t *testing.T) {
 			}
 		})
 
+		t.Run("Validate Function Data Sources", func(t *testing.T) {
+			f, err := cfg.LookupFunction("example")
+			if err != nil {
+				t.Fatalf("Unexpected error looking up function - %s", err)
+			}
+			if f.DataSources.SQL != "orders" || f.DataSources.KVStore != "cache" {
+				t.Errorf("Unexpected Function Data Sources - %+v", f.DataSources)
+			}
+
+			f, err = cfg.LookupFunction("example-defaults")
+			if err != nil {
+				t.Fatalf("Unexpected error looking up function - %s", err)
+			}
+			if f.DataSources != (DataSources{}) {
+				t.Errorf("Unexpected Default Function Data Sources - %+v", f.DataSources)
+			}
+		})
+
 		t.Run("Validate Default Pool Size", func(t *testing.T) {
 			if cfg.Services["example"].Functions["example-defaults"].PoolSize != 100 {
 				t.Errorf(
@@ -145,6 +164,24 @@ func TestParserFile(t *testing.T) {
 			}
 		})
 
+		t.Run("Validate Function Timeout", func(t *testing.T) {
+			if cfg.Services["example"].Functions["example"].Timeout != 5 {
+				t.Errorf("Unexpected Function Timeout - %d", cfg.Services["example"].Functions["example"].Timeout)
+			}
+		})
+
+		t.Run("Validate Route Timeout", func(t *testing.T) {
+			if cfg.Services["example"].Routes[0].Timeout != 2 {
+				t.Errorf("Unexpected Route Timeout - %d", cfg.Services["example"].Routes[0].Timeout)
+			}
+		})
+
+		t.Run("Validate Default Lease TTL", func(t *testing.T) {
+			if cfg.Services["example"].Routes[1].LeaseTTL != DefaultLeaseTTL {
+				t.Errorf("Unexpected Lease TTL - %d", cfg.Services["example"].Routes[1].LeaseTTL)
+			}
+		})
+
 		t.Run("Validate Function Name", func(t *testing.T) {
 			if cfg.Services["example"].Routes[4].Function != "function1" {
 				t.Errorf("Unexpected Function Name - %s", cfg.Services["example"].Routes[4].Function)
@@ -166,6 +203,55 @@ func TestParserFile(t *testing.T) {
 			t.Errorf("Unexpected success looking up routei - %s", err)
 		}
 	})
+
+	// Validate LookupRoute
+	t.Run("Validate LookupRoute with Valid Route", func(t *testing.T) {
+		r, err := cfg.LookupRoute("http:GET:/example")
+		if err != nil {
+			t.Errorf("Unexpected failure looking up route")
+		}
+		if r.Function != "example" {
+			t.Errorf("Unexpected Route Function - %s", r.Function)
+		}
+	})
+
+	t.Run("Validate LookupRoute with Invalid Route", func(t *testing.T) {
+		_, err := cfg.LookupRoute("http:DELETE:/example")
+		if err == nil {
+			t.Errorf("Unexpected success looking up route")
+		}
+	})
+
+	// Validate LookupFunction
+	t.Run("Validate LookupFunction with Valid Function", func(t *testing.T) {
+		f, err := cfg.LookupFunction("example")
+		if err != nil {
+			t.Errorf("Unexpected failure looking up function")
+		}
+		if f.Timeout != 5 {
+			t.Errorf("Unexpected Function Timeout - %d", f.Timeout)
+		}
+	})
+
+	t.Run("Validate LookupFunction with Invalid Function", func(t *testing.T) {
+		_, err := cfg.LookupFunction("doesnotexist")
+		if err == nil {
+			t.Errorf("Unexpected success looking up function")
+		}
+	})
+
+	// Validate LookupFunctionService
+	t.Run("Validate LookupFunctionService", func(t *testing.T) {
+		svc, err := cfg.LookupFunctionService("example-defaults")
+		if err != nil || svc != "example" {
+			t.Errorf("Unexpected result looking up function service - %s, %v", svc, err)
+		}
+
+		_, err = cfg.LookupFunctionService("doesnotexist")
+		if err == nil {
+			t.Errorf("Unexpected success looking up function service")
+		}
+	})
 }
 
 func TestMissingFile(t *testing.T) {
@@ -265,6 +351,48 @@ func TestConfigParser(t *testing.T) {
 			),
 			valid: false,
 		},
+		{
+			name: "Valid HTTP Envelope",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"example","envelope":"proto"},{"type":"http","path":"/example2","methods":["GET"],"function":"example","envelope":"json"}]}}}`,
+			),
+			valid: true,
+		},
+		{
+			name: "Unknown HTTP Envelope",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"example","envelope":"xml"}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "HTTP Route with Path Parameters",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"http","path":"/users/:id/*filepath","methods":["GET"],"function":"example","envelope":"json"}]}}}`,
+			),
+			valid: true,
+		},
+		{
+			name: "HTTP Route with Path Parameters and no Envelope",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"http","path":"/users/:id","methods":["GET"],"function":"example"}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "Negative Function Timeout",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm","timeout":-1}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"example"}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "Negative Route Timeout",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"example","timeout":-1}]}}}`,
+			),
+			valid: false,
+		},
 		{
 			name: "Missing Route Function",
 			data: []byte(
@@ -272,6 +400,195 @@ func TestConfigParser(t *testing.T) {
 			),
 			valid: false,
 		},
+		{
+			name: "Valid Singleton scheduled_task",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"scheduled_task","function":"example","frequency":15,"singleton":true,"lease_ttl":30}]}}}`,
+			),
+			valid: true,
+		},
+		{
+			name: "Negative Lease TTL scheduled_task",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"scheduled_task","function":"example","frequency":15,"singleton":true,"lease_ttl":-1}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "Singleton HTTP Route",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"example","singleton":true}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "Valid Cron scheduled_task",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"scheduled_task","function":"example","cron":"0 2 * * *","time_zone":"America/New_York","run_on_start":true}]}}}`,
+			),
+			valid: true,
+		},
+		{
+			name: "Valid Cron Descriptor scheduled_task",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"scheduled_task","function":"example","cron":"@daily"}]}}}`,
+			),
+			valid: true,
+		},
+		{
+			name: "Valid At scheduled_task",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"scheduled_task","function":"example","at":"2030-01-02T15:04:05Z"}]}}}`,
+			),
+			valid: true,
+		},
+		{
+			name: "Valid At without Offset scheduled_task",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"scheduled_task","function":"example","at":"2030-01-02T15:04:05","time_zone":"Europe/London"}]}}}`,
+			),
+			valid: true,
+		},
+		{
+			name: "Invalid Cron scheduled_task",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"scheduled_task","function":"example","cron":"0 2 * *"}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "Invalid Time Zone scheduled_task",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"scheduled_task","function":"example","cron":"0 2 * * *","time_zone":"Mars/Olympus"}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "Invalid At scheduled_task",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"scheduled_task","function":"example","at":"tomorrow"}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "Frequency and Cron scheduled_task",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"scheduled_task","function":"example","frequency":15,"cron":"0 2 * * *"}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "Valid NATS Route",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"nats","topic":"orders.*","queue":"workers","function":"example"}]}}}`,
+			),
+			valid: true,
+		},
+		{
+			name: "Valid NATS JetStream Route",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"nats","topic":"orders.*","function":"example","jetstream":{"stream":"ORDERS","ack_wait":30,"max_deliver":5}}]}}}`,
+			),
+			valid: true,
+		},
+		{
+			name: "Missing NATS Topic",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"nats","function":"example"}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "Missing NATS JetStream Stream",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"nats","topic":"orders.*","function":"example","jetstream":{"durable":"example"}}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "NATS Route with Queue and JetStream",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"nats","topic":"orders.*","queue":"workers","function":"example","jetstream":{"stream":"ORDERS"}}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "Valid Function Capabilities",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm","capabilities":["kvstore:get","logger:*"]}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"example"}]}}}`,
+			),
+			valid: true,
+		},
+		{
+			name: "Valid Function Memory Limit",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm","max_memory_pages":256}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"example"}]}}}`,
+			),
+			valid: true,
+		},
+		{
+			name: "Function Memory Limit Exceeds Maximum",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm","max_memory_pages":65537}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"example"}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "Invalid Function Capability",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm","capabilities":["kvstore"]}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"example"}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "Valid Function SQL Policy",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm","sql_policy":{"read_only":true,"statements":["select","dml"]}}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"example"}]}}}`,
+			),
+			valid: true,
+		},
+		{
+			name: "Unknown Function SQL Statement Class",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm","sql_policy":{"statements":["drop"]}}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"example"}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "Valid Function KV Namespace",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm","kv_namespace":"function"}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"example"}]}}}`,
+			),
+			valid: true,
+		},
+		{
+			name: "Service Name with Separator",
+			data: []byte(
+				`{"services":{"team/example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"example"}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "Function Name with Separator",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"team/example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"team/example"}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "Unknown Function KV Namespace",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm","kv_namespace":"team"}},"routes":[{"type":"http","path":"/example","methods":["GET"],"function":"example"}]}}}`,
+			),
+			valid: false,
+		},
+		{
+			name: "Negative NATS JetStream Max Deliver",
+			data: []byte(
+				`{"services":{"example":{"name":"example","functions":{"example":{"filepath":"./functions/example.wasm"}},"routes":[{"type":"nats","topic":"orders.*","function":"example","jetstream":{"stream":"ORDERS","max_deliver":-1}}]}}}`,
+			),
+			valid: false,
+		},
 	}
 
 	// Loop through the test cases
@@ -318,3 +635,84 @@ func TestConfigParser(t *testing.T) {
 		})
 	}
 }
+
+func TestRouteSchedule(t *testing.T) {
+	t.Run("Cron with Time Zone", func(t *testing.T) {
+		r := Route{Cron: "0 2 * * *", TimeZone: "America/New_York"}
+		sched, err := r.Schedule()
+		if err != nil {
+			t.Fatalf("Unexpected error parsing cron - %s", err)
+		}
+
+		loc, err := time.LoadLocation("America/New_York")
+		if err != nil {
+			t.Fatalf("Unable to load location - %s", err)
+		}
+
+		next := sched.Next(time.Date(2025, 3, 1, 12, 0, 0, 0, loc))
+		if !next.Equal(time.Date(2025, 3, 2, 2, 0, 0, 0, loc)) {
+			t.Errorf("Unexpected next execution - %s", next)
+		}
+	})
+
+	t.Run("Cron Defaults to UTC", func(t *testing.T) {
+		sched, err := Route{Cron: "30 1 * * *"}.Schedule()
+		if err != nil {
+			t.Fatalf("Unexpected error parsing cron - %s", err)
+		}
+
+		next := sched.Next(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+		if !next.Equal(time.Date(2025, 3, 2, 1, 30, 0, 0, time.UTC)) {
+			t.Errorf("Unexpected next execution - %s", next)
+		}
+	})
+
+	t.Run("At with Offset", func(t *testing.T) {
+		at, err := Route{At: "2030-01-02T15:04:05+02:00", TimeZone: "America/New_York"}.StartAt()
+		if err != nil {
+			t.Fatalf("Unexpected error parsing at - %s", err)
+		}
+
+		if !at.Equal(time.Date(2030, 1, 2, 13, 4, 5, 0, time.UTC)) {
+			t.Errorf("Unexpected at time - %s", at)
+		}
+	})
+
+	t.Run("At within Time Zone", func(t *testing.T) {
+		at, err := Route{At: "2030-01-02T15:04:05", TimeZone: "Asia/Tokyo"}.StartAt()
+		if err != nil {
+			t.Fatalf("Unexpected error parsing at - %s", err)
+		}
+
+		if !at.Equal(time.Date(2030, 1, 2, 6, 4, 5, 0, time.UTC)) {
+			t.Errorf("Unexpected at time - %s", at)
+		}
+	})
+}
+
+func TestFunctionPermits(t *testing.T) {
+	tt := []struct {
+		name         string
+		capabilities []string
+		namespace    string
+		op           string
+		permitted    bool
+	}{
+		{name: "Undefined Capabilities", namespace: "sql", op: "exec", permitted: true},
+		{name: "Empty Capabilities", capabilities: []string{}, namespace: "logger", op: "info"},
+		{name: "Granted", capabilities: []string{"kvstore:get"}, namespace: "kvstore", op: "get", permitted: true},
+		{name: "Not Granted", capabilities: []string{"kvstore:get"}, namespace: "kvstore", op: "delete"},
+		{name: "Wildcard", capabilities: []string{"logger:*"}, namespace: "logger", op: "error", permitted: true},
+		{name: "Wildcard Namespace", capabilities: []string{"logger:*"}, namespace: "metrics", op: "counter"},
+		{name: "Function", capabilities: []string{"function:other"}, namespace: "function", op: "other", permitted: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f := Function{Capabilities: tc.capabilities}
+			if f.Permits(tc.namespace, tc.op) != tc.permitted {
+				t.Errorf("Unexpected permission for %s:%s - %t", tc.namespace, tc.op, !tc.permitted)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+/*
+Package election provides lease based leader election on top of a hord key-value store.
+
+Each Elector campaigns for a lease stored within the key-value store under a shared key. The holder of an unexpired
+lease is the leader and renews the lease at a third of its TTL. When the leader stops renewing the lease, whether by
+resigning or failing, another Elector acquires the lease once it expires.
+
+Leases record their holder and a version incremented on every renewal, rather than an expiration time, so Electors do
+not rely on their clocks agreeing. An Elector considers the lease of another Elector expired once it has observed the
+same version for the TTL, measured by its own clock.
+
+	// Create an Elector
+	e, err := election.New(election.Config{
+		KV:  kv,
+		Key: "tarmac:leader:my-task",
+		ID:  hostname,
+		TTL: 15 * time.Second,
+	})
+	if err != nil {
+		// do something
+	}
+
+	// Campaign until the context is canceled
+	go e.Campaign(ctx)
+
+	// Check for leadership
+	if e.IsLeader() {
+		// do something only one instance should do
+	}
+
+The key-value store must implement kvext.Atomic. Leases are acquired and renewed with SetNX and CompareAndSwap, so
+only one of several concurrent campaigns for an expired lease succeeds. The atomic operations must hold across every
+Elector sharing the Key; a kvext.Locker only serializes operations within a single process.
+*/
+package election
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tarmac-project/hord"
+
+	"github.com/tarmac-project/tarmac/pkg/kvext"
+)
+
+// Config provides the configuration options for an Elector.
+type Config struct {
+	// KV is the key-value store used to hold the lease, which must implement kvext.Atomic.
+	KV hord.Database
+
+	// Key is the key-value store key of the lease. Electors sharing a Key campaign for the same leadership.
+	Key string
+
+	// ID uniquely identifies the Elector within the cluster, such as the hostname.
+	ID string
+
+	// TTL is the duration a lease is held without being renewed.
+	TTL time.Duration
+
+	// OnChange, when defined, is called with the new leadership status every time it changes.
+	OnChange func(leader bool)
+}
+
+// Elector campaigns for leadership by acquiring and renewing a lease.
+type Elector struct {
+	sync.RWMutex
+
+	// cfg is the Elector configuration.
+	cfg Config
+
+	// kv is the key-value store holding the lease.
+	kv kvext.Atomic
+
+	// observed is the stored lease value last read by the Elector.
+	observed []byte
+
+	// observedAt is the time the Elector first read the observed lease value.
+	observedAt time.Time
+
+	// renewed is the time the Elector last began storing its lease. The lease is held until TTL after renewed.
+	renewed time.Time
+
+	// version is the version of the lease last stored by the Elector.
+	version uint64
+
+	// leader is true while the Elector holds the lease.
+	leader bool
+}
+
+// lease is the value stored within the key-value store.
+type lease struct {
+	// Holder is the ID of the Elector holding the lease, or empty once the lease is released.
+	Holder string `json:"holder"`
+
+	// Version is incremented every time the lease is acquired, renewed, or released.
+	Version uint64 `json:"version"`
+}
+
+var (
+	// ErrInvalidConfig is returned when the Elector configuration is missing required fields.
+	ErrInvalidConfig = errors.New("invalid election configuration")
+)
+
+// New creates a new Elector with the configuration provided.
+func New(cfg Config) (*Elector, error) {
+	if cfg.KV == nil {
+		return nil, fmt.Errorf("%w - key-value store cannot be nil", ErrInvalidConfig)
+	}
+	if cfg.Key == "" || cfg.ID == "" {
+		return nil, fmt.Errorf("%w - key and id must be defined", ErrInvalidConfig)
+	}
+	if cfg.TTL <= 0 {
+		return nil, fmt.Errorf("%w - ttl must be greater than zero", ErrInvalidConfig)
+	}
+	kv, ok := cfg.KV.(kvext.Atomic)
+	if !ok {
+		return nil, fmt.Errorf("%w - key-value store must support atomic operations", ErrInvalidConfig)
+	}
+	return &Elector{cfg: cfg, kv: kv}, nil
+}
+
+// Campaign acquires and renews the lease until ctx is canceled, at which point any held lease is released.
+func (e *Elector) Campaign(ctx context.Context) {
+	ticker := time.NewTicker(e.cfg.TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		_ = e.Acquire()
+
+		select {
+		case <-ctx.Done():
+			_ = e.Resign()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Acquire attempts to acquire or renew the lease once. The lease is acquired when it does not exist, has been
+// released, is already held by this Elector, or has been observed unchanged for the TTL.
+func (e *Elector) Acquire() error {
+	now := time.Now()
+
+	current, raw, err := e.current()
+	if err != nil {
+		e.setLeader(false, 0, time.Time{})
+		return err
+	}
+	if e.expired(current, raw, now) {
+		b, err := json.Marshal(lease{Holder: e.cfg.ID, Version: current.Version + 1})
+		if err != nil {
+			return fmt.Errorf("unable to encode lease - %w", err)
+		}
+
+		acquired, err := e.swap(raw, b)
+		if err != nil || !acquired {
+			e.setLeader(false, 0, time.Time{})
+			return err
+		}
+		e.observe(b, now)
+		e.setLeader(true, current.Version+1, now)
+		return nil
+	}
+
+	e.setLeader(false, 0, time.Time{})
+	return nil
+}
+
+// expired records raw as the observed lease value and returns true if the lease may be acquired by this Elector.
+func (e *Elector) expired(current lease, raw []byte, now time.Time) bool {
+	observedAt := e.observe(raw, now)
+	if current.Holder == "" || current.Holder == e.cfg.ID {
+		return true
+	}
+	return now.Sub(observedAt) >= e.cfg.TTL
+}
+
+// observe records raw as the observed lease value, returning the time the value was first observed.
+func (e *Elector) observe(raw []byte, now time.Time) time.Time {
+	e.Lock()
+	defer e.Unlock()
+	if e.observedAt.IsZero() || !bytes.Equal(raw, e.observed) {
+		e.observed = raw
+		e.observedAt = now
+	}
+	return e.observedAt
+}
+
+// swap atomically replaces the lease read as raw with b, creating the lease when raw is nil. It returns false if the
+// lease was modified since it was read.
+func (e *Elector) swap(raw, b []byte) (bool, error) {
+	var ok bool
+	var err error
+	if raw == nil {
+		ok, err = e.kv.SetNX(e.cfg.Key, b, 0)
+	} else {
+		ok, err = e.kv.CompareAndSwap(e.cfg.Key, raw, b)
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to store lease - %w", err)
+	}
+	return ok, nil
+}
+
+// Resign releases the lease if it is held by this Elector, allowing another Elector to acquire it immediately. Leases
+// renewed since by another Elector with the same ID are left in place.
+func (e *Elector) Resign() error {
+	if !e.IsLeader() {
+		return nil
+	}
+	e.RLock()
+	version := e.version
+	e.RUnlock()
+	e.setLeader(false, 0, time.Time{})
+
+	current, raw, err := e.current()
+	if err != nil {
+		return err
+	}
+	if current.Holder != e.cfg.ID || current.Version != version {
+		return nil
+	}
+
+	b, err := json.Marshal(lease{Version: version + 1})
+	if err != nil {
+		return fmt.Errorf("unable to encode lease - %w", err)
+	}
+	_, err = e.kv.CompareAndSwap(e.cfg.Key, raw, b)
+	if err != nil {
+		return fmt.Errorf("unable to release lease - %w", err)
+	}
+	return nil
+}
+
+// IsLeader returns true if this Elector holds an unexpired lease.
+func (e *Elector) IsLeader() bool {
+	e.RLock()
+	defer e.RUnlock()
+	return e.leader && time.Since(e.renewed) < e.cfg.TTL
+}
+
+// current fetches the lease from the key-value store, along with its stored value. An empty lease and nil value are
+// returned if no lease exists.
+func (e *Elector) current() (lease, []byte, error) {
+	var l lease
+
+	b, err := e.cfg.KV.Get(e.cfg.Key)
+	if errors.Is(err, hord.ErrNil) {
+		return l, nil, nil
+	}
+	if err != nil {
+		return l, nil, fmt.Errorf("unable to fetch lease - %w", err)
+	}
+
+	err = json.Unmarshal(b, &l)
+	if err != nil {
+		// Treat corrupt leases as released so they are replaced
+		return lease{}, b, nil
+	}
+	return l, b, nil
+}
+
+// setLeader updates the leadership status along with the version and renewal time of the held lease, calling OnChange
+// when the status changes.
+func (e *Elector) setLeader(leader bool, version uint64, renewed time.Time) {
+	e.Lock()
+	changed := e.leader != leader
+	e.leader = leader
+	e.version = version
+	e.renewed = renewed
+	e.Unlock()
+
+	if changed && e.cfg.OnChange != nil {
+		e.cfg.OnChange(leader)
+	}
+}
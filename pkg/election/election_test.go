@@ -0,0 +1,271 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tarmac-project/hord/drivers/hashmap"
+
+	"github.com/tarmac-project/tarmac/pkg/kvext"
+)
+
+func TestNew(t *testing.T) {
+	db, err := hashmap.Dial(hashmap.Config{})
+	if err != nil {
+		t.Fatalf("Unable to create kv - %s", err)
+	}
+	kv, err := kvext.NewLocker(kvext.LockerConfig{KV: db})
+	if err != nil {
+		t.Fatalf("Unable to create locker - %s", err)
+	}
+
+	tt := map[string]Config{
+		"Missing KV":    {Key: "leader", ID: "a", TTL: time.Second},
+		"Non-Atomic KV": {KV: db, Key: "leader", ID: "a", TTL: time.Second},
+		"Missing Key":   {KV: kv, ID: "a", TTL: time.Second},
+		"Missing ID":    {KV: kv, Key: "leader", TTL: time.Second},
+		"Missing TTL":   {KV: kv, Key: "leader", ID: "a"},
+		"Negative TTL":  {KV: kv, Key: "leader", ID: "a", TTL: -time.Second},
+	}
+
+	for name, cfg := range tt {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(cfg)
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("Expected invalid config error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestElection(t *testing.T) {
+	db, err := hashmap.Dial(hashmap.Config{})
+	if err != nil {
+		t.Fatalf("Unable to create kv - %s", err)
+	}
+	err = db.Setup()
+	if err != nil {
+		t.Fatalf("Unable to setup kv - %s", err)
+	}
+	kv, err := kvext.NewLocker(kvext.LockerConfig{KV: db})
+	if err != nil {
+		t.Fatalf("Unable to create locker - %s", err)
+	}
+
+	changes := make(chan bool, 10)
+	a, err := New(Config{KV: kv, Key: "leader", ID: "a", TTL: time.Second, OnChange: func(l bool) { changes <- l }})
+	if err != nil {
+		t.Fatalf("Unable to create elector - %s", err)
+	}
+
+	b, err := New(Config{KV: kv, Key: "leader", ID: "b", TTL: time.Second})
+	if err != nil {
+		t.Fatalf("Unable to create elector - %s", err)
+	}
+
+	t.Run("Acquire", func(t *testing.T) {
+		err := a.Acquire()
+		if err != nil {
+			t.Fatalf("Unexpected error acquiring lease - %s", err)
+		}
+		if !a.IsLeader() {
+			t.Errorf("Expected elector to be leader")
+		}
+		if l := <-changes; !l {
+			t.Errorf("Expected leadership change to be reported")
+		}
+	})
+
+	t.Run("Lease Held", func(t *testing.T) {
+		err := b.Acquire()
+		if err != nil {
+			t.Fatalf("Unexpected error acquiring lease - %s", err)
+		}
+		if b.IsLeader() {
+			t.Errorf("Unexpected leadership while lease is held")
+		}
+	})
+
+	t.Run("Renew", func(t *testing.T) {
+		err := a.Acquire()
+		if err != nil {
+			t.Fatalf("Unexpected error renewing lease - %s", err)
+		}
+		if !a.IsLeader() {
+			t.Errorf("Expected elector to remain leader")
+		}
+		if len(changes) != 0 {
+			t.Errorf("Unexpected leadership change on renewal")
+		}
+	})
+
+	t.Run("Expired Lease", func(t *testing.T) {
+		// Observe the renewed lease, which expires once it is observed unchanged for the TTL
+		err := b.Acquire()
+		if err != nil || b.IsLeader() {
+			t.Fatalf("Unexpected result acquiring held lease - %t, %v", b.IsLeader(), err)
+		}
+
+		<-time.After(1100 * time.Millisecond)
+		if a.IsLeader() {
+			t.Errorf("Unexpected leadership with expired lease")
+		}
+
+		err = b.Acquire()
+		if err != nil {
+			t.Fatalf("Unexpected error acquiring lease - %s", err)
+		}
+		if !b.IsLeader() {
+			t.Errorf("Expected elector to acquire expired lease")
+		}
+
+		err = a.Acquire()
+		if err != nil {
+			t.Fatalf("Unexpected error acquiring lease - %s", err)
+		}
+		if a.IsLeader() {
+			t.Errorf("Unexpected leadership after lease taken over")
+		}
+		if l := <-changes; l {
+			t.Errorf("Expected loss of leadership to be reported")
+		}
+	})
+
+	t.Run("Resign", func(t *testing.T) {
+		err := b.Resign()
+		if err != nil {
+			t.Fatalf("Unexpected error resigning - %s", err)
+		}
+		if b.IsLeader() {
+			t.Errorf("Unexpected leadership after resigning")
+		}
+
+		err = a.Acquire()
+		if err != nil {
+			t.Fatalf("Unexpected error acquiring lease - %s", err)
+		}
+		if !a.IsLeader() {
+			t.Errorf("Expected elector to acquire released lease")
+		}
+	})
+
+	t.Run("Resign after Renewal by Same ID", func(t *testing.T) {
+		replacement, err := New(Config{KV: kv, Key: "leader", ID: "a", TTL: time.Second})
+		if err != nil {
+			t.Fatalf("Unable to create elector - %s", err)
+		}
+
+		<-time.After(10 * time.Millisecond)
+		err = replacement.Acquire()
+		if err != nil {
+			t.Fatalf("Unexpected error acquiring lease - %s", err)
+		}
+
+		err = a.Resign()
+		if err != nil {
+			t.Fatalf("Unexpected error resigning - %s", err)
+		}
+
+		err = b.Acquire()
+		if err != nil || b.IsLeader() {
+			t.Errorf("Expected lease renewed by replacement to be retained - %t, %v", b.IsLeader(), err)
+		}
+		if !replacement.IsLeader() {
+			t.Errorf("Expected replacement elector to remain leader")
+		}
+	})
+
+	t.Run("Campaign", func(t *testing.T) {
+		c, err := New(Config{KV: kv, Key: "campaign", ID: "c", TTL: 300 * time.Millisecond})
+		if err != nil {
+			t.Fatalf("Unable to create elector - %s", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			c.Campaign(ctx)
+			close(done)
+		}()
+
+		// Leadership should be retained across multiple TTLs through renewals
+		<-time.After(time.Second)
+		if !c.IsLeader() {
+			t.Errorf("Expected campaigning elector to be leader")
+		}
+
+		cancel()
+		<-done
+		if c.IsLeader() {
+			t.Errorf("Unexpected leadership after campaign stopped")
+		}
+
+		// Released leases are acquired without waiting for the TTL
+		d, err := New(Config{KV: kv, Key: "campaign", ID: "d", TTL: time.Minute})
+		if err != nil {
+			t.Fatalf("Unable to create elector - %s", err)
+		}
+		err = d.Acquire()
+		if err != nil || !d.IsLeader() {
+			t.Errorf("Expected lease to be released after campaign stopped - %t, %v", d.IsLeader(), err)
+		}
+	})
+}
+
+func TestElectionAtomic(t *testing.T) {
+	db, err := hashmap.Dial(hashmap.Config{})
+	if err != nil {
+		t.Fatalf("Unable to create kv - %s", err)
+	}
+	kv, err := kvext.NewLocker(kvext.LockerConfig{KV: db})
+	if err != nil {
+		t.Fatalf("Unable to create locker - %s", err)
+	}
+
+	electors := make([]*Elector, 10)
+	for i := range electors {
+		electors[i], err = New(Config{KV: kv, Key: "leader", ID: fmt.Sprintf("e%d", i), TTL: time.Minute})
+		if err != nil {
+			t.Fatalf("Unable to create elector - %s", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, e := range electors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := e.Acquire()
+			if err != nil {
+				t.Errorf("Unexpected error acquiring lease - %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var leaders int
+	for _, e := range electors {
+		if e.IsLeader() {
+			leaders++
+		}
+	}
+	if leaders != 1 {
+		t.Fatalf("Unexpected number of leaders - %d", leaders)
+	}
+
+	t.Run("Renew", func(t *testing.T) {
+		for _, e := range electors {
+			if !e.IsLeader() {
+				continue
+			}
+			err := e.Acquire()
+			if err != nil || !e.IsLeader() {
+				t.Errorf("Unexpected result renewing lease - %t, %v", e.IsLeader(), err)
+			}
+		}
+	})
+}
@@ -0,0 +1,82 @@
+/*
+Package envelope provides the envelopes Tarmac uses to pass invocation context to WASM functions and to receive
+structured results back from them, along with the typed result sets returned to functions by SQL host callbacks.
+
+Envelopes are defined within envelope.proto alongside the messages of github.com/tarmac-project/protobuf-go, and are
+generated with the same protoc-gen-go-lite toolchain, including the MarshalVT and UnmarshalVT methods. Guests in other
+languages can generate their envelopes from envelope.proto. Guests that cannot use protobuf may exchange the JSON
+equivalents defined within the github.com/tarmac-project/tarmac package instead.
+*/
+package envelope
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrInvalidValue is returned when a SQLValue cannot hold a value of an unsupported type.
+	ErrInvalidValue = errors.New("invalid SQL value")
+)
+
+// NewSQLValue returns a SQLValue holding v, which must be nil, a string, int64, float64, bool, []byte, or time.Time.
+// Values of other types return ErrInvalidValue.
+func NewSQLValue(v any) (*SQLValue, error) {
+	switch v := v.(type) {
+	case nil:
+		return &SQLValue{Value: &SQLValue_Null{Null: true}}, nil
+	case string:
+		return &SQLValue{Value: &SQLValue_String_{String_: v}}, nil
+	case int64:
+		return &SQLValue{Value: &SQLValue_Int{Int: v}}, nil
+	case float64:
+		return &SQLValue{Value: &SQLValue_Float{Float: v}}, nil
+	case bool:
+		return &SQLValue{Value: &SQLValue_Bool{Bool: v}}, nil
+	case []byte:
+		return &SQLValue{Value: &SQLValue_Bytes{Bytes: v}}, nil
+	case time.Time:
+		return &SQLValue{Value: &SQLValue_Timestamp{Timestamp: v.UnixNano()}}, nil
+	default:
+		return nil, fmt.Errorf("%w - %T", ErrInvalidValue, v)
+	}
+}
+
+// Interface returns the Go value held by the SQLValue, which is nil, a string, int64, float64, bool, []byte, or
+// time.Time in UTC.
+func (x *SQLValue) Interface() any {
+	switch v := x.GetValue().(type) {
+	case *SQLValue_String_:
+		return v.String_
+	case *SQLValue_Int:
+		return v.Int
+	case *SQLValue_Float:
+		return v.Float
+	case *SQLValue_Bool:
+		return v.Bool
+	case *SQLValue_Bytes:
+		if v.Bytes == nil {
+			return []byte{}
+		}
+		return v.Bytes
+	case *SQLValue_Timestamp:
+		return time.Unix(0, v.Timestamp).UTC()
+	default:
+		return nil
+	}
+}
+
+// NewSQLRow returns a SQLRow holding a SQLValue for each of values. Values of unsupported types return
+// ErrInvalidValue.
+func NewSQLRow(values []any) (*SQLRow, error) {
+	r := &SQLRow{Values: make([]*SQLValue, 0, len(values))}
+	for _, v := range values {
+		value, err := NewSQLValue(v)
+		if err != nil {
+			return nil, err
+		}
+		r.Values = append(r.Values, value)
+	}
+	return r, nil
+}
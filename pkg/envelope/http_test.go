@@ -0,0 +1,152 @@
+package envelope
+
+import (
+	"bytes"
+	"testing"
+
+	proto "github.com/tarmac-project/protobuf-go/sdk/http"
+)
+
+func TestHTTPRequest(t *testing.T) {
+	t.Run("Round Trip", func(t *testing.T) {
+		rq := &HTTPRequest{
+			Method: "POST",
+			Path:   "/users/123",
+			Query:  "a=1&b=2",
+			Headers: map[string]*proto.Header{
+				"Content-Type": {Values: []string{"application/json"}},
+				"Accept":       {Values: []string{"text/plain", "application/json"}},
+			},
+			RemoteAddr: "127.0.0.1:5555",
+			Tls: &TLS{
+				Version:     "TLS 1.3",
+				CipherSuite: "TLS_AES_128_GCM_SHA256",
+				ServerName:  "example.com",
+				PeerCertificates: []*Certificate{
+					{Subject: "CN=client", Issuer: "CN=ca", SerialNumber: "42", DnsNames: []string{"client.example.com"}},
+				},
+			},
+			Body:   []byte("Testing 1 2 3"),
+			Params: map[string]string{"id": "123", "filepath": "/a/b.txt"},
+		}
+
+		b, err := rq.MarshalVT()
+		if err != nil {
+			t.Fatalf("Unexpected error marshaling request - %s", err)
+		}
+
+		var got HTTPRequest
+		err = got.UnmarshalVT(b)
+		if err != nil {
+			t.Fatalf("Unexpected error unmarshaling request - %s", err)
+		}
+
+		if got.Method != rq.Method || got.Path != rq.Path || got.Query != rq.Query || got.RemoteAddr != rq.RemoteAddr {
+			t.Errorf("Unexpected request values - %+v", got)
+		}
+
+		if !bytes.Equal(got.Body, rq.Body) {
+			t.Errorf("Unexpected body - %s", got.Body)
+		}
+
+		if len(got.Params) != 2 || got.Params["id"] != "123" || got.Params["filepath"] != "/a/b.txt" {
+			t.Errorf("Unexpected params - %+v", got.Params)
+		}
+
+		if len(got.Headers["Accept"].GetValues()) != 2 || got.Headers["Accept"].GetValues()[1] != "application/json" {
+			t.Errorf("Unexpected headers - %+v", got.Headers)
+		}
+
+		if got.Tls == nil || got.Tls.Version != "TLS 1.3" || got.Tls.ServerName != "example.com" {
+			t.Fatalf("Unexpected TLS details - %+v", got.Tls)
+		}
+
+		if len(got.Tls.PeerCertificates) != 1 || got.Tls.PeerCertificates[0].Subject != "CN=client" ||
+			got.Tls.PeerCertificates[0].DnsNames[0] != "client.example.com" {
+			t.Errorf("Unexpected peer certificates - %+v", got.Tls.PeerCertificates)
+		}
+	})
+
+	t.Run("Plain Text Request", func(t *testing.T) {
+		b, err := (&HTTPRequest{Method: "GET", Path: "/"}).MarshalVT()
+		if err != nil {
+			t.Fatalf("Unexpected error marshaling request - %s", err)
+		}
+
+		var got HTTPRequest
+		err = got.UnmarshalVT(b)
+		if err != nil {
+			t.Fatalf("Unexpected error unmarshaling request - %s", err)
+		}
+
+		if got.Tls != nil {
+			t.Errorf("Unexpected TLS details for plain text request - %+v", got.Tls)
+		}
+	})
+}
+
+func TestHTTPResponse(t *testing.T) {
+	t.Run("Round Trip", func(t *testing.T) {
+		rsp := &HTTPResponse{
+			Code: 404,
+			Headers: map[string]*proto.Header{
+				"Set-Cookie": {Values: []string{"a=1", "b=2"}},
+			},
+			Body: []byte("Not Found"),
+		}
+
+		b, err := rsp.MarshalVT()
+		if err != nil {
+			t.Fatalf("Unexpected error marshaling response - %s", err)
+		}
+
+		var got HTTPResponse
+		err = got.UnmarshalVT(b)
+		if err != nil {
+			t.Fatalf("Unexpected error unmarshaling response - %s", err)
+		}
+
+		if got.Code != 404 {
+			t.Errorf("Unexpected status code - %d", got.Code)
+		}
+
+		if len(got.Headers["Set-Cookie"].GetValues()) != 2 {
+			t.Errorf("Unexpected headers - %+v", got.Headers)
+		}
+
+		if string(got.Body) != "Not Found" {
+			t.Errorf("Unexpected body - %s", got.Body)
+		}
+	})
+
+	t.Run("Empty Response", func(t *testing.T) {
+		var got HTTPResponse
+		err := got.UnmarshalVT([]byte{})
+		if err != nil {
+			t.Fatalf("Unexpected error unmarshaling empty response - %s", err)
+		}
+		if got.Code != 0 || len(got.Body) != 0 {
+			t.Errorf("Unexpected values from empty response - %+v", got)
+		}
+	})
+
+	t.Run("Invalid Payloads", func(t *testing.T) {
+		tt := map[string][]byte{
+			"JSON":             []byte(`{"code":200,"body":""}`),
+			"Truncated":        {0x1a, 0x05, 'a'},
+			"Wrong Wire Type":  {0x08 | 0x02, 0x01, 'a'},
+			"Invalid Varint":   {0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			"Truncated Header": {0x12, 0x03, 0x0a, 0x05, 'a'},
+		}
+
+		for name, b := range tt {
+			t.Run(name, func(t *testing.T) {
+				var got HTTPResponse
+				err := got.UnmarshalVT(b)
+				if err == nil {
+					t.Errorf("Unexpected success unmarshaling invalid payload - %+v", got)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package envelope
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	sdkproto "github.com/tarmac-project/protobuf-go/sdk"
+)
+
+func TestSQLResultSet(t *testing.T) {
+	t.Run("Round Trip", func(t *testing.T) {
+		ts := time.Date(2024, 1, 2, 15, 4, 5, 6, time.UTC)
+		rows := [][]any{
+			{int64(1), "John Smith", 1.5, true, []byte("data"), ts, nil},
+			{int64(0), "", 0.0, false, []byte{}, time.Unix(0, 0).UTC(), nil},
+			{int64(-42)},
+		}
+
+		rs := &SQLResultSet{
+			Status: &sdkproto.Status{Code: 200, Status: "OK"},
+			Columns: []*SQLColumn{
+				{Name: "id", DatabaseType: "INT"},
+				{Name: "name", DatabaseType: "VARCHAR", Nullable: true},
+			},
+			Cursor: "abc123",
+		}
+		for _, values := range rows {
+			r, err := NewSQLRow(values)
+			if err != nil {
+				t.Fatalf("Unexpected error creating row - %s", err)
+			}
+			rs.Rows = append(rs.Rows, r)
+		}
+
+		b, err := rs.MarshalVT()
+		if err != nil {
+			t.Fatalf("Unexpected error marshaling result set - %s", err)
+		}
+
+		var got SQLResultSet
+		err = got.UnmarshalVT(b)
+		if err != nil {
+			t.Fatalf("Unexpected error unmarshaling result set - %s", err)
+		}
+
+		if got.Status.GetCode() != 200 || got.Status.GetStatus() != "OK" || got.Cursor != "abc123" {
+			t.Errorf("Unexpected result set values - %+v", got)
+		}
+
+		if len(got.Columns) != 2 || got.Columns[0].Name != "id" || got.Columns[1].DatabaseType != "VARCHAR" ||
+			got.Columns[0].Nullable || !got.Columns[1].Nullable {
+			t.Errorf("Unexpected columns - %+v", got.Columns)
+		}
+
+		// Zero values retain their type
+		if len(got.Rows) != len(rows) {
+			t.Fatalf("Unexpected rows - %+v", got.Rows)
+		}
+		for i, r := range got.Rows {
+			values := make([]any, 0, len(r.Values))
+			for _, v := range r.Values {
+				values = append(values, v.Interface())
+			}
+			if !reflect.DeepEqual(values, rows[i]) {
+				t.Errorf("Unexpected row values - %#v", values)
+			}
+		}
+	})
+
+	t.Run("Invalid Value", func(t *testing.T) {
+		_, err := NewSQLRow([]any{struct{}{}})
+		if !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("Expected invalid value error, got %v", err)
+		}
+	})
+
+	t.Run("Invalid Wire Type", func(t *testing.T) {
+		// Float value (field 4) encoded as a varint
+		row := []byte{0x0a, 0x02, 0x20, 0x01}
+		rs := append([]byte{0x1a, byte(len(row))}, row...)
+
+		var got SQLResultSet
+		err := got.UnmarshalVT(rs)
+		if err == nil {
+			t.Errorf("Expected error unmarshaling invalid wire type")
+		}
+	})
+}
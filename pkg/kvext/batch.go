@@ -0,0 +1,71 @@
+package kvext
+
+import (
+	"github.com/tarmac-project/hord"
+)
+
+// Entry is a key and the data stored under it.
+type Entry struct {
+	// Key is the key of the entry.
+	Key string
+
+	// Data is the data stored under Key.
+	Data []byte
+}
+
+// Batcher is implemented by KV stores able to operate on multiple keys with a single request, such as with multi-key
+// commands or pipelining. Results are returned in the order of the keys or entries provided, with a nil error for
+// each key the operation succeeded on.
+type Batcher interface {
+	// GetMany fetches the data stored under each key. Missing keys are reported with hord.ErrNil.
+	GetMany(keys []string) ([][]byte, []error)
+
+	// SetMany stores the data of each entry under its key.
+	SetMany(entries []Entry) []error
+
+	// DeleteMany removes each key.
+	DeleteMany(keys []string) []error
+}
+
+// GetMany fetches the data stored under each key of kv, using a single request on KV stores implementing Batcher and
+// a Get per key on other KV stores.
+func GetMany(kv hord.Database, keys []string) ([][]byte, []error) {
+	if b, ok := kv.(Batcher); ok {
+		return b.GetMany(keys)
+	}
+
+	data := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		data[i], errs[i] = kv.Get(key)
+	}
+	return data, errs
+}
+
+// SetMany stores each entry within kv, using a single request on KV stores implementing Batcher and a Set per entry
+// on other KV stores.
+func SetMany(kv hord.Database, entries []Entry) []error {
+	if b, ok := kv.(Batcher); ok {
+		return b.SetMany(entries)
+	}
+
+	errs := make([]error, len(entries))
+	for i, e := range entries {
+		errs[i] = kv.Set(e.Key, e.Data)
+	}
+	return errs
+}
+
+// DeleteMany removes each key from kv, using a single request on KV stores implementing Batcher and a Delete per key
+// on other KV stores.
+func DeleteMany(kv hord.Database, keys []string) []error {
+	if b, ok := kv.(Batcher); ok {
+		return b.DeleteMany(keys)
+	}
+
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		errs[i] = kv.Delete(key)
+	}
+	return errs
+}
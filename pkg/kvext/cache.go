@@ -0,0 +1,372 @@
+package kvext
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tarmac-project/hord"
+)
+
+// CacheConfig provides the configuration options of a Cache.
+type CacheConfig struct {
+	// KV is the KV store to wrap.
+	KV hord.Database
+
+	// Size is the maximum number of keys cached. The least recently used key is evicted once Size is reached.
+	Size int
+
+	// TTL is the duration a key is cached before it is fetched again from KV.
+	TTL time.Duration
+
+	// Watch, when defined, is called by Setup to watch KV for keys modified by other processes. Watch calls invalidate
+	// with each modified key until the function it returns is called by Close.
+	Watch func(invalidate func(key string)) (func(), error)
+
+	// OnLookup, when defined, is called by every Get with true when the key was cached and false when it was fetched
+	// from KV.
+	OnLookup func(hit bool)
+}
+
+// cacheEntry is a cached key and its data.
+type cacheEntry struct {
+	// key is the cached key.
+	key string
+
+	// data is the data stored under key.
+	data []byte
+
+	// expires is the time the entry is no longer used.
+	expires time.Time
+}
+
+// Cache wraps a KV store with a bounded in-memory read-through cache, serving repeated fetches of a key without a
+// request to the KV store. Keys modified through the Cache are removed from it, while keys modified by other processes
+// are served from the Cache until their TTL elapses or a Watch reports them. Keys expiring within the wrapped KV store
+// are cached no longer than their remaining TTL.
+//
+// Cache implements every interface of this package, returning ErrNotSupported when the wrapped KV store does not.
+type Cache struct {
+	hord.Database
+
+	// mu protects entries, order, and generation.
+	mu sync.Mutex
+
+	// entries are the cached entries by key, each an element of order.
+	entries map[string]*list.Element
+
+	// order holds entries from the most to the least recently used.
+	order *list.List
+
+	// generation is incremented every time a key is invalidated, so fetches overlapping a modification are not cached.
+	generation uint64
+
+	// size is the maximum number of cached keys.
+	size int
+
+	// ttl is the duration keys are cached.
+	ttl time.Duration
+
+	// watch starts watching for modified keys.
+	watch func(invalidate func(key string)) (func(), error)
+
+	// stop stops watching for modified keys.
+	stop func()
+
+	// onLookup reports the result of each lookup.
+	onLookup func(hit bool)
+}
+
+// NewCache returns a Cache initialized with CacheConfig.
+func NewCache(cfg CacheConfig) (*Cache, error) {
+	if cfg.KV == nil {
+		return nil, fmt.Errorf("%w - kv cannot be nil", ErrInvalidConfig)
+	}
+	if cfg.Size <= 0 {
+		return nil, fmt.Errorf("%w - size must be greater than zero", ErrInvalidConfig)
+	}
+	if cfg.TTL <= 0 {
+		return nil, fmt.Errorf("%w - ttl must be greater than zero", ErrInvalidConfig)
+	}
+
+	return &Cache{
+		Database: cfg.KV,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		size:     cfg.Size,
+		ttl:      cfg.TTL,
+		watch:    cfg.Watch,
+		onLookup: cfg.OnLookup,
+	}, nil
+}
+
+// Setup sets up the wrapped KV store, then starts watching for modified keys.
+func (c *Cache) Setup() error {
+	err := c.Database.Setup()
+	if err != nil {
+		return err
+	}
+
+	if c.watch != nil {
+		c.stop, err = c.watch(c.Invalidate)
+		if err != nil {
+			return fmt.Errorf("unable to watch for modified keys - %w", err)
+		}
+	}
+	return nil
+}
+
+// Close stops watching for modified keys and closes the wrapped KV store.
+func (c *Cache) Close() {
+	if c.stop != nil {
+		c.stop()
+	}
+	c.Database.Close()
+}
+
+// Invalidate removes key from the Cache, so it is fetched from the wrapped KV store on the next Get.
+func (c *Cache) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if e, ok := c.entries[key]; ok {
+		c.order.Remove(e)
+		delete(c.entries, key)
+	}
+}
+
+// lookup returns the cached data of key, and false with the current generation when the key is not cached.
+func (c *Cache) lookup(key string) ([]byte, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, c.generation, false
+	}
+
+	entry := e.Value.(*cacheEntry)
+	if !time.Now().Before(entry.expires) {
+		c.order.Remove(e)
+		delete(c.entries, key)
+		return nil, c.generation, false
+	}
+
+	c.order.MoveToFront(e)
+	return entry.data, c.generation, true
+}
+
+// lifetime returns the duration key may be cached, capped at the remaining TTL of the key within the wrapped KV store so
+// expired keys are not served from the Cache. False is returned when the remaining TTL cannot be fetched.
+func (c *Cache) lifetime(key string) (time.Duration, bool) {
+	t, ok := c.Database.(TTLGetter)
+	if !ok {
+		return c.ttl, true
+	}
+
+	ttl, err := t.TTL(key)
+	if errors.Is(err, ErrNotSupported) {
+		return c.ttl, true
+	}
+	if err != nil {
+		return 0, false
+	}
+	if ttl > 0 && ttl < c.ttl {
+		return ttl, true
+	}
+	return c.ttl, true
+}
+
+// store caches data under key for ttl if no key was invalidated since generation, evicting the least recently used key
+// when the Cache is full.
+func (c *Cache) store(key string, data []byte, generation uint64, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generation != generation {
+		return
+	}
+
+	entry := &cacheEntry{key: key, data: append([]byte(nil), data...), expires: time.Now().Add(ttl)}
+	if e, ok := c.entries[key]; ok {
+		e.Value = entry
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// report reports the result of a lookup.
+func (c *Cache) report(hit bool) {
+	if c.onLookup != nil {
+		c.onLookup(hit)
+	}
+}
+
+// Get returns the cached data of key, fetching and caching it from the wrapped KV store when it is not cached.
+func (c *Cache) Get(key string) ([]byte, error) {
+	data, generation, ok := c.lookup(key)
+	c.report(ok)
+	if ok {
+		return data, nil
+	}
+
+	data, err := c.Database.Get(key)
+	if err != nil {
+		return data, err
+	}
+	if ttl, ok := c.lifetime(key); ok {
+		c.store(key, data, generation, ttl)
+	}
+	return data, nil
+}
+
+// Set stores data under key, removing the key from the Cache.
+func (c *Cache) Set(key string, data []byte) error {
+	defer c.Invalidate(key)
+	return c.Database.Set(key, data)
+}
+
+// Delete removes the key from the wrapped KV store and the Cache.
+func (c *Cache) Delete(key string) error {
+	defer c.Invalidate(key)
+	return c.Database.Delete(key)
+}
+
+// SetWithTTL stores data under key, expiring the key after ttl and removing it from the Cache. The wrapped KV store
+// must implement TTLSetter.
+func (c *Cache) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	t, ok := c.Database.(TTLSetter)
+	if !ok {
+		return fmt.Errorf("%w - ttl", ErrNotSupported)
+	}
+
+	defer c.Invalidate(key)
+	return t.SetWithTTL(key, data, ttl)
+}
+
+// TTL returns the remaining TTL of key from the wrapped KV store, which must implement TTLGetter.
+func (c *Cache) TTL(key string) (time.Duration, error) {
+	t, ok := c.Database.(TTLGetter)
+	if !ok {
+		return 0, fmt.Errorf("%w - ttl", ErrNotSupported)
+	}
+	return t.TTL(key)
+}
+
+// atomic returns the wrapped KV store as an Atomic.
+func (c *Cache) atomic() (Atomic, error) {
+	a, ok := c.Database.(Atomic)
+	if !ok {
+		return nil, fmt.Errorf("%w - atomic operations", ErrNotSupported)
+	}
+	return a, nil
+}
+
+// CompareAndSwap stores data under key if the key currently holds old, comparing against the wrapped KV store rather
+// than the Cache. The wrapped KV store must implement Atomic.
+func (c *Cache) CompareAndSwap(key string, old, data []byte) (bool, error) {
+	a, err := c.atomic()
+	if err != nil {
+		return false, err
+	}
+
+	defer c.Invalidate(key)
+	return a.CompareAndSwap(key, old, data)
+}
+
+// SetNX stores data under key if the key does not exist within the wrapped KV store. The wrapped KV store must
+// implement Atomic.
+func (c *Cache) SetNX(key string, data []byte, ttl time.Duration) (bool, error) {
+	a, err := c.atomic()
+	if err != nil {
+		return false, err
+	}
+
+	defer c.Invalidate(key)
+	return a.SetNX(key, data, ttl)
+}
+
+// Incr adds delta to the integer stored under key. The wrapped KV store must implement Atomic.
+func (c *Cache) Incr(key string, delta int64) (int64, error) {
+	a, err := c.atomic()
+	if err != nil {
+		return 0, err
+	}
+
+	defer c.Invalidate(key)
+	return a.Incr(key, delta)
+}
+
+// Scan lists keys using ScanKeys on the wrapped KV store.
+func (c *Cache) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	return ScanKeys(c.Database, prefix, cursor, limit)
+}
+
+// GetMany returns the cached data of each key, fetching the keys not cached using GetMany on the wrapped KV store.
+func (c *Cache) GetMany(keys []string) ([][]byte, []error) {
+	data := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+
+	var missed []int
+	var fetch []string
+	var generation uint64
+	for i, key := range keys {
+		var ok bool
+		var g uint64
+		data[i], g, ok = c.lookup(key)
+		c.report(ok)
+		if ok {
+			continue
+		}
+		if len(missed) == 0 {
+			generation = g
+		}
+		missed = append(missed, i)
+		fetch = append(fetch, key)
+	}
+	if len(missed) == 0 {
+		return data, errs
+	}
+
+	values, ferrs := GetMany(c.Database, fetch)
+	for j, i := range missed {
+		data[i], errs[i] = values[j], ferrs[j]
+		if errs[i] != nil {
+			continue
+		}
+		if ttl, ok := c.lifetime(keys[i]); ok {
+			c.store(keys[i], data[i], generation, ttl)
+		}
+	}
+	return data, errs
+}
+
+// SetMany stores each entry using SetMany on the wrapped KV store, removing each key from the Cache.
+func (c *Cache) SetMany(entries []Entry) []error {
+	defer func() {
+		for _, e := range entries {
+			c.Invalidate(e.Key)
+		}
+	}()
+	return SetMany(c.Database, entries)
+}
+
+// DeleteMany removes each key using DeleteMany on the wrapped KV store, removing each key from the Cache.
+func (c *Cache) DeleteMany(keys []string) []error {
+	defer func() {
+		for _, key := range keys {
+			c.Invalidate(key)
+		}
+	}()
+	return DeleteMany(c.Database, keys)
+}
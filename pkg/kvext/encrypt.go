@@ -0,0 +1,387 @@
+package kvext
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tarmac-project/hord"
+)
+
+// encryptedMagic begins every value stored by an Encryptor, followed by the format version.
+var encryptedMagic = []byte("\x00TENC")
+
+// encryptedVersion is the format version of values stored by an Encryptor.
+const encryptedVersion = 1
+
+var (
+	// ErrDecrypt is returned when an encrypted value cannot be decrypted, such as when it was modified.
+	ErrDecrypt = errors.New("unable to decrypt value")
+
+	// ErrUnknownKey is returned when a value is encrypted with a key ID the Encryptor has no key for.
+	ErrUnknownKey = errors.New("unknown encryption key")
+)
+
+// EncryptorConfig provides the configuration options of an Encryptor.
+type EncryptorConfig struct {
+	// KV is the KV store to wrap.
+	KV hord.Database
+
+	// Keys are the AES keys able to decrypt values, by key ID. Keys must be 16, 24, or 32 bytes, selecting AES-128,
+	// AES-192, or AES-256.
+	Keys map[string][]byte
+
+	// KeyID is the ID of the key within Keys encrypting new values. Key IDs are stored with each value and must be at
+	// most 255 bytes.
+	KeyID string
+}
+
+// Encryptor wraps a KV store, encrypting values at rest with AES-GCM. Each value records the ID of the key encrypting
+// it, so keys can be rotated by adding a new key, encrypting new values with it, and re-encrypting existing values with
+// Reencrypt. Values are bound to the key they are stored under, so they cannot be moved between keys.
+//
+// Values stored before encryption was enabled are returned unchanged until re-encrypted.
+//
+// Encryptor implements every interface of this package, returning ErrNotSupported when the wrapped KV store does not.
+type Encryptor struct {
+	hord.Database
+
+	// aeads are the ciphers of each key, by key ID.
+	aeads map[string]cipher.AEAD
+
+	// keyID is the ID of the key encrypting new values.
+	keyID string
+}
+
+// NewEncryptor returns an Encryptor initialized with EncryptorConfig.
+func NewEncryptor(cfg EncryptorConfig) (*Encryptor, error) {
+	if cfg.KV == nil {
+		return nil, fmt.Errorf("%w - kv cannot be nil", ErrInvalidConfig)
+	}
+	if _, ok := cfg.Keys[cfg.KeyID]; !ok {
+		return nil, fmt.Errorf("%w - no key defined for key id %q", ErrInvalidConfig, cfg.KeyID)
+	}
+
+	e := &Encryptor{Database: cfg.KV, aeads: make(map[string]cipher.AEAD, len(cfg.Keys)), keyID: cfg.KeyID}
+	for id, key := range cfg.Keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("%w - key id %q must be between 1 and 255 bytes", ErrInvalidConfig, id)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w - key %s - %w", ErrInvalidConfig, id, err)
+		}
+		e.aeads[id], err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("%w - key %s - %w", ErrInvalidConfig, id, err)
+		}
+	}
+	return e, nil
+}
+
+// encrypt returns data encrypted with the current key, bound to key.
+func (e *Encryptor) encrypt(key string, data []byte) ([]byte, error) {
+	aead := e.aeads[e.keyID]
+
+	b := make([]byte, 0, len(encryptedMagic)+2+len(e.keyID)+aead.NonceSize()+len(data)+aead.Overhead())
+	b = append(b, encryptedMagic...)
+	b = append(b, encryptedVersion, byte(len(e.keyID)))
+	b = append(b, e.keyID...)
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate nonce - %w", err)
+	}
+	b = append(b, nonce...)
+
+	return aead.Seal(b, nonce, data, []byte(key)), nil
+}
+
+// decrypt returns the plaintext of the value stored under key, along with the ID of the key encrypting it. Values
+// without the encryption header are returned unchanged with an empty key ID.
+func (e *Encryptor) decrypt(key string, value []byte) ([]byte, string, error) {
+	if !bytes.HasPrefix(value, encryptedMagic) {
+		return value, "", nil
+	}
+
+	b := value[len(encryptedMagic):]
+	if len(b) < 2 || b[0] != encryptedVersion || len(b) < 2+int(b[1]) {
+		return nil, "", fmt.Errorf("%w - malformed header", ErrDecrypt)
+	}
+	id := string(b[2 : 2+int(b[1])])
+	b = b[2+int(b[1]):]
+
+	aead, ok := e.aeads[id]
+	if !ok {
+		return nil, id, fmt.Errorf("%w - %s", ErrUnknownKey, id)
+	}
+	if len(b) < aead.NonceSize() {
+		return nil, id, fmt.Errorf("%w - malformed value", ErrDecrypt)
+	}
+
+	data, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], []byte(key))
+	if err != nil {
+		return nil, id, fmt.Errorf("%w - %w", ErrDecrypt, err)
+	}
+	return data, id, nil
+}
+
+// Get fetches and decrypts the data stored under key.
+func (e *Encryptor) Get(key string) ([]byte, error) {
+	value, err := e.Database.Get(key)
+	if err != nil {
+		return value, err
+	}
+
+	data, _, err := e.decrypt(key, value)
+	return data, err
+}
+
+// Set encrypts and stores data under key.
+func (e *Encryptor) Set(key string, data []byte) error {
+	if err := hord.ValidData(data); err != nil {
+		return err
+	}
+
+	value, err := e.encrypt(key, data)
+	if err != nil {
+		return err
+	}
+	return e.Database.Set(key, value)
+}
+
+// SetWithTTL encrypts and stores data under key, expiring the key after ttl. The wrapped KV store must implement
+// TTLSetter.
+func (e *Encryptor) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	t, ok := e.Database.(TTLSetter)
+	if !ok {
+		return fmt.Errorf("%w - ttl", ErrNotSupported)
+	}
+	if err := hord.ValidData(data); err != nil {
+		return err
+	}
+
+	value, err := e.encrypt(key, data)
+	if err != nil {
+		return err
+	}
+	return t.SetWithTTL(key, value, ttl)
+}
+
+// TTL returns the remaining TTL of key from the wrapped KV store, which must implement TTLGetter.
+func (e *Encryptor) TTL(key string) (time.Duration, error) {
+	t, ok := e.Database.(TTLGetter)
+	if !ok {
+		return 0, fmt.Errorf("%w - ttl", ErrNotSupported)
+	}
+	return t.TTL(key)
+}
+
+// atomic returns the wrapped KV store as an Atomic.
+func (e *Encryptor) atomic() (Atomic, error) {
+	a, ok := e.Database.(Atomic)
+	if !ok {
+		return nil, fmt.Errorf("%w - atomic operations", ErrNotSupported)
+	}
+	return a, nil
+}
+
+// CompareAndSwap stores data under key if the decrypted value of the key equals old. The encrypted value is compared
+// and swapped by the wrapped KV store, which must implement Atomic.
+func (e *Encryptor) CompareAndSwap(key string, old, data []byte) (bool, error) {
+	a, err := e.atomic()
+	if err != nil {
+		return false, err
+	}
+	if err := hord.ValidData(data); err != nil {
+		return false, err
+	}
+
+	current, err := e.Database.Get(key)
+	if errors.Is(err, hord.ErrNil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	plain, _, err := e.decrypt(key, current)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(plain, old) {
+		return false, nil
+	}
+
+	value, err := e.encrypt(key, data)
+	if err != nil {
+		return false, err
+	}
+	return a.CompareAndSwap(key, current, value)
+}
+
+// SetNX encrypts and stores data under key if the key does not exist. The wrapped KV store must implement Atomic.
+func (e *Encryptor) SetNX(key string, data []byte, ttl time.Duration) (bool, error) {
+	a, err := e.atomic()
+	if err != nil {
+		return false, err
+	}
+	if err := hord.ValidData(data); err != nil {
+		return false, err
+	}
+
+	value, err := e.encrypt(key, data)
+	if err != nil {
+		return false, err
+	}
+	return a.SetNX(key, value, ttl)
+}
+
+// Incr adds delta to the integer stored under key, swapping the encrypted value with the wrapped KV store until no
+// concurrent write interferes. The wrapped KV store must implement Atomic. Incrementing a key removes its TTL.
+func (e *Encryptor) Incr(key string, delta int64) (int64, error) {
+	a, err := e.atomic()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		current, err := e.Database.Get(key)
+		if err != nil && !errors.Is(err, hord.ErrNil) {
+			return 0, err
+		}
+		missing := err != nil
+
+		var plain []byte
+		if !missing {
+			plain, _, err = e.decrypt(key, current)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := increment(plain, delta)
+		if err != nil {
+			return 0, err
+		}
+		value, err := e.encrypt(key, formatInt(n))
+		if err != nil {
+			return 0, err
+		}
+
+		var ok bool
+		if missing {
+			ok, err = a.SetNX(key, value, 0)
+		} else {
+			ok, err = a.CompareAndSwap(key, current, value)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return n, nil
+		}
+	}
+}
+
+// Scan lists keys using ScanKeys on the wrapped KV store.
+func (e *Encryptor) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	return ScanKeys(e.Database, prefix, cursor, limit)
+}
+
+// GetMany fetches and decrypts the data stored under each key, using GetMany on the wrapped KV store.
+func (e *Encryptor) GetMany(keys []string) ([][]byte, []error) {
+	values, errs := GetMany(e.Database, keys)
+	for i, key := range keys {
+		if errs[i] == nil {
+			values[i], _, errs[i] = e.decrypt(key, values[i])
+		}
+	}
+	return values, errs
+}
+
+// SetMany encrypts and stores each entry, using SetMany on the wrapped KV store.
+func (e *Encryptor) SetMany(entries []Entry) []error {
+	errs := make([]error, len(entries))
+
+	var valid []int
+	var encrypted []Entry
+	for i, entry := range entries {
+		errs[i] = hord.ValidData(entry.Data)
+		if errs[i] != nil {
+			continue
+		}
+
+		var value []byte
+		value, errs[i] = e.encrypt(entry.Key, entry.Data)
+		if errs[i] == nil {
+			valid = append(valid, i)
+			encrypted = append(encrypted, Entry{Key: entry.Key, Data: value})
+		}
+	}
+
+	for j, err := range SetMany(e.Database, encrypted) {
+		errs[valid[j]] = err
+	}
+	return errs
+}
+
+// DeleteMany removes each key, using DeleteMany on the wrapped KV store.
+func (e *Encryptor) DeleteMany(keys []string) []error {
+	return DeleteMany(e.Database, keys)
+}
+
+// Reencrypt encrypts the value of key with the current key if it is stored in plaintext or encrypted with another key,
+// returning true if the value was rewritten. TTLs reported by a wrapped KV store implementing TTLGetter are kept.
+// Otherwise, values are rewritten with CompareAndSwap when the wrapped KV store implements Atomic, so values written
+// concurrently are left in place.
+func (e *Encryptor) Reencrypt(key string) (bool, error) {
+	current, err := e.Database.Get(key)
+	if errors.Is(err, hord.ErrNil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	plain, id, err := e.decrypt(key, current)
+	if err != nil {
+		return false, err
+	}
+	if id == e.keyID {
+		return false, nil
+	}
+
+	value, err := e.encrypt(key, plain)
+	if err != nil {
+		return false, err
+	}
+
+	if g, ok := e.Database.(TTLGetter); ok {
+		ttl, err := g.TTL(key)
+		if errors.Is(err, hord.ErrNil) {
+			return false, nil
+		}
+		if err != nil && !errors.Is(err, ErrNotSupported) {
+			return false, err
+		}
+		if ttl > 0 {
+			s, ok := e.Database.(TTLSetter)
+			if !ok {
+				return false, fmt.Errorf("%w - ttl", ErrNotSupported)
+			}
+			return true, s.SetWithTTL(key, value, ttl)
+		}
+	}
+
+	if a, ok := e.Database.(Atomic); ok {
+		return a.CompareAndSwap(key, current, value)
+	}
+	return true, e.Database.Set(key, value)
+}
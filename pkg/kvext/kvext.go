@@ -0,0 +1,153 @@
+/*
+Package kvext extends hord KV stores with operations the hord.Database interface does not provide, such as storing
+keys that expire and atomically modifying keys.
+
+KV stores supporting an operation natively, such as Redis and NATS key expiration, are wrapped with an implementation
+using the native operation. Other KV stores are wrapped with a host-side implementation built on the hord.Database
+interface.
+
+	// Wrap a KV store with a Sweeper removing expired keys every minute
+	kv, err := kvext.NewSweeper(kvext.SweeperConfig{
+		KV:       db,
+		Interval: time.Minute,
+	})
+	if err != nil {
+		// do something
+	}
+
+	// Setup the KV store and start the Sweeper
+	err = kv.Setup()
+	if err != nil {
+		// do something
+	}
+
+	// Store a key removed after 30 seconds
+	err = kv.SetWithTTL("session", data, 30*time.Second)
+	if err != nil {
+		// do something
+	}
+
+KV stores without native atomic operations are wrapped with a Locker, which serializes operations on each key within
+the process.
+
+	// Count requests atomically
+	n, err := kv.Incr("requests", 1)
+	if err != nil {
+		// do something
+	}
+
+Keys are listed incrementally with ScanKeys, which pages through keys matching a prefix using a native scan on KV
+stores implementing Scanner, such as Redis and BoltDB, and falls back to filtering the result of Keys on other KV
+stores.
+
+	// List up to 100 keys beginning with "user:"
+	keys, cursor, err := kvext.ScanKeys(kv, "user:", "", 100)
+	if err != nil {
+		// do something
+	}
+
+Multiple keys are fetched, stored, or removed with GetMany, SetMany, and DeleteMany, using multi-key commands or
+pipelining on KV stores implementing Batcher and an operation per key on other KV stores.
+
+Values are encrypted at rest by wrapping a KV store with an Encryptor, which records the ID of the key encrypting each
+value so keys can be rotated and existing values re-encrypted with Reencrypt.
+
+Repeated fetches of keys are served from memory by wrapping a KV store with a Cache, which removes keys modified
+through it and, with a Watch, keys modified by other processes.
+
+Every wrapper implements hord.Database, delegating the operations it does not extend to the wrapped KV store.
+*/
+package kvext
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/tarmac-project/hord"
+)
+
+// ReservedPrefix prefixes the keys Tarmac stores for its own use, such as leader election leases and the expiration of
+// keys. Namespace rejects keys with this prefix, so its callers cannot read or modify them.
+const ReservedPrefix = "tarmac:"
+
+// TTLSetter is implemented by KV stores able to store keys that expire.
+type TTLSetter interface {
+	// SetWithTTL stores data under key, removing the key once ttl has elapsed. Storing the key again with Set clears
+	// the TTL.
+	SetWithTTL(key string, data []byte, ttl time.Duration) error
+}
+
+// TTLGetter is implemented by KV stores able to report the remaining TTL of keys.
+type TTLGetter interface {
+	// TTL returns the duration until key expires, or zero if the key does not expire. Missing keys are reported with
+	// hord.ErrNil.
+	TTL(key string) (time.Duration, error)
+}
+
+// Atomic is implemented by KV stores able to modify keys atomically.
+type Atomic interface {
+	// CompareAndSwap stores data under key if the current value of the key equals old, returning false if the key does
+	// not exist or holds another value.
+	CompareAndSwap(key string, old, data []byte) (bool, error)
+
+	// SetNX stores data under key if the key does not exist, returning false if it does. When ttl is greater than zero,
+	// the key expires once ttl has elapsed.
+	SetNX(key string, data []byte, ttl time.Duration) (bool, error)
+
+	// Incr adds delta to the base 10 integer stored under key, returning the new value. Missing keys are treated as
+	// zero.
+	Incr(key string, delta int64) (int64, error)
+}
+
+var (
+	// ErrInvalidConfig is returned when a wrapper configuration is missing required fields.
+	ErrInvalidConfig = errors.New("invalid kv extension configuration")
+
+	// ErrInvalidTTL is returned when a TTL is not greater than zero.
+	ErrInvalidTTL = errors.New("ttl must be greater than zero")
+
+	// ErrNotSupported is returned when an operation is not supported by the wrapped KV store.
+	ErrNotSupported = errors.New("operation not supported by kv store")
+
+	// ErrNotInteger is returned when incrementing a key that does not hold an integer, or when the result overflows.
+	ErrNotInteger = errors.New("value is not an integer or out of range")
+)
+
+// validTTL returns an error if the key, data, or ttl of a SetWithTTL call are invalid.
+func validTTL(key string, data []byte, ttl time.Duration) error {
+	if err := hord.ValidKey(key); err != nil {
+		return err
+	}
+	if err := hord.ValidData(data); err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("%w - %s", ErrInvalidTTL, ttl)
+	}
+	return nil
+}
+
+// increment returns the base 10 integer within current plus delta, treating an empty current value as zero.
+func increment(current []byte, delta int64) (int64, error) {
+	var n int64
+	if len(current) > 0 {
+		var err error
+		n, err = strconv.ParseInt(string(current), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w - %s", ErrNotInteger, current)
+		}
+	}
+
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, fmt.Errorf("%w - increment overflows", ErrNotInteger)
+	}
+	return n + delta, nil
+}
+
+// formatInt returns n encoded as a base 10 integer.
+func formatInt(n int64) []byte {
+	return []byte(strconv.FormatInt(n, 10))
+}
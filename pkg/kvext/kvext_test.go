@@ -0,0 +1,1285 @@
+package kvext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nats-io/nats-server/v2/server"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/tarmac-project/hord"
+	"github.com/tarmac-project/hord/drivers/hashmap"
+	"github.com/tarmac-project/hord/drivers/nats"
+	hordredis "github.com/tarmac-project/hord/drivers/redis"
+)
+
+func newHashmap(t *testing.T) hord.Database {
+	t.Helper()
+	kv, err := hashmap.Dial(hashmap.Config{})
+	if err != nil {
+		t.Fatalf("Unable to create hashmap - %s", err)
+	}
+	return kv
+}
+
+// testAtomic runs the atomic operations of kv against the cas, setnx, and counter keys.
+func testAtomic(t *testing.T, kv interface {
+	hord.Database
+	Atomic
+}) {
+	t.Helper()
+	for _, key := range []string{"cas", "setnx", "counter"} {
+		_ = kv.Delete(key)
+	}
+
+	t.Run("SetNX", func(t *testing.T) {
+		ok, err := kv.SetNX("setnx", []byte("a"), 0)
+		if err != nil || !ok {
+			t.Fatalf("Unexpected result setting missing key - %t, %v", ok, err)
+		}
+
+		ok, err = kv.SetNX("setnx", []byte("b"), 0)
+		if err != nil || ok {
+			t.Fatalf("Unexpected result setting existing key - %t, %v", ok, err)
+		}
+
+		data, err := kv.Get("setnx")
+		if err != nil || string(data) != "a" {
+			t.Errorf("Unexpected value - %q, %v", data, err)
+		}
+	})
+
+	t.Run("CompareAndSwap", func(t *testing.T) {
+		ok, err := kv.CompareAndSwap("cas", []byte("a"), []byte("b"))
+		if err != nil || ok {
+			t.Fatalf("Unexpected result swapping missing key - %t, %v", ok, err)
+		}
+
+		err = kv.Set("cas", []byte("a"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		ok, err = kv.CompareAndSwap("cas", []byte("a"), []byte("b"))
+		if err != nil || !ok {
+			t.Fatalf("Unexpected result swapping matching key - %t, %v", ok, err)
+		}
+
+		ok, err = kv.CompareAndSwap("cas", []byte("a"), []byte("c"))
+		if err != nil || ok {
+			t.Fatalf("Unexpected result swapping stale key - %t, %v", ok, err)
+		}
+
+		data, err := kv.Get("cas")
+		if err != nil || string(data) != "b" {
+			t.Errorf("Unexpected value - %q, %v", data, err)
+		}
+	})
+
+	t.Run("Incr", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := kv.Incr("counter", 2)
+				if err != nil {
+					t.Errorf("Unexpected error incrementing key - %s", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		n, err := kv.Incr("counter", -1)
+		if err != nil || n != 19 {
+			t.Errorf("Unexpected result incrementing key - %d, %v", n, err)
+		}
+
+		_, err = kv.Incr("setnx", 1)
+		if !errors.Is(err, ErrNotInteger) {
+			t.Errorf("Unexpected error incrementing non integer key - %v", err)
+		}
+	})
+}
+
+func TestNew(t *testing.T) {
+	kv := newHashmap(t)
+
+	tt := []struct {
+		name string
+		new  func() error
+	}{
+		{name: "Sweeper Missing KV", new: func() error {
+			_, err := NewSweeper(SweeperConfig{Interval: time.Second})
+			return err
+		}},
+		{name: "Sweeper Missing Interval", new: func() error {
+			_, err := NewSweeper(SweeperConfig{KV: kv})
+			return err
+		}},
+		{name: "Redis Missing Pool", new: func() error {
+			_, err := NewRedis(RedisConfig{KV: kv})
+			return err
+		}},
+		{name: "NATS Missing Conn", new: func() error {
+			_, err := NewNATS(NATSConfig{KV: kv, Bucket: "tarmac"})
+			return err
+		}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.new()
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("Unexpected error - got %v, expected %s", err, ErrInvalidConfig)
+			}
+		})
+	}
+}
+
+func TestSweeper(t *testing.T) {
+	kv := newHashmap(t)
+	s, err := NewSweeper(SweeperConfig{KV: kv, Interval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Unexpected error creating sweeper - %s", err)
+	}
+	err = s.Setup()
+	if err != nil {
+		t.Fatalf("Unexpected error setting up sweeper - %s", err)
+	}
+	defer s.Close()
+
+	t.Run("Invalid TTL", func(t *testing.T) {
+		err := s.SetWithTTL("invalid", []byte("data"), 0)
+		if !errors.Is(err, ErrInvalidTTL) {
+			t.Errorf("Unexpected error - got %v, expected %s", err, ErrInvalidTTL)
+		}
+	})
+
+	t.Run("Expires", func(t *testing.T) {
+		err := s.SetWithTTL("session", []byte("data"), 50*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		data, err := s.Get("session")
+		if err != nil || string(data) != "data" {
+			t.Fatalf("Unexpected result fetching key before expiring - %q, %v", data, err)
+		}
+
+		keys, err := s.Keys()
+		if err != nil {
+			t.Fatalf("Unexpected error fetching keys - %s", err)
+		}
+		if len(keys) != 1 || keys[0] != "session" {
+			t.Errorf("Unexpected keys - %v", keys)
+		}
+
+		time.Sleep(60 * time.Millisecond)
+		_, err = s.Get("session")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected error fetching expired key - %v", err)
+		}
+
+		// Wait for a sweep to remove the key from the wrapped KV store
+		time.Sleep(50 * time.Millisecond)
+		keys, err = kv.Keys()
+		if err != nil {
+			t.Fatalf("Unexpected error fetching keys - %s", err)
+		}
+		if len(keys) != 0 {
+			t.Errorf("Unexpected keys after sweep - %v", keys)
+		}
+	})
+
+	t.Run("Set Clears TTL", func(t *testing.T) {
+		err := s.SetWithTTL("persisted", []byte("data"), 50*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		err = s.Set("persisted", []byte("data"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		_, err = s.Get("persisted")
+		if err != nil {
+			t.Errorf("Unexpected error fetching key without ttl - %s", err)
+		}
+	})
+
+	t.Run("Shared Expiration", func(t *testing.T) {
+		// Expirations stored within the KV store are swept by other Sweepers
+		other, err := NewSweeper(SweeperConfig{KV: kv, Interval: time.Hour})
+		if err != nil {
+			t.Fatalf("Unexpected error creating sweeper - %s", err)
+		}
+
+		err = other.SetWithTTL("shared", []byte("data"), 10*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		// Expired keys are hidden before any sweep of either Sweeper
+		time.Sleep(15 * time.Millisecond)
+		_, err = s.Get("shared")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected error fetching key expired by another sweeper - %v", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		err := s.SetWithTTL("deleted", []byte("data"), time.Hour)
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		err = s.Delete("deleted")
+		if err != nil {
+			t.Fatalf("Unexpected error deleting key - %s", err)
+		}
+
+		_, err = kv.Get(ExpiryPrefix + "deleted")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected expiration remaining after delete - %v", err)
+		}
+	})
+
+	t.Run("Set without Expiration", func(t *testing.T) {
+		err := s.Set("plain", []byte("data"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		_, err = kv.Get(ExpiryPrefix + "plain")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected expiration of key set without ttl - %v", err)
+		}
+	})
+
+	t.Run("Overwritten by Another Sweeper", func(t *testing.T) {
+		other, err := NewSweeper(SweeperConfig{KV: kv, Interval: time.Hour})
+		if err != nil {
+			t.Fatalf("Unexpected error creating sweeper - %s", err)
+		}
+
+		err = s.SetWithTTL("overwritten", []byte("data"), 30*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		err = other.Set("overwritten", []byte("new data"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		data, err := s.Get("overwritten")
+		if err != nil || string(data) != "new data" {
+			t.Errorf("Unexpected result fetching key stored again without ttl - %q, %v", data, err)
+		}
+
+		_, err = kv.Get(ExpiryPrefix + "overwritten")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected expiration remaining after sweep - %v", err)
+		}
+	})
+
+	t.Run("Concurrent Expirations", func(t *testing.T) {
+		db := newHashmap(t)
+		sweepers := make([]*Sweeper, 4)
+		for i := range sweepers {
+			sweepers[i], err = NewSweeper(SweeperConfig{KV: db, Interval: time.Hour})
+			if err != nil {
+				t.Fatalf("Unexpected error creating sweeper - %s", err)
+			}
+		}
+
+		// Expirations stored concurrently by every Sweeper are swept by any of them
+		var wg sync.WaitGroup
+		for i, sw := range sweepers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := range 25 {
+					err := sw.SetWithTTL(fmt.Sprintf("key-%d-%d", i, n), []byte("data"), 10*time.Millisecond)
+					if err != nil {
+						t.Errorf("Unexpected error setting key - %s", err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		time.Sleep(20 * time.Millisecond)
+		err := sweepers[0].Sweep()
+		if err != nil {
+			t.Fatalf("Unexpected error sweeping - %s", err)
+		}
+
+		keys, err := db.Keys()
+		if err != nil || len(keys) != 0 {
+			t.Errorf("Unexpected keys after sweep - %v, %v", keys, err)
+		}
+	})
+
+	t.Run("Sweep on Setup", func(t *testing.T) {
+		db := newHashmap(t)
+		err := db.Set("orphan", []byte("data"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+		err = db.Set(ExpiryPrefix+"orphan", []byte("0:"+checksum([]byte("data"))))
+		if err != nil {
+			t.Fatalf("Unexpected error setting expiration - %s", err)
+		}
+
+		r, err := NewSweeper(SweeperConfig{KV: db, Interval: time.Hour})
+		if err != nil {
+			t.Fatalf("Unexpected error creating sweeper - %s", err)
+		}
+		err = r.Setup()
+		if err != nil {
+			t.Fatalf("Unexpected error setting up sweeper - %s", err)
+		}
+		defer r.Close()
+
+		_, err = db.Get("orphan")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected error fetching key expired before setup - %v", err)
+		}
+	})
+}
+
+func TestNATS(t *testing.T) {
+	ns, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("Unable to create nats server - %s", err)
+	}
+	go ns.Start()
+	defer ns.Shutdown()
+	if !ns.ReadyForConnections(10 * time.Second) {
+		t.Fatalf("NATS server not ready for connections")
+	}
+
+	nc, err := natsgo.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("Unable to connect to nats server - %s", err)
+	}
+
+	// Create the bucket without per-message TTLs, as an existing bucket would be
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Unable to create jetstream context - %s", err)
+	}
+	bucket, err := js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{Bucket: "tarmac"})
+	if err != nil {
+		t.Fatalf("Unable to create bucket - %s", err)
+	}
+
+	db, err := nats.Dial(nats.Config{URL: ns.ClientURL(), Bucket: "tarmac"})
+	if err != nil {
+		t.Fatalf("Unable to connect to nats kv - %s", err)
+	}
+
+	t.Run("TTL Disabled", func(t *testing.T) {
+		disabled, err := NewNATS(NATSConfig{KV: db, Conn: nc, Bucket: "tarmac"})
+		if err != nil {
+			t.Fatalf("Unexpected error creating nats wrapper - %s", err)
+		}
+
+		err = disabled.Setup()
+		if err != nil {
+			t.Fatalf("Unexpected error setting up nats wrapper - %s", err)
+		}
+
+		err = disabled.SetWithTTL("session", []byte("data"), time.Second)
+		if !errors.Is(err, ErrNotSupported) {
+			t.Errorf("Unexpected error setting key with ttl - %v", err)
+		}
+
+		_, err = disabled.SetNX("session", []byte("data"), time.Second)
+		if !errors.Is(err, ErrNotSupported) {
+			t.Errorf("Unexpected error setting key with ttl - %v", err)
+		}
+
+		info, err := js.Stream(context.Background(), "KV_tarmac")
+		if err != nil || info.CachedInfo().Config.AllowMsgTTL {
+			t.Errorf("Unexpected message ttls enabled without EnableTTL - %v", err)
+		}
+	})
+
+	kv, err := NewNATS(NATSConfig{KV: db, Conn: nc, Bucket: "tarmac", EnableTTL: true})
+	if err != nil {
+		t.Fatalf("Unexpected error creating nats wrapper - %s", err)
+	}
+	defer kv.Close()
+
+	err = kv.Setup()
+	if err != nil {
+		t.Fatalf("Unexpected error setting up nats wrapper - %s", err)
+	}
+
+	err = kv.SetWithTTL("session", []byte("data"), time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error setting key - %s", err)
+	}
+
+	entry, err := bucket.Get(context.Background(), "session")
+	if err != nil || string(entry.Value()) != "data" {
+		t.Fatalf("Unexpected result fetching key before expiring - %v", err)
+	}
+
+	time.Sleep(2 * time.Second)
+	_, err = bucket.Get(context.Background(), "session")
+	if !errors.Is(err, jetstream.ErrKeyNotFound) {
+		t.Errorf("Unexpected error fetching expired key - %v", err)
+	}
+
+	t.Run("SetNX with TTL", func(t *testing.T) {
+		ok, err := kv.SetNX("lease", []byte("data"), time.Second)
+		if err != nil || !ok {
+			t.Fatalf("Unexpected result setting key - %t, %v", ok, err)
+		}
+
+		time.Sleep(2 * time.Second)
+		ok, err = kv.SetNX("lease", []byte("data"), time.Second)
+		if err != nil || !ok {
+			t.Errorf("Unexpected result setting expired key - %t, %v", ok, err)
+		}
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		err := kv.SetWithTTL("ttl", []byte("data"), time.Minute)
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+		ttl, err := kv.TTL("ttl")
+		if err != nil || ttl <= 50*time.Second || ttl > time.Minute {
+			t.Errorf("Unexpected ttl of key - %s, %v", ttl, err)
+		}
+
+		err = kv.Set("ttl", []byte("data"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+		ttl, err = kv.TTL("ttl")
+		if err != nil || ttl != 0 {
+			t.Errorf("Unexpected ttl of key without ttl - %s, %v", ttl, err)
+		}
+
+		err = kv.Delete("ttl")
+		if err != nil {
+			t.Fatalf("Unexpected error deleting key - %s", err)
+		}
+		_, err = kv.TTL("ttl")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected error fetching ttl of deleted key - %v", err)
+		}
+	})
+
+	testAtomic(t, kv)
+}
+
+func TestMinVersion(t *testing.T) {
+	tc := map[string]bool{
+		"2.11.0":       true,
+		"2.12.3":       true,
+		"v2.11.1":      true,
+		"3.0.0":        true,
+		"2.10.24":      false,
+		"1.12.0":       false,
+		"2.11.0-beta1": true,
+		"":             false,
+		"invalid":      false,
+	}
+
+	for v, expected := range tc {
+		if minVersion(v, 2, 11) != expected {
+			t.Errorf("Unexpected result for version %q - expected %t", v, expected)
+		}
+	}
+}
+
+func TestRedis(t *testing.T) {
+	db, err := hordredis.Dial(hordredis.Config{Server: "redis:6379"})
+	if err != nil {
+		t.Fatalf("Unable to connect to redis - %s", err)
+	}
+
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", "redis:6379")
+		},
+	}
+
+	kv, err := NewRedis(RedisConfig{KV: db, Pool: pool})
+	if err != nil {
+		t.Fatalf("Unexpected error creating redis wrapper - %s", err)
+	}
+	defer kv.Close()
+
+	err = kv.Setup()
+	if err != nil {
+		t.Fatalf("Unexpected error setting up redis wrapper - %s", err)
+	}
+
+	err = kv.SetWithTTL("session", []byte("data"), 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error setting key - %s", err)
+	}
+
+	data, err := kv.Get("session")
+	if err != nil || string(data) != "data" {
+		t.Fatalf("Unexpected result fetching key before expiring - %q, %v", data, err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	_, err = kv.Get("session")
+	if err == nil {
+		t.Errorf("Expected error fetching expired key")
+	}
+
+	testAtomic(t, kv)
+
+	t.Run("Scan", func(t *testing.T) {
+		for _, key := range []string{"scan:a*", "scan:b", "scan:c", "scanned"} {
+			err := kv.Set(key, []byte("data"))
+			if err != nil {
+				t.Fatalf("Unexpected error setting key - %s", err)
+			}
+		}
+
+		var keys []string
+		var cursor string
+		for {
+			page, next, err := kv.Scan("scan:", cursor, 1)
+			if err != nil {
+				t.Fatalf("Unexpected error scanning keys - %s", err)
+			}
+			keys = append(keys, page...)
+			cursor = next
+			if cursor == "" {
+				break
+			}
+		}
+		sort.Strings(keys)
+		if strings.Join(keys, ",") != "scan:a*,scan:b,scan:c" {
+			t.Errorf("Unexpected keys scanned - %v", keys)
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		testBatch(t, kv)
+	})
+}
+
+// testBatch runs the batch operations of kv against the batch:a and batch:b keys.
+func testBatch(t *testing.T, kv hord.Database) {
+	t.Helper()
+
+	errs := SetMany(kv, []Entry{{Key: "batch:a", Data: []byte("a")}, {Key: "batch:b", Data: []byte("b")}, {Key: ""}})
+	if errs[0] != nil || errs[1] != nil || errs[2] == nil {
+		t.Fatalf("Unexpected results setting keys - %v", errs)
+	}
+
+	data, errs := GetMany(kv, []string{"batch:a", "batch:missing", "batch:b"})
+	if errs[0] != nil || !errors.Is(errs[1], hord.ErrNil) || errs[2] != nil {
+		t.Fatalf("Unexpected results fetching keys - %v", errs)
+	}
+	if string(data[0]) != "a" || len(data[1]) != 0 || string(data[2]) != "b" {
+		t.Errorf("Unexpected data fetched - %q", data)
+	}
+
+	errs = DeleteMany(kv, []string{"batch:a", "batch:b"})
+	if errs[0] != nil || errs[1] != nil {
+		t.Fatalf("Unexpected results deleting keys - %v", errs)
+	}
+
+	_, errs = GetMany(kv, []string{"batch:a"})
+	if !errors.Is(errs[0], hord.ErrNil) {
+		t.Errorf("Unexpected result fetching deleted key - %v", errs[0])
+	}
+}
+
+func TestBatch(t *testing.T) {
+	testBatch(t, newHashmap(t))
+}
+
+func TestNamespace(t *testing.T) {
+	_, err := NewNamespace(NamespaceConfig{})
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Unexpected error creating namespace without kv - %v", err)
+	}
+	_, err = NewNamespace(NamespaceConfig{KV: newHashmap(t), Prefix: ReservedPrefix + "ns/"})
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Unexpected error creating namespace with reserved prefix - %v", err)
+	}
+
+	db, err := NewLocker(LockerConfig{KV: newHashmap(t)})
+	if err != nil {
+		t.Fatalf("Unexpected error creating locker - %s", err)
+	}
+	err = db.Set("shared", []byte("data"))
+	if err != nil {
+		t.Fatalf("Unexpected error setting key - %s", err)
+	}
+
+	a, err := NewNamespace(NamespaceConfig{KV: db, Prefix: "service/a/"})
+	if err != nil {
+		t.Fatalf("Unexpected error creating namespace - %s", err)
+	}
+	b, err := NewNamespace(NamespaceConfig{KV: db, Prefix: "service/b/"})
+	if err != nil {
+		t.Fatalf("Unexpected error creating namespace - %s", err)
+	}
+
+	t.Run("Isolation", func(t *testing.T) {
+		err := a.Set("key", []byte("a"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		_, err = b.Get("key")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected result fetching key of another namespace - %v", err)
+		}
+
+		data, err := db.Get("service/a/key")
+		if err != nil || string(data) != "a" {
+			t.Errorf("Unexpected prefixed key - %q, %v", data, err)
+		}
+
+		keys, err := a.Keys()
+		if err != nil || strings.Join(keys, ",") != "key" {
+			t.Errorf("Unexpected keys listed - %v, %v", keys, err)
+		}
+
+		keys, _, err = ScanKeys(b, "", "", 0)
+		if err != nil || len(keys) != 0 {
+			t.Errorf("Unexpected keys scanned - %v, %v", keys, err)
+		}
+	})
+
+	t.Run("Empty Key", func(t *testing.T) {
+		_, err := a.Get("")
+		if !errors.Is(err, hord.ErrInvalidKey) {
+			t.Errorf("Unexpected error fetching empty key - %v", err)
+		}
+	})
+
+	t.Run("Reserved Keys", func(t *testing.T) {
+		err := db.Set(ExpiryPrefix+"shared", []byte("0"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		unprefixed, err := NewNamespace(NamespaceConfig{KV: db})
+		if err != nil {
+			t.Fatalf("Unexpected error creating namespace - %s", err)
+		}
+
+		data, err := unprefixed.Get("shared")
+		if err != nil || string(data) != "data" {
+			t.Errorf("Unexpected unprefixed key - %q, %v", data, err)
+		}
+
+		_, err = unprefixed.Get(ExpiryPrefix + "shared")
+		if !errors.Is(err, hord.ErrInvalidKey) {
+			t.Errorf("Unexpected error fetching reserved key - %v", err)
+		}
+		err = unprefixed.Set(ReservedPrefix+"leader:task", []byte("data"))
+		if !errors.Is(err, hord.ErrInvalidKey) {
+			t.Errorf("Unexpected error setting reserved key - %v", err)
+		}
+		_, err = unprefixed.SetNX(ReservedPrefix+"leader:task", []byte("data"), 0)
+		if !errors.Is(err, hord.ErrInvalidKey) {
+			t.Errorf("Unexpected error setting reserved key - %v", err)
+		}
+		errs := unprefixed.DeleteMany([]string{ExpiryPrefix + "shared"})
+		if !errors.Is(errs[0], hord.ErrInvalidKey) {
+			t.Errorf("Unexpected error deleting reserved key - %v", errs[0])
+		}
+
+		// Keys of a prefixed namespace cannot reach the reserved keys, so any key is permitted
+		err = a.Set(ReservedPrefix+"leader:task", []byte("data"))
+		if err != nil {
+			t.Errorf("Unexpected error setting key beginning with %s within namespace - %s", ReservedPrefix, err)
+		}
+		keys, err := a.Keys()
+		if err != nil || !slices.Contains(keys, ReservedPrefix+"leader:task") {
+			t.Errorf("Unexpected keys listed within namespace - %v, %v", keys, err)
+		}
+		err = a.Delete(ReservedPrefix + "leader:task")
+		if err != nil {
+			t.Errorf("Unexpected error deleting key within namespace - %s", err)
+		}
+		_, err = db.Get(ReservedPrefix + "leader:task")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected reserved key stored through namespace - %v", err)
+		}
+
+		keys, err = unprefixed.Keys()
+		if err != nil || slices.Contains(keys, ExpiryPrefix+"shared") || !slices.Contains(keys, "shared") {
+			t.Errorf("Unexpected keys listed - %v, %v", keys, err)
+		}
+		keys, _, err = unprefixed.Scan("tarmac", "", 0)
+		if err != nil || len(keys) != 0 {
+			t.Errorf("Unexpected keys scanned - %v, %v", keys, err)
+		}
+	})
+
+	t.Run("Not Supported", func(t *testing.T) {
+		plain, err := NewNamespace(NamespaceConfig{KV: newHashmap(t), Prefix: "p/"})
+		if err != nil {
+			t.Fatalf("Unexpected error creating namespace - %s", err)
+		}
+
+		_, err = plain.Incr("counter", 1)
+		if !errors.Is(err, ErrNotSupported) {
+			t.Errorf("Unexpected error incrementing key - %v", err)
+		}
+		err = plain.SetWithTTL("key", []byte("data"), time.Minute)
+		if !errors.Is(err, ErrNotSupported) {
+			t.Errorf("Unexpected error setting key with ttl - %v", err)
+		}
+	})
+
+	testAtomic(t, a)
+	testBatch(t, a)
+}
+
+func TestEncryptor(t *testing.T) {
+	keys := map[string][]byte{
+		"old": []byte("0123456789abcdef"),
+		"new": []byte("0123456789abcdef0123456789abcdef"),
+	}
+
+	cases := []struct {
+		name string
+		cfg  EncryptorConfig
+	}{
+		{"Missing KV", EncryptorConfig{Keys: keys, KeyID: "new"}},
+		{"Missing Key ID", EncryptorConfig{KV: newHashmap(t), Keys: keys, KeyID: "missing"}},
+		{"Invalid Key", EncryptorConfig{KV: newHashmap(t), Keys: map[string][]byte{"bad": []byte("short")}, KeyID: "bad"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewEncryptor(tc.cfg)
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("Unexpected error creating encryptor - %v", err)
+			}
+		})
+	}
+
+	db, err := NewLocker(LockerConfig{KV: newHashmap(t)})
+	if err != nil {
+		t.Fatalf("Unexpected error creating locker - %s", err)
+	}
+	old, err := NewEncryptor(EncryptorConfig{KV: db, Keys: map[string][]byte{"old": keys["old"]}, KeyID: "old"})
+	if err != nil {
+		t.Fatalf("Unexpected error creating encryptor - %s", err)
+	}
+	e, err := NewEncryptor(EncryptorConfig{KV: db, Keys: keys, KeyID: "new"})
+	if err != nil {
+		t.Fatalf("Unexpected error creating encryptor - %s", err)
+	}
+
+	t.Run("Round Trip", func(t *testing.T) {
+		err := e.Set("key", []byte("secret"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		raw, err := db.Get("key")
+		if err != nil || strings.Contains(string(raw), "secret") {
+			t.Errorf("Unexpected value stored - %q, %v", raw, err)
+		}
+
+		data, err := e.Get("key")
+		if err != nil || string(data) != "secret" {
+			t.Errorf("Unexpected value fetched - %q, %v", data, err)
+		}
+	})
+
+	t.Run("Moved Value", func(t *testing.T) {
+		raw, err := db.Get("key")
+		if err != nil {
+			t.Fatalf("Unexpected error fetching key - %s", err)
+		}
+		err = db.Set("moved", raw)
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		_, err = e.Get("moved")
+		if !errors.Is(err, ErrDecrypt) {
+			t.Errorf("Unexpected error fetching moved value - %v", err)
+		}
+	})
+
+	t.Run("Unknown Key", func(t *testing.T) {
+		_, err := old.Get("key")
+		if !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("Unexpected error fetching value encrypted with an unknown key - %v", err)
+		}
+	})
+
+	t.Run("Reencrypt", func(t *testing.T) {
+		err := db.Set("plain", []byte("legacy"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+		err = old.Set("rotated", []byte("value"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		data, err := e.Get("plain")
+		if err != nil || string(data) != "legacy" {
+			t.Errorf("Unexpected plaintext value fetched - %q, %v", data, err)
+		}
+
+		for key, want := range map[string]bool{"plain": true, "rotated": true, "key": false, "missing": false} {
+			ok, err := e.Reencrypt(key)
+			if err != nil || ok != want {
+				t.Errorf("Unexpected result re-encrypting key %s - %t, %v", key, ok, err)
+			}
+		}
+
+		_, err = old.Get("rotated")
+		if !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("Unexpected error fetching re-encrypted value with the old key - %v", err)
+		}
+		for key, want := range map[string]string{"plain": "legacy", "rotated": "value"} {
+			data, err := e.Get(key)
+			if err != nil || string(data) != want {
+				t.Errorf("Unexpected value of re-encrypted key %s - %q, %v", key, data, err)
+			}
+		}
+	})
+
+	t.Run("Reencrypt Keeps TTL", func(t *testing.T) {
+		s, err := NewSweeper(SweeperConfig{KV: newHashmap(t), Interval: time.Minute})
+		if err != nil {
+			t.Fatalf("Unexpected error creating sweeper - %s", err)
+		}
+		err = s.SetWithTTL("session", []byte("data"), time.Hour)
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		e, err := NewEncryptor(EncryptorConfig{KV: s, Keys: keys, KeyID: "new"})
+		if err != nil {
+			t.Fatalf("Unexpected error creating encryptor - %s", err)
+		}
+		ok, err := e.Reencrypt("session")
+		if err != nil || !ok {
+			t.Fatalf("Unexpected result re-encrypting key - %t, %v", ok, err)
+		}
+
+		ttl, err := e.TTL("session")
+		if err != nil || ttl <= 59*time.Minute {
+			t.Errorf("Unexpected ttl of re-encrypted key - %s, %v", ttl, err)
+		}
+	})
+
+	t.Run("Not Supported", func(t *testing.T) {
+		plain, err := NewEncryptor(EncryptorConfig{KV: newHashmap(t), Keys: keys, KeyID: "new"})
+		if err != nil {
+			t.Fatalf("Unexpected error creating encryptor - %s", err)
+		}
+
+		_, err = plain.Incr("counter", 1)
+		if !errors.Is(err, ErrNotSupported) {
+			t.Errorf("Unexpected error incrementing key - %v", err)
+		}
+	})
+
+	testAtomic(t, e)
+	testBatch(t, e)
+}
+
+func TestCache(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  CacheConfig
+	}{
+		{"Missing KV", CacheConfig{Size: 1, TTL: time.Minute}},
+		{"Missing Size", CacheConfig{KV: newHashmap(t), TTL: time.Minute}},
+		{"Missing TTL", CacheConfig{KV: newHashmap(t), Size: 1}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewCache(tc.cfg)
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("Unexpected error creating cache - %v", err)
+			}
+		})
+	}
+
+	db, err := NewLocker(LockerConfig{KV: newHashmap(t)})
+	if err != nil {
+		t.Fatalf("Unexpected error creating locker - %s", err)
+	}
+
+	var mu sync.Mutex
+	var hits, misses int
+	var invalidate func(string)
+	stopped := false
+	c, err := NewCache(CacheConfig{
+		KV:   db,
+		Size: 2,
+		TTL:  time.Minute,
+		Watch: func(fn func(string)) (func(), error) {
+			invalidate = fn
+			return func() { stopped = true }, nil
+		},
+		OnLookup: func(hit bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			if hit {
+				hits++
+				return
+			}
+			misses++
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating cache - %s", err)
+	}
+	err = c.Setup()
+	if err != nil {
+		t.Fatalf("Unexpected error setting up cache - %s", err)
+	}
+
+	lookups := func(t *testing.T, wantHits, wantMisses int) {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+		if hits != wantHits || misses != wantMisses {
+			t.Errorf("Unexpected lookups - %d hits, %d misses, want %d hits, %d misses", hits, misses, wantHits, wantMisses)
+		}
+		hits, misses = 0, 0
+	}
+
+	t.Run("Read Through", func(t *testing.T) {
+		err := c.Set("key", []byte("one"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		for range 3 {
+			data, err := c.Get("key")
+			if err != nil || string(data) != "one" {
+				t.Errorf("Unexpected value fetched - %q, %v", data, err)
+			}
+		}
+		lookups(t, 2, 1)
+
+		_, err = c.Get("missing")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected error fetching missing key - %v", err)
+		}
+		lookups(t, 0, 1)
+	})
+
+	t.Run("Invalidate on Write", func(t *testing.T) {
+		err := c.Set("key", []byte("two"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+		data, err := c.Get("key")
+		if err != nil || string(data) != "two" {
+			t.Errorf("Unexpected value fetched after set - %q, %v", data, err)
+		}
+
+		n, err := c.Incr("counter", 1)
+		if err != nil || n != 1 {
+			t.Fatalf("Unexpected result incrementing key - %d, %v", n, err)
+		}
+		_, _ = c.Get("counter")
+		_, err = c.Incr("counter", 1)
+		if err != nil {
+			t.Fatalf("Unexpected error incrementing key - %s", err)
+		}
+		data, err = c.Get("counter")
+		if err != nil || string(data) != "2" {
+			t.Errorf("Unexpected value fetched after incr - %q, %v", data, err)
+		}
+
+		err = c.Delete("key")
+		if err != nil {
+			t.Fatalf("Unexpected error deleting key - %s", err)
+		}
+		_, err = c.Get("key")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected error fetching deleted key - %v", err)
+		}
+		lookups(t, 0, 4)
+	})
+
+	t.Run("Watch", func(t *testing.T) {
+		err := c.Set("watched", []byte("local"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+		_, _ = c.Get("watched")
+
+		// Modify the key without the cache, as another process would
+		err = db.Set("watched", []byte("remote"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+		data, _ := c.Get("watched")
+		if string(data) != "local" {
+			t.Errorf("Unexpected value fetched before invalidation - %q", data)
+		}
+
+		invalidate("watched")
+		data, err = c.Get("watched")
+		if err != nil || string(data) != "remote" {
+			t.Errorf("Unexpected value fetched after invalidation - %q, %v", data, err)
+		}
+		lookups(t, 1, 2)
+	})
+
+	t.Run("Eviction", func(t *testing.T) {
+		for _, key := range []string{"a", "b", "c"} {
+			err := c.Set(key, []byte(key))
+			if err != nil {
+				t.Fatalf("Unexpected error setting key - %s", err)
+			}
+		}
+
+		_, _ = c.Get("a")
+		_, _ = c.Get("b")
+		_, _ = c.Get("a")
+		_, _ = c.Get("c")
+		lookups(t, 1, 3)
+
+		// b is the least recently used key, so it was evicted by c
+		_, _ = c.Get("a")
+		_, _ = c.Get("b")
+		lookups(t, 1, 1)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		short, err := NewCache(CacheConfig{KV: db, Size: 10, TTL: 20 * time.Millisecond})
+		if err != nil {
+			t.Fatalf("Unexpected error creating cache - %s", err)
+		}
+		_, _ = short.Get("a")
+
+		err = db.Set("a", []byte("changed"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		data, err := short.Get("a")
+		if err != nil || string(data) != "changed" {
+			t.Errorf("Unexpected value fetched after expiry - %q, %v", data, err)
+		}
+	})
+
+	t.Run("Key Expiry", func(t *testing.T) {
+		sweeper, err := NewSweeper(SweeperConfig{KV: newHashmap(t), Interval: time.Hour})
+		if err != nil {
+			t.Fatalf("Unexpected error creating sweeper - %s", err)
+		}
+		expiring, err := NewCache(CacheConfig{KV: sweeper, Size: 10, TTL: time.Hour})
+		if err != nil {
+			t.Fatalf("Unexpected error creating cache - %s", err)
+		}
+
+		for _, get := range []func(string) ([]byte, error){
+			expiring.Get,
+			func(key string) ([]byte, error) {
+				data, errs := expiring.GetMany([]string{key})
+				return data[0], errs[0]
+			},
+		} {
+			err = expiring.SetWithTTL("session", []byte("data"), 30*time.Millisecond)
+			if err != nil {
+				t.Fatalf("Unexpected error setting key - %s", err)
+			}
+
+			data, err := get("session")
+			if err != nil || string(data) != "data" {
+				t.Fatalf("Unexpected value fetched before expiry - %q, %v", data, err)
+			}
+
+			// The key is cached no longer than its TTL, though the cache TTL has not elapsed
+			time.Sleep(50 * time.Millisecond)
+			_, err = get("session")
+			if !errors.Is(err, hord.ErrNil) {
+				t.Errorf("Unexpected error fetching expired key - %v", err)
+			}
+		}
+	})
+
+	t.Run("Get Many", func(t *testing.T) {
+		_ = c.Set("a", []byte("a"))
+		_, _ = c.Get("a")
+		lookups(t, 0, 1)
+
+		data, errs := c.GetMany([]string{"a", "c", "missing"})
+		if string(data[0]) != "a" || string(data[1]) != "c" || errs[0] != nil || errs[1] != nil {
+			t.Errorf("Unexpected values fetched - %q, %v", data, errs)
+		}
+		if !errors.Is(errs[2], hord.ErrNil) {
+			t.Errorf("Unexpected error fetching missing key - %v", errs[2])
+		}
+		lookups(t, 1, 2)
+	})
+
+	testAtomic(t, c)
+	testBatch(t, c)
+
+	c.Close()
+	if !stopped {
+		t.Errorf("Expected watch to be stopped on close")
+	}
+}
+
+func TestScanKeys(t *testing.T) {
+	kv := newHashmap(t)
+	for _, key := range []string{"b2", "a1", "b1", "b3"} {
+		err := kv.Set(key, []byte("data"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+	}
+
+	tt := []struct {
+		name   string
+		prefix string
+		cursor string
+		limit  int
+		keys   string
+		next   string
+	}{
+		{name: "All Keys", keys: "a1,b1,b2,b3"},
+		{name: "Prefix", prefix: "b", keys: "b1,b2,b3"},
+		{name: "First Page", prefix: "b", limit: 2, keys: "b1,b2", next: "b2"},
+		{name: "Last Page", prefix: "b", cursor: "b2", limit: 2, keys: "b3"},
+		{name: "Exact Page", limit: 4, keys: "a1,b1,b2,b3"},
+		{name: "No Match", prefix: "c", keys: ""},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			keys, next, err := ScanKeys(kv, tc.prefix, tc.cursor, tc.limit)
+			if err != nil {
+				t.Fatalf("Unexpected error scanning keys - %s", err)
+			}
+			if strings.Join(keys, ",") != tc.keys || next != tc.next {
+				t.Errorf("Unexpected result - got %v %q, expected %s %q", keys, next, tc.keys, tc.next)
+			}
+		})
+	}
+
+	t.Run("Native Scan through Wrappers", func(t *testing.T) {
+		native := &nativeScanner{Database: kv}
+		sweeper, err := NewSweeper(SweeperConfig{KV: native, Interval: time.Hour})
+		if err != nil {
+			t.Fatalf("Unexpected error creating sweeper - %s", err)
+		}
+		locker, err := NewLocker(LockerConfig{KV: sweeper})
+		if err != nil {
+			t.Fatalf("Unexpected error creating locker - %s", err)
+		}
+
+		err = kv.Set(ExpiryPrefix+"b1", []byte("0"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+		defer func() { _ = kv.Delete(ExpiryPrefix + "b1") }()
+
+		keys, _, err := ScanKeys(locker, "", "", 0)
+		if err != nil || strings.Join(keys, ",") != "a1,b1,b2,b3" {
+			t.Errorf("Unexpected keys - %v, %v", keys, err)
+		}
+		if native.scans != 1 {
+			t.Errorf("Expected native scan of wrapped KV store, got %d scans", native.scans)
+		}
+	})
+}
+
+// nativeScanner counts the scans of a KV store listing keys with ScanKeys.
+type nativeScanner struct {
+	hord.Database
+	scans int
+}
+
+func (n *nativeScanner) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	n.scans++
+	return ScanKeys(n.Database, prefix, cursor, limit)
+}
+
+func TestLocker(t *testing.T) {
+	_, err := NewLocker(LockerConfig{})
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Unexpected error creating locker without kv - %v", err)
+	}
+
+	kv, err := NewLocker(LockerConfig{KV: newHashmap(t)})
+	if err != nil {
+		t.Fatalf("Unexpected error creating locker - %s", err)
+	}
+
+	testAtomic(t, kv)
+
+	t.Run("TTL Not Supported", func(t *testing.T) {
+		_, err := kv.SetNX("lease", []byte("data"), time.Minute)
+		if !errors.Is(err, ErrNotSupported) {
+			t.Errorf("Unexpected error setting key with ttl - %v", err)
+		}
+
+		err = kv.SetWithTTL("lease", []byte("data"), time.Minute)
+		if !errors.Is(err, ErrNotSupported) {
+			t.Errorf("Unexpected error setting key with ttl - %v", err)
+		}
+	})
+
+	t.Run("SetNX with TTL", func(t *testing.T) {
+		sweeper, err := NewSweeper(SweeperConfig{KV: newHashmap(t), Interval: time.Hour})
+		if err != nil {
+			t.Fatalf("Unexpected error creating sweeper - %s", err)
+		}
+
+		kv, err := NewLocker(LockerConfig{KV: sweeper})
+		if err != nil {
+			t.Fatalf("Unexpected error creating locker - %s", err)
+		}
+
+		ok, err := kv.SetNX("lease", []byte("data"), 50*time.Millisecond)
+		if err != nil || !ok {
+			t.Fatalf("Unexpected result setting key - %t, %v", ok, err)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		ok, err = kv.SetNX("lease", []byte("data"), 50*time.Millisecond)
+		if err != nil || !ok {
+			t.Errorf("Unexpected result setting expired key - %t, %v", ok, err)
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package kvext
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/tarmac-project/hord"
+)
+
+// lockStripes is the number of locks keys are distributed across by a Locker.
+const lockStripes = 64
+
+// LockerConfig provides the configuration options of a Locker.
+type LockerConfig struct {
+	// KV is the KV store to wrap.
+	KV hord.Database
+}
+
+// Locker wraps a KV store without native atomic operations, implementing them by serializing the operations on each
+// key with host-side locks.
+//
+// Locks are held within the process, so operations are atomic only between callers sharing the Locker. Callers
+// sharing the KV store through other processes may still interleave their writes.
+type Locker struct {
+	hord.Database
+
+	// locks serialize operations on the keys hashed to each lock.
+	locks [lockStripes]sync.Mutex
+}
+
+// NewLocker returns a Locker initialized with LockerConfig.
+func NewLocker(cfg LockerConfig) (*Locker, error) {
+	if cfg.KV == nil {
+		return nil, fmt.Errorf("%w - kv cannot be nil", ErrInvalidConfig)
+	}
+	return &Locker{Database: cfg.KV}, nil
+}
+
+// lock acquires the lock of the key, returning a function releasing it.
+func (l *Locker) lock(key string) func() {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	m := &l.locks[h.Sum32()%lockStripes]
+	m.Lock()
+	return m.Unlock
+}
+
+// Set stores data under key once no atomic operation on the key is in progress.
+func (l *Locker) Set(key string, data []byte) error {
+	defer l.lock(key)()
+	return l.Database.Set(key, data)
+}
+
+// SetWithTTL stores data under key once no atomic operation on the key is in progress. The wrapped KV store must
+// implement TTLSetter.
+func (l *Locker) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	t, ok := l.Database.(TTLSetter)
+	if !ok {
+		return fmt.Errorf("%w - ttl", ErrNotSupported)
+	}
+
+	defer l.lock(key)()
+	return t.SetWithTTL(key, data, ttl)
+}
+
+// TTL returns the remaining TTL of key from the wrapped KV store, which must implement TTLGetter.
+func (l *Locker) TTL(key string) (time.Duration, error) {
+	t, ok := l.Database.(TTLGetter)
+	if !ok {
+		return 0, fmt.Errorf("%w - ttl", ErrNotSupported)
+	}
+	return t.TTL(key)
+}
+
+// Delete removes the key once no atomic operation on the key is in progress.
+func (l *Locker) Delete(key string) error {
+	defer l.lock(key)()
+	return l.Database.Delete(key)
+}
+
+// CompareAndSwap stores data under key if the current value of the key equals old.
+func (l *Locker) CompareAndSwap(key string, old, data []byte) (bool, error) {
+	if err := hord.ValidData(data); err != nil {
+		return false, err
+	}
+
+	defer l.lock(key)()
+
+	current, err := l.Database.Get(key)
+	if errors.Is(err, hord.ErrNil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(current, old) {
+		return false, nil
+	}
+
+	err = l.Database.Set(key, data)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetNX stores data under key if the key does not exist, expiring it after ttl when ttl is greater than zero. A TTL
+// requires the wrapped KV store to implement TTLSetter.
+func (l *Locker) SetNX(key string, data []byte, ttl time.Duration) (bool, error) {
+	if err := hord.ValidData(data); err != nil {
+		return false, err
+	}
+
+	t, ok := l.Database.(TTLSetter)
+	if ttl > 0 && !ok {
+		return false, fmt.Errorf("%w - ttl", ErrNotSupported)
+	}
+
+	defer l.lock(key)()
+
+	_, err := l.Database.Get(key)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, hord.ErrNil) {
+		return false, err
+	}
+
+	if ttl > 0 {
+		err = t.SetWithTTL(key, data, ttl)
+	} else {
+		err = l.Database.Set(key, data)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Incr adds delta to the integer stored under key, returning the new value. Missing keys are treated as zero.
+func (l *Locker) Incr(key string, delta int64) (int64, error) {
+	defer l.lock(key)()
+
+	current, err := l.Database.Get(key)
+	if errors.Is(err, hord.ErrNil) {
+		current = nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	n, err := increment(current, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	err = l.Database.Set(key, formatInt(n))
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Scan lists keys using ScanKeys on the wrapped KV store.
+func (l *Locker) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	return ScanKeys(l.Database, prefix, cursor, limit)
+}
@@ -0,0 +1,210 @@
+package kvext
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tarmac-project/hord"
+)
+
+// NamespaceConfig provides the configuration options of a Namespace.
+type NamespaceConfig struct {
+	// KV is the KV store to wrap.
+	KV hord.Database
+
+	// Prefix is prepended to every key stored through the Namespace. When empty, callers share the unprefixed keys of
+	// the wrapped KV store, other than the reserved keys. Prefixes must not begin with ReservedPrefix.
+	Prefix string
+}
+
+// Namespace wraps a KV store, isolating its callers within the keys beginning with a prefix. Keys are prefixed before
+// reaching the wrapped KV store and listed without the prefix, so callers are unaware of the Namespace.
+//
+// Within the unprefixed namespace, keys beginning with ReservedPrefix are rejected with hord.ErrInvalidKey and omitted
+// from listings, so callers cannot reach the keys Tarmac stores for its own use. Prefixed keys never begin with
+// ReservedPrefix, so callers of a prefixed namespace may use any key.
+//
+// Namespace implements every interface of this package, returning ErrNotSupported when the wrapped KV store does not.
+type Namespace struct {
+	hord.Database
+
+	// prefix is prepended to every key.
+	prefix string
+}
+
+// NewNamespace returns a Namespace initialized with NamespaceConfig.
+func NewNamespace(cfg NamespaceConfig) (*Namespace, error) {
+	if cfg.KV == nil {
+		return nil, fmt.Errorf("%w - kv cannot be nil", ErrInvalidConfig)
+	}
+	if reserved(cfg.Prefix) {
+		return nil, fmt.Errorf("%w - prefix cannot begin with %s", ErrInvalidConfig, ReservedPrefix)
+	}
+	return &Namespace{Database: cfg.KV, prefix: cfg.Prefix}, nil
+}
+
+// Get fetches the data stored under key within the namespace.
+func (n *Namespace) Get(key string) ([]byte, error) {
+	if err := n.valid(key); err != nil {
+		return nil, err
+	}
+	return n.Database.Get(n.prefix + key)
+}
+
+// Set stores data under key within the namespace.
+func (n *Namespace) Set(key string, data []byte) error {
+	if err := n.valid(key); err != nil {
+		return err
+	}
+	return n.Database.Set(n.prefix+key, data)
+}
+
+// Delete removes key from the namespace.
+func (n *Namespace) Delete(key string) error {
+	if err := n.valid(key); err != nil {
+		return err
+	}
+	return n.Database.Delete(n.prefix + key)
+}
+
+// Keys lists the keys within the namespace.
+func (n *Namespace) Keys() ([]string, error) {
+	keys, err := n.Database.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if k, ok := strings.CutPrefix(k, n.prefix); ok && !n.reserved(k) {
+			matched = append(matched, k)
+		}
+	}
+	return matched, nil
+}
+
+// SetWithTTL stores data under key within the namespace, expiring the key after ttl. The wrapped KV store must
+// implement TTLSetter.
+func (n *Namespace) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	t, ok := n.Database.(TTLSetter)
+	if !ok {
+		return fmt.Errorf("%w - ttl", ErrNotSupported)
+	}
+	if err := n.valid(key); err != nil {
+		return err
+	}
+	return t.SetWithTTL(n.prefix+key, data, ttl)
+}
+
+// atomic returns the wrapped KV store as an Atomic, validating key.
+func (n *Namespace) atomic(key string) (Atomic, error) {
+	a, ok := n.Database.(Atomic)
+	if !ok {
+		return nil, fmt.Errorf("%w - atomic operations", ErrNotSupported)
+	}
+	if err := n.valid(key); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// CompareAndSwap stores data under key within the namespace if the key currently holds old. The wrapped KV store must
+// implement Atomic.
+func (n *Namespace) CompareAndSwap(key string, old, data []byte) (bool, error) {
+	a, err := n.atomic(key)
+	if err != nil {
+		return false, err
+	}
+	return a.CompareAndSwap(n.prefix+key, old, data)
+}
+
+// SetNX stores data under key within the namespace if the key does not exist. The wrapped KV store must implement
+// Atomic.
+func (n *Namespace) SetNX(key string, data []byte, ttl time.Duration) (bool, error) {
+	a, err := n.atomic(key)
+	if err != nil {
+		return false, err
+	}
+	return a.SetNX(n.prefix+key, data, ttl)
+}
+
+// Incr adds delta to the integer stored under key within the namespace. The wrapped KV store must implement Atomic.
+func (n *Namespace) Incr(key string, delta int64) (int64, error) {
+	a, err := n.atomic(key)
+	if err != nil {
+		return 0, err
+	}
+	return a.Incr(n.prefix+key, delta)
+}
+
+// Scan lists keys within the namespace beginning with prefix, using ScanKeys on the wrapped KV store.
+func (n *Namespace) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	keys, next, err := ScanKeys(n.Database, n.prefix+prefix, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	matched := keys[:0]
+	for _, k := range keys {
+		if k = strings.TrimPrefix(k, n.prefix); !n.reserved(k) {
+			matched = append(matched, k)
+		}
+	}
+	return matched, next, nil
+}
+
+// GetMany fetches the data stored under each key within the namespace, using GetMany on the wrapped KV store.
+func (n *Namespace) GetMany(keys []string) ([][]byte, []error) {
+	return GetMany(n.Database, n.keys(keys))
+}
+
+// SetMany stores each entry within the namespace, using SetMany on the wrapped KV store.
+func (n *Namespace) SetMany(entries []Entry) []error {
+	prefixed := make([]Entry, len(entries))
+	for i, e := range entries {
+		prefixed[i] = Entry{Key: n.key(e.Key), Data: e.Data}
+	}
+	return SetMany(n.Database, prefixed)
+}
+
+// DeleteMany removes each key from the namespace, using DeleteMany on the wrapped KV store.
+func (n *Namespace) DeleteMany(keys []string) []error {
+	return DeleteMany(n.Database, n.keys(keys))
+}
+
+// valid returns hord.ErrInvalidKey if key is invalid or reserved.
+func (n *Namespace) valid(key string) error {
+	if n.reserved(key) {
+		return fmt.Errorf("%w - keys beginning with %s are reserved", hord.ErrInvalidKey, ReservedPrefix)
+	}
+	return hord.ValidKey(key)
+}
+
+// reserved returns true if key is within the unprefixed namespace and begins with ReservedPrefix. Keys within a
+// prefixed namespace cannot reach the reserved keys.
+func (n *Namespace) reserved(key string) bool {
+	return n.prefix == "" && reserved(key)
+}
+
+// reserved returns true if key begins with ReservedPrefix.
+func reserved(key string) bool {
+	return strings.HasPrefix(key, ReservedPrefix)
+}
+
+// key returns key within the namespace. Empty and reserved keys are left empty, so they remain invalid.
+func (n *Namespace) key(key string) string {
+	if key == "" || n.reserved(key) {
+		return ""
+	}
+	return n.prefix + key
+}
+
+// keys returns each of keys within the namespace.
+func (n *Namespace) keys(keys []string) []string {
+	prefixed := make([]string, len(keys))
+	for i, k := range keys {
+		prefixed[i] = n.key(k)
+	}
+	return prefixed
+}
@@ -0,0 +1,317 @@
+package kvext
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/tarmac-project/hord"
+)
+
+// natsTimeout is the maximum duration of a single JetStream request.
+const natsTimeout = 5 * time.Second
+
+// NATSConfig provides the configuration options of a NATS KV store wrapper.
+type NATSConfig struct {
+	// KV is the hord NATS KV store to wrap.
+	KV hord.Database
+
+	// Conn is a connection to the NATS server of KV, used for operations KV does not provide. Conn is closed with the
+	// wrapper.
+	Conn *natsgo.Conn
+
+	// Bucket is the name of the NATS KV bucket used by KV.
+	Bucket string
+
+	// EnableTTL enables per-message TTLs on the stream backing the bucket when they are not already enabled, which
+	// requires NATS Server 2.11 or later. Without per-message TTLs, storing keys with a TTL returns ErrNotSupported.
+	EnableTTL bool
+}
+
+// NATS wraps a hord NATS KV store, extending it with native JetStream operations.
+type NATS struct {
+	hord.Database
+
+	// nc is the connection used for native operations.
+	nc *natsgo.Conn
+
+	// js is the JetStream context of nc.
+	js jetstream.JetStream
+
+	// bucket is the name of the NATS KV bucket.
+	bucket string
+
+	// kv is the JetStream KV bucket, available once Setup is called.
+	kv jetstream.KeyValue
+
+	// enableTTL enables per-message TTLs on the stream during Setup.
+	enableTTL bool
+
+	// ttl is true once Setup finds per-message TTLs enabled on the stream.
+	ttl bool
+}
+
+// NewNATS returns a NATS KV store wrapper initialized with NATSConfig.
+func NewNATS(cfg NATSConfig) (*NATS, error) {
+	if cfg.KV == nil || cfg.Conn == nil {
+		return nil, fmt.Errorf("%w - kv and conn cannot be nil", ErrInvalidConfig)
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("%w - bucket must be defined", ErrInvalidConfig)
+	}
+
+	js, err := jetstream.New(cfg.Conn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create jetstream context - %w", err)
+	}
+	return &NATS{Database: cfg.KV, nc: cfg.Conn, js: js, bucket: cfg.Bucket, enableTTL: cfg.EnableTTL}, nil
+}
+
+// Setup sets up the wrapped KV store, then enables per-message TTLs on the stream backing the bucket if EnableTTL is
+// set. Setup fails when the NATS server does not support per-message TTLs.
+func (n *NATS) Setup() error {
+	err := n.Database.Setup()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	s, err := n.js.Stream(ctx, "KV_"+n.bucket)
+	if err != nil {
+		return fmt.Errorf("unable to find stream of bucket %s - %w", n.bucket, err)
+	}
+
+	cfg := s.CachedInfo().Config
+	n.ttl = cfg.AllowMsgTTL
+	if !n.ttl && n.enableTTL {
+		v := n.nc.ConnectedServerVersion()
+		if !minVersion(v, 2, 11) {
+			return fmt.Errorf("%w - message ttls on bucket %s require nats server 2.11 or later, connected to %s",
+				ErrInvalidConfig, n.bucket, v)
+		}
+
+		cfg.AllowMsgTTL = true
+		s, err = n.js.UpdateStream(ctx, cfg)
+		if err != nil {
+			return fmt.Errorf("unable to enable message ttls on bucket %s - %w", n.bucket, err)
+		}
+
+		// Servers ignoring the setting accept the update without enabling it
+		if !s.CachedInfo().Config.AllowMsgTTL {
+			return fmt.Errorf("unable to enable message ttls on bucket %s - not supported by nats server %s",
+				n.bucket, v)
+		}
+		n.ttl = true
+	}
+
+	n.kv, err = n.js.KeyValue(ctx, n.bucket)
+	if err != nil {
+		return fmt.Errorf("unable to open bucket %s - %w", n.bucket, err)
+	}
+	return nil
+}
+
+// SetWithTTL stores data under key using a JetStream per-message TTL. TTLs are rounded up to whole seconds.
+// ErrNotSupported is returned when per-message TTLs are not enabled on the bucket.
+func (n *NATS) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	err := validTTL(key, data, ttl)
+	if err != nil {
+		return err
+	}
+	if !n.ttl {
+		return fmt.Errorf("%w - message ttls are not enabled on bucket %s", ErrNotSupported, n.bucket)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	_, err = n.js.Publish(ctx, "$KV."+n.bucket+"."+key, data, jetstream.WithMsgTTL(seconds(ttl)))
+	if err != nil {
+		return fmt.Errorf("unable to store key %s - %w", key, err)
+	}
+	return nil
+}
+
+// TTL returns the duration until key expires, using the per-message TTL and timestamp of the latest message of the key.
+func (n *NATS) TTL(key string) (time.Duration, error) {
+	if err := hord.ValidKey(key); err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	s, err := n.js.Stream(ctx, "KV_"+n.bucket)
+	if err != nil {
+		return 0, fmt.Errorf("unable to find stream of bucket %s - %w", n.bucket, err)
+	}
+
+	msg, err := s.GetLastMsgForSubject(ctx, "$KV."+n.bucket+"."+key)
+	if errors.Is(err, jetstream.ErrMsgNotFound) {
+		return 0, hord.ErrNil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unable to fetch key %s - %w", key, err)
+	}
+	if msg.Header.Get("KV-Operation") != "" {
+		// Deleted and purged keys are recorded with an operation header
+		return 0, hord.ErrNil
+	}
+
+	h := msg.Header.Get(jetstream.MsgTTLHeader)
+	if h == "" || h == "never" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(h)
+	if err != nil {
+		s, serr := strconv.ParseInt(h, 10, 64)
+		if serr != nil {
+			return 0, fmt.Errorf("unable to parse ttl %q of key %s - %w", h, key, err)
+		}
+		ttl = time.Duration(s) * time.Second
+	}
+
+	remaining := ttl - time.Since(msg.Time)
+	if remaining <= 0 {
+		return 0, hord.ErrNil
+	}
+	return remaining, nil
+}
+
+// CompareAndSwap stores data under key if the current value of the key equals old, updating the key only if its
+// revision is unchanged since the value was compared.
+func (n *NATS) CompareAndSwap(key string, old, data []byte) (bool, error) {
+	if err := hord.ValidData(data); err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	entry, err := n.kv.Get(ctx, key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to fetch key %s - %w", key, err)
+	}
+	if !bytes.Equal(entry.Value(), old) {
+		return false, nil
+	}
+
+	_, err = n.kv.Update(ctx, key, data, entry.Revision())
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to swap key %s - %w", key, err)
+	}
+	return true, nil
+}
+
+// SetNX stores data under key if the key does not exist, creating the key with a per-message TTL when ttl is greater
+// than zero. TTLs are rounded up to whole seconds, and ErrNotSupported is returned when per-message TTLs are not enabled
+// on the bucket.
+func (n *NATS) SetNX(key string, data []byte, ttl time.Duration) (bool, error) {
+	if err := hord.ValidData(data); err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	var opts []jetstream.KVCreateOpt
+	if ttl > 0 {
+		if !n.ttl {
+			return false, fmt.Errorf("%w - message ttls are not enabled on bucket %s", ErrNotSupported, n.bucket)
+		}
+		opts = append(opts, jetstream.KeyTTL(seconds(ttl)))
+	}
+
+	_, err := n.kv.Create(ctx, key, data, opts...)
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to store key %s - %w", key, err)
+	}
+	return true, nil
+}
+
+// Incr adds delta to the integer stored under key, retrying while the key is modified concurrently.
+func (n *NATS) Incr(key string, delta int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	for {
+		var current []byte
+		var revision uint64
+		entry, err := n.kv.Get(ctx, key)
+		switch {
+		case errors.Is(err, jetstream.ErrKeyNotFound):
+		case err != nil:
+			return 0, fmt.Errorf("unable to fetch key %s - %w", key, err)
+		default:
+			current = entry.Value()
+			revision = entry.Revision()
+		}
+
+		v, err := increment(current, delta)
+		if err != nil {
+			return 0, err
+		}
+
+		if revision == 0 {
+			_, err = n.kv.Create(ctx, key, formatInt(v))
+		} else {
+			_, err = n.kv.Update(ctx, key, formatInt(v), revision)
+		}
+		if errors.Is(err, jetstream.ErrKeyExists) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("unable to increment key %s - %w", key, err)
+		}
+		return v, nil
+	}
+}
+
+// minVersion returns true when the server version v is at least major.minor.
+func minVersion(v string, major, minor int) bool {
+	parts := strings.SplitN(strings.TrimPrefix(v, "v"), ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+
+	vmajor, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	vminor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	return vmajor > major || (vmajor == major && vminor >= minor)
+}
+
+// seconds returns ttl rounded up to whole seconds, the resolution of JetStream per-message TTLs.
+func seconds(ttl time.Duration) time.Duration {
+	if r := ttl % time.Second; r != 0 {
+		ttl += time.Second - r
+	}
+	return ttl
+}
+
+// Close closes the wrapped KV store and the connection.
+func (n *NATS) Close() {
+	n.Database.Close()
+	n.nc.Close()
+}
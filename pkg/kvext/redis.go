@@ -0,0 +1,322 @@
+package kvext
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/tarmac-project/hord"
+)
+
+// RedisConfig provides the configuration options of a Redis KV store wrapper.
+type RedisConfig struct {
+	// KV is the hord Redis KV store to wrap.
+	KV hord.Database
+
+	// Pool is a connection pool to the Redis server of KV, used for operations KV does not provide. Pool is closed
+	// with the wrapper.
+	Pool *redis.Pool
+}
+
+// casScript sets KEYS[1] to ARGV[2] if its current value equals ARGV[1], returning 1 when set.
+var casScript = redis.NewScript(1, `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[2])
+	return 1
+end
+return 0`)
+
+// Redis wraps a hord Redis KV store, extending it with native Redis operations.
+type Redis struct {
+	hord.Database
+
+	// pool is the connection pool used for native operations.
+	pool *redis.Pool
+}
+
+// NewRedis returns a Redis KV store wrapper initialized with RedisConfig.
+func NewRedis(cfg RedisConfig) (*Redis, error) {
+	if cfg.KV == nil || cfg.Pool == nil {
+		return nil, fmt.Errorf("%w - kv and pool cannot be nil", ErrInvalidConfig)
+	}
+	return &Redis{Database: cfg.KV, pool: cfg.Pool}, nil
+}
+
+// SetWithTTL stores data under key using the Redis key expiration.
+func (r *Redis) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	err := validTTL(key, data, ttl)
+	if err != nil {
+		return err
+	}
+
+	c := r.pool.Get()
+	defer c.Close()
+
+	_, err = c.Do("SET", key, data, "PX", ttl.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("unable to store key %s - %w", key, err)
+	}
+	return nil
+}
+
+// TTL returns the duration until key expires using PTTL.
+func (r *Redis) TTL(key string) (time.Duration, error) {
+	if err := hord.ValidKey(key); err != nil {
+		return 0, err
+	}
+
+	c := r.pool.Get()
+	defer c.Close()
+
+	ms, err := redis.Int64(c.Do("PTTL", key))
+	if err != nil {
+		return 0, fmt.Errorf("unable to fetch ttl of key %s - %w", key, err)
+	}
+
+	// PTTL replies -2 for missing keys and -1 for keys without a TTL
+	switch {
+	case ms == -2:
+		return 0, hord.ErrNil
+	case ms < 0:
+		return 0, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// CompareAndSwap stores data under key if the current value of the key equals old, using a Lua script.
+func (r *Redis) CompareAndSwap(key string, old, data []byte) (bool, error) {
+	if err := hord.ValidKey(key); err != nil {
+		return false, err
+	}
+	if err := hord.ValidData(data); err != nil {
+		return false, err
+	}
+
+	c := r.pool.Get()
+	defer c.Close()
+
+	n, err := redis.Int(casScript.Do(c, key, old, data))
+	if err != nil {
+		return false, fmt.Errorf("unable to swap key %s - %w", key, err)
+	}
+	return n == 1, nil
+}
+
+// SetNX stores data under key if the key does not exist, using SET with NX.
+func (r *Redis) SetNX(key string, data []byte, ttl time.Duration) (bool, error) {
+	if err := hord.ValidKey(key); err != nil {
+		return false, err
+	}
+	if err := hord.ValidData(data); err != nil {
+		return false, err
+	}
+
+	args := redis.Args{key, data, "NX"}
+	if ttl > 0 {
+		args = args.Add("PX", ttl.Milliseconds())
+	}
+
+	c := r.pool.Get()
+	defer c.Close()
+
+	reply, err := c.Do("SET", args...)
+	if err != nil {
+		return false, fmt.Errorf("unable to store key %s - %w", key, err)
+	}
+	return reply != nil, nil
+}
+
+// Incr adds delta to the integer stored under key using INCRBY, which keeps any TTL of the key.
+func (r *Redis) Incr(key string, delta int64) (int64, error) {
+	if err := hord.ValidKey(key); err != nil {
+		return 0, err
+	}
+
+	c := r.pool.Get()
+	defer c.Close()
+
+	n, err := redis.Int64(c.Do("INCRBY", key, delta))
+	var rerr redis.Error
+	if errors.As(err, &rerr) {
+		return 0, fmt.Errorf("%w - %s", ErrNotInteger, rerr)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unable to increment key %s - %w", key, err)
+	}
+	return n, nil
+}
+
+// scanCount is the number of keys Redis is hinted to examine per SCAN call when listing keys without a limit.
+const scanCount = 1000
+
+// globEscaper escapes the glob pattern characters of SCAN MATCH patterns.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// Scan lists keys beginning with prefix using SCAN, resuming from the SCAN cursor. SCAN returns keys in batches, so a
+// page may hold slightly more than limit keys, and keys modified during the listing may be listed twice or not at all.
+func (r *Redis) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	if cursor == "" {
+		cursor = "0"
+	}
+	count := limit
+	if count <= 0 {
+		count = scanCount
+	}
+
+	c := r.pool.Get()
+	defer c.Close()
+
+	var keys []string
+	for {
+		values, err := redis.Values(c.Do("SCAN", cursor, "MATCH", globEscaper.Replace(prefix)+"*", "COUNT", count))
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to scan keys - %w", err)
+		}
+		if len(values) != 2 {
+			return nil, "", fmt.Errorf("unable to scan keys - unexpected reply length %d", len(values))
+		}
+
+		cursor, err = redis.String(values[0], nil)
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to scan keys - %w", err)
+		}
+		batch, err := redis.Strings(values[1], nil)
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to scan keys - %w", err)
+		}
+		keys = append(keys, batch...)
+
+		if cursor == "0" {
+			return keys, "", nil
+		}
+		if limit > 0 && len(keys) >= limit {
+			return keys, cursor, nil
+		}
+	}
+}
+
+// GetMany fetches the data stored under each key using a single MGET.
+func (r *Redis) GetMany(keys []string) ([][]byte, []error) {
+	data := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+
+	var valid []int
+	var args redis.Args
+	for i, key := range keys {
+		errs[i] = hord.ValidKey(key)
+		if errs[i] == nil {
+			valid = append(valid, i)
+			args = args.Add(key)
+		}
+	}
+	if len(valid) == 0 {
+		return data, errs
+	}
+
+	c := r.pool.Get()
+	defer c.Close()
+
+	values, err := redis.ByteSlices(c.Do("MGET", args...))
+	if err == nil && len(values) != len(valid) {
+		err = fmt.Errorf("unexpected reply length %d", len(values))
+	}
+	for j, i := range valid {
+		switch {
+		case err != nil:
+			errs[i] = fmt.Errorf("unable to fetch key %s - %w", keys[i], err)
+		case values[j] == nil:
+			errs[i] = hord.ErrNil
+		default:
+			data[i] = values[j]
+		}
+	}
+	return data, errs
+}
+
+// SetMany stores the data of each entry under its key, pipelining a SET per entry.
+func (r *Redis) SetMany(entries []Entry) []error {
+	errs := make([]error, len(entries))
+
+	var valid []int
+	var args []redis.Args
+	for i, e := range entries {
+		errs[i] = hord.ValidKey(e.Key)
+		if errs[i] == nil {
+			errs[i] = hord.ValidData(e.Data)
+		}
+		if errs[i] == nil {
+			valid = append(valid, i)
+			args = append(args, redis.Args{e.Key, e.Data})
+		}
+	}
+
+	c := r.pool.Get()
+	defer c.Close()
+
+	for j, err := range pipeline(c, "SET", args) {
+		if err != nil {
+			errs[valid[j]] = fmt.Errorf("unable to store key %s - %w", entries[valid[j]].Key, err)
+		}
+	}
+	return errs
+}
+
+// DeleteMany removes each key, pipelining a DEL per key.
+func (r *Redis) DeleteMany(keys []string) []error {
+	errs := make([]error, len(keys))
+
+	var valid []int
+	var args []redis.Args
+	for i, key := range keys {
+		errs[i] = hord.ValidKey(key)
+		if errs[i] == nil {
+			valid = append(valid, i)
+			args = append(args, redis.Args{key})
+		}
+	}
+
+	c := r.pool.Get()
+	defer c.Close()
+
+	for j, err := range pipeline(c, "DEL", args) {
+		if err != nil {
+			errs[valid[j]] = fmt.Errorf("unable to delete key %s - %w", keys[valid[j]], err)
+		}
+	}
+	return errs
+}
+
+// pipeline sends cmd once per argument list within a single round trip, returning the error of each command.
+func pipeline(c redis.Conn, cmd string, args []redis.Args) []error {
+	errs := make([]error, len(args))
+	if len(args) == 0 {
+		return errs
+	}
+
+	fail := func(err error) []error {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	for _, a := range args {
+		if err := c.Send(cmd, a...); err != nil {
+			return fail(err)
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return fail(err)
+	}
+	for i := range args {
+		_, errs[i] = c.Receive()
+	}
+	return errs
+}
+
+// Close closes the wrapped KV store and the connection pool.
+func (r *Redis) Close() {
+	r.Database.Close()
+	_ = r.pool.Close()
+}
@@ -0,0 +1,43 @@
+package kvext
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/tarmac-project/hord"
+)
+
+// Scanner is implemented by KV stores able to list keys incrementally using a native scan.
+type Scanner interface {
+	// Scan lists keys beginning with prefix, resuming after cursor. It returns up to limit keys along with the cursor
+	// continuing the listing, which is empty once every key has been listed. When limit is zero or less, every remaining
+	// key is listed. Cursors are opaque and only valid for the KV store returning them.
+	Scan(prefix, cursor string, limit int) ([]string, string, error)
+}
+
+// ScanKeys lists keys of kv beginning with prefix, resuming after cursor. KV stores implementing Scanner are scanned
+// natively; other KV stores list every key with Keys and return them in lexical order, using the last key returned as
+// the cursor.
+func ScanKeys(kv hord.Database, prefix, cursor string, limit int) ([]string, string, error) {
+	if s, ok := kv.(Scanner); ok {
+		return s.Scan(prefix, cursor, limit)
+	}
+
+	keys, err := kv.Keys()
+	if err != nil {
+		return nil, "", err
+	}
+
+	matched := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if strings.HasPrefix(k, prefix) && k > cursor {
+			matched = append(matched, k)
+		}
+	}
+	sort.Strings(matched)
+
+	if limit <= 0 || len(matched) <= limit {
+		return matched, "", nil
+	}
+	return matched[:limit], matched[limit-1], nil
+}
@@ -0,0 +1,340 @@
+package kvext
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tarmac-project/hord"
+)
+
+// ExpiryPrefix prefixes the keys a Sweeper uses to record the expiration of keys. Keys with this prefix are reserved
+// and hidden from Keys.
+const ExpiryPrefix = ReservedPrefix + "expiry:"
+
+// SweeperConfig provides the configuration options of a Sweeper.
+type SweeperConfig struct {
+	// KV is the KV store to wrap.
+	KV hord.Database
+
+	// Interval is the duration between sweeps removing expired keys.
+	Interval time.Duration
+}
+
+// Sweeper wraps a KV store without native key expiration, removing expired keys on an interval.
+//
+// The expiration of each key is stored within the KV store itself under its own key, so expirations persist across
+// restarts and are shared by every Sweeper using the KV store without coordination. Get checks the expiration of the
+// key on every read, hiding expired keys regardless of the Sweeper that stored them, and sweeps list the expirations
+// using ScanKeys to remove the expired keys.
+//
+// An expiration records a hash of the data stored with it, so the expiration no longer applies once the key is stored
+// again with other data, even if the expiration has yet to be cleared.
+type Sweeper struct {
+	hord.Database
+
+	// RWMutex prevents a sweep removing a key while a key is being stored. Stores hold the read lock and sweeps the
+	// write lock.
+	sync.RWMutex
+
+	// interval is the duration between sweeps.
+	interval time.Duration
+
+	// mu protects running.
+	mu sync.Mutex
+
+	// stop stops the sweep loop when closed.
+	stop chan struct{}
+
+	// done is closed once the sweep loop stops.
+	done chan struct{}
+
+	// running is true once the sweep loop is started.
+	running bool
+
+	// once ensures the sweep loop is stopped once.
+	once sync.Once
+}
+
+// NewSweeper returns a Sweeper initialized with SweeperConfig. The Sweeper starts sweeping once Setup is called.
+func NewSweeper(cfg SweeperConfig) (*Sweeper, error) {
+	if cfg.KV == nil {
+		return nil, fmt.Errorf("%w - kv cannot be nil", ErrInvalidConfig)
+	}
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("%w - interval must be greater than zero", ErrInvalidConfig)
+	}
+
+	return &Sweeper{
+		Database: cfg.KV,
+		interval: cfg.Interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Setup sets up the wrapped KV store, removes keys that expired while no Sweeper was running, and starts sweeping.
+func (s *Sweeper) Setup() error {
+	err := s.Database.Setup()
+	if err != nil {
+		return err
+	}
+
+	err = s.Sweep()
+	if err != nil {
+		return fmt.Errorf("unable to sweep expired keys - %w", err)
+	}
+
+	s.mu.Lock()
+	s.running = true
+	s.mu.Unlock()
+
+	go s.run()
+	return nil
+}
+
+// run sweeps expired keys every interval until the Sweeper is closed. Failed sweeps are retried on the next interval.
+func (s *Sweeper) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			_ = s.Sweep()
+		}
+	}
+}
+
+// Sweep removes every expired key with a recorded expiration, along with expirations that no longer apply.
+func (s *Sweeper) Sweep() error {
+	expirations, _, err := ScanKeys(s.Database, ExpiryPrefix, "", 0)
+	if err != nil {
+		return fmt.Errorf("unable to list expirations - %w", err)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, k := range expirations {
+		key, ok := strings.CutPrefix(k, ExpiryPrefix)
+		if !ok {
+			continue
+		}
+
+		err = s.sweepKey(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sweepKey removes the key if it has expired, and its expiration if it no longer applies.
+func (s *Sweeper) sweepKey(key string) error {
+	data, err := s.Database.Get(key)
+	if err != nil && !errors.Is(err, hord.ErrNil) {
+		return fmt.Errorf("unable to fetch key %s - %w", key, err)
+	}
+
+	if err == nil {
+		t, ok, err := s.expiry(key, data)
+		if err != nil {
+			return err
+		}
+		if ok && time.Now().Before(t) {
+			return nil
+		}
+
+		if ok {
+			err = s.Database.Delete(key)
+			if err != nil {
+				return fmt.Errorf("unable to remove expired key %s - %w", key, err)
+			}
+		}
+	}
+
+	// The key has expired, was removed, or was stored again with other data
+	err = s.Database.Delete(ExpiryPrefix + key)
+	if err != nil {
+		return fmt.Errorf("unable to remove expiration of key %s - %w", key, err)
+	}
+	return nil
+}
+
+// expiry returns the stored expiration of the key, and false when the key does not expire or the expiration was
+// recorded for data other than data.
+func (s *Sweeper) expiry(key string, data []byte) (time.Time, bool, error) {
+	b, err := s.Database.Get(ExpiryPrefix + key)
+	if errors.Is(err, hord.ErrNil) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("unable to fetch expiration of key %s - %w", key, err)
+	}
+
+	ts, sum, _ := strings.Cut(string(b), ":")
+	if sum != "" && sum != checksum(data) {
+		return time.Time{}, false, nil
+	}
+
+	n, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		// Treat unreadable expirations as expired so the key is not kept forever
+		return time.Time{}, true, nil
+	}
+	return time.Unix(0, n), true, nil
+}
+
+// checksum returns the hash of data recorded with an expiration.
+func checksum(data []byte) string {
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// Get fetches the data stored under key, returning hord.ErrNil if the key has expired.
+func (s *Sweeper) Get(key string) ([]byte, error) {
+	data, err := s.Database.Get(key)
+	if err != nil {
+		return data, err
+	}
+
+	t, ok, err := s.expiry(key, data)
+	if err != nil {
+		return nil, err
+	}
+	if ok && !time.Now().Before(t) {
+		return nil, hord.ErrNil
+	}
+	return data, nil
+}
+
+// Set stores data under key, clearing any expiration of the key.
+func (s *Sweeper) Set(key string, data []byte) error {
+	s.RLock()
+	defer s.RUnlock()
+
+	err := s.Database.Set(key, data)
+	if err != nil {
+		return err
+	}
+
+	err = s.Database.Delete(ExpiryPrefix + key)
+	if err != nil {
+		return fmt.Errorf("unable to clear expiration of key %s - %w", key, err)
+	}
+	return nil
+}
+
+// SetWithTTL stores data under key, recording its expiration for removal by a sweep.
+func (s *Sweeper) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	err := validTTL(key, data, ttl)
+	if err != nil {
+		return err
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	// Record the expiration first, so a failure cannot leave a key that never expires
+	t := time.Now().Add(ttl)
+	err = s.Database.Set(ExpiryPrefix+key, []byte(strconv.FormatInt(t.UnixNano(), 10)+":"+checksum(data)))
+	if err != nil {
+		return fmt.Errorf("unable to store expiration of key %s - %w", key, err)
+	}
+
+	return s.Database.Set(key, data)
+}
+
+// TTL returns the duration until key expires, or zero if the key does not expire. Expired keys are reported with
+// hord.ErrNil.
+func (s *Sweeper) TTL(key string) (time.Duration, error) {
+	data, err := s.Database.Get(key)
+	if err != nil {
+		return 0, err
+	}
+
+	t, ok, err := s.expiry(key, data)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	ttl := time.Until(t)
+	if ttl <= 0 {
+		return 0, hord.ErrNil
+	}
+	return ttl, nil
+}
+
+// Delete removes the key and its expiration.
+func (s *Sweeper) Delete(key string) error {
+	s.RLock()
+	defer s.RUnlock()
+
+	err := s.Database.Delete(key)
+	if err != nil {
+		return err
+	}
+
+	err = s.Database.Delete(ExpiryPrefix + key)
+	if err != nil {
+		return fmt.Errorf("unable to remove expiration of key %s - %w", key, err)
+	}
+	return nil
+}
+
+// Keys returns the keys within the KV store, excluding the keys recording expirations.
+func (s *Sweeper) Keys() ([]string, error) {
+	keys, err := s.Database.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := keys[:0]
+	for _, k := range keys {
+		if !strings.HasPrefix(k, ExpiryPrefix) {
+			filtered = append(filtered, k)
+		}
+	}
+	return filtered, nil
+}
+
+// Scan lists keys using ScanKeys on the wrapped KV store, excluding the keys recording expirations.
+func (s *Sweeper) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	keys, next, err := ScanKeys(s.Database, prefix, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	filtered := keys[:0]
+	for _, k := range keys {
+		if !strings.HasPrefix(k, ExpiryPrefix) {
+			filtered = append(filtered, k)
+		}
+	}
+	return filtered, next, nil
+}
+
+// Close stops sweeping and closes the wrapped KV store.
+func (s *Sweeper) Close() {
+	s.once.Do(func() {
+		close(s.stop)
+
+		s.mu.Lock()
+		running := s.running
+		s.mu.Unlock()
+		if running {
+			<-s.done
+		}
+	})
+	s.Database.Close()
+}
@@ -0,0 +1,352 @@
+/*
+Package migrate applies ordered SQL schema migrations to a database.
+
+Migrations are files within a directory named with a numeric version and a description, such as
+0001_create_users.up.sql. Files are applied in version order, and each applied version is recorded within the
+tarmac_schema_migrations table so it is never applied again. Files not ending in .up.sql, such as down migrations, are
+ignored.
+
+	// Create a Migrator
+	m, err := migrate.New(migrate.Config{
+		DB:      db,
+		Dialect: "postgres",
+		Dir:     "/migrations",
+	})
+	if err != nil {
+		// do something
+	}
+
+	// Apply pending migrations
+	applied, err := m.Up(ctx)
+	if err != nil {
+		// do something
+	}
+
+Migrations are applied while holding a lock, so concurrent instances sharing a database wait for each other rather than
+applying the same migration twice. PostgreSQL and MySQL use advisory locks, which are released if the instance holding
+them fails. SQLite applies all pending migrations within a single immediate transaction.
+
+With PostgreSQL and SQLite, each migration is applied within a transaction alongside its version record. MySQL commits
+schema changes implicitly, so a failed MySQL migration may be partially applied.
+*/
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Table is the table recording applied migration versions.
+const Table = "tarmac_schema_migrations"
+
+// mysqlLockTimeout is the number of seconds MySQL waits for the migration lock before checking the context again.
+const mysqlLockTimeout = 5
+
+// filePattern matches up-migration file names, capturing the version and name.
+var filePattern = regexp.MustCompile(`^(\d+)_(.+)\.up\.sql$`)
+
+// ErrUnknownDialect is returned when the database dialect is not supported.
+var ErrUnknownDialect = errors.New("unknown sql dialect")
+
+// Config provides the configuration options for a Migrator.
+type Config struct {
+	// DB is the database to migrate.
+	DB *sql.DB
+
+	// Dialect is the SQL dialect of the database (Options: mysql, postgres, sqlite).
+	Dialect string
+
+	// Dir is the directory containing migration files.
+	Dir string
+}
+
+// Migration is a single versioned schema migration.
+type Migration struct {
+	// Version orders migrations and identifies them within the migrations table.
+	Version int64
+
+	// Name describes the migration and is taken from the file name.
+	Name string
+
+	// Path is the path of the migration file.
+	Path string
+}
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	// cfg is the Migrator configuration.
+	cfg Config
+}
+
+// New returns a Migrator initialized with Config.
+func New(cfg Config) (*Migrator, error) {
+	if cfg.DB == nil {
+		return nil, errors.New("DB cannot be nil")
+	}
+
+	if cfg.Dir == "" {
+		return nil, errors.New("Dir cannot be empty")
+	}
+
+	switch cfg.Dialect {
+	case "mysql", "postgres", "sqlite":
+	default:
+		return nil, fmt.Errorf("%w - %s", ErrUnknownDialect, cfg.Dialect)
+	}
+
+	return &Migrator{cfg: cfg}, nil
+}
+
+// Load returns the migrations within dir ordered by version.
+func Load(dir string) ([]Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read migrations directory - %w", err)
+	}
+
+	seen := make(map[int64]string)
+	var migrations []Migration
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		m := filePattern.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+
+		v, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version of migration %s - %w", e.Name(), err)
+		}
+
+		if f, ok := seen[v]; ok {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", f, e.Name(), v)
+		}
+		seen[v] = e.Name()
+
+		migrations = append(migrations, Migration{Version: v, Name: m[2], Path: filepath.Join(dir, e.Name())})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Up applies all pending migrations in version order, returning the migrations applied. Up blocks while another
+// instance holds the migration lock.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	migrations, err := Load(m.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pin a single connection, as locks are held by the connection that acquired them
+	conn, err := m.cfg.DB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to database - %w", err)
+	}
+	defer conn.Close()
+
+	if m.cfg.Dialect == "sqlite" {
+		return m.upSQLite(ctx, conn, migrations)
+	}
+
+	err = m.lock(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	defer m.unlock(conn)
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mg := range migrations {
+		if applied[mg.Version] {
+			continue
+		}
+
+		err := m.apply(ctx, conn, mg)
+		if err != nil {
+			return done, err
+		}
+		done = append(done, mg)
+	}
+
+	return done, nil
+}
+
+// upSQLite applies pending migrations within a single immediate transaction, which holds the SQLite write lock until
+// all migrations are applied.
+func (m *Migrator) upSQLite(ctx context.Context, conn *sql.Conn, migrations []Migration) ([]Migration, error) {
+	_, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE")
+	if err != nil {
+		return nil, fmt.Errorf("unable to acquire migration lock - %w", err)
+	}
+
+	done, err := func() ([]Migration, error) {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+
+		var done []Migration
+		for _, mg := range migrations {
+			if applied[mg.Version] {
+				continue
+			}
+
+			err := m.exec(ctx, conn, mg)
+			if err != nil {
+				return nil, err
+			}
+			done = append(done, mg)
+		}
+		return done, nil
+	}()
+	if err != nil {
+		_, _ = conn.ExecContext(context.Background(), "ROLLBACK")
+		return nil, err
+	}
+
+	_, err = conn.ExecContext(ctx, "COMMIT")
+	if err != nil {
+		return nil, fmt.Errorf("unable to commit migrations - %w", err)
+	}
+	return done, nil
+}
+
+// applied creates the migrations table if needed and returns the versions already applied.
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]bool, error) {
+	_, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+Table+
+		" (version BIGINT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL,"+
+		" applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create migrations table - %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM "+Table)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query applied migrations - %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]bool)
+	for rows.Next() {
+		var v int64
+		err := rows.Scan(&v)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read applied migrations - %w", err)
+		}
+		applied[v] = true
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read applied migrations - %w", err)
+	}
+	return applied, nil
+}
+
+// apply applies a migration and records its version within a transaction.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mg Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to begin migration %d - %w", mg.Version, err)
+	}
+
+	err = m.exec(ctx, tx, mg)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("unable to commit migration %d - %w", mg.Version, err)
+	}
+	return nil
+}
+
+// execer is implemented by both sql.Conn and sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// exec executes the migration file and records its version.
+func (m *Migrator) exec(ctx context.Context, db execer, mg Migration) error {
+	b, err := os.ReadFile(mg.Path)
+	if err != nil {
+		return fmt.Errorf("unable to read migration %d - %w", mg.Version, err)
+	}
+
+	_, err = db.ExecContext(ctx, string(b))
+	if err != nil {
+		return fmt.Errorf("unable to apply migration %d %s - %w", mg.Version, mg.Name, err)
+	}
+
+	q := "INSERT INTO " + Table + " (version, name) VALUES (?, ?)"
+	if m.cfg.Dialect == "postgres" {
+		q = "INSERT INTO " + Table + " (version, name) VALUES ($1, $2)"
+	}
+
+	_, err = db.ExecContext(ctx, q, mg.Version, mg.Name)
+	if err != nil {
+		return fmt.Errorf("unable to record migration %d - %w", mg.Version, err)
+	}
+	return nil
+}
+
+// lock acquires the advisory migration lock, waiting until it is available or the context is canceled.
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) error {
+	if m.cfg.Dialect == "postgres" {
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", Table)
+		if err != nil {
+			return fmt.Errorf("unable to acquire migration lock - %w", err)
+		}
+		return nil
+	}
+
+	for {
+		var ok sql.NullInt64
+		err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", Table, mysqlLockTimeout).Scan(&ok)
+		if err != nil {
+			return fmt.Errorf("unable to acquire migration lock - %w", err)
+		}
+		if ok.Int64 == 1 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("unable to acquire migration lock - %w", ctx.Err())
+		default:
+		}
+	}
+}
+
+// unlock releases the advisory migration lock.
+func (m *Migrator) unlock(conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if m.cfg.Dialect == "postgres" {
+		_, _ = conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext($1))", Table)
+		return
+	}
+	_, _ = conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", Table)
+}
@@ -0,0 +1,225 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	// Import SQLite Driver.
+	_ "modernc.org/sqlite"
+)
+
+func writeMigrations(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, body := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0600)
+		if err != nil {
+			t.Fatalf("Unable to write migration %s - %s", name, err)
+		}
+	}
+}
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "tarmac.db")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatalf("Unable to open database - %s", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestNew(t *testing.T) {
+	db := openDB(t)
+
+	tt := []struct {
+		name string
+		cfg  Config
+		err  bool
+	}{
+		{name: "Valid", cfg: Config{DB: db, Dialect: "sqlite", Dir: "/migrations"}},
+		{name: "Missing DB", cfg: Config{Dialect: "sqlite", Dir: "/migrations"}, err: true},
+		{name: "Missing Dir", cfg: Config{DB: db, Dialect: "sqlite"}, err: true},
+		{name: "Unknown Dialect", cfg: Config{DB: db, Dialect: "oracle", Dir: "/migrations"}, err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(tc.cfg)
+			if (err != nil) != tc.err {
+				t.Errorf("Unexpected error result - %v", err)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("Ordered", func(t *testing.T) {
+		dir := t.TempDir()
+		writeMigrations(t, dir, map[string]string{
+			"10_add_index.up.sql":        "",
+			"2_add_email.up.sql":         "",
+			"0001_create_users.up.sql":   "",
+			"0001_create_users.down.sql": "",
+			"README.md":                  "",
+		})
+
+		migrations, err := Load(dir)
+		if err != nil {
+			t.Fatalf("Unexpected error loading migrations - %s", err)
+		}
+
+		expected := []Migration{
+			{Version: 1, Name: "create_users", Path: filepath.Join(dir, "0001_create_users.up.sql")},
+			{Version: 2, Name: "add_email", Path: filepath.Join(dir, "2_add_email.up.sql")},
+			{Version: 10, Name: "add_index", Path: filepath.Join(dir, "10_add_index.up.sql")},
+		}
+		if len(migrations) != len(expected) {
+			t.Fatalf("Unexpected migrations - %+v", migrations)
+		}
+		for i := range expected {
+			if migrations[i] != expected[i] {
+				t.Errorf("Unexpected migration - got %+v, expected %+v", migrations[i], expected[i])
+			}
+		}
+	})
+
+	t.Run("Duplicate Version", func(t *testing.T) {
+		dir := t.TempDir()
+		writeMigrations(t, dir, map[string]string{
+			"1_create_users.up.sql":   "",
+			"01_create_orders.up.sql": "",
+		})
+
+		_, err := Load(dir)
+		if err == nil {
+			t.Errorf("Expected error loading migrations with duplicate versions")
+		}
+	})
+
+	t.Run("Missing Directory", func(t *testing.T) {
+		_, err := Load(filepath.Join(t.TempDir(), "missing"))
+		if err == nil {
+			t.Errorf("Expected error loading migrations from missing directory")
+		}
+	})
+}
+
+func TestUp(t *testing.T) {
+	t.Run("Apply Pending", func(t *testing.T) {
+		db := openDB(t)
+		dir := t.TempDir()
+		writeMigrations(t, dir, map[string]string{
+			"1_create_users.up.sql": "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);",
+			"2_seed_users.up.sql":   "INSERT INTO users (name) VALUES ('a'); INSERT INTO users (name) VALUES ('b');",
+		})
+
+		m, err := New(Config{DB: db, Dialect: "sqlite", Dir: dir})
+		if err != nil {
+			t.Fatalf("Unexpected error creating migrator - %s", err)
+		}
+
+		applied, err := m.Up(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error applying migrations - %s", err)
+		}
+		if len(applied) != 2 {
+			t.Errorf("Unexpected number of applied migrations - %d", len(applied))
+		}
+
+		// Add a new migration and apply again
+		writeMigrations(t, dir, map[string]string{
+			"3_add_email.up.sql": "ALTER TABLE users ADD COLUMN email TEXT;",
+		})
+
+		applied, err = m.Up(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error applying migrations - %s", err)
+		}
+		if len(applied) != 1 || applied[0].Version != 3 {
+			t.Errorf("Unexpected applied migrations - %+v", applied)
+		}
+
+		var count int
+		err = db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+		if err != nil {
+			t.Fatalf("Unexpected error querying users - %s", err)
+		}
+		if count != 2 {
+			t.Errorf("Unexpected number of users - got %d, expected 2", count)
+		}
+
+		err = db.QueryRow("SELECT COUNT(*) FROM " + Table).Scan(&count)
+		if err != nil {
+			t.Fatalf("Unexpected error querying migrations table - %s", err)
+		}
+		if count != 3 {
+			t.Errorf("Unexpected number of recorded migrations - got %d, expected 3", count)
+		}
+	})
+
+	t.Run("Failed Migration", func(t *testing.T) {
+		db := openDB(t)
+		dir := t.TempDir()
+		writeMigrations(t, dir, map[string]string{
+			"1_create_users.up.sql": "CREATE TABLE users (id INTEGER PRIMARY KEY);",
+			"2_broken.up.sql":       "CREATE TABLE orders (id INTEGER PRIMARY KEY); INSERT INTO missing VALUES (1);",
+		})
+
+		m, err := New(Config{DB: db, Dialect: "sqlite", Dir: dir})
+		if err != nil {
+			t.Fatalf("Unexpected error creating migrator - %s", err)
+		}
+
+		_, err = m.Up(context.Background())
+		if err == nil {
+			t.Fatalf("Expected error applying broken migration")
+		}
+
+		// No partial changes should remain
+		var count int
+		err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name IN ('users', 'orders', ?)", Table).
+			Scan(&count)
+		if err != nil {
+			t.Fatalf("Unexpected error querying schema - %s", err)
+		}
+		if count != 0 {
+			t.Errorf("Unexpected tables remaining after failed migration - %d", count)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		db := openDB(t)
+		dir := t.TempDir()
+		writeMigrations(t, dir, map[string]string{
+			"1_create_users.up.sql": "CREATE TABLE users (id INTEGER PRIMARY KEY);",
+		})
+
+		m, err := New(Config{DB: db, Dialect: "sqlite", Dir: dir})
+		if err != nil {
+			t.Fatalf("Unexpected error creating migrator - %s", err)
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 5)
+		for range 5 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := m.Up(context.Background())
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Errorf("Unexpected error applying migrations concurrently - %s", err)
+			}
+		}
+	})
+}
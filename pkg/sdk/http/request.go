@@ -0,0 +1,168 @@
+package http
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/valyala/fastjson"
+)
+
+// Request is the HTTP request envelope Tarmac passes to functions on HTTP routes configured with the json envelope.
+type Request struct {
+	// Method is the HTTP method of the inbound request.
+	Method string
+
+	// Path is the escaped URL path of the inbound request.
+	Path string
+
+	// Query is the raw, encoded query string of the inbound request without the leading "?".
+	Query string
+
+	// Headers are the HTTP headers of the inbound request.
+	Headers map[string][]string
+
+	// RemoteAddr is the network address of the client that sent the request.
+	RemoteAddr string
+
+	// TLS provides details of the TLS connection; this field is nil for plain-text HTTP requests.
+	TLS *TLS
+
+	// Body is the HTTP body of the inbound request.
+	Body []byte
+
+	// Params are the named and catch-all parameters captured from the request path by the route.
+	Params map[string]string
+}
+
+// TLS provides details of the TLS connection a Request was received on.
+type TLS struct {
+	// Version is the negotiated TLS version (i.e. "TLS 1.3").
+	Version string
+
+	// CipherSuite is the name of the negotiated cipher suite.
+	CipherSuite string
+
+	// ServerName is the server name requested by the client via SNI.
+	ServerName string
+
+	// PeerCertificates are the certificates presented by the client, populated when using mutual-TLS.
+	PeerCertificates []Certificate
+}
+
+// Certificate provides details of a certificate presented by the client.
+type Certificate struct {
+	// Subject is the distinguished name of the certificate subject.
+	Subject string
+
+	// Issuer is the distinguished name of the certificate issuer.
+	Issuer string
+
+	// SerialNumber is the serial number of the certificate.
+	SerialNumber string
+
+	// DNSNames are the DNS subject alternative names of the certificate.
+	DNSNames []string
+}
+
+// ParseRequest parses the payload received by a function handler into a Request.
+func ParseRequest(payload []byte) (Request, error) {
+	rq := Request{}
+
+	// Parse request JSON
+	v, err := fastjson.ParseBytes(payload)
+	if err != nil {
+		return rq, fmt.Errorf("unable to parse request - %w", err)
+	}
+
+	rq.Method = string(v.GetStringBytes("method"))
+	rq.Path = string(v.GetStringBytes("path"))
+	rq.Query = string(v.GetStringBytes("query"))
+	rq.RemoteAddr = string(v.GetStringBytes("remote_addr"))
+
+	// Extract Headers
+	rq.Headers = make(map[string][]string)
+	vMap := v.GetObject("headers")
+	if vMap != nil {
+		vMap.Visit(func(k []byte, val *fastjson.Value) {
+			for _, h := range val.GetArray() {
+				rq.Headers[string(k)] = append(rq.Headers[string(k)], string(h.GetStringBytes()))
+			}
+		})
+	}
+
+	// Extract Path Parameters
+	rq.Params = make(map[string]string)
+	pMap := v.GetObject("params")
+	if pMap != nil {
+		pMap.Visit(func(k []byte, val *fastjson.Value) {
+			rq.Params[string(k)] = string(val.GetStringBytes())
+		})
+	}
+
+	// Extract TLS details
+	if t := v.Get("tls"); t != nil && t.Type() == fastjson.TypeObject {
+		rq.TLS = &TLS{
+			Version:     string(t.GetStringBytes("version")),
+			CipherSuite: string(t.GetStringBytes("cipher_suite")),
+			ServerName:  string(t.GetStringBytes("server_name")),
+		}
+		for _, c := range t.GetArray("peer_certificates") {
+			cert := Certificate{
+				Subject:      string(c.GetStringBytes("subject")),
+				Issuer:       string(c.GetStringBytes("issuer")),
+				SerialNumber: string(c.GetStringBytes("serial_number")),
+			}
+			for _, n := range c.GetArray("dns_names") {
+				cert.DNSNames = append(cert.DNSNames, string(n.GetStringBytes()))
+			}
+			rq.TLS.PeerCertificates = append(rq.TLS.PeerCertificates, cert)
+		}
+	}
+
+	// Extract and Decode Payload
+	rq.Body, err = base64.StdEncoding.DecodeString(string(v.GetStringBytes("body")))
+	if err != nil {
+		return rq, fmt.Errorf("unable to decode request body - %w", err)
+	}
+
+	return rq, nil
+}
+
+// Header returns the first value of the named HTTP header, ignoring case. An empty string is returned if the
+// header is not present.
+func (rq Request) Header(key string) string {
+	for k, v := range rq.Headers {
+		if strings.EqualFold(k, key) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// MarshalResponse creates the HTTP response envelope returned from function handlers on HTTP routes configured
+// with the json envelope. The StatusCode, Headers, and Body of the Response are returned to the HTTP client.
+func MarshalResponse(rsp Response) ([]byte, error) {
+	if rsp.StatusCode != 0 && (rsp.StatusCode < 100 || rsp.StatusCode > 999) {
+		return []byte(""), errors.New("invalid status code specified")
+	}
+
+	var a fastjson.Arena
+	o := a.NewObject()
+	o.Set("code", a.NewNumberInt(rsp.StatusCode))
+
+	// Build headers
+	h := a.NewObject()
+	for k, v := range rsp.Headers {
+		arr := a.NewArray()
+		arr.SetArrayItem(0, a.NewString(v))
+		h.Set(k, arr)
+	}
+	o.Set("headers", h)
+
+	// Encode HTTP Payload
+	o.Set("body", a.NewString(base64.StdEncoding.EncodeToString(rsp.Body)))
+
+	return o.MarshalTo(nil), nil
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/pquerna/ffjson/ffjson"
+)
+
+func TestParseRequest(t *testing.T) {
+	t.Run("Full Request", func(t *testing.T) {
+		payload := []byte(`{"method":"POST","path":"/users/123","query":"a=1","remote_addr":"127.0.0.1:5555",` +
+			`"headers":{"Content-Type":["application/json"],"Accept":["text/plain","application/json"]},` +
+			`"tls":{"version":"TLS 1.3","cipher_suite":"TLS_AES_128_GCM_SHA256","server_name":"example.com",` +
+			`"peer_certificates":[{"subject":"CN=client","issuer":"CN=ca","serial_number":"42",` +
+			`"dns_names":["client.example.com"]}]},"params":{"id":"123"},"body":"VGVzdGluZyAxIDIgMw=="}`)
+
+		rq, err := ParseRequest(payload)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing request - %s", err)
+		}
+
+		if rq.Method != "POST" || rq.Path != "/users/123" || rq.Query != "a=1" || rq.RemoteAddr != "127.0.0.1:5555" {
+			t.Errorf("Unexpected request values - %+v", rq)
+		}
+
+		if string(rq.Body) != "Testing 1 2 3" {
+			t.Errorf("Unexpected body - %s", rq.Body)
+		}
+
+		if len(rq.Headers["Accept"]) != 2 || rq.Header("content-type") != "application/json" {
+			t.Errorf("Unexpected headers - %+v", rq.Headers)
+		}
+
+		if rq.Params["id"] != "123" {
+			t.Errorf("Unexpected params - %+v", rq.Params)
+		}
+
+		if rq.Header("missing") != "" {
+			t.Errorf("Unexpected value for missing header")
+		}
+
+		if rq.TLS == nil || rq.TLS.Version != "TLS 1.3" || len(rq.TLS.PeerCertificates) != 1 ||
+			rq.TLS.PeerCertificates[0].DNSNames[0] != "client.example.com" {
+			t.Errorf("Unexpected TLS details - %+v", rq.TLS)
+		}
+	})
+
+	t.Run("Plain Text Request", func(t *testing.T) {
+		rq, err := ParseRequest([]byte(`{"method":"GET","path":"/","headers":{},"body":""}`))
+		if err != nil {
+			t.Fatalf("Unexpected error parsing request - %s", err)
+		}
+		if rq.TLS != nil || len(rq.Body) != 0 {
+			t.Errorf("Unexpected request values - %+v", rq)
+		}
+	})
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		_, err := ParseRequest([]byte(`not json`))
+		if err == nil {
+			t.Errorf("Expected error parsing invalid JSON")
+		}
+	})
+
+	t.Run("Invalid Body", func(t *testing.T) {
+		_, err := ParseRequest([]byte(`{"method":"GET","body":"THIS IS NOT BASE64"}`))
+		if err == nil {
+			t.Errorf("Expected error parsing invalid body")
+		}
+	})
+}
+
+func TestMarshalResponse(t *testing.T) {
+	t.Run("Valid Response", func(t *testing.T) {
+		b, err := MarshalResponse(Response{
+			StatusCode: 201,
+			Headers:    map[string]string{"Content-Type": "text/plain"},
+			Body:       []byte("Testing 1 2 3"),
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error marshaling response - %s", err)
+		}
+
+		var rsp struct {
+			Code    int                 `json:"code"`
+			Headers map[string][]string `json:"headers"`
+			Body    string              `json:"body"`
+		}
+		err = ffjson.Unmarshal(b, &rsp)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing response JSON - %s", err)
+		}
+
+		if rsp.Code != 201 || rsp.Body != "VGVzdGluZyAxIDIgMw==" || rsp.Headers["Content-Type"][0] != "text/plain" {
+			t.Errorf("Unexpected response - %s", b)
+		}
+	})
+
+	t.Run("Invalid Status Code", func(t *testing.T) {
+		_, err := MarshalResponse(Response{StatusCode: 42})
+		if err == nil {
+			t.Errorf("Expected error with invalid status code")
+		}
+	})
+}
@@ -9,14 +9,17 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/valyala/fastjson"
 )
 
 // KV provides a simple interface for Tarmac Functions to store key:value data using supported KV datastores.
 type KV struct {
-	namespace string
-	hostCall  func(string, string, string, []byte) ([]byte, error)
+	namespace  string
+	dataSource string
+	hostCall   func(string, string, string, []byte) ([]byte, error)
 }
 
 // Config provides users with the ability to specify namespaces, function handlers and other key information required to execute the
@@ -26,6 +29,10 @@ type Config struct {
 	// Users can provide an alternative namespace by specifying this field.
 	Namespace string
 
+	// DataSource selects a named KV store configured within Tarmac. When empty, the KV store bound to the function
+	// within tarmac.json is used, falling back to the default KV store.
+	DataSource string
+
 	// HostCall is used internally for host callbacks. This is mainly here for testing.
 	HostCall func(string, string, string, []byte) ([]byte, error)
 }
@@ -42,7 +49,7 @@ func New(cfg Config) (*KV, error) {
 		return &KV{}, errors.New("HostCall cannot be nil")
 	}
 
-	return &KV{namespace: cfg.Namespace, hostCall: cfg.HostCall}, nil
+	return &KV{namespace: cfg.Namespace, dataSource: cfg.DataSource, hostCall: cfg.HostCall}, nil
 }
 
 // Set will store the supplied data under the provided key.
@@ -56,7 +63,7 @@ func (kv *KV) Set(key string, data []byte) error {
 	}
 
 	d := base64.StdEncoding.EncodeToString(data)
-	j := fmt.Sprintf(`{"key":"%s","data":"%s"}`, key, d)
+	j := fmt.Sprintf(`{"key":"%s","data":"%s"%s}`, key, d, kv.dataSourceField())
 
 	_, err := kv.hostCall(kv.namespace, "kvstore", "set", []byte(j))
 	if err != nil {
@@ -66,13 +73,126 @@ func (kv *KV) Set(key string, data []byte) error {
 	return nil
 }
 
+// SetWithTTL will store the supplied data under the provided key, removing the key once the ttl has elapsed. TTLs are
+// rounded up to whole seconds. Storing the key again with Set clears the TTL.
+func (kv *KV) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	if key == "" {
+		return errors.New("key cannot be empty")
+	}
+
+	if len(data) == 0 {
+		return errors.New("data cannot be empty")
+	}
+
+	if ttl <= 0 {
+		return errors.New("ttl must be greater than zero")
+	}
+
+	secs := int64((ttl + time.Second - 1) / time.Second)
+	d := base64.StdEncoding.EncodeToString(data)
+	j := fmt.Sprintf(`{"key":"%s","data":"%s","ttl":%d%s}`, key, d, secs, kv.dataSourceField())
+
+	_, err := kv.hostCall(kv.namespace, "kvstore", "set", []byte(j))
+	if err != nil {
+		return fmt.Errorf("unable to execute set - %w", err)
+	}
+
+	return nil
+}
+
+// SetNX will store the supplied data under the provided key only if the key does not exist, returning true if the data
+// was stored. When ttl is greater than zero, the key is removed once the ttl has elapsed; TTLs are rounded up to whole
+// seconds.
+func (kv *KV) SetNX(key string, data []byte, ttl time.Duration) (bool, error) {
+	if key == "" {
+		return false, errors.New("key cannot be empty")
+	}
+
+	if len(data) == 0 {
+		return false, errors.New("data cannot be empty")
+	}
+
+	if ttl < 0 {
+		return false, errors.New("ttl cannot be negative")
+	}
+
+	t := ""
+	if ttl > 0 {
+		t = fmt.Sprintf(`,"ttl":%d`, int64((ttl+time.Second-1)/time.Second))
+	}
+	d := base64.StdEncoding.EncodeToString(data)
+	j := fmt.Sprintf(`{"key":"%s","data":"%s"%s%s}`, key, d, t, kv.dataSourceField())
+
+	b, err := kv.hostCall(kv.namespace, "kvstore", "setnx", []byte(j))
+	if err != nil {
+		return false, fmt.Errorf("unable to execute setnx - %w", err)
+	}
+
+	return fastjson.GetBool(b, "set"), nil
+}
+
+// CompareAndSwap will store the supplied data under the provided key only if the key currently holds the old value,
+// returning true if the data was stored.
+func (kv *KV) CompareAndSwap(key string, old, data []byte) (bool, error) {
+	if key == "" {
+		return false, errors.New("key cannot be empty")
+	}
+
+	if len(data) == 0 {
+		return false, errors.New("data cannot be empty")
+	}
+
+	o := base64.StdEncoding.EncodeToString(old)
+	d := base64.StdEncoding.EncodeToString(data)
+	j := fmt.Sprintf(`{"key":"%s","expected":"%s","data":"%s"%s}`, key, o, d, kv.dataSourceField())
+
+	b, err := kv.hostCall(kv.namespace, "kvstore", "cas", []byte(j))
+	if err != nil {
+		return false, fmt.Errorf("unable to execute cas - %w", err)
+	}
+
+	return fastjson.GetBool(b, "swapped"), nil
+}
+
+// Incr will add delta to the integer stored under the provided key, returning the new value. Missing keys are treated as
+// zero.
+func (kv *KV) Incr(key string, delta int64) (int64, error) {
+	if key == "" {
+		return 0, errors.New("key cannot be empty")
+	}
+
+	j := fmt.Sprintf(`{"key":"%s","delta":%d%s}`, key, delta, kv.dataSourceField())
+
+	b, err := kv.hostCall(kv.namespace, "kvstore", "incr", []byte(j))
+	if err != nil {
+		return 0, fmt.Errorf("unable to execute incr - %w", err)
+	}
+
+	v, err := fastjson.ParseBytes(b)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse returned data - %w", err)
+	}
+
+	val := v.Get("value")
+	if val == nil {
+		return 0, errors.New("unable to parse returned value - value missing")
+	}
+
+	n, err := val.Int64()
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse returned value - %w", err)
+	}
+
+	return n, nil
+}
+
 // Get will fetch the data stored under the supplied key.
 func (kv *KV) Get(key string) ([]byte, error) {
 	if key == "" {
 		return []byte(""), errors.New("key cannot be empty")
 	}
 
-	b, err := kv.hostCall(kv.namespace, "kvstore", "get", []byte(fmt.Sprintf(`{"key":"%s"}`, key)))
+	b, err := kv.hostCall(kv.namespace, "kvstore", "get", []byte(fmt.Sprintf(`{"key":"%s"%s}`, key, kv.dataSourceField())))
 	if err != nil {
 		return []byte(""), fmt.Errorf("unable to execute get - %w", err)
 	}
@@ -91,7 +211,7 @@ func (kv *KV) Delete(key string) error {
 		return errors.New("key cannot be empty")
 	}
 
-	_, err := kv.hostCall(kv.namespace, "kvstore", "delete", []byte(fmt.Sprintf(`{"key":"%s"}`, key)))
+	_, err := kv.hostCall(kv.namespace, "kvstore", "delete", []byte(fmt.Sprintf(`{"key":"%s"%s}`, key, kv.dataSourceField())))
 	if err != nil {
 		return fmt.Errorf("unable to execute delete - %w", err)
 	}
@@ -103,7 +223,12 @@ func (kv *KV) Delete(key string) error {
 func (kv *KV) Keys() ([]string, error) {
 	var keys []string
 
-	b, err := kv.hostCall(kv.namespace, "kvstore", "keys", []byte(""))
+	rq := []byte("")
+	if kv.dataSource != "" {
+		rq = []byte(fmt.Sprintf(`{"data_source":"%s"}`, kv.dataSource))
+	}
+
+	b, err := kv.hostCall(kv.namespace, "kvstore", "keys", rq)
 	if err != nil {
 		return keys, fmt.Errorf("unable to execute keys - %w", err)
 	}
@@ -119,3 +244,194 @@ func (kv *KV) Keys() ([]string, error) {
 
 	return keys, nil
 }
+
+// ErrKeyNotFound is returned within the results of GetMany for keys that do not exist.
+var ErrKeyNotFound = errors.New("key not found")
+
+// Entry is a key and the data to store under it with SetMany.
+type Entry struct {
+	Key  string
+	Data []byte
+}
+
+// Result is the result of a batch operation on a single key. Err is nil when the operation on the key succeeded.
+type Result struct {
+	Key  string
+	Data []byte
+	Err  error
+}
+
+// GetMany will fetch the data stored under each of the supplied keys with a single host call, returning a result per
+// key in the order of keys. Missing keys return ErrKeyNotFound within their result.
+func (kv *KV) GetMany(keys []string) ([]Result, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keys cannot be empty")
+	}
+
+	j := fmt.Sprintf(`{"keys":%s%s}`, jsonKeys(keys), kv.dataSourceField())
+	return kv.batch("mget", []byte(j))
+}
+
+// SetMany will store each of the supplied entries with a single host call, returning a result per key in the order of
+// entries.
+func (kv *KV) SetMany(entries []Entry) ([]Result, error) {
+	if len(entries) == 0 {
+		return nil, errors.New("entries cannot be empty")
+	}
+
+	e := make([]string, len(entries))
+	for i, entry := range entries {
+		if len(entry.Data) == 0 {
+			return nil, fmt.Errorf("data of key %s cannot be empty", entry.Key)
+		}
+		e[i] = fmt.Sprintf(`{"key":"%s","data":"%s"}`, entry.Key, base64.StdEncoding.EncodeToString(entry.Data))
+	}
+
+	j := fmt.Sprintf(`{"entries":[%s]%s}`, strings.Join(e, ","), kv.dataSourceField())
+	return kv.batch("mset", []byte(j))
+}
+
+// DeleteMany will delete each of the supplied keys with a single host call, returning a result per key in the order of
+// keys.
+func (kv *KV) DeleteMany(keys []string) ([]Result, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keys cannot be empty")
+	}
+
+	j := fmt.Sprintf(`{"keys":%s%s}`, jsonKeys(keys), kv.dataSourceField())
+	return kv.batch("mdelete", []byte(j))
+}
+
+// batch executes a batch host callback, parsing the result of each key.
+func (kv *KV) batch(operation string, rq []byte) ([]Result, error) {
+	b, err := kv.hostCall(kv.namespace, "kvstore", operation, rq)
+	if err != nil {
+		return nil, fmt.Errorf("unable to execute %s - %w", operation, err)
+	}
+
+	v, err := fastjson.ParseBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse returned data - %w", err)
+	}
+
+	var results []Result
+	for _, r := range v.GetArray("results") {
+		result := Result{Key: string(r.GetStringBytes("key"))}
+
+		switch r.GetInt("status", "code") {
+		case 200:
+			if d := r.GetStringBytes("data"); len(d) > 0 {
+				result.Data, err = base64.StdEncoding.DecodeString(string(d))
+				if err != nil {
+					result.Err = fmt.Errorf("unable to decode fetched data - %w", err)
+				}
+			}
+		case 404:
+			result.Err = ErrKeyNotFound
+		default:
+			result.Err = errors.New(string(r.GetStringBytes("status", "status")))
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// jsonKeys returns keys as a JSON array.
+func jsonKeys(keys []string) string {
+	return `["` + strings.Join(keys, `","`) + `"]`
+}
+
+// KeysConfig configures the keys listed by a KeyIterator.
+type KeysConfig struct {
+	// Prefix limits the listed keys to those beginning with Prefix.
+	Prefix string
+
+	// PageSize is the maximum number of keys fetched from Tarmac per host call. When zero, every matching key is
+	// fetched with a single host call.
+	PageSize int
+}
+
+// KeyIterator lists keys page by page, fetching the next page from Tarmac once the current page is consumed.
+type KeyIterator struct {
+	kv     *KV
+	cfg    KeysConfig
+	keys   []string
+	key    string
+	cursor string
+	done   bool
+	err    error
+}
+
+// Iterate returns a KeyIterator listing the keys matching the supplied configuration.
+//
+//	it := kv.Iterate(kvstore.KeysConfig{Prefix: "user:", PageSize: 100})
+//	for it.Next() {
+//		key := it.Key()
+//	}
+//	if err := it.Err(); err != nil {
+//		// do something
+//	}
+func (kv *KV) Iterate(cfg KeysConfig) *KeyIterator {
+	return &KeyIterator{kv: kv, cfg: cfg}
+}
+
+// Next advances the iterator to the next key, returning false once every key is listed or an error occurs.
+func (it *KeyIterator) Next() bool {
+	for len(it.keys) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.keys, it.cursor, it.err = it.kv.keysPage(it.cfg.Prefix, it.cursor, it.cfg.PageSize)
+		it.done = it.cursor == ""
+	}
+
+	it.key, it.keys = it.keys[0], it.keys[1:]
+	return true
+}
+
+// Key returns the current key of the iterator.
+func (it *KeyIterator) Key() string {
+	return it.key
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (it *KeyIterator) Err() error {
+	return it.err
+}
+
+// keysPage fetches a page of keys beginning with prefix, returning the cursor of the next page.
+func (kv *KV) keysPage(prefix, cursor string, limit int) ([]string, string, error) {
+	if limit < 0 {
+		return nil, "", errors.New("page size cannot be negative")
+	}
+
+	j := fmt.Sprintf(`{"prefix":"%s","limit":%d,"cursor":"%s"%s}`, prefix, limit, cursor, kv.dataSourceField())
+
+	b, err := kv.hostCall(kv.namespace, "kvstore", "keys", []byte(j))
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to execute keys - %w", err)
+	}
+
+	v, err := fastjson.ParseBytes(b)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to parse returned data - %w", err)
+	}
+
+	var keys []string
+	for _, k := range v.GetArray("keys") {
+		keys = append(keys, string(k.GetStringBytes()))
+	}
+
+	return keys, string(v.GetStringBytes("cursor")), nil
+}
+
+// dataSourceField returns the JSON data_source field of host callback requests, or an empty string when no data
+// source is configured.
+func (kv *KV) dataSourceField() string {
+	if kv.dataSource == "" {
+		return ""
+	}
+	return fmt.Sprintf(`,"data_source":"%s"`, kv.dataSource)
+}
@@ -5,7 +5,11 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/valyala/fastjson"
 )
 
 type KVSetTestCase struct {
@@ -240,3 +244,336 @@ func TestKVStore_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestKVStore_DataSource(t *testing.T) {
+	var calls []string
+	hostCall := func(_, _, operation string, data []byte) ([]byte, error) {
+		calls = append(calls, fmt.Sprintf("%s %s", operation, data))
+		return []byte(`{"data":"YmFy","keys":[]}`), nil
+	}
+	kv, err := New(Config{Namespace: "default", DataSource: "cache", HostCall: hostCall})
+	if err != nil {
+		t.Fatalf("Unexpected error initializing kvstore - %s", err)
+	}
+
+	err = kv.Set("foo", []byte("bar"))
+	if err != nil {
+		t.Errorf("Unexpected error executing kv.Set() - %s", err)
+	}
+
+	_, err = kv.Get("foo")
+	if err != nil {
+		t.Errorf("Unexpected error executing kv.Get() - %s", err)
+	}
+
+	err = kv.Delete("foo")
+	if err != nil {
+		t.Errorf("Unexpected error executing kv.Delete() - %s", err)
+	}
+
+	_, err = kv.Keys()
+	if err != nil {
+		t.Errorf("Unexpected error executing kv.Keys() - %s", err)
+	}
+
+	expected := []string{
+		`set {"key":"foo","data":"YmFy","data_source":"cache"}`,
+		`get {"key":"foo","data_source":"cache"}`,
+		`delete {"key":"foo","data_source":"cache"}`,
+		`keys {"data_source":"cache"}`,
+	}
+	if len(calls) != len(expected) {
+		t.Fatalf("Unexpected host calls - %q", calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Errorf("Unexpected host call - got %s, expected %s", calls[i], expected[i])
+		}
+	}
+}
+
+func TestKVStore_SetWithTTL(t *testing.T) {
+	tc := []struct {
+		name    string
+		err     bool
+		key     string
+		data    []byte
+		ttl     time.Duration
+		request string
+	}{
+		{name: "Key empty", err: true, data: []byte("bar"), ttl: time.Second},
+		{name: "Data empty", err: true, key: "foo", ttl: time.Second},
+		{name: "TTL zero", err: true, key: "foo", data: []byte("bar")},
+		{
+			name:    "Whole seconds",
+			key:     "foo",
+			data:    []byte("bar"),
+			ttl:     time.Minute,
+			request: `{"key":"foo","data":"YmFy","ttl":60}`,
+		},
+		{
+			name:    "Rounded up",
+			key:     "foo",
+			data:    []byte("bar"),
+			ttl:     1500 * time.Millisecond,
+			request: `{"key":"foo","data":"YmFy","ttl":2}`,
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var request string
+			kv, err := New(Config{Namespace: "default", HostCall: func(_, _, operation string, data []byte) ([]byte, error) {
+				if operation != "set" {
+					t.Errorf("Unexpected host call operation - %s", operation)
+				}
+				request = string(data)
+				return []byte(""), nil
+			}})
+			if err != nil {
+				t.Fatalf("Unexpected error initializing kvstore - %s", err)
+			}
+
+			err = kv.SetWithTTL(c.key, c.data, c.ttl)
+			if (err != nil) != c.err {
+				t.Fatalf("Unexpected error result executing kv.SetWithTTL() - %v", err)
+			}
+			if request != c.request {
+				t.Errorf("Unexpected host call request - got %s, expected %s", request, c.request)
+			}
+		})
+	}
+}
+
+func TestKVStore_Atomic(t *testing.T) {
+	tc := []struct {
+		name      string
+		err       bool
+		operation string
+		call      func(*KV) (any, error)
+		response  string
+		request   string
+		result    any
+	}{
+		{
+			name:      "SetNX",
+			operation: "setnx",
+			call:      func(kv *KV) (any, error) { return kv.SetNX("foo", []byte("bar"), 0) },
+			response:  `{"set":true,"status":{"code":200,"status":"OK"}}`,
+			request:   `{"key":"foo","data":"YmFy"}`,
+			result:    true,
+		},
+		{
+			name:      "SetNX with TTL",
+			operation: "setnx",
+			call:      func(kv *KV) (any, error) { return kv.SetNX("foo", []byte("bar"), 1500*time.Millisecond) },
+			response:  `{"set":false,"status":{"code":200,"status":"OK"}}`,
+			request:   `{"key":"foo","data":"YmFy","ttl":2}`,
+			result:    false,
+		},
+		{
+			name:   "SetNX Negative TTL",
+			err:    true,
+			call:   func(kv *KV) (any, error) { return kv.SetNX("foo", []byte("bar"), -time.Second) },
+			result: false,
+		},
+		{
+			name:      "CompareAndSwap",
+			operation: "cas",
+			call:      func(kv *KV) (any, error) { return kv.CompareAndSwap("foo", []byte("bar"), []byte("baz")) },
+			response:  `{"swapped":true,"status":{"code":200,"status":"OK"}}`,
+			request:   `{"key":"foo","expected":"YmFy","data":"YmF6"}`,
+			result:    true,
+		},
+		{
+			name:   "CompareAndSwap Key empty",
+			err:    true,
+			call:   func(kv *KV) (any, error) { return kv.CompareAndSwap("", []byte("bar"), []byte("baz")) },
+			result: false,
+		},
+		{
+			name:      "Incr",
+			operation: "incr",
+			call:      func(kv *KV) (any, error) { return kv.Incr("foo", -2) },
+			response:  `{"value":40,"status":{"code":200,"status":"OK"}}`,
+			request:   `{"key":"foo","delta":-2}`,
+			result:    int64(40),
+		},
+		{
+			name:      "Incr Invalid Response",
+			err:       true,
+			operation: "incr",
+			call:      func(kv *KV) (any, error) { return kv.Incr("foo", 1) },
+			response:  `{"status":{"code":200,"status":"OK"}}`,
+			request:   `{"key":"foo","delta":1}`,
+			result:    int64(0),
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var request string
+			kv, err := New(Config{Namespace: "default", HostCall: func(_, _, operation string, data []byte) ([]byte, error) {
+				if operation != c.operation {
+					t.Errorf("Unexpected host call operation - %s", operation)
+				}
+				request = string(data)
+				return []byte(c.response), nil
+			}})
+			if err != nil {
+				t.Fatalf("Unexpected error initializing kvstore - %s", err)
+			}
+
+			r, err := c.call(kv)
+			if (err != nil) != c.err {
+				t.Fatalf("Unexpected error result - %v", err)
+			}
+			if request != c.request {
+				t.Errorf("Unexpected host call request - got %s, expected %s", request, c.request)
+			}
+			if r != c.result {
+				t.Errorf("Unexpected result - got %v, expected %v", r, c.result)
+			}
+		})
+	}
+}
+
+func TestKVStore_Iterate(t *testing.T) {
+	pages := map[string]string{
+		"":   `{"keys":["user:1","user:2"],"cursor":"c1","status":{"code":200,"status":"OK"}}`,
+		"c1": `{"keys":[],"cursor":"c2","status":{"code":200,"status":"OK"}}`,
+		"c2": `{"keys":["user:3"],"status":{"code":200,"status":"OK"}}`,
+	}
+
+	kv, err := New(Config{Namespace: "default", HostCall: func(_, _, operation string, data []byte) ([]byte, error) {
+		if operation != "keys" {
+			t.Errorf("Unexpected host call operation - %s", operation)
+		}
+		v, err := fastjson.ParseBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		if string(v.GetStringBytes("prefix")) != "user:" || v.GetInt("limit") != 2 {
+			t.Errorf("Unexpected host call request - %s", data)
+		}
+		return []byte(pages[string(v.GetStringBytes("cursor"))]), nil
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error initializing kvstore - %s", err)
+	}
+
+	var keys []string
+	it := kv.Iterate(KeysConfig{Prefix: "user:", PageSize: 2})
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	if it.Err() != nil {
+		t.Fatalf("Unexpected error iterating keys - %s", it.Err())
+	}
+	if strings.Join(keys, ",") != "user:1,user:2,user:3" {
+		t.Errorf("Unexpected keys returned - %v", keys)
+	}
+
+	t.Run("Host Call Error", func(t *testing.T) {
+		kv, err := New(Config{Namespace: "default", HostCall: func(_, _, _ string, _ []byte) ([]byte, error) {
+			return nil, errors.New("failed")
+		}})
+		if err != nil {
+			t.Fatalf("Unexpected error initializing kvstore - %s", err)
+		}
+
+		it := kv.Iterate(KeysConfig{})
+		if it.Next() || it.Err() == nil {
+			t.Errorf("Expected iterator to stop with an error")
+		}
+	})
+}
+
+func TestKVStore_Batch(t *testing.T) {
+	tc := []struct {
+		name      string
+		err       bool
+		operation string
+		call      func(*KV) ([]Result, error)
+		response  string
+		request   string
+		results   []Result
+	}{
+		{
+			name:      "GetMany",
+			operation: "mget",
+			call:      func(kv *KV) ([]Result, error) { return kv.GetMany([]string{"a", "b", "c"}) },
+			response: `{"results":[{"key":"a","data":"YmFy","status":{"code":200,"status":"OK"}},` +
+				`{"key":"b","status":{"code":404,"status":"missing"}},` +
+				`{"key":"c","status":{"code":500,"status":"failed"}}],"status":{"code":200,"status":"OK"}}`,
+			request: `{"keys":["a","b","c"]}`,
+			results: []Result{
+				{Key: "a", Data: []byte("bar")},
+				{Key: "b", Err: ErrKeyNotFound},
+				{Key: "c", Err: errors.New("failed")},
+			},
+		},
+		{
+			name:      "SetMany",
+			operation: "mset",
+			call: func(kv *KV) ([]Result, error) {
+				return kv.SetMany([]Entry{{Key: "a", Data: []byte("bar")}, {Key: "b", Data: []byte("baz")}})
+			},
+			response: `{"results":[{"key":"a","status":{"code":200,"status":"OK"}},` +
+				`{"key":"b","status":{"code":200,"status":"OK"}}],"status":{"code":200,"status":"OK"}}`,
+			request: `{"entries":[{"key":"a","data":"YmFy"},{"key":"b","data":"YmF6"}]}`,
+			results: []Result{{Key: "a"}, {Key: "b"}},
+		},
+		{
+			name:      "DeleteMany",
+			operation: "mdelete",
+			call:      func(kv *KV) ([]Result, error) { return kv.DeleteMany([]string{"a"}) },
+			response:  `{"results":[{"key":"a","status":{"code":200,"status":"OK"}}],"status":{"code":200,"status":"OK"}}`,
+			request:   `{"keys":["a"]}`,
+			results:   []Result{{Key: "a"}},
+		},
+		{
+			name: "GetMany Keys empty",
+			err:  true,
+			call: func(kv *KV) ([]Result, error) { return kv.GetMany(nil) },
+		},
+		{
+			name: "SetMany Data empty",
+			err:  true,
+			call: func(kv *KV) ([]Result, error) { return kv.SetMany([]Entry{{Key: "a"}}) },
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var request string
+			kv, err := New(Config{Namespace: "default", HostCall: func(_, _, operation string, data []byte) ([]byte, error) {
+				if operation != c.operation {
+					t.Errorf("Unexpected host call operation - %s", operation)
+				}
+				request = string(data)
+				return []byte(c.response), nil
+			}})
+			if err != nil {
+				t.Fatalf("Unexpected error initializing kvstore - %s", err)
+			}
+
+			results, err := c.call(kv)
+			if (err != nil) != c.err {
+				t.Fatalf("Unexpected error result - %v", err)
+			}
+			if request != c.request {
+				t.Errorf("Unexpected host call request - got %s, expected %s", request, c.request)
+			}
+			if len(results) != len(c.results) {
+				t.Fatalf("Unexpected results - %+v", results)
+			}
+			for i, r := range results {
+				expected := c.results[i]
+				if r.Key != expected.Key || !bytes.Equal(r.Data, expected.Data) || fmt.Sprint(r.Err) != fmt.Sprint(expected.Err) {
+					t.Errorf("Unexpected result - got %+v, expected %+v", r, expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,446 @@
+package sql
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/valyala/fastjson"
+)
+
+// Column describes a column of Rows.
+type Column struct {
+	// Name is the column name.
+	Name string
+
+	// DatabaseType is the database system type name of the column (i.e. "VARCHAR" or "INT").
+	DatabaseType string
+
+	// Nullable reports whether the column may contain NULL values.
+	Nullable bool
+}
+
+// Rows is a page of typed rows returned by QueryRows. When more rows remain, More returns true and Next reads the
+// following page.
+type Rows struct {
+	// Columns describe the columns of each row, in the order returned by the query.
+	Columns []Column
+
+	// Values are the rows within the page, holding a value for each column. Each value is nil, a string, int64,
+	// float64, bool, []byte, or time.Time.
+	Values [][]any
+
+	sql     *SQL
+	cursor  string
+	maxRows int
+}
+
+// QueryRows will execute the specified SQL query and return the typed rows of the result along with column metadata.
+// When maxRows is greater than zero, at most maxRows rows are returned and the remaining rows are read using Next;
+// otherwise, all rows are returned. Any params supplied are bound to placeholders within the query.
+func (sql *SQL) QueryRows(maxRows int, q string, params ...Param) (*Rows, error) {
+	return sql.queryRows("", maxRows, q, params)
+}
+
+// QueryRows will execute the specified SQL query within the transaction, returning typed rows as SQL.QueryRows.
+func (tx *Tx) QueryRows(maxRows int, q string, params ...Param) (*Rows, error) {
+	return tx.sql.queryRows(tx.handle, maxRows, q, params)
+}
+
+// More reports whether rows remain after this page.
+func (r *Rows) More() bool {
+	return r.cursor != ""
+}
+
+// Next reads the next page of rows. Rows must be read before the function execution ends.
+func (r *Rows) Next() (*Rows, error) {
+	if !r.More() {
+		return nil, errors.New("no rows remain")
+	}
+
+	var a fastjson.Arena
+	o := a.NewObject()
+	o.Set("cursor", a.NewString(r.cursor))
+	o.Set("max_rows", a.NewNumberInt(r.maxRows))
+	o.Set("format", a.NewString("proto"))
+
+	return r.sql.rows(o.MarshalTo(nil), r.maxRows)
+}
+
+// Decode appends each row of the page to dst, which must be a pointer to a slice of structs or struct pointers.
+// Columns are matched to fields using the sql struct tag, or the field name ignoring case when no tag is set.
+// Fields tagged with "-" are skipped, and columns without a matching field are ignored.
+func (r *Rows) Decode(dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return errors.New("destination must be a pointer to a slice")
+	}
+	slice := v.Elem()
+
+	elem := slice.Type().Elem()
+	ptr := elem.Kind() == reflect.Ptr
+	if ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return errors.New("destination must be a slice of structs")
+	}
+
+	// Map each column to a struct field
+	fields := make([]int, len(r.Columns))
+	for i, c := range r.Columns {
+		fields[i] = fieldIndex(elem, c.Name)
+	}
+
+	for _, row := range r.Values {
+		s := reflect.New(elem).Elem()
+		for i, value := range row {
+			if i >= len(fields) || fields[i] < 0 {
+				continue
+			}
+			err := assign(s.Field(fields[i]), value)
+			if err != nil {
+				return fmt.Errorf("unable to decode column %s - %w", r.Columns[i].Name, err)
+			}
+		}
+
+		if ptr {
+			slice = reflect.Append(slice, s.Addr())
+			continue
+		}
+		slice = reflect.Append(slice, s)
+	}
+
+	v.Elem().Set(slice)
+	return nil
+}
+
+// queryRows executes a query requesting typed rows, within the transaction referred to by handle when set.
+func (sql *SQL) queryRows(handle string, maxRows int, q string, params []Param) (*Rows, error) {
+	if maxRows < 0 {
+		return nil, errors.New("maxRows cannot be negative")
+	}
+	return sql.rows(sql.request(handle, q, params, maxRows, "proto"), maxRows)
+}
+
+// rows executes a query callback and decodes the returned result set.
+func (sql *SQL) rows(rq []byte, maxRows int) (*Rows, error) {
+	rsp, err := sql.hostCall(sql.namespace, "sql", "query", rq)
+	if err != nil {
+		return nil, fmt.Errorf("error while executing host callback - %w", err)
+	}
+
+	r := &Rows{sql: sql, maxRows: maxRows}
+	err = r.unmarshal(rsp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode returned data - %w", err)
+	}
+	return r, nil
+}
+
+// fieldIndex returns the index of the struct field matching the column name, or -1 if no field matches.
+func fieldIndex(t reflect.Type, column string) int {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		tag := f.Tag.Get("sql")
+		if tag == "-" {
+			continue
+		}
+		if tag == column || (tag == "" && strings.EqualFold(f.Name, column)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// assign sets the struct field to the value, converting between compatible types.
+func assign(f reflect.Value, value any) error {
+	if value == nil {
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	}
+
+	if f.Kind() == reflect.Ptr {
+		p := reflect.New(f.Type().Elem())
+		err := assign(p.Elem(), value)
+		if err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Type().AssignableTo(f.Type()) {
+		f.Set(v)
+		return nil
+	}
+
+	switch value := value.(type) {
+	case int64:
+		switch f.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if f.OverflowInt(value) {
+				return fmt.Errorf("value %d overflows %s", value, f.Type())
+			}
+			f.SetInt(value)
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if value < 0 || f.OverflowUint(uint64(value)) {
+				return fmt.Errorf("value %d overflows %s", value, f.Type())
+			}
+			f.SetUint(uint64(value))
+			return nil
+		case reflect.Float32, reflect.Float64:
+			f.SetFloat(float64(value))
+			return nil
+		}
+	case float64:
+		if f.Kind() == reflect.Float32 || f.Kind() == reflect.Float64 {
+			f.SetFloat(value)
+			return nil
+		}
+	case string:
+		if f.Kind() == reflect.String {
+			f.SetString(value)
+			return nil
+		}
+		if f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Uint8 {
+			f.SetBytes([]byte(value))
+			return nil
+		}
+	case []byte:
+		if f.Kind() == reflect.String {
+			f.SetString(string(value))
+			return nil
+		}
+		if f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Uint8 {
+			f.SetBytes(value)
+			return nil
+		}
+	case bool:
+		if f.Kind() == reflect.Bool {
+			f.SetBool(value)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("cannot assign %T to %s", value, f.Type())
+}
+
+// unmarshal decodes a protobuf wire format SQLResultSet, defined within pkg/envelope/envelope.proto, into r.
+//
+//	message SQLResultSet {
+//	  tarmac.Status status = 1;
+//	  repeated SQLColumn columns = 2;
+//	  repeated SQLRow rows = 3;
+//	  string cursor = 4;
+//	}
+func (r *Rows) unmarshal(b []byte) error {
+	return consumeFields(b, func(num, typ uint64, data []byte, _ uint64) error {
+		if typ != wireBytes {
+			return nil
+		}
+		switch num {
+		case 1:
+			return consumeStatus(data)
+		case 2:
+			c, err := consumeColumn(data)
+			if err != nil {
+				return err
+			}
+			r.Columns = append(r.Columns, c)
+		case 3:
+			row, err := consumeRow(data)
+			if err != nil {
+				return err
+			}
+			r.Values = append(r.Values, row)
+		case 4:
+			r.cursor = string(data)
+		}
+		return nil
+	})
+}
+
+// consumeStatus decodes the Status message of a SQLResultSet, returning an error for failed queries.
+func consumeStatus(b []byte) error {
+	var code uint64
+	var status string
+	err := consumeFields(b, func(num, typ uint64, data []byte, v uint64) error {
+		switch {
+		case num == 1 && typ == wireVarint:
+			code = v
+		case num == 2 && typ == wireBytes:
+			status = string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if code != 0 && code != 200 {
+		return fmt.Errorf("query failed with status %d - %s", code, status)
+	}
+	return nil
+}
+
+// consumeColumn decodes a SQLColumn message.
+//
+//	message SQLColumn {
+//	  string name = 1;
+//	  string database_type = 2;
+//	  bool nullable = 3;
+//	}
+func consumeColumn(b []byte) (Column, error) {
+	var c Column
+	err := consumeFields(b, func(num, typ uint64, data []byte, v uint64) error {
+		switch {
+		case num == 1 && typ == wireBytes:
+			c.Name = string(data)
+		case num == 2 && typ == wireBytes:
+			c.DatabaseType = string(data)
+		case num == 3 && typ == wireVarint:
+			c.Nullable = v != 0
+		}
+		return nil
+	})
+	return c, err
+}
+
+// consumeRow decodes the values of a SQLRow message.
+//
+//	message SQLRow {
+//	  repeated SQLValue values = 1;
+//	}
+//
+//	message SQLValue {
+//	  oneof value {
+//	    bool null = 1;
+//	    string string = 2;
+//	    int64 int = 3;
+//	    double float = 4;
+//	    bool bool = 5;
+//	    bytes bytes = 6;
+//	    int64 timestamp = 7; // Unix time in nanoseconds
+//	  }
+//	}
+func consumeRow(b []byte) ([]any, error) {
+	var row []any
+	err := consumeFields(b, func(num, typ uint64, data []byte, _ uint64) error {
+		if num != 1 || typ != wireBytes {
+			return nil
+		}
+
+		var value any
+		err := consumeFields(data, func(num, typ uint64, data []byte, v uint64) error {
+			switch {
+			case num == 1:
+				value = nil
+			case num == 2 && typ == wireBytes:
+				value = string(data)
+			case num == 3 && typ == wireVarint:
+				value = int64(v)
+			case num == 4 && typ == wireFixed64:
+				value = math.Float64frombits(v)
+			case num == 5 && typ == wireVarint:
+				value = v != 0
+			case num == 6 && typ == wireBytes:
+				value = append([]byte{}, data...)
+			case num == 7 && typ == wireVarint:
+				value = time.Unix(0, int64(v)).UTC()
+			default:
+				return errInvalidEncoding
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		row = append(row, value)
+		return nil
+	})
+	return row, err
+}
+
+// Protobuf wire types used by the SQLResultSet message.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// errInvalidEncoding is returned when a result set is not valid protobuf wire format.
+var errInvalidEncoding = errors.New("invalid protobuf encoding")
+
+// consumeFields walks each field within b and calls fn with the field number, wire type, and value. Length-delimited
+// values are passed as data, while varint and fixed values are passed as v.
+func consumeFields(b []byte, fn func(num, typ uint64, data []byte, v uint64) error) error {
+	for len(b) > 0 {
+		tag, n := consumeVarint(b)
+		if n == 0 {
+			return errInvalidEncoding
+		}
+		b = b[n:]
+
+		num, typ := tag>>3, tag&7
+		var err error
+		switch typ {
+		case wireVarint:
+			v, n := consumeVarint(b)
+			if n == 0 {
+				return errInvalidEncoding
+			}
+			err = fn(num, typ, nil, v)
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errInvalidEncoding
+			}
+			err = fn(num, typ, nil, binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case wireBytes:
+			l, n := consumeVarint(b)
+			if n == 0 || uint64(len(b)-n) < l {
+				return errInvalidEncoding
+			}
+			b = b[n:]
+			err = fn(num, typ, b[:l], 0)
+			b = b[l:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errInvalidEncoding
+			}
+			b = b[4:]
+		default:
+			return errInvalidEncoding
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consumeVarint decodes a varint from b, returning the value and the number of bytes read, or zero bytes when b does
+// not hold a valid varint.
+func consumeVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * i)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
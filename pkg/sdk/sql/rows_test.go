@@ -0,0 +1,192 @@
+package sql
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// pbVarint encodes v as a protobuf varint.
+func pbVarint(v uint64) []byte {
+	var b []byte
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// pbField encodes a protobuf field with the supplied wire type and encoded value.
+func pbField(num, typ uint64, v []byte) []byte {
+	b := pbVarint(num<<3 | typ)
+	if typ == wireBytes {
+		b = append(b, pbVarint(uint64(len(v)))...)
+	}
+	return append(b, v...)
+}
+
+// pbResultSet encodes a SQLResultSet with two columns, the supplied rows, and cursor.
+func pbResultSet(code uint64, cursor string, rows ...[][]byte) []byte {
+	status := append(pbField(1, wireVarint, pbVarint(code)), pbField(2, wireBytes, []byte("OK"))...)
+	b := pbField(1, wireBytes, status)
+	b = append(b, pbField(2, wireBytes, append(
+		pbField(1, wireBytes, []byte("id")), pbField(2, wireBytes, []byte("INT"))...))...)
+	b = append(b, pbField(2, wireBytes, append(
+		pbField(1, wireBytes, []byte("name")), pbField(3, wireVarint, pbVarint(1))...))...)
+	for _, row := range rows {
+		var r []byte
+		for _, v := range row {
+			r = append(r, pbField(1, wireBytes, v)...)
+		}
+		b = append(b, pbField(3, wireBytes, r)...)
+	}
+	if cursor != "" {
+		b = append(b, pbField(4, wireBytes, []byte(cursor))...)
+	}
+	return b
+}
+
+func TestSQL_QueryRows(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	f := make([]byte, 8)
+	binary.LittleEndian.PutUint64(f, math.Float64bits(1.5))
+
+	var payloads []string
+	sql, err := New(Config{HostCall: func(_, _, endpoint string, payload []byte) ([]byte, error) {
+		payloads = append(payloads, string(payload))
+		if len(payloads) == 1 {
+			return pbResultSet(200, "abc123",
+				[][]byte{pbField(3, wireVarint, pbVarint(1)), pbField(2, wireBytes, []byte("John"))},
+				[][]byte{pbField(3, wireVarint, pbVarint(2)), pbField(1, wireVarint, pbVarint(1))},
+			), nil
+		}
+		return pbResultSet(200, "",
+			[][]byte{pbField(3, wireVarint, pbVarint(3)), pbField(6, wireBytes, []byte("Jane"))},
+			[][]byte{pbField(4, wireFixed64, f), pbField(7, wireVarint, pbVarint(uint64(ts.UnixNano())))},
+		), nil
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error while creating SQL instance - %s", err)
+	}
+
+	rows, err := sql.QueryRows(2, "SELECT id, name FROM users WHERE id > ?;", Int(0))
+	if err != nil {
+		t.Fatalf("Unexpected error when calling SQL QueryRows - %s", err)
+	}
+
+	expected := []Column{{Name: "id", DatabaseType: "INT"}, {Name: "name", Nullable: true}}
+	if !reflect.DeepEqual(rows.Columns, expected) {
+		t.Errorf("Unexpected columns - %+v", rows.Columns)
+	}
+	if !reflect.DeepEqual(rows.Values, [][]any{{int64(1), "John"}, {int64(2), nil}}) {
+		t.Errorf("Unexpected values - %#v", rows.Values)
+	}
+	if !rows.More() {
+		t.Fatalf("Expected more rows to remain")
+	}
+
+	next, err := rows.Next()
+	if err != nil {
+		t.Fatalf("Unexpected error reading next page - %s", err)
+	}
+	if !reflect.DeepEqual(next.Values, [][]any{{int64(3), []byte("Jane")}, {1.5, ts}}) {
+		t.Errorf("Unexpected values - %#v", next.Values)
+	}
+	if next.More() {
+		t.Errorf("Unexpected rows remaining")
+	}
+
+	_, err = next.Next()
+	if err == nil {
+		t.Errorf("Expected error reading past the last page")
+	}
+
+	expectedPayloads := []string{
+		`{"query":"U0VMRUNUIGlkLCBuYW1lIEZST00gdXNlcnMgV0hFUkUgaWQgPiA/Ow==","params":[{"type":"int","value":"0"}],` +
+			`"max_rows":2,"format":"proto"}`,
+		`{"cursor":"abc123","max_rows":2,"format":"proto"}`,
+	}
+	if !reflect.DeepEqual(payloads, expectedPayloads) {
+		t.Errorf("Unexpected payloads - %q", payloads)
+	}
+
+	t.Run("Decode", func(t *testing.T) {
+		type user struct {
+			ID       int
+			Username *string `sql:"name"`
+			Skipped  string  `sql:"-"`
+		}
+
+		var users []user
+		err := rows.Decode(&users)
+		if err != nil {
+			t.Fatalf("Unexpected error decoding rows - %s", err)
+		}
+
+		var ptrs []*user
+		err = next.Decode(&ptrs)
+		if err == nil {
+			t.Errorf("Expected error decoding float into int field")
+		}
+
+		if len(users) != 2 || users[0].ID != 1 || *users[0].Username != "John" || users[1].ID != 2 ||
+			users[1].Username != nil {
+			t.Errorf("Unexpected decoded rows - %+v", users)
+		}
+	})
+
+	t.Run("Decode Invalid Destination", func(t *testing.T) {
+		for name, dst := range map[string]any{"Slice": []struct{}{}, "Ints": &[]int{}} {
+			t.Run(name, func(t *testing.T) {
+				err := rows.Decode(dst)
+				if err == nil {
+					t.Errorf("Expected error decoding into %T", dst)
+				}
+			})
+		}
+	})
+
+	tests := map[string][]byte{
+		"Failed Status":    pbResultSet(500, ""),
+		"Invalid Encoding": {0x0a, 0x05, 0x01},
+		"Invalid Value":    pbResultSet(200, "", [][]byte{pbField(3, wireBytes, []byte("1"))}),
+	}
+	for name, rsp := range tests {
+		t.Run(name, func(t *testing.T) {
+			sql, err := New(Config{HostCall: func(string, string, string, []byte) ([]byte, error) {
+				return rsp, nil
+			}})
+			if err != nil {
+				t.Fatalf("Unexpected error while creating SQL instance - %s", err)
+			}
+
+			_, err = sql.QueryRows(0, "SELECT * FROM users;")
+			if err == nil {
+				t.Errorf("Expected error decoding result set")
+			}
+		})
+	}
+
+	t.Run("Negative Max Rows", func(t *testing.T) {
+		_, err := sql.QueryRows(-1, "SELECT * FROM users;")
+		if err == nil {
+			t.Errorf("Expected error with negative max rows")
+		}
+	})
+
+	t.Run("Transaction", func(t *testing.T) {
+		payloads = nil
+		tx := &Tx{sql: sql, handle: "tx1"}
+		_, err := tx.QueryRows(0, "SELECT 1;")
+		if err != nil {
+			t.Fatalf("Unexpected error - %s", err)
+		}
+		if len(payloads) != 1 || payloads[0] != fmt.Sprintf(`{"query":"%s","transaction":"tx1","format":"proto"}`,
+			"U0VMRUNUIDE7") {
+			t.Errorf("Unexpected payloads - %q", payloads)
+		}
+	})
+}
@@ -9,14 +9,17 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/valyala/fastjson"
 )
 
 // SQL provides an interface to the underlying SQL datastores within Tarmac.
 type SQL struct {
-	namespace string
-	hostCall  func(string, string, string, []byte) ([]byte, error)
+	namespace  string
+	dataSource string
+	hostCall   func(string, string, string, []byte) ([]byte, error)
 }
 
 // Config provides users with the ability to specify namespaces, function handlers and other key information required to execute the
@@ -26,6 +29,10 @@ type Config struct {
 	// Users can provide an alternative namespace by specifying this field.
 	Namespace string
 
+	// DataSource selects a named SQL database configured within Tarmac. When empty, the database bound to the function
+	// within tarmac.json is used, falling back to the default database.
+	DataSource string
+
 	// HostCall is used internally for host callbacks. This is mainly here for testing.
 	HostCall func(string, string, string, []byte) ([]byte, error)
 }
@@ -42,17 +49,149 @@ func New(cfg Config) (*SQL, error) {
 		return &SQL{}, errors.New("HostCall cannot be nil")
 	}
 
-	return &SQL{namespace: cfg.Namespace, hostCall: cfg.HostCall}, nil
+	return &SQL{namespace: cfg.Namespace, dataSource: cfg.DataSource, hostCall: cfg.HostCall}, nil
+}
+
+// Param is a typed bind parameter of a SQL query or statement. Params are created with the String, Int, Float, Bool,
+// Bytes, Null, and Timestamp functions and are passed to the database separately from the query, avoiding the need
+// to build queries from user-supplied data.
+type Param struct {
+	name  string
+	typ   string
+	value string
+}
+
+// String returns a string bind parameter.
+func String(v string) Param {
+	return Param{typ: "string", value: v}
+}
+
+// Int returns an integer bind parameter.
+func Int(v int64) Param {
+	return Param{typ: "int", value: strconv.FormatInt(v, 10)}
+}
+
+// Float returns a floating point bind parameter.
+func Float(v float64) Param {
+	return Param{typ: "float", value: strconv.FormatFloat(v, 'g', -1, 64)}
+}
+
+// Bool returns a boolean bind parameter.
+func Bool(v bool) Param {
+	return Param{typ: "bool", value: strconv.FormatBool(v)}
+}
+
+// Bytes returns a byte slice bind parameter.
+func Bytes(v []byte) Param {
+	return Param{typ: "bytes", value: base64.StdEncoding.EncodeToString(v)}
+}
+
+// Null returns a NULL bind parameter.
+func Null() Param {
+	return Param{typ: "null"}
+}
+
+// Timestamp returns a timestamp bind parameter.
+func Timestamp(v time.Time) Param {
+	return Param{typ: "timestamp", value: v.Format(time.RFC3339Nano)}
+}
+
+// Named binds the parameter to a named placeholder rather than by position. Named placeholders are only supported
+// by some database drivers.
+func Named(name string, p Param) Param {
+	p.name = name
+	return p
+}
+
+// ExecResult is the result of a SQL statement executed with Exec.
+type ExecResult struct {
+	// LastInsertID is the ID of the last inserted row, if the statement was an insert and the database supports it.
+	LastInsertID int64
+
+	// RowsAffected is the number of rows affected by an insert, update, or delete statement.
+	RowsAffected int64
+}
+
+// Tx is a SQL transaction begun with Begin. Queries and statements executed with the Tx are applied atomically once
+// the Tx is committed. Transactions still open when the function execution ends are rolled back by Tarmac.
+type Tx struct {
+	sql    *SQL
+	handle string
 }
 
 // Query will execute the specified SQL query and return a byte array
-// containing a JSON representation of the SQL data.
-func (sql *SQL) Query(q string) ([]byte, error) {
-	// Encode SQL Query
-	qry := base64.StdEncoding.EncodeToString([]byte(q))
+// containing a JSON representation of the SQL data. Any params supplied are bound to placeholders within the query.
+func (sql *SQL) Query(q string, params ...Param) ([]byte, error) {
+	return sql.query("", q, params)
+}
+
+// Exec will execute the specified SQL statement, such as an insert, update, or delete, which does not return rows.
+// Any params supplied are bound to placeholders within the statement.
+func (sql *SQL) Exec(q string, params ...Param) (ExecResult, error) {
+	return sql.exec("", q, params)
+}
+
+// Begin starts a new transaction.
+func (sql *SQL) Begin() (*Tx, error) {
+	rq := []byte("")
+	if sql.dataSource != "" {
+		var a fastjson.Arena
+		o := a.NewObject()
+		o.Set("data_source", a.NewString(sql.dataSource))
+		rq = o.MarshalTo(nil)
+	}
 
+	rsp, err := sql.hostCall(sql.namespace, "sql", "begin", rq)
+	if err != nil {
+		return nil, fmt.Errorf("error while executing host callback - %w", err)
+	}
+
+	handle := fastjson.GetString(rsp, "transaction")
+	if handle == "" {
+		return nil, errors.New("host did not return a transaction")
+	}
+
+	return &Tx{sql: sql, handle: handle}, nil
+}
+
+// Query will execute the specified SQL query within the transaction, returning the same JSON representation as
+// SQL.Query.
+func (tx *Tx) Query(q string, params ...Param) ([]byte, error) {
+	return tx.sql.query(tx.handle, q, params)
+}
+
+// Exec will execute the specified SQL statement within the transaction.
+func (tx *Tx) Exec(q string, params ...Param) (ExecResult, error) {
+	return tx.sql.exec(tx.handle, q, params)
+}
+
+// Commit commits the transaction.
+func (tx *Tx) Commit() error {
+	return tx.end("commit")
+}
+
+// Rollback aborts the transaction, discarding its changes.
+func (tx *Tx) Rollback() error {
+	return tx.end("rollback")
+}
+
+// end commits or rolls back the transaction using the specified host callback.
+func (tx *Tx) end(op string) error {
+	var a fastjson.Arena
+	o := a.NewObject()
+	o.Set("transaction", a.NewString(tx.handle))
+
+	_, err := tx.sql.hostCall(tx.sql.namespace, "sql", op, o.MarshalTo(nil))
+	if err != nil {
+		return fmt.Errorf("error while executing host callback - %w", err)
+	}
+	return nil
+}
+
+// query executes a query, within the transaction referred to by handle when set.
+func (sql *SQL) query(handle, q string, params []Param) ([]byte, error) {
 	// Callback to host
-	rsp, err := sql.hostCall(sql.namespace, "sql", "query", []byte(fmt.Sprintf(`{"query":"%s"}`, qry)))
+	rsp, err := sql.hostCall(sql.namespace, "sql", "query", sql.request(handle, q, params, 0, ""))
 	if err != nil {
 		return []byte(""), fmt.Errorf("error while executing host callback - %w", err)
 	}
@@ -71,3 +210,63 @@ func (sql *SQL) Query(q string) ([]byte, error) {
 
 	return d, nil
 }
+
+// exec executes a statement, within the transaction referred to by handle when set.
+func (sql *SQL) exec(handle, q string, params []Param) (ExecResult, error) {
+	rsp, err := sql.hostCall(sql.namespace, "sql", "exec", sql.request(handle, q, params, 0, ""))
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("error while executing host callback - %w", err)
+	}
+
+	v, err := fastjson.ParseBytes(rsp)
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("unable to parse returned data - %w", err)
+	}
+
+	return ExecResult{
+		LastInsertID: v.GetInt64("last_insert_id"),
+		RowsAffected: v.GetInt64("rows_affected"),
+	}, nil
+}
+
+// request creates the JSON host callback request for a query, its bind parameters, transaction handle, maximum rows,
+// and response format. Queries outside of a transaction are sent to the configured data source.
+func (sql *SQL) request(handle, q string, params []Param, maxRows int, format string) []byte {
+	var a fastjson.Arena
+	o := a.NewObject()
+
+	// Encode SQL Query
+	o.Set("query", a.NewString(base64.StdEncoding.EncodeToString([]byte(q))))
+
+	if len(params) > 0 {
+		arr := a.NewArray()
+		for i, p := range params {
+			po := a.NewObject()
+			if p.name != "" {
+				po.Set("name", a.NewString(p.name))
+			}
+			po.Set("type", a.NewString(p.typ))
+			if p.typ != "null" {
+				po.Set("value", a.NewString(p.value))
+			}
+			arr.SetArrayItem(i, po)
+		}
+		o.Set("params", arr)
+	}
+
+	if handle != "" {
+		o.Set("transaction", a.NewString(handle))
+	} else if sql.dataSource != "" {
+		o.Set("data_source", a.NewString(sql.dataSource))
+	}
+
+	if maxRows > 0 {
+		o.Set("max_rows", a.NewNumberInt(maxRows))
+	}
+
+	if format != "" {
+		o.Set("format", a.NewString(format))
+	}
+
+	return o.MarshalTo(nil)
+}
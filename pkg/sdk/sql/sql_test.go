@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestSQL_Query(t *testing.T) {
@@ -116,3 +118,193 @@ func TestSQL_Query(t *testing.T) {
 		})
 	}
 }
+
+func TestSQL_QueryParams(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	var payload []byte
+	sql, err := New(Config{HostCall: func(_, _, _ string, p []byte) ([]byte, error) {
+		payload = p
+		return []byte(`{"data":""}`), nil
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error while creating SQL instance - %s", err)
+	}
+
+	_, err = sql.Query(
+		"SELECT * FROM users WHERE name = ?;",
+		String(`John "Doe"`), Int(-1), Float(1.5), Bool(true), Bytes([]byte("hi")), Null(), Timestamp(ts),
+		Named("id", Int(7)),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error when calling SQL Query - %s", err)
+	}
+
+	expected := `{"query":"U0VMRUNUICogRlJPTSB1c2VycyBXSEVSRSBuYW1lID0gPzs=","params":[` +
+		`{"type":"string","value":"John \"Doe\""},{"type":"int","value":"-1"},{"type":"float","value":"1.5"},` +
+		`{"type":"bool","value":"true"},{"type":"bytes","value":"aGk="},{"type":"null"},` +
+		`{"type":"timestamp","value":"2024-01-02T15:04:05Z"},{"name":"id","type":"int","value":"7"}]}`
+	if string(payload) != expected {
+		t.Errorf("Unexpected payload - got: %s, expected: %s", payload, expected)
+	}
+}
+
+func TestSQL_Exec(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostCall func(string, string, string, []byte) ([]byte, error)
+		expected ExecResult
+		err      bool
+	}{
+		{
+			name: "success",
+			hostCall: func(namespace, service, endpoint string, payload []byte) ([]byte, error) {
+				if service != "sql" || endpoint != "exec" {
+					return nil, fmt.Errorf("unexpected arguments - service: %s, endpoint: %s", service, endpoint)
+				}
+
+				expectedPayload := `{"query":"REVMRVRFIEZST00gdXNlcnMgV0hFUkUgaWQgPSA/Ow==","params":[{"type":"int","value":"1"}]}`
+				if string(payload) != expectedPayload {
+					return nil, fmt.Errorf("unexpected payload - got: %s, expected: %s", payload, expectedPayload)
+				}
+
+				return []byte(`{"status":{"code":200,"status":"OK"},"last_insert_id":0,"rows_affected":1}`), nil
+			},
+			expected: ExecResult{RowsAffected: 1},
+		},
+		{
+			name: "hostcall error",
+			hostCall: func(namespace, service, endpoint string, payload []byte) ([]byte, error) {
+				return []byte(""), errors.New("an error")
+			},
+			err: true,
+		},
+		{
+			name: "invalid response",
+			hostCall: func(namespace, service, endpoint string, payload []byte) ([]byte, error) {
+				return []byte(`{asdf`), nil
+			},
+			err: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sql, err := New(Config{HostCall: tc.hostCall})
+			if err != nil {
+				t.Fatalf("Unexpected error while creating SQL instance - %s", err)
+			}
+
+			rsp, err := sql.Exec("DELETE FROM users WHERE id = ?;", Int(1))
+			if (err != nil) != tc.err {
+				t.Fatalf("Unexpected error result when calling SQL Exec - %v", err)
+			}
+			if rsp != tc.expected {
+				t.Errorf("Unexpected result - %+v", rsp)
+			}
+		})
+	}
+}
+
+func TestSQL_Transaction(t *testing.T) {
+	var calls []string
+	sql, err := New(Config{HostCall: func(_, _, endpoint string, payload []byte) ([]byte, error) {
+		calls = append(calls, fmt.Sprintf("%s %s", endpoint, payload))
+		if endpoint == "begin" {
+			return []byte(`{"status":{"code":200,"status":"OK"},"transaction":"abc123"}`), nil
+		}
+		return []byte(`{"status":{"code":200,"status":"OK"}}`), nil
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error while creating SQL instance - %s", err)
+	}
+
+	tx, err := sql.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error beginning transaction - %s", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM users WHERE id = ?;", Int(1))
+	if err != nil {
+		t.Fatalf("Unexpected error executing statement - %s", err)
+	}
+
+	_, err = tx.Query("SELECT * FROM users;")
+	if err != nil {
+		t.Fatalf("Unexpected error executing query - %s", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		t.Fatalf("Unexpected error committing transaction - %s", err)
+	}
+
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatalf("Unexpected error rolling back transaction - %s", err)
+	}
+
+	expected := []string{
+		"begin ",
+		`exec {"query":"REVMRVRFIEZST00gdXNlcnMgV0hFUkUgaWQgPSA/Ow==","params":[{"type":"int","value":"1"}],` +
+			`"transaction":"abc123"}`,
+		`query {"query":"U0VMRUNUICogRlJPTSB1c2Vyczs=","transaction":"abc123"}`,
+		`commit {"transaction":"abc123"}`,
+		`rollback {"transaction":"abc123"}`,
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Unexpected host calls - %q", calls)
+	}
+
+	t.Run("Begin Error", func(t *testing.T) {
+		sql, err := New(Config{HostCall: func(string, string, string, []byte) ([]byte, error) {
+			return []byte(`{"status":{"code":500,"status":"failed"}}`), errors.New("failed")
+		}})
+		if err != nil {
+			t.Fatalf("Unexpected error while creating SQL instance - %s", err)
+		}
+
+		_, err = sql.Begin()
+		if err == nil {
+			t.Errorf("Expected error beginning transaction")
+		}
+	})
+}
+
+func TestSQL_DataSource(t *testing.T) {
+	var calls []string
+	sql, err := New(Config{DataSource: "orders", HostCall: func(_, _, endpoint string, payload []byte) ([]byte, error) {
+		calls = append(calls, fmt.Sprintf("%s %s", endpoint, payload))
+		if endpoint == "begin" {
+			return []byte(`{"status":{"code":200,"status":"OK"},"transaction":"abc123"}`), nil
+		}
+		return []byte(`{"status":{"code":200,"status":"OK"}}`), nil
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error while creating SQL instance - %s", err)
+	}
+
+	_, err = sql.Query("SELECT * FROM users;")
+	if err != nil {
+		t.Fatalf("Unexpected error executing query - %s", err)
+	}
+
+	tx, err := sql.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error beginning transaction - %s", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM users;")
+	if err != nil {
+		t.Fatalf("Unexpected error executing statement - %s", err)
+	}
+
+	expected := []string{
+		`query {"query":"U0VMRUNUICogRlJPTSB1c2Vyczs=","data_source":"orders"}`,
+		`begin {"data_source":"orders"}`,
+		`exec {"query":"REVMRVRFIEZST00gdXNlcnM7","transaction":"abc123"}`,
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Unexpected host calls - %q", calls)
+	}
+}
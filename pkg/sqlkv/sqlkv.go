@@ -0,0 +1,613 @@
+/*
+Package sqlkv is a hord.Database driver storing keys within a table of a SQL database, allowing deployments already
+running PostgreSQL, MySQL, or SQLite to use them as a KV store.
+
+	// Create a KV store within an open database
+	kv, err := sqlkv.Dial(sqlkv.Config{
+		DB:      db,
+		Dialect: "postgres",
+	})
+	if err != nil {
+		// do something
+	}
+
+	// Create the table if it does not exist
+	err = kv.Setup()
+	if err != nil {
+		// do something
+	}
+
+Keys are stored within the tarmac_kv table unless another Table is configured. Keys are compared as bytes, so keys
+differing only by case are distinct on every dialect.
+
+Keys stored with a TTL record their expiration within the table, using the clock of the database, and are hidden as
+soon as they expire. Expired rows are deleted every SweepInterval once Setup is called. Scan pages through keys with
+indexed range queries, and the atomic operations of kvext.Atomic are performed with conditional statements, so they
+are atomic between every process sharing the table.
+
+The database is shared with its other users and is not closed by Close.
+*/
+package sqlkv
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tarmac-project/hord"
+
+	"github.com/tarmac-project/tarmac/pkg/kvext"
+)
+
+// DefaultTable is the table keys are stored within when Table is not configured.
+const DefaultTable = "tarmac_kv"
+
+// DefaultSweepInterval is the duration between deletions of expired rows when SweepInterval is not configured.
+const DefaultSweepInterval = 30 * time.Second
+
+// pingTimeout is the maximum duration of a HealthCheck ping.
+const pingTimeout = 5 * time.Second
+
+// tablePattern matches valid table names, which are interpolated within queries.
+var tablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// likeEscaper escapes the pattern characters of LIKE patterns using the ! escape character.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// globEscaper escapes the pattern characters of SQLite GLOB patterns, which have no escape character.
+var globEscaper = strings.NewReplacer("[", "[[]", "*", "[*]", "?", "[?]")
+
+var (
+	// ErrUnknownDialect is returned when the database dialect is not supported.
+	ErrUnknownDialect = errors.New("unknown sql dialect")
+
+	// ErrClosed is returned by operations on a closed Database.
+	ErrClosed = errors.New("kv store is closed")
+)
+
+// Config provides the configuration options of a Database.
+type Config struct {
+	// DB is the database storing keys.
+	DB *sql.DB
+
+	// Dialect is the SQL dialect of the database (Options: mysql, postgres, sqlite).
+	Dialect string
+
+	// Table is the table keys are stored within (Default: tarmac_kv).
+	Table string
+
+	// SweepInterval is the duration between deletions of expired rows (Default: 30s).
+	SweepInterval time.Duration
+}
+
+// dialect holds the statement fragments differing between SQL dialects.
+type dialect struct {
+	// create creates the table.
+	create string
+
+	// now is an expression of the current time of the database in milliseconds since the Unix epoch.
+	now string
+
+	// upsert is the clause of an INSERT replacing the value and expiration of an existing key.
+	upsert string
+
+	// upsertExpired is the clause of an INSERT replacing the value and expiration of an existing key only once it has
+	// expired.
+	upsertExpired string
+
+	// match is the condition matching keys against the pattern returned by pattern for a prefix.
+	match string
+
+	// pattern returns the pattern matching keys beginning with prefix.
+	pattern func(prefix string) string
+
+	// numbered is true when placeholders are numbered ($1) rather than positional (?).
+	numbered bool
+}
+
+// queries are the statements of a dialect.
+type queries struct {
+	create string
+	get    string
+	set    string
+	setTTL string
+	ttl    string
+	delete string
+	keys   string
+	scan   string
+	setNX  string
+	swap   string
+	sweep  string
+}
+
+// Database is a hord.Database storing keys within a SQL table.
+type Database struct {
+	// db is the database storing keys.
+	db *sql.DB
+
+	// q are the statements of the configured dialect and table.
+	q queries
+
+	// pattern returns the Scan pattern of a prefix.
+	pattern func(prefix string) string
+
+	// interval is the duration between deletions of expired rows.
+	interval time.Duration
+
+	// closed is true once Close is called.
+	closed atomic.Bool
+
+	// running is true once Setup starts deleting expired rows.
+	running atomic.Bool
+
+	// start ensures expired rows are deleted by a single goroutine.
+	start sync.Once
+
+	// stop stops deleting expired rows when closed.
+	stop chan struct{}
+
+	// done is closed once expired rows are no longer deleted.
+	done chan struct{}
+
+	// once ensures stop is closed once.
+	once sync.Once
+}
+
+// Dial returns a Database initialized with Config. The table is created by Setup.
+func Dial(cfg Config) (*Database, error) {
+	if cfg.DB == nil {
+		return nil, errors.New("DB cannot be nil")
+	}
+
+	t := cfg.Table
+	if t == "" {
+		t = DefaultTable
+	}
+	if !tablePattern.MatchString(t) {
+		return nil, fmt.Errorf("invalid table name %q", t)
+	}
+
+	like := func(prefix string) string { return likeEscaper.Replace(prefix) + "%" }
+
+	var d dialect
+	switch cfg.Dialect {
+	case "postgres":
+		d = dialect{
+			create: "CREATE TABLE IF NOT EXISTS " + t +
+				` (kv_key TEXT COLLATE "C" PRIMARY KEY, kv_value BYTEA NOT NULL, expires_at BIGINT)`,
+			now:      "CAST(EXTRACT(EPOCH FROM now()) * 1000 AS BIGINT)",
+			upsert:   "ON CONFLICT (kv_key) DO UPDATE SET kv_value = EXCLUDED.kv_value, expires_at = EXCLUDED.expires_at",
+			match:    "kv_key LIKE ? ESCAPE '!'",
+			pattern:  like,
+			numbered: true,
+		}
+		d.upsertExpired = d.upsert + " WHERE " + t + ".expires_at <= " + d.now
+	case "mysql":
+		d = dialect{
+			create: "CREATE TABLE IF NOT EXISTS " + t +
+				" (kv_key VARBINARY(767) PRIMARY KEY, kv_value LONGBLOB NOT NULL, expires_at BIGINT)",
+			now:     "CAST(UNIX_TIMESTAMP(NOW(3)) * 1000 AS SIGNED)",
+			upsert:  "ON DUPLICATE KEY UPDATE kv_value = VALUES(kv_value), expires_at = VALUES(expires_at)",
+			match:   "kv_key LIKE ? ESCAPE '!'",
+			pattern: like,
+		}
+		// Assignments see the expiration before it is replaced, as expires_at is assigned last
+		expired := "expires_at <= " + d.now
+		d.upsertExpired = "ON DUPLICATE KEY UPDATE kv_value = IF(" + expired + ", VALUES(kv_value), kv_value), " +
+			"expires_at = IF(" + expired + ", VALUES(expires_at), expires_at)"
+	case "sqlite":
+		d = dialect{
+			create: "CREATE TABLE IF NOT EXISTS " + t +
+				" (kv_key TEXT PRIMARY KEY, kv_value BLOB NOT NULL, expires_at INTEGER)",
+			now:    "CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)",
+			upsert: "ON CONFLICT (kv_key) DO UPDATE SET kv_value = excluded.kv_value, expires_at = excluded.expires_at",
+			// SQLite LIKE ignores case, while GLOB compares bytes
+			match:   "kv_key GLOB ?",
+			pattern: func(prefix string) string { return globEscaper.Replace(prefix) + "*" },
+		}
+		d.upsertExpired = d.upsert + " WHERE " + t + ".expires_at <= " + d.now
+	default:
+		return nil, fmt.Errorf("%w - %s", ErrUnknownDialect, cfg.Dialect)
+	}
+
+	interval := cfg.SweepInterval
+	if interval <= 0 {
+		interval = DefaultSweepInterval
+	}
+
+	return &Database{
+		db:       cfg.DB,
+		q:        d.queries(t),
+		pattern:  d.pattern,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// queries returns the statements of the dialect for table t.
+func (d dialect) queries(t string) queries {
+	live := "(expires_at IS NULL OR expires_at > " + d.now + ")"
+	q := queries{
+		create: d.create,
+		get:    "SELECT kv_value FROM " + t + " WHERE kv_key = ? AND " + live,
+		set:    "INSERT INTO " + t + " (kv_key, kv_value, expires_at) VALUES (?, ?, NULL) " + d.upsert,
+		setTTL: "INSERT INTO " + t + " (kv_key, kv_value, expires_at) VALUES (?, ?, " + d.now + " + ?) " + d.upsert,
+		ttl:    "SELECT expires_at - " + d.now + " FROM " + t + " WHERE kv_key = ? AND " + live,
+		delete: "DELETE FROM " + t + " WHERE kv_key = ?",
+		keys:   "SELECT kv_key FROM " + t + " WHERE " + live + " ORDER BY kv_key",
+		scan: "SELECT kv_key FROM " + t + " WHERE kv_key >= ? AND kv_key > ? AND " + d.match + " AND " + live +
+			" ORDER BY kv_key LIMIT ?",
+		setNX: "INSERT INTO " + t + " (kv_key, kv_value, expires_at) VALUES (?, ?, " + d.now + " + ?) " +
+			d.upsertExpired,
+		swap:  "UPDATE " + t + " SET kv_value = ?, expires_at = NULL WHERE kv_key = ? AND kv_value = ? AND " + live,
+		sweep: "DELETE FROM " + t + " WHERE expires_at <= " + d.now,
+	}
+	if !d.numbered {
+		return q
+	}
+
+	for _, s := range []*string{&q.get, &q.set, &q.setTTL, &q.ttl, &q.delete, &q.scan, &q.setNX, &q.swap} {
+		*s = number(*s)
+	}
+	return q
+}
+
+// number replaces the positional placeholders of query with numbered placeholders.
+func number(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// Setup creates the table if it does not exist, then starts deleting expired rows every SweepInterval.
+func (d *Database) Setup() error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	_, err := d.db.Exec(d.q.create)
+	if err != nil {
+		return fmt.Errorf("unable to create kv table - %w", err)
+	}
+
+	d.start.Do(func() {
+		d.running.Store(true)
+		go d.run()
+	})
+	return nil
+}
+
+// run deletes expired rows every interval until the Database is closed. Failed deletions are retried on the next
+// interval.
+func (d *Database) run() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			_ = d.Sweep()
+		}
+	}
+}
+
+// Sweep deletes the rows of expired keys, which are hidden from every other operation once they expire.
+func (d *Database) Sweep() error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	_, err := d.db.Exec(d.q.sweep)
+	if err != nil {
+		return fmt.Errorf("unable to delete expired keys - %w", err)
+	}
+	return nil
+}
+
+// HealthCheck pings the database.
+func (d *Database) HealthCheck() error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	return d.db.PingContext(ctx)
+}
+
+// Get fetches the data stored under key, returning hord.ErrNil if the key does not exist or has expired.
+func (d *Database) Get(key string) ([]byte, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+	if err := hord.ValidKey(key); err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	err := d.db.QueryRow(d.q.get, key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, hord.ErrNil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch key %s - %w", key, err)
+	}
+	return data, nil
+}
+
+// Set stores data under key, replacing any existing data and clearing any TTL of the key.
+func (d *Database) Set(key string, data []byte) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+	if err := hord.ValidKey(key); err != nil {
+		return err
+	}
+	if err := hord.ValidData(data); err != nil {
+		return err
+	}
+
+	_, err := d.db.Exec(d.q.set, key, data)
+	if err != nil {
+		return fmt.Errorf("unable to store key %s - %w", key, err)
+	}
+	return nil
+}
+
+// SetWithTTL stores data under key, expiring the key once ttl has elapsed. TTLs are rounded up to whole milliseconds.
+func (d *Database) SetWithTTL(key string, data []byte, ttl time.Duration) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+	if err := hord.ValidKey(key); err != nil {
+		return err
+	}
+	if err := hord.ValidData(data); err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("%w - %s", kvext.ErrInvalidTTL, ttl)
+	}
+
+	_, err := d.db.Exec(d.q.setTTL, key, data, milliseconds(ttl))
+	if err != nil {
+		return fmt.Errorf("unable to store key %s - %w", key, err)
+	}
+	return nil
+}
+
+// TTL returns the duration until key expires, or zero if the key does not expire. Missing and expired keys are
+// reported with hord.ErrNil.
+func (d *Database) TTL(key string) (time.Duration, error) {
+	if d.closed.Load() {
+		return 0, ErrClosed
+	}
+	if err := hord.ValidKey(key); err != nil {
+		return 0, err
+	}
+
+	var ms sql.NullInt64
+	err := d.db.QueryRow(d.q.ttl, key).Scan(&ms)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, hord.ErrNil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unable to fetch ttl of key %s - %w", key, err)
+	}
+	if !ms.Valid {
+		return 0, nil
+	}
+	return time.Duration(ms.Int64) * time.Millisecond, nil
+}
+
+// Delete removes the key. Deleting a missing key is not an error.
+func (d *Database) Delete(key string) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+	if err := hord.ValidKey(key); err != nil {
+		return err
+	}
+
+	_, err := d.db.Exec(d.q.delete, key)
+	if err != nil {
+		return fmt.Errorf("unable to delete key %s - %w", key, err)
+	}
+	return nil
+}
+
+// Keys lists every key in byte order.
+func (d *Database) Keys() ([]string, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+	return d.list(d.q.keys)
+}
+
+// Scan lists keys beginning with prefix in byte order, resuming after cursor, using an indexed range query. It returns
+// up to limit keys along with the last key returned as the cursor when more keys remain. When limit is zero or less,
+// every remaining key is listed.
+func (d *Database) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	if d.closed.Load() {
+		return nil, "", ErrClosed
+	}
+
+	// Fetch one key beyond the limit to find whether more keys remain
+	n := int64(math.MaxInt64)
+	if limit > 0 {
+		n = int64(limit) + 1
+	}
+
+	keys, err := d.list(d.q.scan, prefix, cursor, d.pattern(prefix), n)
+	if err != nil {
+		return nil, "", err
+	}
+	if limit <= 0 || len(keys) <= limit {
+		return keys, "", nil
+	}
+	return keys[:limit], keys[limit-1], nil
+}
+
+// list returns the keys selected by query.
+func (d *Database) list(query string, args ...any) ([]string, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list keys - %w", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var k string
+		err = rows.Scan(&k)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list keys - %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to list keys - %w", err)
+	}
+	return keys, nil
+}
+
+// CompareAndSwap stores data under key if the current value of the key equals old, clearing any TTL of the key. False
+// is returned if the key does not exist, has expired, or holds another value.
+func (d *Database) CompareAndSwap(key string, old, data []byte) (bool, error) {
+	if d.closed.Load() {
+		return false, ErrClosed
+	}
+	if err := hord.ValidKey(key); err != nil {
+		return false, err
+	}
+	if err := hord.ValidData(data); err != nil {
+		return false, err
+	}
+
+	rs, err := d.db.Exec(d.q.swap, data, key, old)
+	if err != nil {
+		return false, fmt.Errorf("unable to swap key %s - %w", key, err)
+	}
+	n, err := rs.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("unable to swap key %s - %w", key, err)
+	}
+	if n > 0 || !bytes.Equal(old, data) {
+		return n > 0, nil
+	}
+
+	// MySQL reports rows left unchanged by an update as unaffected
+	current, err := d.Get(key)
+	if errors.Is(err, hord.ErrNil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(current, old), nil
+}
+
+// SetNX stores data under key if the key does not exist or has expired, returning false otherwise. When ttl is greater
+// than zero, the key expires once ttl has elapsed.
+func (d *Database) SetNX(key string, data []byte, ttl time.Duration) (bool, error) {
+	if d.closed.Load() {
+		return false, ErrClosed
+	}
+	if err := hord.ValidKey(key); err != nil {
+		return false, err
+	}
+	if err := hord.ValidData(data); err != nil {
+		return false, err
+	}
+
+	var ms sql.NullInt64
+	if ttl > 0 {
+		ms = sql.NullInt64{Int64: milliseconds(ttl), Valid: true}
+	}
+
+	rs, err := d.db.Exec(d.q.setNX, key, data, ms)
+	if err != nil {
+		return false, fmt.Errorf("unable to store key %s - %w", key, err)
+	}
+	n, err := rs.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("unable to store key %s - %w", key, err)
+	}
+	return n > 0, nil
+}
+
+// Incr adds delta to the base 10 integer stored under key, returning the new value. Missing keys are treated as zero.
+// The key is updated with CompareAndSwap, retrying when another process modifies it first, and any TTL is cleared.
+func (d *Database) Incr(key string, delta int64) (int64, error) {
+	for {
+		current, err := d.Get(key)
+		if errors.Is(err, hord.ErrNil) {
+			ok, err := d.SetNX(key, []byte(strconv.FormatInt(delta, 10)), 0)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				return delta, nil
+			}
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		v, err := strconv.ParseInt(string(current), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w - %s", kvext.ErrNotInteger, current)
+		}
+		if (delta > 0 && v > math.MaxInt64-delta) || (delta < 0 && v < math.MinInt64-delta) {
+			return 0, fmt.Errorf("%w - increment overflows", kvext.ErrNotInteger)
+		}
+
+		ok, err := d.CompareAndSwap(key, current, []byte(strconv.FormatInt(v+delta, 10)))
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return v + delta, nil
+		}
+	}
+}
+
+// Close stops the Database from being used and stops deleting expired rows. The database itself is left open for its
+// other users.
+func (d *Database) Close() {
+	d.closed.Store(true)
+	d.once.Do(func() {
+		close(d.stop)
+		if d.running.Load() {
+			<-d.done
+		}
+	})
+}
+
+// milliseconds returns ttl rounded up to whole milliseconds, the resolution of stored expirations.
+func milliseconds(ttl time.Duration) int64 {
+	return int64((ttl + time.Millisecond - 1) / time.Millisecond)
+}
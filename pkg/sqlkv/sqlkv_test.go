@@ -0,0 +1,396 @@
+package sqlkv
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tarmac-project/hord"
+
+	"github.com/tarmac-project/tarmac/pkg/kvext"
+
+	// Import SQLite Driver.
+	_ "modernc.org/sqlite"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "tarmac.db")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatalf("Unable to open database - %s", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestDial(t *testing.T) {
+	db := openDB(t)
+
+	tt := []struct {
+		name string
+		cfg  Config
+		err  bool
+	}{
+		{name: "Valid", cfg: Config{DB: db, Dialect: "sqlite"}},
+		{name: "Valid Table", cfg: Config{DB: db, Dialect: "postgres", Table: "kv_cache"}},
+		{name: "Missing DB", cfg: Config{Dialect: "sqlite"}, err: true},
+		{name: "Unknown Dialect", cfg: Config{DB: db, Dialect: "oracle"}, err: true},
+		{name: "Invalid Table", cfg: Config{DB: db, Dialect: "mysql", Table: "kv; DROP TABLE users"}, err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Dial(tc.cfg)
+			if (err != nil) != tc.err {
+				t.Errorf("Unexpected error result - %v", err)
+			}
+		})
+	}
+}
+
+func TestNumber(t *testing.T) {
+	q := number("SELECT kv_key FROM t WHERE kv_key >= ? AND kv_key > ? LIMIT ?")
+	if q != "SELECT kv_key FROM t WHERE kv_key >= $1 AND kv_key > $2 LIMIT $3" {
+		t.Errorf("Unexpected numbered query - %s", q)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	kv, err := Dial(Config{DB: openDB(t), Dialect: "sqlite", SweepInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Unexpected error creating kv store - %s", err)
+	}
+	defer kv.Close()
+	err = kv.Setup()
+	if err != nil {
+		t.Fatalf("Unexpected error setting up kv store - %s", err)
+	}
+
+	t.Run("Invalid TTL", func(t *testing.T) {
+		err := kv.SetWithTTL("session", []byte("data"), 0)
+		if !errors.Is(err, kvext.ErrInvalidTTL) {
+			t.Errorf("Unexpected error setting key - %v", err)
+		}
+	})
+
+	t.Run("Expires", func(t *testing.T) {
+		err := kv.SetWithTTL("session", []byte("data"), 50*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		ttl, err := kv.TTL("session")
+		if err != nil || ttl <= 0 || ttl > 50*time.Millisecond {
+			t.Errorf("Unexpected ttl of key - %s, %v", ttl, err)
+		}
+		data, err := kv.Get("session")
+		if err != nil || string(data) != "data" {
+			t.Fatalf("Unexpected value fetched before expiry - %q, %v", data, err)
+		}
+
+		time.Sleep(60 * time.Millisecond)
+		_, err = kv.Get("session")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected error fetching expired key - %v", err)
+		}
+		_, err = kv.TTL("session")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected error fetching ttl of expired key - %v", err)
+		}
+		keys, err := kv.Keys()
+		if err != nil || len(keys) != 0 {
+			t.Errorf("Unexpected keys listed after expiry - %v, %v", keys, err)
+		}
+
+		// Wait for the expired row to be deleted
+		time.Sleep(50 * time.Millisecond)
+		var n int
+		err = kv.db.QueryRow("SELECT COUNT(*) FROM " + DefaultTable).Scan(&n)
+		if err != nil || n != 0 {
+			t.Errorf("Unexpected rows remaining after sweep - %d, %v", n, err)
+		}
+	})
+
+	t.Run("Set Clears TTL", func(t *testing.T) {
+		err := kv.SetWithTTL("persisted", []byte("data"), time.Minute)
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+		err = kv.Set("persisted", []byte("data"))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		ttl, err := kv.TTL("persisted")
+		if err != nil || ttl != 0 {
+			t.Errorf("Unexpected ttl of key without ttl - %s, %v", ttl, err)
+		}
+	})
+
+	t.Run("Missing Key TTL", func(t *testing.T) {
+		_, err := kv.TTL("missing")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected error fetching ttl of missing key - %v", err)
+		}
+	})
+}
+
+func TestScan(t *testing.T) {
+	kv, err := Dial(Config{DB: openDB(t), Dialect: "sqlite"})
+	if err != nil {
+		t.Fatalf("Unexpected error creating kv store - %s", err)
+	}
+	defer kv.Close()
+	err = kv.Setup()
+	if err != nil {
+		t.Fatalf("Unexpected error setting up kv store - %s", err)
+	}
+
+	for _, k := range []string{"user:b", "user:a", "User:c", "user*:d", "session:a", "user:c"} {
+		err := kv.Set(k, []byte(k))
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+	}
+	err = kv.SetWithTTL("user:expired", []byte("data"), time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error setting key - %s", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	tt := []struct {
+		name   string
+		prefix string
+		cursor string
+		limit  int
+		keys   string
+		next   string
+	}{
+		{name: "Every Key", keys: "User:c,session:a,user*:d,user:a,user:b,user:c"},
+		{name: "Prefix", prefix: "user:", keys: "user:a,user:b,user:c"},
+		{name: "Pattern Characters", prefix: "user*", keys: "user*:d"},
+		{name: "First Page", prefix: "user:", limit: 2, keys: "user:a,user:b", next: "user:b"},
+		{name: "Last Page", prefix: "user:", cursor: "user:b", limit: 2, keys: "user:c"},
+		{name: "Exact Page", prefix: "user:", limit: 3, keys: "user:a,user:b,user:c"},
+		{name: "No Match", prefix: "missing:"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			keys, next, err := kv.Scan(tc.prefix, tc.cursor, tc.limit)
+			if err != nil {
+				t.Fatalf("Unexpected error scanning keys - %s", err)
+			}
+			if strings.Join(keys, ",") != tc.keys || next != tc.next {
+				t.Errorf("Unexpected scan result - %v, %q", keys, next)
+			}
+		})
+	}
+}
+
+func TestAtomic(t *testing.T) {
+	kv, err := Dial(Config{DB: openDB(t), Dialect: "sqlite"})
+	if err != nil {
+		t.Fatalf("Unexpected error creating kv store - %s", err)
+	}
+	defer kv.Close()
+	err = kv.Setup()
+	if err != nil {
+		t.Fatalf("Unexpected error setting up kv store - %s", err)
+	}
+
+	t.Run("SetNX", func(t *testing.T) {
+		ok, err := kv.SetNX("lock", []byte("a"), 0)
+		if err != nil || !ok {
+			t.Fatalf("Unexpected result setting missing key - %t, %v", ok, err)
+		}
+		ok, err = kv.SetNX("lock", []byte("b"), 0)
+		if err != nil || ok {
+			t.Errorf("Unexpected result setting existing key - %t, %v", ok, err)
+		}
+
+		data, err := kv.Get("lock")
+		if err != nil || string(data) != "a" {
+			t.Errorf("Unexpected value fetched - %q, %v", data, err)
+		}
+	})
+
+	t.Run("SetNX with TTL", func(t *testing.T) {
+		ok, err := kv.SetNX("lease", []byte("a"), 20*time.Millisecond)
+		if err != nil || !ok {
+			t.Fatalf("Unexpected result setting missing key - %t, %v", ok, err)
+		}
+		ok, err = kv.SetNX("lease", []byte("b"), 20*time.Millisecond)
+		if err != nil || ok {
+			t.Errorf("Unexpected result setting existing key - %t, %v", ok, err)
+		}
+
+		// Expired keys are replaced, though their rows have not been deleted
+		time.Sleep(30 * time.Millisecond)
+		ok, err = kv.SetNX("lease", []byte("c"), 0)
+		if err != nil || !ok {
+			t.Errorf("Unexpected result setting expired key - %t, %v", ok, err)
+		}
+		ttl, err := kv.TTL("lease")
+		if err != nil || ttl != 0 {
+			t.Errorf("Unexpected ttl of key without ttl - %s, %v", ttl, err)
+		}
+	})
+
+	t.Run("CompareAndSwap", func(t *testing.T) {
+		err := kv.SetWithTTL("cas", []byte("a"), time.Minute)
+		if err != nil {
+			t.Fatalf("Unexpected error setting key - %s", err)
+		}
+
+		ok, err := kv.CompareAndSwap("cas", []byte("b"), []byte("c"))
+		if err != nil || ok {
+			t.Errorf("Unexpected result swapping mismatched value - %t, %v", ok, err)
+		}
+		ok, err = kv.CompareAndSwap("cas", []byte("a"), []byte("c"))
+		if err != nil || !ok {
+			t.Errorf("Unexpected result swapping matching value - %t, %v", ok, err)
+		}
+		ok, err = kv.CompareAndSwap("cas", []byte("c"), []byte("c"))
+		if err != nil || !ok {
+			t.Errorf("Unexpected result swapping unchanged value - %t, %v", ok, err)
+		}
+		ok, err = kv.CompareAndSwap("missing", []byte("a"), []byte("c"))
+		if err != nil || ok {
+			t.Errorf("Unexpected result swapping missing key - %t, %v", ok, err)
+		}
+
+		ttl, err := kv.TTL("cas")
+		if err != nil || ttl != 0 {
+			t.Errorf("Unexpected ttl of swapped key - %s, %v", ttl, err)
+		}
+	})
+
+	t.Run("Incr", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := kv.Incr("counter", 2)
+				if err != nil {
+					t.Errorf("Unexpected error incrementing key - %s", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		n, err := kv.Incr("counter", -1)
+		if err != nil || n != 19 {
+			t.Errorf("Unexpected result incrementing key - %d, %v", n, err)
+		}
+
+		_, err = kv.Incr("lock", 1)
+		if !errors.Is(err, kvext.ErrNotInteger) {
+			t.Errorf("Unexpected error incrementing non-integer key - %v", err)
+		}
+	})
+}
+
+func TestDatabase(t *testing.T) {
+	db := openDB(t)
+	kv, err := Dial(Config{DB: db, Dialect: "sqlite"})
+	if err != nil {
+		t.Fatalf("Unexpected error creating kv store - %s", err)
+	}
+
+	// Setup is repeatable, as every instance sharing the database runs it
+	for range 2 {
+		err = kv.Setup()
+		if err != nil {
+			t.Fatalf("Unexpected error setting up kv store - %s", err)
+		}
+	}
+
+	err = kv.HealthCheck()
+	if err != nil {
+		t.Errorf("Unexpected error checking health - %s", err)
+	}
+
+	t.Run("Set and Get", func(t *testing.T) {
+		for _, data := range []string{"one", "two"} {
+			err := kv.Set("key", []byte(data))
+			if err != nil {
+				t.Fatalf("Unexpected error setting key - %s", err)
+			}
+
+			got, err := kv.Get("key")
+			if err != nil || string(got) != data {
+				t.Errorf("Unexpected value fetched - %q, %v", got, err)
+			}
+		}
+
+		_, err := kv.Get("missing")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected error fetching missing key - %v", err)
+		}
+	})
+
+	t.Run("Invalid Input", func(t *testing.T) {
+		err := kv.Set("", []byte("data"))
+		if !errors.Is(err, hord.ErrInvalidKey) {
+			t.Errorf("Unexpected error setting empty key - %v", err)
+		}
+		err = kv.Set("key", nil)
+		if !errors.Is(err, hord.ErrInvalidData) {
+			t.Errorf("Unexpected error setting empty data - %v", err)
+		}
+	})
+
+	t.Run("Keys", func(t *testing.T) {
+		for _, k := range []string{"b", "A", "a"} {
+			err := kv.Set(k, []byte(k))
+			if err != nil {
+				t.Fatalf("Unexpected error setting key - %s", err)
+			}
+		}
+
+		keys, err := kv.Keys()
+		if err != nil || strings.Join(keys, ",") != "A,a,b,key" {
+			t.Errorf("Unexpected keys listed - %v, %v", keys, err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		err := kv.Delete("key")
+		if err != nil {
+			t.Fatalf("Unexpected error deleting key - %s", err)
+		}
+		_, err = kv.Get("key")
+		if !errors.Is(err, hord.ErrNil) {
+			t.Errorf("Unexpected error fetching deleted key - %v", err)
+		}
+
+		err = kv.Delete("key")
+		if err != nil {
+			t.Errorf("Unexpected error deleting missing key - %s", err)
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		kv.Close()
+
+		_, err := kv.Get("a")
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("Unexpected error fetching key after close - %v", err)
+		}
+		err = kv.HealthCheck()
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("Unexpected error checking health after close - %v", err)
+		}
+
+		err = db.Ping()
+		if err != nil {
+			t.Errorf("Unexpected error pinging database after close - %s", err)
+		}
+	})
+}
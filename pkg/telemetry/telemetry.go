@@ -24,6 +24,24 @@ type Telemetry struct {
 
 	// Routes is a gauge metric of the configured service routes.
 	Routes *prometheus.GaugeVec
+
+	// Messages is a summary metric of NATS messages processed by WASM functions.
+	Messages *prometheus.SummaryVec
+
+	// Leaders is a gauge metric of the leadership status of singleton scheduled tasks on this node.
+	Leaders *prometheus.GaugeVec
+
+	// Timeouts is a counter metric of WASM guest module executions stopped for exceeding their timeout.
+	Timeouts *prometheus.CounterVec
+
+	// MemoryLimits is a counter metric of WASM guest module instances replaced after reaching their memory limit.
+	MemoryLimits *prometheus.CounterVec
+
+	// Reloads is a counter metric of service configuration reloads.
+	Reloads *prometheus.CounterVec
+
+	// KVCache is a counter metric of KV store cache lookups.
+	KVCache *prometheus.CounterVec
 }
 
 // New creates and returns an initialized Telemetry instance with default metrics.
@@ -62,6 +80,14 @@ func New() *Telemetry {
 		[]string{"route"},
 	)
 
+	m.Messages = promauto.NewSummaryVec(prometheus.SummaryOpts{
+		Name:       "nats_messages",
+		Help:       "Summary of NATS messages processed by WASM functions",
+		Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+	},
+		[]string{"topic"},
+	)
+
 	m.Routes = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "service_routes",
 		Help: "Number of configured service routes",
@@ -69,6 +95,41 @@ func New() *Telemetry {
 		[]string{"service", "type"},
 	)
 
+	m.Leaders = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scheduled_task_leader",
+		Help: "Leadership status of singleton scheduled tasks, 1 when this node is the leader",
+	},
+		[]string{"task", "node"},
+	)
+
+	m.Timeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wasm_function_timeouts",
+		Help: "Number of wasm function executions stopped for exceeding their timeout",
+	},
+		[]string{"function"},
+	)
+
+	m.MemoryLimits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wasm_function_memory_limits",
+		Help: "Number of wasm function instances replaced after reaching their memory limit",
+	},
+		[]string{"function"},
+	)
+
+	m.Reloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "service_reloads",
+		Help: "Number of service configuration reloads",
+	},
+		[]string{"status"},
+	)
+
+	m.KVCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kvstore_cache_lookups",
+		Help: "Number of KV store cache lookups, by data source and result (hit or miss)",
+	},
+		[]string{"data_source", "result"},
+	)
+
 	return m
 }
 
@@ -78,5 +139,11 @@ func (t *Telemetry) Close() {
 	_ = prometheus.Unregister(t.Srv)
 	_ = prometheus.Unregister(t.Callbacks)
 	_ = prometheus.Unregister(t.Wasm)
+	_ = prometheus.Unregister(t.Messages)
 	_ = prometheus.Unregister(t.Routes)
+	_ = prometheus.Unregister(t.Leaders)
+	_ = prometheus.Unregister(t.Timeouts)
+	_ = prometheus.Unregister(t.MemoryLimits)
+	_ = prometheus.Unregister(t.Reloads)
+	_ = prometheus.Unregister(t.KVCache)
 }
@@ -33,6 +33,22 @@ func TestNewTelemetry(t *testing.T) {
 			routeLabels := prometheus.Labels{"service": "service1", "type": "http"}
 			tm.Routes.With(routeLabels).Inc()
 			tm.Routes.With(routeLabels).Dec()
+
+			timeoutLabels := prometheus.Labels{"function": "function1"}
+			tm.Timeouts.With(timeoutLabels).Inc()
+			tm.MemoryLimits.With(timeoutLabels).Inc()
+
+			messageLabels := prometheus.Labels{"topic": "orders.*"}
+			tm.Messages.With(messageLabels).Observe(0.4)
+
+			leaderLabels := prometheus.Labels{"task": "task1", "node": "node1"}
+			tm.Leaders.With(leaderLabels).Set(1)
+
+			reloadLabels := prometheus.Labels{"status": "success"}
+			tm.Reloads.With(reloadLabels).Inc()
+
+			cacheLabels := prometheus.Labels{"data_source": "cache", "result": "hit"}
+			tm.KVCache.With(cacheLabels).Inc()
 		})
 	}
 }
@@ -4,6 +4,22 @@ Package wasm is a Web Assembly Runtime wrapper for Tarmac.
 This package is deprecated and will be removed in a future release.
 
 Use github.com/tarmac-project/wapc-toolkit instead.
+
+Modules are executed using the wazero runtime, with each execution bound to a context. When the context is canceled
+or its deadline expires, the executing module instance is stopped and replaced within the module pool. Likewise,
+instances failing after being refused memory beyond the module memory limit are replaced, releasing their memory.
+Instances that cannot be replaced leave their pool slot empty until a later execution refills it, and executions
+fail with ErrPoolEmpty rather than waiting on a pool without instances.
+
+The context passed to host callbacks carries the name of the calling module, available using ModuleName, and is
+canceled when the execution ends so callbacks can release resources bound to the execution.
+
+Modules can be reloaded while the Server is running. Loading a module with the name of an existing module atomically
+replaces it, and the replaced module is closed once its in-flight executions complete.
+
+Tarmac itself continues to run modules using this package until github.com/tarmac-project/wapc-toolkit/engine can
+run modules with a context, as function timeouts, memory limits, and reloads depend on it. This is an interim measure
+and does not lift the deprecation.
 */
 package wasm
 
@@ -13,10 +29,15 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/experimental"
+	"github.com/tetratelabs/wazero/imports/assemblyscript"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
 	wapc "github.com/wapc/wapc-go"
-	"github.com/wapc/wapc-go/engines/wazero"
+	wapcwazero "github.com/wapc/wapc-go/engines/wazero"
 )
 
 const (
@@ -25,8 +46,38 @@ const (
 
 	// DefaultPoolTimeout is the default pool timeout in seconds.
 	DefaultPoolTimeout = 5
+
+	// MaxMemoryPages is the maximum number of 64KiB memory pages a module can use.
+	MaxMemoryPages = 65536
+
+	// pageSize is the size in bytes of a WASM memory page.
+	pageSize = 65536
+)
+
+var (
+	// ErrModuleClosed is returned when executing a module that has been replaced or unloaded. Callers should fetch the
+	// module from the Server again.
+	ErrModuleClosed = errors.New("module closed")
+
+	// ErrMemoryLimit is returned when an execution fails after the instance was refused memory beyond the module memory
+	// limit.
+	ErrMemoryLimit = errors.New("module memory limit reached")
+
+	// ErrPoolEmpty is returned when executing a module whose pool has no instances, as every instance failed to be
+	// replaced and could not be refilled.
+	ErrPoolEmpty = errors.New("module pool has no instances")
 )
 
+// moduleKey is the context key of the name of the module performing a host callback.
+type moduleKey struct{}
+
+// ModuleName returns the name of the module performing the host callback, or an empty string when ctx was not
+// provided by a host callback.
+func ModuleName(ctx context.Context) string {
+	name, _ := ctx.Value(moduleKey{}).(string)
+	return name
+}
+
 // Config is used to configure the initial WASM Server.
 type Config struct {
 
@@ -55,6 +106,10 @@ type ModuleConfig struct {
 
 	// PoolSize is used to control the size of the WASM Module Pool.
 	PoolSize int
+
+	// MaxMemoryPages limits the linear memory of each module instance to the number of 64KiB pages. The default value
+	// of 0 uses the MaxMemoryPages limit of the runtime.
+	MaxMemoryPages uint32
 }
 
 // Module is a specific WASM Module that can be loaded into the engine.
@@ -76,6 +131,24 @@ type Module struct {
 
 	// poolSize will determine the size of a module pool.
 	poolSize uint64
+
+	// maxMemoryPages is the memory limit of each module instance in pages, 0 when unlimited.
+	maxMemoryPages uint32
+
+	// mu protects closed.
+	mu sync.Mutex
+
+	// closed is true once the module has been replaced or unloaded, after which no new executions are started.
+	closed bool
+
+	// inflight tracks executions in progress, allowing replaced modules to be closed once drained.
+	inflight sync.WaitGroup
+
+	// refillMu serializes refilling the module pool.
+	refillMu sync.Mutex
+
+	// missing counts pool slots left empty by instances that could not be replaced.
+	missing atomic.Uint64
 }
 
 // NewServer will create a new Server with the Engine and Module Store pre-loaded.
@@ -102,10 +175,91 @@ func (s *Server) Shutdown() {
 	}
 }
 
-// LoadModule will read and load the WASM module from the filesysem.
+// LoadModule will read and load the WASM module from the filesysem. An existing module with the same name is replaced.
 func (s *Server) LoadModule(cfg ModuleConfig) error {
+	return s.LoadModules(cfg)
+}
+
+// LoadModules will read and load the WASM modules from the filesystem. Modules are only made available once all of
+// them have loaded successfully, at which point they atomically replace any existing modules with the same name.
+// Replaced modules are closed once their in-flight executions complete.
+func (s *Server) LoadModules(cfgs ...ModuleConfig) error {
+	staged, err := s.PrepareModules(cfgs...)
+	if err != nil {
+		return err
+	}
+	s.ActivateModules(staged)
+	return nil
+}
+
+// StagedModules are modules loaded by PrepareModules which are not yet available for execution.
+type StagedModules struct {
+	// modules are the loaded modules.
+	modules []*Module
+}
+
+// Close closes staged modules which will not be activated. Closing activated modules has no effect.
+func (sm *StagedModules) Close() {
+	if sm == nil {
+		return
+	}
+	for _, m := range sm.modules {
+		m.close()
+	}
+	sm.modules = nil
+}
+
+// PrepareModules will read and load the WASM modules from the filesystem without making them available. The modules
+// replace any existing modules with the same name once passed to ActivateModules, or must be released with Close.
+func (s *Server) PrepareModules(cfgs ...ModuleConfig) (*StagedModules, error) {
+	staged := &StagedModules{modules: make([]*Module, 0, len(cfgs))}
+	for _, cfg := range cfgs {
+		m, err := s.newModule(cfg)
+		if err != nil {
+			staged.Close()
+			return nil, err
+		}
+		staged.modules = append(staged.modules, m)
+	}
+	return staged, nil
+}
+
+// ActivateModules atomically replaces any existing modules with the staged modules of the same name. Replaced modules
+// are closed once their in-flight executions complete.
+func (s *Server) ActivateModules(sm *StagedModules) {
+	if sm == nil {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	for _, m := range sm.modules {
+		if old, ok := s.modules[m.Name]; ok {
+			go old.drain()
+		}
+		s.modules[m.Name] = m
+	}
+	sm.modules = nil
+}
+
+// UnloadModule removes the specified module from the Server. The module is closed once its in-flight executions
+// complete.
+func (s *Server) UnloadModule(key string) {
+	s.Lock()
+	defer s.Unlock()
+	if m, ok := s.modules[key]; ok {
+		delete(s.modules, key)
+		go m.drain()
+	}
+}
+
+// newModule reads the WASM module from the filesystem and creates the module pool.
+func (s *Server) newModule(cfg ModuleConfig) (*Module, error) {
 	if cfg.Name == "" || cfg.Filepath == "" {
-		return errors.New("key and file cannot be empty")
+		return nil, errors.New("key and file cannot be empty")
+	}
+	if cfg.MaxMemoryPages > MaxMemoryPages {
+		return nil, fmt.Errorf("max memory pages cannot exceed %d", MaxMemoryPages)
 	}
 
 	// Create Module
@@ -113,10 +267,8 @@ func (s *Server) LoadModule(cfg ModuleConfig) error {
 		Name: cfg.Name,
 	}
 
-	// Create context
-	m.ctx, m.cancel = context.WithCancel(context.Background())
-
-	// Set Pool Size
+	// Set Pool Size and Memory Limit
+	m.maxMemoryPages = cfg.MaxMemoryPages
 	m.poolSize = uint64(cfg.PoolSize)
 	if cfg.PoolSize == 0 {
 		m.poolSize = uint64(DefaultPoolSize)
@@ -125,33 +277,43 @@ func (s *Server) LoadModule(cfg ModuleConfig) error {
 	// Read the WASM module file
 	guest, err := os.ReadFile(cfg.Filepath)
 	if err != nil {
-		return fmt.Errorf("unable to read wasm module file - %w", err)
+		return nil, fmt.Errorf("unable to read wasm module file - %w", err)
 	}
 
+	// Create context
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+
 	// Initiate waPC Engine
-	engine := wazero.Engine()
+	engine := wapcwazero.EngineWithRuntime(newRuntime)
+
+	// Identify the module within the context of its host callbacks
+	callback := func(ctx context.Context, binding, namespace, op string, payload []byte) ([]byte, error) {
+		return s.callback(context.WithValue(ctx, moduleKey{}, m.Name), binding, namespace, op, payload)
+	}
 
 	// Create a new Module from file contents
-	m.module, err = engine.New(m.ctx, s.callback, guest, &wapc.ModuleConfig{
+	m.module, err = engine.New(m.ctx, callback, guest, &wapc.ModuleConfig{
 		Logger: wapc.PrintlnLogger,
 		Stdout: os.Stdout,
 		Stderr: os.Stderr,
 	})
 	if err != nil {
-		return fmt.Errorf("unable to load module with wasm file %s - %w", cfg.Filepath, err)
+		m.cancel()
+		return nil, fmt.Errorf("unable to load module with wasm file %s - %w", cfg.Filepath, err)
+	}
+	if m.maxMemoryPages > 0 {
+		m.module = &limitedModule{Module: m.module, max: uint64(m.maxMemoryPages) * pageSize}
 	}
 
 	// Create pool for module
 	m.pool, err = wapc.NewPool(m.ctx, m.module, m.poolSize)
 	if err != nil {
-		return fmt.Errorf("unable to create module pool for wasm file %s - %w", cfg.Filepath, err)
+		_ = m.module.Close(m.ctx)
+		m.cancel()
+		return nil, fmt.Errorf("unable to create module pool for wasm file %s - %w", cfg.Filepath, err)
 	}
 
-	s.Lock()
-	defer s.Unlock()
-	s.modules[m.Name] = m
-
-	return nil
+	return m, nil
 }
 
 // Module will return the WASMModule stored for the specified WASM module.
@@ -167,23 +329,288 @@ func (s *Server) Module(key string) (*Module, error) {
 
 // Run will fetch an instance from the module pool and execute it.
 func (m *Module) Run(handler string, payload []byte) ([]byte, error) {
+	return m.RunWithContext(m.ctx, handler, payload)
+}
+
+// RunWithContext will fetch an instance from the module pool and execute it using the provided context. The context
+// is passed to any host callbacks made during execution, and canceled once the execution ends. If the context is
+// canceled or its deadline expires, the execution is stopped, and the returned error will wrap the context error.
+func (m *Module) RunWithContext(ctx context.Context, handler string, payload []byte) ([]byte, error) {
 	var r []byte
-	i, err := m.pool.Get(DefaultPoolTimeout * time.Second)
+
+	if ctx.Err() != nil {
+		return r, fmt.Errorf("could not fetch module from pool - %w", ctx.Err())
+	}
+
+	// Track the execution so the module is not closed while in use
+	if !m.acquire() {
+		return r, fmt.Errorf("could not fetch module from pool - %w", ErrModuleClosed)
+	}
+	defer m.inflight.Done()
+
+	// Wait for an instance no longer than the context allows
+	timeout := DefaultPoolTimeout * time.Second
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+		if timeout <= 0 {
+			return r, fmt.Errorf("could not fetch module from pool - %w", context.DeadlineExceeded)
+		}
+	}
+
+	// Refill slots left empty by failed replacements rather than waiting on an empty pool
+	err := m.refill()
 	if err != nil {
 		return r, fmt.Errorf("could not fetch module from pool - %w", err)
 	}
 
+	i, err := m.pool.Get(timeout)
+	if err != nil {
+		if ctx.Err() != nil {
+			return r, fmt.Errorf("could not fetch module from pool - %w", ctx.Err())
+		}
+		return r, fmt.Errorf("could not fetch module from pool - %w", err)
+	}
+
+	// Callbacks receive a context canceled when the execution ends
+	ictx, cancel := context.WithCancel(ctx)
+	resetMemoryLimit(i)
+	r, err = i.Invoke(ictx, handler, payload)
+	cancel()
+	if err != nil && ctx.Err() != nil {
+		// The runtime closes instances when the context is done, replace it with a new instance
+		rErr := m.replace(i)
+		if rErr != nil {
+			return r, fmt.Errorf("invocation of WASM module stopped - %w", errors.Join(ctx.Err(), rErr))
+		}
+		return r, fmt.Errorf("invocation of WASM module stopped - %w", ctx.Err())
+	}
+
+	if err != nil && memoryLimitExceeded(i) {
+		// Replace the instance to release the memory it has grown
+		rErr := m.replace(i)
+		if rErr != nil {
+			return r, fmt.Errorf("invocation of WASM module failed - %w", errors.Join(ErrMemoryLimit, err, rErr))
+		}
+		return r, fmt.Errorf("invocation of WASM module failed - %w", errors.Join(ErrMemoryLimit, err))
+	}
+
 	defer func() {
 		err := m.pool.Return(i)
 		if err != nil {
+			m.missing.Add(1)
 			defer i.Close(m.ctx)
 		}
 	}()
 
-	r, err = i.Invoke(m.ctx, handler, payload)
 	if err != nil {
 		return r, fmt.Errorf("invocation of WASM module failed - %w", err)
 	}
 
 	return r, nil
 }
+
+// acquire registers an in-flight execution, returning false if the module is closed.
+func (m *Module) acquire() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return false
+	}
+	m.inflight.Add(1)
+	return true
+}
+
+// drain stops new executions of the module and closes it once in-flight executions complete.
+func (m *Module) drain() {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+
+	m.inflight.Wait()
+	m.close()
+}
+
+// close closes the module pool, instances, and runtime.
+func (m *Module) close() {
+	m.pool.Close(m.ctx)
+	_ = m.module.Close(m.ctx)
+	m.cancel()
+}
+
+// replace closes the given instance and adds a newly created instance to the module pool in its place. If the
+// replacement cannot be added, the slot is recorded as missing so it is refilled by a later execution.
+func (m *Module) replace(i wapc.Instance) error {
+	_ = i.Close(m.ctx)
+
+	err := m.fill()
+	if err != nil {
+		m.missing.Add(1)
+		return err
+	}
+	return nil
+}
+
+// refill adds newly created instances to the module pool for slots left empty by failed replacements. It returns
+// ErrPoolEmpty when the pool has no instances and none could be created.
+func (m *Module) refill() error {
+	if m.missing.Load() == 0 {
+		return nil
+	}
+
+	m.refillMu.Lock()
+	defer m.refillMu.Unlock()
+
+	for m.missing.Load() > 0 {
+		err := m.fill()
+		if err != nil {
+			if m.missing.Load() >= m.poolSize {
+				return errors.Join(ErrPoolEmpty, err)
+			}
+			// Executions continue with the remaining instances
+			return nil
+		}
+		m.missing.Add(^uint64(0))
+	}
+	return nil
+}
+
+// fill creates a module instance and adds it to the module pool.
+func (m *Module) fill() error {
+	n, err := m.module.Instantiate(m.ctx)
+	if err != nil {
+		return fmt.Errorf("unable to create replacement module instance - %w", err)
+	}
+
+	err = m.pool.Return(n)
+	if err != nil {
+		_ = n.Close(m.ctx)
+		return fmt.Errorf("unable to return replacement module instance to pool - %w", err)
+	}
+	return nil
+}
+
+// newRuntime creates the wazero runtime for a module. The runtime is configured to stop executions once the context
+// passed to the execution is done. Memory limits are applied by limitedModule rather than the runtime, as the runtime
+// refuses memory beyond its limit without reporting it.
+func newRuntime(ctx context.Context) (wazero.Runtime, error) {
+	cfg := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	return instantiateRuntime(ctx, wazero.NewRuntimeWithConfig(ctx, cfg))
+}
+
+// instantiateRuntime instantiates the host modules required by guests within the runtime.
+func instantiateRuntime(ctx context.Context, r wazero.Runtime) (wazero.Runtime, error) {
+	_, err := wasi_snapshot_preview1.Instantiate(ctx, r)
+	if err != nil {
+		_ = r.Close(ctx)
+		return nil, err
+	}
+
+	// Disable the AssemblyScript abort message to match other engines
+	envBuilder := r.NewHostModuleBuilder("env")
+	assemblyscript.NewFunctionExporter().WithAbortMessageDisabled().ExportFunctions(envBuilder)
+	_, err = envBuilder.Instantiate(ctx)
+	if err != nil {
+		_ = r.Close(ctx)
+		return nil, err
+	}
+	return r, nil
+}
+
+// limitedModule wraps a module, limiting the linear memory of each instance to max bytes.
+type limitedModule struct {
+	wapc.Module
+
+	// max is the memory limit of each instance in bytes.
+	max uint64
+}
+
+// Instantiate creates an instance of the module whose memory is allocated by a memoryLimit. Instances requiring more
+// memory than the limit to instantiate are closed and an error returned.
+func (m *limitedModule) Instantiate(ctx context.Context) (wapc.Instance, error) {
+	limit := &memoryLimit{max: m.max}
+	i, err := m.Module.Instantiate(experimental.WithMemoryAllocator(ctx, limit))
+	if err != nil {
+		return nil, err
+	}
+	if limit.exceeded.Load() {
+		_ = i.Close(ctx)
+		return nil, fmt.Errorf("module instance requires more than %d memory pages - %w", m.max/pageSize,
+			ErrMemoryLimit)
+	}
+	return &limitedInstance{Instance: i, limit: limit}, nil
+}
+
+// limitedInstance is an instance of a limitedModule.
+type limitedInstance struct {
+	wapc.Instance
+
+	// limit allocates the memory of the instance.
+	limit *memoryLimit
+}
+
+// resetMemoryLimit clears the record of the instance being refused memory, ahead of an execution.
+func resetMemoryLimit(i wapc.Instance) {
+	if li, ok := i.(*limitedInstance); ok {
+		li.limit.exceeded.Store(false)
+	}
+}
+
+// memoryLimitExceeded returns true if the instance has been refused memory beyond its limit since it was last reset.
+func memoryLimitExceeded(i wapc.Instance) bool {
+	li, ok := i.(*limitedInstance)
+	return ok && li.limit.exceeded.Load()
+}
+
+// memoryLimit is a wazero memory allocator limiting linear memory to max bytes. Growing memory beyond the limit is
+// refused, which guests observe as memory.grow returning -1, and recorded so failures can be attributed to the limit.
+type memoryLimit struct {
+	// max is the memory limit in bytes.
+	max uint64
+
+	// exceeded is true once memory has been requested beyond max.
+	exceeded atomic.Bool
+}
+
+// Allocate implements experimental.MemoryAllocator, returning a linear memory limited to max bytes.
+func (l *memoryLimit) Allocate(capacity, _ uint64) experimental.LinearMemory {
+	return &limitedMemory{limit: l, buf: make([]byte, 0, capacity)}
+}
+
+// limitedMemory is a linear memory allocated by a memoryLimit.
+type limitedMemory struct {
+	// limit is the memoryLimit the memory was allocated by.
+	limit *memoryLimit
+
+	// buf is the memory buffer.
+	buf []byte
+
+	// allocated is true once the initial memory has been allocated.
+	allocated bool
+}
+
+// Reallocate implements experimental.LinearMemory, growing the memory to size bytes. Memory cannot be grown beyond the
+// limit. The initial allocation is not refused, as the runtime requires it to succeed, but is recorded when it exceeds
+// the limit.
+func (m *limitedMemory) Reallocate(size uint64) []byte {
+	if size > m.limit.max {
+		m.limit.exceeded.Store(true)
+		if m.allocated {
+			return nil
+		}
+	}
+	m.allocated = true
+
+	// Double the capacity to amortize growth, without reserving memory beyond the limit
+	if size > uint64(cap(m.buf)) {
+		buf := make([]byte, size, max(size, min(2*uint64(cap(m.buf)), m.limit.max)))
+		copy(buf, m.buf)
+		m.buf = buf
+	}
+	m.buf = m.buf[:size]
+	return m.buf
+}
+
+// Free implements experimental.LinearMemory, releasing the memory buffer.
+func (m *limitedMemory) Free() {
+	m.buf = nil
+}
@@ -1,9 +1,16 @@
 package wasm
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	wapc "github.com/wapc/wapc-go"
 )
 
 func TestWASMServerCreation(t *testing.T) {
@@ -145,3 +152,457 @@ func TestWASMExecution(t *testing.T) {
 		return
 	}
 }
+
+// loopModule is a waPC guest whose __guest_call export never returns.
+var loopModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// Type: (i32, i32) -> i32
+	0x01, 0x07, 0x01, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f,
+	// Function
+	0x03, 0x02, 0x01, 0x00,
+	// Export: __guest_call
+	0x07, 0x10, 0x01, 0x0c, '_', '_', 'g', 'u', 'e', 's', 't', '_', 'c', 'a', 'l', 'l', 0x00, 0x00,
+	// Code: loop br 0 end; i32.const 0
+	0x0a, 0x0b, 0x01, 0x09, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x41, 0x00, 0x0b,
+}
+
+// hostCallModule is a waPC guest whose __guest_call export performs a single host call and returns its result.
+var hostCallModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// Types: (i32, i32) -> i32 and (i32 x8) -> i32
+	0x01, 0x13, 0x02,
+	0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f,
+	0x60, 0x08, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0x7f, 0x01, 0x7f,
+	// Import: wapc.__host_call
+	0x02, 0x14, 0x01, 0x04, 'w', 'a', 'p', 'c',
+	0x0b, '_', '_', 'h', 'o', 's', 't', '_', 'c', 'a', 'l', 'l', 0x00, 0x01,
+	// Function
+	0x03, 0x02, 0x01, 0x00,
+	// Memory: 1 page
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	// Exports: __guest_call and memory
+	0x07, 0x19, 0x02,
+	0x0c, '_', '_', 'g', 'u', 'e', 's', 't', '_', 'c', 'a', 'l', 'l', 0x00, 0x01,
+	0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+	// Code: call __host_call(0, 0, 0, 0, 0, 0, 0, 0)
+	0x0a, 0x16, 0x01, 0x14, 0x00,
+	0x41, 0x00, 0x41, 0x00, 0x41, 0x00, 0x41, 0x00, 0x41, 0x00, 0x41, 0x00, 0x41, 0x00, 0x41, 0x00,
+	0x10, 0x00, 0x0b,
+}
+
+// growModule is a waPC guest whose __guest_call export grows memory by one page, trapping when memory cannot grow.
+var growModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// Type: (i32, i32) -> i32
+	0x01, 0x07, 0x01, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f,
+	// Function
+	0x03, 0x02, 0x01, 0x00,
+	// Memory: 1 page
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	// Exports: __guest_call and memory
+	0x07, 0x19, 0x02,
+	0x0c, '_', '_', 'g', 'u', 'e', 's', 't', '_', 'c', 'a', 'l', 'l', 0x00, 0x00,
+	0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+	// Code: if memory.grow(1) == -1 unreachable; return 1
+	0x0a, 0x11, 0x01, 0x0f, 0x00,
+	0x41, 0x01, 0x40, 0x00, 0x41, 0x7f, 0x46, 0x04, 0x40, 0x00, 0x0b,
+	0x41, 0x01, 0x0b,
+}
+
+// trapModule is a waPC guest whose __guest_call export traps without growing memory.
+var trapModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// Type: (i32, i32) -> i32
+	0x01, 0x07, 0x01, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f,
+	// Function
+	0x03, 0x02, 0x01, 0x00,
+	// Memory: 1 page
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	// Exports: __guest_call and memory
+	0x07, 0x19, 0x02,
+	0x0c, '_', '_', 'g', 'u', 'e', 's', 't', '_', 'c', 'a', 'l', 'l', 0x00, 0x00,
+	0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+	// Code: unreachable
+	0x0a, 0x05, 0x01, 0x03, 0x00, 0x00, 0x0b,
+}
+
+func TestWASMExecutionContext(t *testing.T) {
+	deadlineCh := make(chan bool, 1)
+	moduleCh := make(chan string, 1)
+	ctxCh := make(chan context.Context, 1)
+	s, err := NewServer(Config{
+		Callback: func(ctx context.Context, _, _, _ string, _ []byte) ([]byte, error) {
+			_, ok := ctx.Deadline()
+			deadlineCh <- ok
+			moduleCh <- ModuleName(ctx)
+			ctxCh <- ctx
+			return []byte(""), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create WASM Server - %s", err)
+	}
+	defer s.Shutdown()
+
+	dir := t.TempDir()
+	for name, b := range map[string][]byte{"loop": loopModule, "hostcall": hostCallModule} {
+		err := os.WriteFile(filepath.Join(dir, name+".wasm"), b, 0600)
+		if err != nil {
+			t.Fatalf("Unable to write module - %s", err)
+		}
+
+		err = s.LoadModule(ModuleConfig{Name: name, Filepath: filepath.Join(dir, name+".wasm"), PoolSize: 1})
+		if err != nil {
+			t.Fatalf("Failed to load module - %s", err)
+		}
+	}
+
+	t.Run("Deadline Exceeded", func(t *testing.T) {
+		m, err := s.Module("loop")
+		if err != nil {
+			t.Fatalf("Cannot find module - %s", err)
+		}
+
+		// Execute twice to validate the stopped instance is replaced within the pool
+		for i := 0; i < 2; i++ {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			_, err = m.RunWithContext(ctx, "handler", []byte(""))
+			cancel()
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("Expected deadline exceeded error on execution %d, got %v", i, err)
+			}
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		m, err := s.Module("loop")
+		if err != nil {
+			t.Fatalf("Cannot find module - %s", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-time.After(50 * time.Millisecond)
+			cancel()
+		}()
+
+		_, err = m.RunWithContext(ctx, "handler", []byte(""))
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected canceled error, got %v", err)
+		}
+	})
+
+	t.Run("Context Passed to Callback", func(t *testing.T) {
+		m, err := s.Module("hostcall")
+		if err != nil {
+			t.Fatalf("Cannot find module - %s", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err = m.RunWithContext(ctx, "handler", []byte(""))
+		if err != nil {
+			t.Fatalf("Unexpected error executing module - %s", err)
+		}
+
+		if !<-deadlineCh {
+			t.Errorf("Callback context did not include execution deadline")
+		}
+
+		if name := <-moduleCh; name != "hostcall" {
+			t.Errorf("Unexpected module name within callback context - %q", name)
+		}
+
+		if cbCtx := <-ctxCh; cbCtx.Err() == nil {
+			t.Errorf("Expected callback context to be canceled once the execution ended")
+		}
+		if ctx.Err() != nil {
+			t.Errorf("Unexpected cancellation of the execution context - %s", ctx.Err())
+		}
+	})
+}
+
+func TestWASMModuleReload(t *testing.T) {
+	s, err := NewServer(Config{
+		Callback: func(context.Context, string, string, string, []byte) ([]byte, error) { return []byte(""), nil },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create WASM Server - %s", err)
+	}
+	defer s.Shutdown()
+
+	dir := t.TempDir()
+	for name, b := range map[string][]byte{"loop": loopModule, "hostcall": hostCallModule} {
+		err := os.WriteFile(filepath.Join(dir, name+".wasm"), b, 0600)
+		if err != nil {
+			t.Fatalf("Unable to write module - %s", err)
+		}
+	}
+
+	loop := ModuleConfig{Name: "loop", Filepath: filepath.Join(dir, "loop.wasm"), PoolSize: 1}
+	hostcall := ModuleConfig{Name: "hostcall", Filepath: filepath.Join(dir, "hostcall.wasm"), PoolSize: 1}
+	err = s.LoadModules(loop, hostcall)
+	if err != nil {
+		t.Fatalf("Failed to load modules - %s", err)
+	}
+
+	t.Run("Failed Load Keeps Existing Modules", func(t *testing.T) {
+		before, err := s.Module("hostcall")
+		if err != nil {
+			t.Fatalf("Cannot find module - %s", err)
+		}
+
+		err = s.LoadModules(hostcall, ModuleConfig{Name: "missing", Filepath: filepath.Join(dir, "missing.wasm")})
+		if err == nil {
+			t.Fatalf("Unexpected success loading missing module")
+		}
+
+		after, err := s.Module("hostcall")
+		if err != nil {
+			t.Fatalf("Cannot find module - %s", err)
+		}
+		if before != after {
+			t.Errorf("Module replaced despite failed load")
+		}
+	})
+
+	t.Run("Replace Drains In-Flight Executions", func(t *testing.T) {
+		old, err := s.Module("loop")
+		if err != nil {
+			t.Fatalf("Cannot find module - %s", err)
+		}
+
+		errCh := make(chan error, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			_, err := old.RunWithContext(ctx, "handler", []byte(""))
+			errCh <- err
+		}()
+		<-time.After(100 * time.Millisecond)
+
+		err = s.LoadModule(loop)
+		if err != nil {
+			t.Fatalf("Failed to reload module - %s", err)
+		}
+
+		current, err := s.Module("loop")
+		if err != nil {
+			t.Fatalf("Cannot find module - %s", err)
+		}
+		if current == old {
+			t.Fatalf("Module was not replaced")
+		}
+
+		// The in-flight execution should complete on the replaced module
+		err = <-errCh
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected in-flight execution to reach its deadline, got %v", err)
+		}
+
+		// New executions of the replaced module should be rejected
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			_, err = old.RunWithContext(ctx, "handler", []byte(""))
+			cancel()
+			if errors.Is(err, ErrModuleClosed) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected replaced module to be closed, got %v", err)
+			}
+			<-time.After(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("Unload", func(t *testing.T) {
+		s.UnloadModule("hostcall")
+		_, err := s.Module("hostcall")
+		if err == nil {
+			t.Errorf("Unexpected success finding unloaded module")
+		}
+	})
+}
+
+func TestWASMMemoryLimit(t *testing.T) {
+	s, err := NewServer(Config{
+		Callback: func(context.Context, string, string, string, []byte) ([]byte, error) { return []byte(""), nil },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create WASM Server - %s", err)
+	}
+	defer s.Shutdown()
+
+	fp := filepath.Join(t.TempDir(), "grow.wasm")
+	err = os.WriteFile(fp, growModule, 0600)
+	if err != nil {
+		t.Fatalf("Unable to write module - %s", err)
+	}
+
+	t.Run("Invalid Limit", func(t *testing.T) {
+		err := s.LoadModule(ModuleConfig{Name: "invalid", Filepath: fp, MaxMemoryPages: MaxMemoryPages + 1})
+		if err == nil {
+			t.Errorf("Expected error loading module with invalid memory limit")
+		}
+	})
+
+	t.Run("Limit Reached", func(t *testing.T) {
+		err := s.LoadModule(ModuleConfig{Name: "grow", Filepath: fp, PoolSize: 1, MaxMemoryPages: 3})
+		if err != nil {
+			t.Fatalf("Failed to load module - %s", err)
+		}
+
+		m, err := s.Module("grow")
+		if err != nil {
+			t.Fatalf("Cannot find module - %s", err)
+		}
+
+		// Memory grows from 1 to 3 pages before the limit is reached
+		for i := 0; i < 2; i++ {
+			_, err := m.Run("handler", []byte(""))
+			if err != nil {
+				t.Fatalf("Unexpected error on execution %d - %s", i, err)
+			}
+		}
+
+		_, err = m.Run("handler", []byte(""))
+		if !errors.Is(err, ErrMemoryLimit) {
+			t.Fatalf("Expected memory limit error, got %v", err)
+		}
+
+		// The instance is replaced, resetting its memory
+		_, err = m.Run("handler", []byte(""))
+		if err != nil {
+			t.Errorf("Unexpected error executing replaced instance - %s", err)
+		}
+	})
+
+	t.Run("Failure at Limit", func(t *testing.T) {
+		trap := filepath.Join(t.TempDir(), "trap.wasm")
+		err := os.WriteFile(trap, trapModule, 0600)
+		if err != nil {
+			t.Fatalf("Unable to write module - %s", err)
+		}
+
+		// Instance memory is at the limit, but the failure is unrelated to memory
+		err = s.LoadModule(ModuleConfig{Name: "trap", Filepath: trap, PoolSize: 1, MaxMemoryPages: 1})
+		if err != nil {
+			t.Fatalf("Failed to load module - %s", err)
+		}
+
+		m, err := s.Module("trap")
+		if err != nil {
+			t.Fatalf("Cannot find module - %s", err)
+		}
+
+		_, err = m.Run("handler", []byte(""))
+		if err == nil || errors.Is(err, ErrMemoryLimit) {
+			t.Errorf("Expected failure unrelated to the memory limit, got %v", err)
+		}
+	})
+
+	t.Run("Initial Memory beyond Limit", func(t *testing.T) {
+		// Require 2 pages of memory on instantiation
+		guest := bytes.Replace(growModule, []byte{0x05, 0x03, 0x01, 0x00, 0x01}, []byte{0x05, 0x03, 0x01, 0x00, 0x02}, 1)
+		large := filepath.Join(t.TempDir(), "large.wasm")
+		err := os.WriteFile(large, guest, 0600)
+		if err != nil {
+			t.Fatalf("Unable to write module - %s", err)
+		}
+
+		err = s.LoadModule(ModuleConfig{Name: "large", Filepath: large, PoolSize: 1, MaxMemoryPages: 1})
+		if !errors.Is(err, ErrMemoryLimit) {
+			t.Errorf("Expected memory limit error loading module, got %v", err)
+		}
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		err := s.LoadModule(ModuleConfig{Name: "unlimited", Filepath: fp, PoolSize: 1})
+		if err != nil {
+			t.Fatalf("Failed to load module - %s", err)
+		}
+
+		m, err := s.Module("unlimited")
+		if err != nil {
+			t.Fatalf("Cannot find module - %s", err)
+		}
+
+		for i := 0; i < 4; i++ {
+			_, err := m.Run("handler", []byte(""))
+			if err != nil {
+				t.Fatalf("Unexpected error on execution %d - %s", i, err)
+			}
+		}
+	})
+}
+
+// failingModule is a module whose instantiation fails while fail is set.
+type failingModule struct {
+	wapc.Module
+
+	fail atomic.Bool
+}
+
+func (m *failingModule) Instantiate(ctx context.Context) (wapc.Instance, error) {
+	if m.fail.Load() {
+		return nil, errors.New("instantiation failed")
+	}
+	return m.Module.Instantiate(ctx)
+}
+
+func TestWASMPoolRefill(t *testing.T) {
+	s, err := NewServer(Config{
+		Callback: func(context.Context, string, string, string, []byte) ([]byte, error) { return []byte(""), nil },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create WASM Server - %s", err)
+	}
+	defer s.Shutdown()
+
+	fp := filepath.Join(t.TempDir(), "grow.wasm")
+	err = os.WriteFile(fp, growModule, 0600)
+	if err != nil {
+		t.Fatalf("Unable to write module - %s", err)
+	}
+
+	err = s.LoadModule(ModuleConfig{Name: "grow", Filepath: fp, PoolSize: 1, MaxMemoryPages: 1})
+	if err != nil {
+		t.Fatalf("Failed to load module - %s", err)
+	}
+
+	m, err := s.Module("grow")
+	if err != nil {
+		t.Fatalf("Cannot find module - %s", err)
+	}
+
+	failing := &failingModule{Module: m.module}
+	m.module = failing
+	failing.fail.Store(true)
+
+	// Reaching the memory limit replaces the only instance, which fails
+	_, err = m.Run("handler", []byte(""))
+	if !errors.Is(err, ErrMemoryLimit) {
+		t.Fatalf("Expected memory limit error, got %v", err)
+	}
+
+	t.Run("Empty Pool", func(t *testing.T) {
+		start := time.Now()
+		_, err := m.Run("handler", []byte(""))
+		if !errors.Is(err, ErrPoolEmpty) {
+			t.Errorf("Expected empty pool error, got %v", err)
+		}
+		if time.Since(start) >= DefaultPoolTimeout*time.Second {
+			t.Errorf("Execution waited on an empty pool")
+		}
+	})
+
+	t.Run("Refilled Pool", func(t *testing.T) {
+		failing.fail.Store(false)
+		_, err := m.Run("handler", []byte(""))
+		if errors.Is(err, ErrPoolEmpty) || !errors.Is(err, ErrMemoryLimit) {
+			t.Errorf("Expected execution of a refilled instance, got %v", err)
+		}
+	})
+}
@@ -23,6 +23,9 @@ type Status struct {
 type KVStoreGet struct {
 	// Key is the index key to use when accessing the key:value store.
 	Key string `json:"key"`
+
+	// DataSource is the name of the KV store to use. When empty, the default KV store of the function is used.
+	DataSource string `json:"data_source,omitempty"`
 }
 
 // KVStoreGetResponse is a structure supplied as response messages to KVStore Get requests. This response is a general
@@ -46,6 +49,12 @@ type KVStoreSet struct {
 	// expects this field to base base64 encoded, and neglecting to do so will result in an error returned from the callback
 	// function.
 	Data string `json:"data"`
+
+	// DataSource is the name of the KV store to use. When empty, the default KV store of the function is used.
+	DataSource string `json:"data_source,omitempty"`
+
+	// TTL is the number of seconds the key is stored before it expires. When zero, the key does not expire.
+	TTL int64 `json:"ttl,omitempty"`
 }
 
 // KVStoreSetResponse is a structure supplied as a response message to the KVStore Set callback function. This response
@@ -60,6 +69,9 @@ type KVStoreSetResponse struct {
 type KVStoreDelete struct {
 	// Key is the index key used to store the data.
 	Key string `json:"key"`
+
+	// DataSource is the name of the KV store to use. When empty, the default KV store of the function is used.
+	DataSource string `json:"data_source,omitempty"`
 }
 
 // KVStoreDeleteResponse is a structure supplied as a response message to the KVStore Delete callback function. This
@@ -69,16 +81,170 @@ type KVStoreDeleteResponse struct {
 	Status Status `json:"status"`
 }
 
+// KVStoreKeys is a structure used to create Keys callback requests to the Tarmac KVStore interface. Keys requests
+// without a payload list the keys of the default KV store of the function.
+type KVStoreKeys struct {
+	// DataSource is the name of the KV store to use. When empty, the default KV store of the function is used.
+	DataSource string `json:"data_source,omitempty"`
+
+	// Prefix limits the listed keys to those beginning with Prefix.
+	Prefix string `json:"prefix,omitempty"`
+
+	// Limit is the maximum number of keys returned per request. When zero, every matching key is returned.
+	Limit int `json:"limit,omitempty"`
+
+	// Cursor continues a listing from the Cursor returned by a previous request with the same Prefix.
+	Cursor string `json:"cursor,omitempty"`
+}
+
 // KVStoreKeysResponse is a structure supplied as a response message to the KVStore Keys callback function. This
 // response is a general response type used for all KVStore types provided by Tarmac.
 type KVStoreKeysResponse struct {
 	// Keys is a list of keys available within the KV Store.
 	Keys []string `json:"keys"`
 
+	// Cursor continues the listing when provided with the next request. Cursor is empty once every key is listed.
+	Cursor string `json:"cursor,omitempty"`
+
+	// Status is the human readible error message or success message for function execution.
+	Status Status `json:"status"`
+}
+
+// KVStoreCAS is a structure used to create CompareAndSwap callback requests to the Tarmac KVStore interface. The key is
+// updated only if it currently holds the expected value.
+type KVStoreCAS struct {
+	// Key is the index key of the data to swap.
+	Key string `json:"key"`
+
+	// Expected is the base64 encoded value the key must currently hold for the swap to happen.
+	Expected string `json:"expected"`
+
+	// Data is the base64 encoded value stored under the key when the swap happens.
+	Data string `json:"data"`
+
+	// DataSource is the name of the KV store to use. When empty, the default KV store of the function is used.
+	DataSource string `json:"data_source,omitempty"`
+}
+
+// KVStoreCASResponse is a structure supplied as a response message to the KVStore CompareAndSwap callback function.
+type KVStoreCASResponse struct {
+	// Swapped is true when the key held the expected value and was updated.
+	Swapped bool `json:"swapped"`
+
+	// Status is the human readible error message or success message for function execution.
+	Status Status `json:"status"`
+}
+
+// KVStoreIncr is a structure used to create Incr callback requests to the Tarmac KVStore interface. Incr requests add
+// a delta to the base 10 integer stored under the key, treating missing keys as zero.
+type KVStoreIncr struct {
+	// Key is the index key of the integer to increment.
+	Key string `json:"key"`
+
+	// Delta is the amount added to the integer, which may be negative.
+	Delta int64 `json:"delta"`
+
+	// DataSource is the name of the KV store to use. When empty, the default KV store of the function is used.
+	DataSource string `json:"data_source,omitempty"`
+}
+
+// KVStoreIncrResponse is a structure supplied as a response message to the KVStore Incr callback function.
+type KVStoreIncrResponse struct {
+	// Value is the integer stored under the key after the increment.
+	Value int64 `json:"value"`
+
+	// Status is the human readible error message or success message for function execution.
+	Status Status `json:"status"`
+}
+
+// KVStoreSetNX is a structure used to create SetNX callback requests to the Tarmac KVStore interface. The data is
+// stored only if the key does not exist.
+type KVStoreSetNX struct {
+	// Key is the index key used to store the data.
+	Key string `json:"key"`
+
+	// Data is the base64 encoded value to store.
+	Data string `json:"data"`
+
+	// DataSource is the name of the KV store to use. When empty, the default KV store of the function is used.
+	DataSource string `json:"data_source,omitempty"`
+
+	// TTL is the number of seconds the key is stored before it expires. When zero, the key does not expire.
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+// KVStoreSetNXResponse is a structure supplied as a response message to the KVStore SetNX callback function.
+type KVStoreSetNXResponse struct {
+	// Set is true when the key did not exist and the data was stored.
+	Set bool `json:"set"`
+
 	// Status is the human readible error message or success message for function execution.
 	Status Status `json:"status"`
 }
 
+// KVStoreEntry is a key and its base64 encoded data, used by KVStore MSet requests.
+type KVStoreEntry struct {
+	// Key is the index key of the data.
+	Key string `json:"key"`
+
+	// Data is the base64 encoded data stored under the key.
+	Data string `json:"data"`
+}
+
+// KVStoreResult is the per-key result of a KVStore batch request.
+type KVStoreResult struct {
+	// Key is the index key the result belongs to.
+	Key string `json:"key"`
+
+	// Data is the base64 encoded data fetched by MGet requests. Data is omitted when the key could not be fetched.
+	Data string `json:"data,omitempty"`
+
+	// Status is the human readible error message or success message for the operation on the key. Missing keys return
+	// a 404 status code.
+	Status Status `json:"status"`
+}
+
+// KVStoreMGet is a structure used to create MGet callback requests to the Tarmac KVStore interface, fetching multiple
+// keys with a single callback.
+type KVStoreMGet struct {
+	// Keys are the index keys of the data to fetch.
+	Keys []string `json:"keys"`
+
+	// DataSource is the name of the KV store to use. When empty, the default KV store of the function is used.
+	DataSource string `json:"data_source,omitempty"`
+}
+
+// KVStoreMSet is a structure used to create MSet callback requests to the Tarmac KVStore interface, storing multiple
+// keys with a single callback.
+type KVStoreMSet struct {
+	// Entries are the keys and base64 encoded data to store.
+	Entries []KVStoreEntry `json:"entries"`
+
+	// DataSource is the name of the KV store to use. When empty, the default KV store of the function is used.
+	DataSource string `json:"data_source,omitempty"`
+}
+
+// KVStoreMDelete is a structure used to create MDelete callback requests to the Tarmac KVStore interface, deleting
+// multiple keys with a single callback.
+type KVStoreMDelete struct {
+	// Keys are the index keys to delete.
+	Keys []string `json:"keys"`
+
+	// DataSource is the name of the KV store to use. When empty, the default KV store of the function is used.
+	DataSource string `json:"data_source,omitempty"`
+}
+
+// KVStoreBatchResponse is a structure supplied as a response message to the KVStore MGet, MSet, and MDelete callback
+// functions.
+type KVStoreBatchResponse struct {
+	// Results are the results of each key, in the order of the request.
+	Results []KVStoreResult `json:"results"`
+
+	// Status is the human readible error message or success message for function execution. A 200 status code is
+	// returned when the request was processed, even if the operations on some keys failed.
+	Status Status `json:"status"`
+}
+
 // MetricsCounter is a structure used to create Counter metrics callback requests to the Tarmac Metrics interface.
 type MetricsCounter struct {
 	// Name is the name of the metric as exposed via the metrics HTTP end-point. Name must be unique across
@@ -145,6 +311,30 @@ type HTTPClientResponse struct {
 type SQLQuery struct {
 	// Query is the SQL Query to be executed. This field should be base64 encoded to avoid conflicts with JSON encoding.
 	Query string `json:"query"`
+
+	// Params are the bind parameters for placeholders within the Query. Parameters are passed to the database driver
+	// separately from the query, rather than interpolated into the query itself.
+	Params []SQLParam `json:"params,omitempty"`
+
+	// Transaction is the handle of a transaction returned by the Begin callback. When set, the query is executed
+	// within the transaction.
+	Transaction string `json:"transaction,omitempty"`
+
+	// DataSource is the name of the SQL database to use. When empty, the default database of the function is used.
+	// DataSource is ignored when a Transaction is set, as the transaction's database is used.
+	DataSource string `json:"data_source,omitempty"`
+
+	// MaxRows limits the number of rows returned; when more rows remain, the response includes a Cursor. A value of
+	// zero returns all rows.
+	MaxRows int `json:"max_rows,omitempty"`
+
+	// Cursor is the cursor of a previous response. When set, the next rows of that result set are returned, and the
+	// Query, Params, Transaction, and DataSource fields are ignored.
+	Cursor string `json:"cursor,omitempty"`
+
+	// Format is the response format; valid options are json (the default), which returns a SQLQueryResponse, and
+	// proto, which returns a protobuf encoded SQLResultSet with typed values and column metadata.
+	Format string `json:"format,omitempty"`
 }
 
 // SQLQueryResponse is a structure supplied as a response message to a SQL Database Query.
@@ -154,4 +344,156 @@ type SQLQueryResponse struct {
 
 	// Data is a base64 encoded JSON represented the returned rows. Each row will contain a column name based map to access data.
 	Data string `json:"data"`
+
+	// Cursor is returned when rows remain after a query limited by MaxRows; it is supplied with a subsequent query
+	// to read the next rows.
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// SQLExec is a structure used to execute SQL statements that do not return rows on a SQL Database.
+type SQLExec struct {
+	// Query is the SQL statement to be executed. This field should be base64 encoded to avoid conflicts with JSON
+	// encoding.
+	Query string `json:"query"`
+
+	// Params are the bind parameters for placeholders within the Query. Parameters are passed to the database driver
+	// separately from the query, rather than interpolated into the query itself.
+	Params []SQLParam `json:"params,omitempty"`
+
+	// Transaction is the handle of a transaction returned by the Begin callback. When set, the query is executed
+	// within the transaction.
+	Transaction string `json:"transaction,omitempty"`
+
+	// DataSource is the name of the SQL database to use. When empty, the default database of the function is used.
+	// DataSource is ignored when a Transaction is set, as the transaction's database is used.
+	DataSource string `json:"data_source,omitempty"`
+}
+
+// SQLExecResponse is a structure supplied as a response message to a SQLExec request.
+type SQLExecResponse struct {
+	// Status is the human readible error message or success message for function execution.
+	Status Status `json:"status"`
+
+	// LastInsertID is the ID of the last inserted row, if the statement was an insert and the database supports it.
+	LastInsertID int64 `json:"last_insert_id"`
+
+	// RowsAffected is the number of rows affected by an insert, update, or delete statement.
+	RowsAffected int64 `json:"rows_affected"`
+}
+
+// SQLBegin is a structure used to begin a transaction on a SQL Database. Begin requests without a payload begin a
+// transaction on the default database of the function.
+type SQLBegin struct {
+	// DataSource is the name of the SQL database to use. When empty, the default database of the function is used.
+	DataSource string `json:"data_source,omitempty"`
+}
+
+// SQLBeginResponse is a structure supplied as a response message to a SQL Begin request.
+type SQLBeginResponse struct {
+	// Status is the human readible error message or success message for function execution.
+	Status Status `json:"status"`
+
+	// Transaction is the handle of the new transaction, used to execute queries within the transaction and to commit
+	// or roll it back.
+	Transaction string `json:"transaction"`
+}
+
+// SQLTransaction is a structure used to commit or roll back a transaction on a SQL Database.
+type SQLTransaction struct {
+	// Transaction is the handle of a transaction returned by the Begin callback.
+	Transaction string `json:"transaction"`
+}
+
+// SQLTransactionResponse is a structure supplied as a response message to SQL Commit and Rollback requests.
+type SQLTransactionResponse struct {
+	// Status is the human readible error message or success message for function execution.
+	Status Status `json:"status"`
+}
+
+// SQLParam is a typed bind parameter of a SQL query or statement. Parameters without a Name are positional and bound
+// in order; parameters with a Name are bound to named placeholders, where supported by the database driver.
+type SQLParam struct {
+	// Name is the placeholder name of a named parameter; positional parameters leave Name empty.
+	Name string `json:"name,omitempty"`
+
+	// Type is the type of the parameter value; valid options are string, int, float, bool, bytes, null, & timestamp.
+	Type string `json:"type"`
+
+	// Value is the string representation of the parameter value. Int and float values are decimal numbers, bool values
+	// are true or false, bytes values are base64 encoded, timestamp values are RFC 3339 formatted, and null parameters
+	// have no value.
+	Value string `json:"value,omitempty"`
+}
+
+// HTTPRequest is the request envelope passed to functions on HTTP routes configured with the json envelope. It
+// provides the function with the full context of the inbound HTTP request.
+type HTTPRequest struct {
+	// Method is the HTTP method of the inbound request.
+	Method string `json:"method"`
+
+	// Path is the escaped URL path of the inbound request.
+	Path string `json:"path"`
+
+	// Query is the raw, encoded query string of the inbound request without the leading "?".
+	Query string `json:"query"`
+
+	// Headers are the HTTP headers of the inbound request.
+	Headers map[string][]string `json:"headers"`
+
+	// RemoteAddr is the network address of the client that sent the request.
+	RemoteAddr string `json:"remote_addr"`
+
+	// TLS provides details of the TLS connection; this field is nil for plain-text HTTP requests.
+	TLS *HTTPRequestTLS `json:"tls,omitempty"`
+
+	// Body is the HTTP body of the inbound request. The body will be base64 encoded to provide a simple JSON-friendly
+	// field for arbitrary data.
+	Body string `json:"body"`
+
+	// Params are the named and catch-all parameters captured from the request path by the route.
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// HTTPRequestTLS provides details of the TLS connection an HTTPRequest was received on.
+type HTTPRequestTLS struct {
+	// Version is the negotiated TLS version (i.e. "TLS 1.3").
+	Version string `json:"version"`
+
+	// CipherSuite is the name of the negotiated cipher suite.
+	CipherSuite string `json:"cipher_suite"`
+
+	// ServerName is the server name requested by the client via SNI.
+	ServerName string `json:"server_name"`
+
+	// PeerCertificates are the certificates presented by the client, populated when using mutual-TLS.
+	PeerCertificates []HTTPRequestCertificate `json:"peer_certificates,omitempty"`
+}
+
+// HTTPRequestCertificate provides details of a certificate presented by the client.
+type HTTPRequestCertificate struct {
+	// Subject is the distinguished name of the certificate subject.
+	Subject string `json:"subject"`
+
+	// Issuer is the distinguished name of the certificate issuer.
+	Issuer string `json:"issuer"`
+
+	// SerialNumber is the serial number of the certificate.
+	SerialNumber string `json:"serial_number"`
+
+	// DNSNames are the DNS subject alternative names of the certificate.
+	DNSNames []string `json:"dns_names,omitempty"`
+}
+
+// HTTPResponse is the response envelope returned by functions on HTTP routes configured with the json envelope. It
+// allows the function to control the HTTP status code, headers, and body returned to the client.
+type HTTPResponse struct {
+	// Code is the HTTP status code to return to the client. When not set, a 200 is returned.
+	Code int `json:"code"`
+
+	// Headers are the HTTP headers to return to the client.
+	Headers map[string][]string `json:"headers"`
+
+	// Body is the HTTP body to return to the client. Tarmac expects this field to be base64 encoded, and neglecting to
+	// do so will result in an error returned to the client.
+	Body string `json:"body"`
 }